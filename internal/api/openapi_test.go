@@ -61,7 +61,7 @@ func TestOpenAPI_ImageEndpointsHaveCommonErrorResponses(t *testing.T) {
 	srv := newTestServer(t)
 	spec := srv.API().OpenAPI()
 
-	endpoints := []string{"/api/v1/compress", "/api/v1/convert"}
+	endpoints := []string{"/api/v1/compress", "/api/v1/convert", "/api/v1/info"}
 	codes := []string{"400", "413", "422", "429", "500"}
 
 	for _, path := range endpoints {
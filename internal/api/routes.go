@@ -36,11 +36,11 @@ func RegisterHealth(api huma.API) {
 }
 
 // RegisterRoutes はAPIルートを登録する。
-func RegisterRoutes(api huma.API, compressHandler *handler.CompressHandler, convertHandler *handler.ConvertHandler) {
+func RegisterRoutes(api huma.API, compressHandler *handler.CompressHandler, convertHandler *handler.ConvertHandler, infoHandler *handler.InfoHandler) {
 	compressOp := huma.Operation{
 		OperationID:  "compress-image",
 		Summary:      "画像を圧縮する",
-		Description:  "画像ファイルをアップロードして圧縮する。JPEG/PNG/WebP対応。\n\n圧縮の強さはqualityまたはlevelで指定できる。qualityは1-100の数値で直接指定、levelはlow/medium/highの3段階から選択。両方指定した場合はqualityが優先される。\n\nレスポンスヘッダーに圧縮結果のメタデータ（元サイズ、圧縮後サイズ、圧縮率）を付与する。",
+		Description:  "画像ファイルをアップロードして圧縮する。JPEG/PNG/WebP/TIFF/GIF対応。マルチページTIFFは全ページを保持する。アニメーションGIF/APNG/アニメーションWebPは全フレームの表示時間とループ回数を保持する。\n\n圧縮の強さはqualityまたはlevelで指定できる。qualityは1-100の数値で直接指定、levelはlow/medium/highの3段階から選択。両方指定した場合はqualityが優先される。\n\nレスポンスヘッダーに圧縮結果のメタデータ（元サイズ、圧縮後サイズ、圧縮率）を付与する。",
 		Method:       http.MethodPost,
 		Path:         "/api/v1/compress",
 		Tags:         []string{"Image"},
@@ -67,7 +67,7 @@ func RegisterRoutes(api huma.API, compressHandler *handler.CompressHandler, conv
 	convertOp := huma.Operation{
 		OperationID:  "convert-image",
 		Summary:      "画像フォーマットを変換する",
-		Description:  "画像ファイルをアップロードして指定フォーマットに変換する。JPEG/PNG/WebP間の相互変換に対応。\n\n出力品質はqualityまたはlevelで指定できる。qualityは1-100の数値で直接指定、levelはlow/medium/highの3段階から選択。両方指定した場合はqualityが優先される。\n\n同一フォーマットを指定した場合は圧縮処理にフォールバックする。\n\nレスポンスヘッダーに変換結果のメタデータ（元サイズ、変換後サイズ、元フォーマット、出力フォーマット）を付与する。",
+		Description:  "画像ファイルをアップロードして指定フォーマットに変換する。JPEG/PNG/WebP/TIFF/GIF間の相互変換に対応。HEIC/HEIF、BMP、SVGは入力のみ対応し、JPEG/PNG/WebP/TIFF/GIFへ変換できる。\n\nwidth/heightで出力サイズを指定できる（片方のみの場合は縦横比を維持）。SVGは指定サイズで直接ラスタライズし、サイズ未指定時はdpi（既定96）で描画する。外部リソースを参照するSVGは400エラーとなる。\n\nマルチページTIFFはpageで変換対象のページ（1始まり）を指定できる。未指定の場合は1ページ目を変換する。\n\nアニメーションGIF/APNG/アニメーションWebPをgif/png/webpへ変換する場合はフレームの表示時間とループ回数を保持する。poster=trueを指定するとpageで指定したフレーム（1始まり）だけを静止画として出力する。jpeg/tiffへの変換は常に1フレームのみ出力する。\n\n出力品質はqualityまたはlevelで指定できる。qualityは1-100の数値で直接指定、levelはlow/medium/highの3段階から選択。両方指定した場合はqualityが優先される。\n\n同一フォーマットを指定した場合は圧縮処理にフォールバックする。\n\nレスポンスヘッダーに変換結果のメタデータ（元サイズ、変換後サイズ、元フォーマット、出力フォーマット）を付与する。",
 		Method:       http.MethodPost,
 		Path:         "/api/v1/convert",
 		Tags:         []string{"Image"},
@@ -91,4 +91,16 @@ func RegisterRoutes(api huma.API, compressHandler *handler.CompressHandler, conv
 		},
 	}
 	huma.Register(api, convertOp, convertHandler.Handle)
+
+	infoOp := huma.Operation{
+		OperationID:  "inspect-image",
+		Summary:      "画像の情報を取得する",
+		Description:  "画像ファイルをアップロードして、実際のフォーマット、寸法、カラーモデル、ビット深度、アルファの有無、EXIFの向き、埋め込みICCプロファイル、プログレッシブ/インターレースの有無、推定JPEG品質、フレーム数（マルチページTIFFはページ数）を返す。\n\nフォーマットはContent-Typeではなくファイルの内容から判別する。画像はヘッダーのみを解析し、画素データはデコードしない。",
+		Method:       http.MethodPost,
+		Path:         "/api/v1/info",
+		Tags:         []string{"Image"},
+		MaxBodyBytes: 50 * 1024 * 1024, // 50MB
+		Errors:       commonErrorCodes(),
+	}
+	huma.Register(api, infoOp, infoHandler.Handle)
 }
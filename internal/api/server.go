@@ -27,12 +27,15 @@ const apiDescription = `画像の圧縮・フォーマット変換を提供す
 ## 機能
 
 - ` + "`POST /api/v1/compress`" + ` — 画像ファイルを圧縮する。
-- ` + "`POST /api/v1/convert`" + ` — 画像のフォーマットを変換する（JPEG / PNG / WebP 相互変換）。
+- ` + "`POST /api/v1/convert`" + ` — 画像のフォーマットを変換する（JPEG / PNG / WebP / TIFF / GIF 相互変換）。
 - ` + "`GET  /api/v1/health`" + ` — サーバー稼働状態を返す。
 
 ## 対応フォーマット
 
-JPEG (` + "`image/jpeg`" + `)、PNG (` + "`image/png`" + `)、WebP (` + "`image/webp`" + `)。
+JPEG (` + "`image/jpeg`" + `)、PNG (` + "`image/png`" + `)、WebP (` + "`image/webp`" + `)、TIFF (` + "`image/tiff`" + `)、GIF (` + "`image/gif`" + `)。
+アニメーション GIF / APNG (` + "`image/apng`" + ` も可) / アニメーション WebP はフレームの表示時間とループ回数を保持して相互変換する。
+HEIC/HEIF (` + "`image/heic`" + `, ` + "`image/heif`" + `)、BMP (` + "`image/bmp`" + `)、SVG (` + "`image/svg+xml`" + `) は変換エンドポイントの入力としてのみ受け付ける。
+SVG は指定サイズでラスタライズし、外部リソースを参照するものは拒否する。
 
 ## 認証
 
@@ -93,12 +96,15 @@ func NewServer(cfg Config) *Server {
 		processor.FormatJPEG: processor.NewJPEGProcessor(),
 		processor.FormatPNG:  processor.NewPNGProcessor(),
 		processor.FormatWEBP: processor.NewWEBPProcessor(),
+		processor.FormatTIFF: processor.NewTIFFProcessor(),
+		processor.FormatGIF:  processor.NewGIFProcessor(),
 	}
 	compressHandler := handler.NewCompressHandler(processors)
 	convertHandler := handler.NewConvertHandler(processors)
+	infoHandler := handler.NewInfoHandler()
 
 	RegisterHealth(api)
-	RegisterRoutes(api, compressHandler, convertHandler)
+	RegisterRoutes(api, compressHandler, convertHandler, infoHandler)
 
 	return &Server{
 		config:      cfg,
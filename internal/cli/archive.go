@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// archiveOutputPath returns the default output of an archive: its name with
+// "_compressed" before the archive extension, e.g. "photos_compressed.tar.gz".
+func archiveOutputPath(inputPath string) string {
+	lower := strings.ToLower(inputPath)
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip", ".tar"} {
+		if strings.HasSuffix(lower, ext) {
+			n := len(inputPath) - len(ext)
+			return inputPath[:n] + "_compressed" + inputPath[n:]
+		}
+	}
+	return inputPath + "_compressed"
+}
+
+// compressArchive compresses the images inside the ZIP or TAR archive at
+// inputPath on the batch workers and writes an archive of the same format,
+// reading and writing it entry by entry. Other entries, and images that
+// fail, are copied unchanged. Ignore files inside the archive are not read.
+func compressArchive(cmd *cobra.Command, inputPath string, format processor.ArchiveFormat, opts processor.CompressOptions) error {
+	if err := rejectFlags("compress", "ZIP/TAR アーカイブ", "incremental", "resume", "backup", "backup-dir", "output-template"); err != nil {
+		return err
+	}
+	outputPath, err := compressOutputPath(inputPath, archiveOutputPath(inputPath))
+	if err != nil {
+		return err
+	}
+	if outFormat, ok := processor.DetectArchiveFormat(outputPath); !ok || outFormat != format {
+		return fmt.Errorf("出力先には入力と同じ形式のアーカイブ (.%s) を指定してください: %s", format, outputPath)
+	}
+
+	writeOpts, err := compressWriteOptions("")
+	if err != nil {
+		return err
+	}
+	memOpts, err := memoryBudgetOptions("compress")
+	if err != nil {
+		return err
+	}
+	policyOpts, err := failurePolicyOptions("compress")
+	if err != nil {
+		return err
+	}
+	retryOpts, err := retryOptions("compress")
+	if err != nil {
+		return err
+	}
+	filter, err := scanFilter("compress")
+	if err != nil {
+		return err
+	}
+	report, err := loadReportConfig("compress")
+	if err != nil {
+		return err
+	}
+	maxEntrySize := viper.GetInt("compress.archive_max_entry_size")
+	if maxEntrySize < 0 {
+		return fmt.Errorf("--archive-max-entry-size は0以上で指定してください (指定値: %d)", maxEntrySize)
+	}
+
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("入力ファイルのオープンに失敗しました: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	archiveOpts := []processor.ArchiveOption{
+		processor.WithArchiveFilter(filter),
+		processor.WithArchiveMaxEntrySize(int64(maxEntrySize) << 20),
+	}
+
+	run := batchRun{
+		opts:   slices.Concat(writeOpts, memOpts, policyOpts, retryOpts),
+		dryRun: viper.GetBool("compress.dry_run"),
+		report: report,
+	}
+	run.report.dryRun = run.dryRun
+	if run.dryRun {
+		return directoryDryRun(cmd, run, "圧縮", func(bp *processor.DefaultBatchProcessor) ([]processor.BatchResult, error) {
+			return bp.CompressArchive(cmd.Context(), f, io.Discard, format, opts, archiveOpts...)
+		})
+	}
+
+	// The output is written atomically, so an existing file, including the
+	// input of --in-place, is only replaced once the archive is complete.
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+	w, err := processor.LocalStorage{}.Create(ctx, outputPath)
+	if err != nil {
+		return fmt.Errorf("出力ファイルの作成に失敗しました: %w", err)
+	}
+	var written atomic.Bool
+	process := func(bp *processor.DefaultBatchProcessor) ([]processor.BatchResult, error) {
+		results, err := bp.CompressArchive(ctx, f, w, format, opts, archiveOpts...)
+		if err != nil {
+			// Abandon the partial archive.
+			cancel()
+		}
+		if cerr := w.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("アーカイブの書き込みに失敗しました: %w", cerr)
+		}
+		written.Store(err == nil)
+		return results, err
+	}
+
+	var batchErr error
+	if useTUI {
+		batchErr = compressBatchWithTUI(cmd, run, 0, process)
+	} else {
+		batchErr = compressBatchWithText(cmd, run, "アーカイブ内の画像ファイルを処理します...", process)
+	}
+	// Failed images are kept unchanged, so the archive is written either way.
+	if written.Load() {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "アーカイブを書き出しました: %s\n", outputPath)
+	}
+	return batchErr
+}
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"fmt"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	compareDiff    string
+	compareMinSSIM float64
+	compareMinPSNR float64
+	compareScan    scanFlags
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <元画像> [<比較画像>]",
+	Short: "2つの画像の見た目の差分を計測する",
+	Long: `2つの画像を比較し、PSNR、SSIM、最大画素誤差を表示します。
+--diff を指定すると、画素ごとの差分を黒→青→緑→黄→赤で表したヒートマップをPNGで書き出します。
+色の範囲は最大画素誤差に合わせるため、小さな差分も確認できます。
+
+元画像にディレクトリを指定すると、サブディレクトリを含むすべての画像を比較画像の
+ディレクトリ (省略時は {dir}_compressed) の同じ相対パスの画像と比較します。
+このとき --diff は出力先ディレクトリで、ヒートマップを元のファイル名に .png を付けた名前
+(例: a.jpg → a.jpg.png) で書き出すため、拡張子だけが異なる画像のヒートマップも区別されます。
+色の差分は透明度を掛けた値で比較するため、完全に透明な画素の色は無視します。透明度の差分は
+最大アルファ誤差として表示し、ヒートマップにも含めます。
+
+--min-ssim または --min-psnr を指定すると、下回った画像を「閾値未満」として表示し、
+1件でもあればエラーで終了します。マルチページTIFFやアニメーションは最初のページ・フレームを比較します。`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runCompare,
+}
+
+func init() {
+	compareCmd.Flags().StringVar(&compareDiff, "diff", "", "差分のヒートマップの出力先 (ディレクトリ比較時はディレクトリ)")
+	compareCmd.Flags().Float64Var(&compareMinSSIM, "min-ssim", 0, "SSIMがこの値を下回る画像を閾値未満とする (0-1)。0は無効")
+	compareCmd.Flags().Float64Var(&compareMinPSNR, "min-psnr", 0, "PSNR (dB) がこの値を下回る画像を閾値未満とする。0は無効")
+	compareScan.register(compareCmd)
+}
+
+// bindCompareFlags binds compare command flags to Viper keys.
+// Called from initConfig() so bindings are re-established after viper.Reset().
+func bindCompareFlags() {
+	_ = viper.BindPFlag("compare.diff", compareCmd.Flags().Lookup("diff"))
+	_ = viper.BindPFlag("compare.min_ssim", compareCmd.Flags().Lookup("min-ssim"))
+	_ = viper.BindPFlag("compare.min_psnr", compareCmd.Flags().Lookup("min-psnr"))
+	bindScanFlags(compareCmd, "compare")
+}
+
+// compareThresholds are the minimum metrics an image must reach.
+type compareThresholds struct {
+	minSSIM float64
+	minPSNR float64
+}
+
+// below reports whether c falls below any of the thresholds.
+func (t compareThresholds) below(c *processor.Comparison) bool {
+	return (t.minSSIM > 0 && c.SSIM < t.minSSIM) || (t.minPSNR > 0 && c.PSNR < t.minPSNR)
+}
+
+func runCompare(cmd *cobra.Command, args []string) error {
+	th := compareThresholds{
+		minSSIM: viper.GetFloat64("compare.min_ssim"),
+		minPSNR: viper.GetFloat64("compare.min_psnr"),
+	}
+	if th.minSSIM < 0 || th.minSSIM > 1 {
+		return fmt.Errorf("--min-ssim は0〜1の範囲で指定してください (指定値: %g)", th.minSSIM)
+	}
+	if th.minPSNR < 0 {
+		return fmt.Errorf("--min-psnr は0以上で指定してください (指定値: %g)", th.minPSNR)
+	}
+
+	refPath := args[0]
+	info, err := os.Stat(refPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("入力パスが存在しません: %s", refPath)
+		}
+		return fmt.Errorf("入力パスの確認に失敗しました: %w", err)
+	}
+	if info.IsDir() {
+		outDir := defaultOutputDir(refPath, "_compressed")
+		if len(args) == 2 {
+			outDir = args[1]
+		}
+		return compareDirectory(cmd, refPath, outDir, th)
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("比較する画像を指定してください")
+	}
+	return compareFiles(cmd, refPath, args[1], th)
+}
+
+func compareFiles(cmd *cobra.Command, refPath, imgPath string, th compareThresholds) error {
+	c, err := compareImageFiles(refPath, imgPath)
+	if err != nil {
+		return fmt.Errorf("比較に失敗しました: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	_, _ = fmt.Fprintf(out, "%s ↔ %s (%dx%d)\n", refPath, imgPath, c.Width, c.Height)
+	_, _ = fmt.Fprintf(out, "  PSNR: %s\n", formatPSNR(c.PSNR))
+	_, _ = fmt.Fprintf(out, "  SSIM: %.4f\n", c.SSIM)
+	_, _ = fmt.Fprintf(out, "  最大誤差: %d\n", c.MaxError)
+	if c.MaxAlphaError > 0 {
+		_, _ = fmt.Fprintf(out, "  最大アルファ誤差: %d\n", c.MaxAlphaError)
+	}
+
+	if diff := viper.GetString("compare.diff"); diff != "" {
+		if err := writeHeatmap(diff, c); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(out, "  差分: %s\n", diff)
+	}
+	if th.below(c) {
+		return fmt.Errorf("閾値を下回りました: %s", imgPath)
+	}
+	return nil
+}
+
+func compareDirectory(cmd *cobra.Command, refDir, outDir string, th compareThresholds) error {
+	if info, err := os.Stat(outDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("比較するディレクトリが存在しません: %s", outDir)
+	}
+	filter, err := scanFilter("compare")
+	if err != nil {
+		return err
+	}
+	// An output directory inside the input one must not be compared with itself.
+	if rel, err := filepath.Rel(refDir, outDir); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		filter.Exclude = append(filter.Exclude, filepath.ToSlash(rel)+"/")
+	}
+	paths, err := processor.ScanImages(refDir, filter)
+	if err != nil {
+		return fmt.Errorf("ディレクトリのスキャンに失敗しました: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	diffDir := viper.GetString("compare.diff")
+	_, _ = fmt.Fprintf(out, "比較中: %s ↔ %s\n", refDir, outDir)
+
+	var compared, below, missing, failed int
+	for _, refPath := range paths {
+		rel, err := filepath.Rel(refDir, refPath)
+		if err != nil {
+			return err
+		}
+		imgPath := filepath.Join(outDir, rel)
+		if _, err := os.Stat(imgPath); err != nil {
+			_, _ = fmt.Fprintf(out, "  %s: 比較画像がありません\n", rel)
+			missing++
+			continue
+		}
+
+		c, err := compareImageFiles(refPath, imgPath)
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "  %s: エラー: %v\n", rel, err)
+			failed++
+			continue
+		}
+		compared++
+		line := fmt.Sprintf("  %s: PSNR %s, SSIM %.4f, 最大誤差 %d", rel, formatPSNR(c.PSNR), c.SSIM, c.MaxError)
+		if c.MaxAlphaError > 0 {
+			line += fmt.Sprintf(", 最大アルファ誤差 %d", c.MaxAlphaError)
+		}
+		if th.below(c) {
+			line += " [閾値未満]"
+			below++
+		}
+		_, _ = fmt.Fprintln(out, line)
+
+		if diffDir != "" {
+			diffPath := filepath.Join(diffDir, rel+".png")
+			if err := writeHeatmap(diffPath, c); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, _ = fmt.Fprintf(out, "完了: 比較 %d, 閾値未満 %d, 比較画像なし %d, 失敗 %d\n", compared, below, missing, failed)
+	switch {
+	case failed > 0:
+		return fmt.Errorf("%d 件の画像の比較に失敗しました", failed)
+	case below > 0:
+		return fmt.Errorf("%d 件の画像が閾値を下回りました", below)
+	}
+	return nil
+}
+
+// compareImageFiles compares the images at refPath and imgPath.
+func compareImageFiles(refPath, imgPath string) (*processor.Comparison, error) {
+	ref, err := os.Open(refPath)
+	if err != nil {
+		return nil, fmt.Errorf("入力ファイルを開けません: %w", err)
+	}
+	defer func() { _ = ref.Close() }()
+	img, err := os.Open(imgPath)
+	if err != nil {
+		return nil, fmt.Errorf("入力ファイルを開けません: %w", err)
+	}
+	defer func() { _ = img.Close() }()
+	return processor.Compare(ref, img)
+}
+
+// writeHeatmap writes the difference heatmap of c to path as a PNG.
+func writeHeatmap(path string, c *processor.Comparison) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("出力ディレクトリの作成に失敗しました: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("差分画像の作成に失敗しました: %w", err)
+	}
+	if err := png.Encode(f, c.Heatmap()); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("差分画像の書き込みに失敗しました: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("差分画像の書き込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// formatPSNR formats a PSNR in dB, which is infinite for identical images.
+func formatPSNR(psnr float64) string {
+	if math.IsInf(psnr, 1) {
+		return "∞ dB"
+	}
+	return fmt.Sprintf("%.2f dB", psnr)
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestE2E_比較_ファイル(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.png", createTestPNG(t, 32, 32))
+	writeTestFile(t, dir, "a.jpg", createTestJPEG(t, 32, 32, 90))
+	diffPath := filepath.Join(dir, "diff", "a.png")
+
+	out, err := executeCompress(t, "compare", filepath.Join(dir, "a.png"), filepath.Join(dir, "a.jpg"), "--diff", diffPath)
+	if err != nil {
+		t.Fatalf("compare error = %v\noutput:\n%s", err, out)
+	}
+	for _, want := range []string{"(32x32)", "PSNR: ", " dB", "SSIM: 0.", "最大誤差: ", "差分: " + diffPath} {
+		if !strings.Contains(out, want) {
+			t.Errorf("出力に %q がありません:\n%s", want, out)
+		}
+	}
+	verifyImageFile(t, diffPath, "png")
+}
+
+func TestE2E_比較_同一画像(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.png", createTestPNG(t, 16, 16))
+
+	out, err := executeCompress(t, "compare", filepath.Join(dir, "a.png"), filepath.Join(dir, "a.png"), "--min-ssim", "0.99")
+	if err != nil {
+		t.Fatalf("compare error = %v\noutput:\n%s", err, out)
+	}
+	if !strings.Contains(out, "PSNR: ∞ dB") || !strings.Contains(out, "最大誤差: 0") {
+		t.Errorf("同一画像の出力が不正です:\n%s", out)
+	}
+}
+
+func TestE2E_比較_閾値未満(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.png", createTestPNG(t, 32, 32))
+	writeTestFile(t, dir, "a.jpg", createTestJPEG(t, 32, 32, 10))
+
+	_, err := executeCompress(t, "compare", filepath.Join(dir, "a.png"), filepath.Join(dir, "a.jpg"), "--min-psnr", "60")
+	if err == nil || !strings.Contains(err.Error(), "閾値を下回りました") {
+		t.Errorf("error = %v, want threshold error", err)
+	}
+}
+
+func TestE2E_比較_ディレクトリ(t *testing.T) {
+	root := t.TempDir()
+	input := filepath.Join(root, "photos")
+	writeTestFile(t, input, "good.jpg", createTestJPEG(t, 32, 32, 95))
+	writeTestFile(t, input, "sub/bad.jpg", createTestJPEG(t, 32, 32, 95))
+	writeTestFile(t, input, "new.jpg", createTestJPEG(t, 32, 32, 95))
+	writeTestFile(t, input+"_compressed", "good.jpg", createTestJPEG(t, 32, 32, 90))
+	writeTestFile(t, input+"_compressed", "sub/bad.jpg", createTestJPEG(t, 32, 32, 5))
+	diffDir := filepath.Join(root, "diff")
+
+	out, err := executeCompress(t, "compare", input, "--min-ssim", "0.9", "--diff", diffDir)
+	if err == nil || !strings.Contains(err.Error(), "1 件の画像が閾値を下回りました") {
+		t.Errorf("error = %v, want one image below the threshold", err)
+	}
+	for _, want := range []string{
+		"good.jpg: PSNR ",
+		filepath.Join("sub", "bad.jpg") + ": PSNR ",
+		"new.jpg: 比較画像がありません",
+		"完了: 比較 2, 閾値未満 1, 比較画像なし 1, 失敗 0",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("出力に %q がありません:\n%s", want, out)
+		}
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, "good.jpg") && strings.Contains(line, "閾値未満") {
+			t.Errorf("good.jpg が閾値未満になっています: %s", line)
+		}
+	}
+	verifyImageFile(t, filepath.Join(diffDir, "good.jpg.png"), "png")
+	verifyImageFile(t, filepath.Join(diffDir, "sub", "bad.jpg.png"), "png")
+}
+
+func TestE2E_比較_エラー(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.png", createTestPNG(t, 10, 10))
+	writeTestFile(t, dir, "b.png", createTestPNG(t, 12, 10))
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "比較画像なし", args: []string{"compare", filepath.Join(dir, "a.png")}, wantErr: "比較する画像を指定してください"},
+		{name: "存在しないパス", args: []string{"compare", filepath.Join(dir, "missing.png"), filepath.Join(dir, "a.png")}, wantErr: "入力パスが存在しません"},
+		{name: "サイズ違い", args: []string{"compare", filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")}, wantErr: "比較に失敗しました"},
+		{name: "比較ディレクトリなし", args: []string{"compare", dir}, wantErr: "比較するディレクトリが存在しません"},
+		{name: "SSIM範囲外", args: []string{"compare", dir, dir, "--min-ssim", "1.5"}, wantErr: "--min-ssim は0〜1の範囲で指定してください"},
+		{name: "PSNR範囲外", args: []string{"compare", dir, dir, "--min-psnr", "-1"}, wantErr: "--min-psnr は0以上で指定してください"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executeCompress(t, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,11 +1,16 @@
 package cli
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/FrontWorksDev/Loki/internal/cli/tui"
 	"github.com/FrontWorksDev/Loki/pkg/processor"
@@ -15,25 +20,211 @@ import (
 )
 
 var (
-	quality   int
-	level     string
-	output    string
-	recursive bool
-	useTUI    bool
+	quality           int
+	level             string
+	output            string
+	recursive         bool
+	useTUI            bool
+	toSRGB            bool
+	dither            bool
+	resume            bool
+	incremental       bool
+	inPlace           bool
+	backup            bool
+	backupDir         string
+	neverGrow         bool
+	outTemplate       string
+	dryRun            bool
+	reportFmt         string
+	reportFile        string
+	memoryLimit       int
+	failFast          bool
+	maxFailures       string
+	retries           int
+	archiveEntryLimit int
 )
 
+const (
+	// journalFileName is the name of the batch journal written to the output directory.
+	journalFileName = ".img-cli-journal.jsonl"
+	// manifestFileName is the name of the incremental manifest written to the output directory.
+	manifestFileName = ".img-cli-manifest.json"
+)
+
+// batchRun holds the settings shared by the text and TUI modes of a directory run.
+type batchRun struct {
+	// opts are additional options for the batch processor.
+	opts []processor.BatchProcessorOption
+	// manifest is the incremental manifest, nil unless --incremental is set.
+	manifest     *processor.Manifest
+	manifestPath string
+	// dryRun discards the outputs and leaves the manifest untouched.
+	dryRun bool
+	// report is the machine-readable report written after the batch.
+	report reportConfig
+}
+
+// memoryBudgetOptions returns the batch options for --memory-limit (in MiB) under prefix.
+func memoryBudgetOptions(prefix string) ([]processor.BatchProcessorOption, error) {
+	limit := viper.GetInt(prefix + ".memory_limit")
+	if limit < 0 {
+		return nil, fmt.Errorf("--memory-limit は0以上で指定してください (指定値: %d)", limit)
+	}
+	if limit == 0 {
+		return nil, nil
+	}
+	return []processor.BatchProcessorOption{processor.WithMemoryBudget(int64(limit) << 20)}, nil
+}
+
+// failurePolicyOptions returns the batch options for --fail-fast and
+// --max-failures under prefix. --max-failures takes a count ("5") or a
+// percentage of the items ("10%").
+func failurePolicyOptions(prefix string) ([]processor.BatchProcessorOption, error) {
+	failFast := viper.GetBool(prefix + ".fail_fast")
+	limit := strings.TrimSpace(viper.GetString(prefix + ".max_failures"))
+	if failFast && limit != "" {
+		return nil, fmt.Errorf("--fail-fast と --max-failures は同時に指定できません")
+	}
+	if failFast {
+		return []processor.BatchProcessorOption{processor.WithFailFast()}, nil
+	}
+	if limit == "" {
+		return nil, nil
+	}
+	if pct, ok := strings.CutSuffix(limit, "%"); ok {
+		p, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("不正な --max-failures の値です: %q (割合は 0%% より大きく 100%% 以下で指定してください)", limit)
+		}
+		return []processor.BatchProcessorOption{processor.WithMaxFailurePercent(p)}, nil
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("不正な --max-failures の値です: %q (1以上の件数か 10%% のような割合を指定してください)", limit)
+	}
+	return []processor.BatchProcessorOption{processor.WithMaxFailures(n)}, nil
+}
+
+// retryOptions returns the batch options for --retries under prefix: the
+// number of extra attempts for items that fail with a transient I/O error.
+func retryOptions(prefix string) ([]processor.BatchProcessorOption, error) {
+	retries := viper.GetInt(prefix + ".retries")
+	if retries < 0 {
+		return nil, fmt.Errorf("--retries は0以上で指定してください (指定値: %d)", retries)
+	}
+	if retries == 0 {
+		return nil, nil
+	}
+	policy := processor.DefaultRetryPolicy()
+	policy.Attempts = retries + 1
+	return []processor.BatchProcessorOption{processor.WithRetry(policy)}, nil
+}
+
+// loadManifest loads the incremental manifest from dir when enabled.
+func loadManifest(enabled bool, dir string) (*processor.Manifest, string, error) {
+	if !enabled {
+		return nil, "", nil
+	}
+	path := filepath.Join(dir, manifestFileName)
+	m, err := processor.LoadManifest(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("マニフェストの読み込みに失敗しました: %w", err)
+	}
+	return m, path, nil
+}
+
+// saveManifest records the successfully processed items in the manifest and saves it.
+func (r batchRun) saveManifest(results []processor.BatchResult) error {
+	if r.manifest == nil || r.dryRun {
+		return nil
+	}
+	for _, res := range results {
+		if !res.IsSuccess() {
+			continue
+		}
+		pl, err := res.Item.Pipeline()
+		if err != nil {
+			return fmt.Errorf("マニフェストの更新に失敗しました: %w", err)
+		}
+		if err := r.manifest.Record(res.Item.InputPath, res.Item.OutputPath, res.InputHash, pl); err != nil {
+			return fmt.Errorf("マニフェストの更新に失敗しました: %w", err)
+		}
+	}
+	if err := r.manifest.Save(r.manifestPath); err != nil {
+		return fmt.Errorf("マニフェストの保存に失敗しました: %w", err)
+	}
+	return nil
+}
+
+// printUnchanged reports the items left out by the incremental scan.
+func (r batchRun) printUnchanged(cmd *cobra.Command) {
+	if r.manifest != nil && r.manifest.Skipped() > 0 {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "変更なし: %d 件をスキップしました\n", r.manifest.Skipped())
+	}
+}
+
 var compressCmd = &cobra.Command{
 	Use:   "compress <input-path>",
 	Short: "画像ファイルまたはディレクトリを圧縮する",
 	Long: `画像ファイルまたはディレクトリを圧縮します。
 
-対応フォーマット: JPEG (.jpg, .jpeg), PNG (.png), WebP (.webp)
+対応フォーマット: JPEG (.jpg, .jpeg), PNG (.png, .apng), WebP (.webp), TIFF (.tif, .tiff), GIF (.gif)
+マルチページTIFFは全ページを保持したまま圧縮します。
+アニメーションGIF/APNG/アニメーションWebPは全フレームとループ回数を保持します。
 
 例:
   img-cli compress photo.jpg
   img-cli compress photo.jpg -q 70
   img-cli compress photo.jpg -l high -o output.jpg
-  img-cli compress images/ -r -o images_compressed/`,
+  img-cli compress images/ -r -o images_compressed/
+  img-cli compress images/ -r --resume
+  img-cli compress images/ -r --incremental
+  img-cli compress assets/ -r --in-place --never-grow --backup
+  img-cli compress assets/ -r --include '**/*.png' --exclude 'node_modules/**' --gitignore
+  img-cli compress images/ -r --output-template '{dir}/{name}.{hash8}.{ext}'
+  img-cli compress assets/ -r --dry-run
+  img-cli compress assets/ -r --report junit --report-file reports/images.xml
+  img-cli compress s3://my-bucket/photos -r
+  img-cli compress photos.zip -o out.zip
+  cat photo.png | img-cli compress - -o - > photo_compressed.png
+
+ディレクトリ処理では完了したファイルを出力先の .img-cli-journal.jsonl に記録します。
+--in-place では入力ディレクトリを汚さないよう、ジャーナルとマニフェストを
+ユーザーキャッシュディレクトリ (Linux では ~/.cache/img-cli/) に保存します。
+中断後に --resume を付けて再実行すると、入力と圧縮オプションが変わっていない完了済みファイルをスキップします。
+--incremental を指定すると出力先の .img-cli-manifest.json に入力と圧縮オプションを記録し、
+次回以降は前回から変更のないファイルをスキップします。
+
+--in-place を指定すると元のファイルを置き換えます。同じディレクトリの一時ファイルに
+書き出して同期した後にリネームするため、途中で中断しても元のファイルは壊れません。
+パーミッションと更新日時は元のファイルのものを保持します。--backup で {name}.bak を、
+--backup-dir で指定ディレクトリにバックアップを保存します。--never-grow を指定すると
+圧縮後のほうが小さくならないファイルは元の内容のまま残します。
+
+ディレクトリ処理では --include/--exclude (globパターン、** は任意の階層に一致)、
+--max-depth、--skip-hidden、--symlinks で対象を絞り込めます。各ディレクトリの
+.lokiignore (--gitignore 指定時は .gitignore も) に一致するファイルは除外します。
+
+--output-template で出力パスを指定できます。ディレクトリ処理では出力先ディレクトリ
+からの相対パス、単一ファイルでは {dir} が入力ファイルのディレクトリになります。
+変数: {dir} {name} {ext} {format} {width} {height} {quality} {hash} {hash8}
+
+--dry-run を指定すると圧縮結果を破棄し、ファイルごとと合計の削減見込みを表示します。
+出力ファイル、ジャーナル、マニフェストは一切書き込みません。--tui とは同時に指定できません。
+
+--report json|csv|junit と --report-file を指定すると、ファイルごとの入出力パス、
+フォーマット、サイズ、削減率、処理時間、エラーと合計をCI向けの形式で書き出します。
+
+入力と --output に s3://bucket/prefix を指定すると、S3互換ストレージ上のオブジェクトを
+ディレクトリとして処理します。接続先と認証情報は AWS_* 環境変数から読み込みます。
+
+入力に ZIP/TAR アーカイブ (.zip/.tar/.tar.gz/.tgz) を指定すると、展開せずに中の画像を
+並列で圧縮し、画像以外のエントリと圧縮に失敗した画像はそのまま同じ形式のアーカイブに
+書き出します。
+
+入力に - を指定すると標準入力から読み込み、画像形式は内容から判別します。
+--output に - を指定するか標準入力で --output を省略すると、入力と同じ形式で
+標準出力に書き出します。このときメッセージは標準エラー出力にのみ表示します。`,
 	Args: cobra.ExactArgs(1),
 	RunE: runCompress,
 }
@@ -44,6 +235,24 @@ func init() {
 	compressCmd.Flags().StringVarP(&output, "output", "o", "", "出力パス (省略時は自動生成)")
 	compressCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "ディレクトリを再帰的に処理する")
 	compressCmd.Flags().BoolVar(&useTUI, "tui", false, "TUIモードでプログレスバーを表示する")
+	compressCmd.Flags().BoolVar(&toSRGB, "srgb", false, "埋め込みICCプロファイルを使ってsRGBに変換する")
+	compressCmd.Flags().BoolVar(&dither, "dither", false, "16bit画像をディザリングして8bitに減色する")
+	compressCmd.Flags().BoolVar(&resume, "resume", false, "ジャーナルを参照して前回完了したファイルをスキップする (ディレクトリ処理のみ)")
+	compressCmd.Flags().BoolVar(&incremental, "incremental", false, "マニフェストを参照して前回から変更のないファイルをスキップする (ディレクトリ処理のみ)")
+	compressCmd.Flags().BoolVar(&inPlace, "in-place", false, "元のファイルを圧縮結果で置き換える")
+	compressCmd.Flags().BoolVar(&backup, "backup", false, "--in-place で置き換える前に {name}.bak を保存する")
+	compressCmd.Flags().StringVar(&backupDir, "backup-dir", "", "--in-place で置き換える前に元のファイルを保存するディレクトリ")
+	compressCmd.Flags().BoolVar(&neverGrow, "never-grow", false, "圧縮後のほうが小さくならない場合は元のファイルを保持する")
+	compressCmd.Flags().StringVar(&outTemplate, "output-template", "", "出力パスのテンプレート (例: '{dir}/{name}.{hash8}.{ext}')")
+	compressCmd.Flags().BoolVar(&dryRun, "dry-run", false, "ファイルを書き込まずに削減見込みを表示する")
+	compressCmd.Flags().StringVar(&reportFmt, "report", "", "処理結果のレポート形式 (json/csv/junit)")
+	compressCmd.Flags().StringVar(&reportFile, "report-file", "", "レポートの出力先ファイル")
+	compressCmd.Flags().BoolVar(&failFast, "fail-fast", false, "最初の失敗で残りの処理を中止する (ディレクトリ処理のみ)")
+	compressCmd.Flags().StringVar(&maxFailures, "max-failures", "", "失敗が指定件数 (例: 5) または割合 (例: 10%) を超えたら残りの処理を中止する (ディレクトリ処理のみ)")
+	compressCmd.Flags().IntVar(&retries, "retries", 0, "一時的なI/Oエラーで失敗したファイルを再試行する回数 (ディレクトリ処理のみ)")
+	compressCmd.Flags().IntVar(&memoryLimit, "memory-limit", 0, "同時に処理する画像のデコード後の推定メモリ上限 (MiB)。0は無制限")
+	compressCmd.Flags().IntVar(&archiveEntryLimit, "archive-max-entry-size", 0, "ZIP/TAR アーカイブ内の画像1件あたりの展開後サイズ上限 (MiB)。0は既定値 (256 MiB)")
+	compressScan.register(compressCmd)
 }
 
 // bindCompressFlags binds compress command flags to Viper keys.
@@ -53,17 +262,43 @@ func bindCompressFlags() {
 	_ = viper.BindPFlag("compress.level", compressCmd.Flags().Lookup("level"))
 	_ = viper.BindPFlag("compress.output", compressCmd.Flags().Lookup("output"))
 	_ = viper.BindPFlag("compress.recursive", compressCmd.Flags().Lookup("recursive"))
+	_ = viper.BindPFlag("compress.srgb", compressCmd.Flags().Lookup("srgb"))
+	_ = viper.BindPFlag("compress.dither", compressCmd.Flags().Lookup("dither"))
+	_ = viper.BindPFlag("compress.resume", compressCmd.Flags().Lookup("resume"))
+	_ = viper.BindPFlag("compress.incremental", compressCmd.Flags().Lookup("incremental"))
+	_ = viper.BindPFlag("compress.in_place", compressCmd.Flags().Lookup("in-place"))
+	_ = viper.BindPFlag("compress.backup", compressCmd.Flags().Lookup("backup"))
+	_ = viper.BindPFlag("compress.backup_dir", compressCmd.Flags().Lookup("backup-dir"))
+	_ = viper.BindPFlag("compress.never_grow", compressCmd.Flags().Lookup("never-grow"))
+	_ = viper.BindPFlag("compress.output_template", compressCmd.Flags().Lookup("output-template"))
+	_ = viper.BindPFlag("compress.dry_run", compressCmd.Flags().Lookup("dry-run"))
+	_ = viper.BindPFlag("compress.report", compressCmd.Flags().Lookup("report"))
+	_ = viper.BindPFlag("compress.report_file", compressCmd.Flags().Lookup("report-file"))
+	_ = viper.BindPFlag("compress.memory_limit", compressCmd.Flags().Lookup("memory-limit"))
+	_ = viper.BindPFlag("compress.fail_fast", compressCmd.Flags().Lookup("fail-fast"))
+	_ = viper.BindPFlag("compress.max_failures", compressCmd.Flags().Lookup("max-failures"))
+	_ = viper.BindPFlag("compress.retries", compressCmd.Flags().Lookup("retries"))
+	_ = viper.BindPFlag("compress.archive_max_entry_size", compressCmd.Flags().Lookup("archive-max-entry-size"))
+	bindScanFlags(compressCmd, "compress")
 }
 
 func runCompress(cmd *cobra.Command, args []string) error {
 	inputPath := args[0]
 
-	info, err := os.Stat(inputPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("入力パスが存在しません: %s", inputPath)
+	// S3 URIs name a prefix of a bucket and are always processed as directories.
+	isDir := isS3URI(inputPath)
+	if !isDir && inputPath != stdioPath {
+		info, err := os.Stat(inputPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("入力パスが存在しません: %s", inputPath)
+			}
+			return fmt.Errorf("入力パスの確認に失敗しました: %w", err)
 		}
-		return fmt.Errorf("入力パスの確認に失敗しました: %w", err)
+		isDir = info.IsDir()
+	}
+	if err := rejectTUIDryRun(useTUI, viper.GetBool("compress.dry_run")); err != nil {
+		return err
 	}
 
 	q := viper.GetInt("compress.quality")
@@ -79,13 +314,25 @@ func runCompress(cmd *cobra.Command, args []string) error {
 	}
 
 	opts := processor.CompressOptions{
-		Quality: q,
-		Level:   compLevel,
+		Quality:       q,
+		Level:         compLevel,
+		ConvertToSRGB: viper.GetBool("compress.srgb"),
+		DitherTo8Bit:  viper.GetBool("compress.dither"),
+	}
+
+	if usesStdio(inputPath, viper.GetString("compress.output")) {
+		if isDir {
+			return fmt.Errorf("ディレクトリの処理結果は標準出力に書き出せません")
+		}
+		return compressStdio(cmd, inputPath, opts)
 	}
 
-	if info.IsDir() {
+	if isDir {
 		return compressDirectory(cmd, inputPath, opts)
 	}
+	if format, ok := processor.DetectArchiveFormat(inputPath); ok {
+		return compressArchive(cmd, inputPath, format, opts)
+	}
 	return compressSingleFile(cmd, inputPath, opts)
 }
 
@@ -94,119 +341,322 @@ func compressSingleFile(cmd *cobra.Command, inputPath string, opts processor.Com
 	if err != nil {
 		return err
 	}
-
-	outputPath := viper.GetString("compress.output")
-	if outputPath == "" {
-		outputPath = defaultOutputPath(inputPath)
+	if !format.CanEncode() {
+		return fmt.Errorf("%sフォーマットは圧縮出力に対応していません。convertコマンドで変換してください", format)
 	}
 
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
-		return fmt.Errorf("出力ディレクトリの作成に失敗しました: %w", err)
+	tmpl, err := outputTemplate("compress")
+	if err != nil {
+		return err
 	}
-
-	inFile, err := os.Open(inputPath)
+	outputPath, err := compressOutputPath(inputPath, defaultOutputPath(inputPath))
+	if err != nil {
+		return err
+	}
+	if tmpl != nil {
+		if viper.GetString("compress.output") != "" {
+			return fmt.Errorf("--output-template と --output は同時に指定できません")
+		}
+		if outputPath, err = tmpl.Expand("", inputPath, format, opts); err != nil {
+			return fmt.Errorf("出力パスの生成に失敗しました: %w", err)
+		}
+	}
+	writeOpts, err := compressWriteOptions(filepath.Dir(inputPath))
 	if err != nil {
-		return fmt.Errorf("入力ファイルを開けません: %w", err)
+		return err
 	}
-	defer func() { _ = inFile.Close() }()
 
-	outFile, err := os.Create(outputPath)
+	report, err := loadReportConfig("compress")
 	if err != nil {
-		return fmt.Errorf("出力ファイルの作成に失敗しました: %w", err)
+		return err
 	}
-
-	var proc processor.Processor
-	switch format {
-	case processor.FormatJPEG:
-		proc = processor.NewJPEGProcessor()
-	case processor.FormatPNG:
-		proc = processor.NewPNGProcessor()
-	case processor.FormatWEBP:
-		proc = processor.NewWEBPProcessor()
+	dry := viper.GetBool("compress.dry_run")
+	if dry {
+		writeOpts = append(writeOpts, processor.WithOutputSink(processor.DiscardSink))
+		report.dryRun = true
 	}
 
-	result, err := proc.Compress(cmd.Context(), inFile, outFile, opts)
+	start := time.Now()
+	bp := processor.NewDefaultBatchProcessor(append(writeOpts, processor.WithMaxWorkers(1))...)
+	results, err := bp.ProcessBatch(cmd.Context(), []processor.BatchItem{
+		{InputPath: inputPath, OutputPath: outputPath, Options: opts},
+	})
 	if err != nil {
-		_ = outFile.Close()
-		_ = os.Remove(outputPath)
 		return fmt.Errorf("圧縮に失敗しました: %w", err)
 	}
-
-	if err := outFile.Close(); err != nil {
-		_ = os.Remove(outputPath)
-		return fmt.Errorf("出力ファイルの書き込みに失敗しました: %w", err)
+	if err := report.writeReport(results, time.Since(start)); err != nil {
+		return err
+	}
+	res := results[0]
+	if res.Error != nil {
+		return fmt.Errorf("圧縮に失敗しました: %w", res.Error)
 	}
+	result := res.Result
 
 	out := cmd.OutOrStdout()
+	if dry {
+		_, _ = fmt.Fprintln(out, dryRunHeader)
+		printDryRun(out, results)
+		return nil
+	}
 	_, _ = fmt.Fprintf(out, "圧縮完了: %s → %s\n", inputPath, outputPath)
 	_, _ = fmt.Fprintf(out, "  元サイズ: %d bytes\n", result.OriginalSize)
 	_, _ = fmt.Fprintf(out, "  圧縮後: %d bytes\n", result.CompressedSize)
 	_, _ = fmt.Fprintf(out, "  削減率: %.1f%%\n", result.SavedPercentage())
+	if res.KeptOriginal {
+		_, _ = fmt.Fprintln(out, "  圧縮しても小さくならないため元のファイルを保持しました")
+	}
 
 	return nil
 }
 
+// compressOutputPath returns the output path for inputPath: the input itself
+// with --in-place, the --output flag if set, and fallback otherwise.
+func compressOutputPath(inputPath, fallback string) (string, error) {
+	outputPath := viper.GetString("compress.output")
+	if viper.GetBool("compress.in_place") {
+		if outputPath != "" {
+			return "", fmt.Errorf("--in-place と --output は同時に指定できません")
+		}
+		if viper.GetString("compress.output_template") != "" {
+			return "", fmt.Errorf("--in-place と --output-template は同時に指定できません")
+		}
+		return inputPath, nil
+	}
+	if outputPath == "" {
+		return fallback, nil
+	}
+	return outputPath, nil
+}
+
+// compressWriteOptions returns the batch options for --backup, --backup-dir and --never-grow.
+// root is the directory whose structure is mirrored under the backup directory.
+func compressWriteOptions(root string) ([]processor.BatchProcessorOption, error) {
+	var opts []processor.BatchProcessorOption
+	backupDir := viper.GetString("compress.backup_dir")
+	backup := viper.GetBool("compress.backup")
+	if (backup || backupDir != "") && !viper.GetBool("compress.in_place") {
+		return nil, fmt.Errorf("--backup と --backup-dir は --in-place と併用してください")
+	}
+	if backup {
+		opts = append(opts, processor.WithBackupSuffix(".bak"))
+	}
+	if backupDir != "" {
+		opts = append(opts, processor.WithBackupDir(root, backupDir))
+	}
+	if viper.GetBool("compress.never_grow") {
+		opts = append(opts, processor.WithNeverGrow())
+	}
+	return opts, nil
+}
+
+// compressStateDir returns the directory holding the journal and manifest of a
+// directory run. It is the output directory, except for --in-place runs, whose
+// state is kept under the user cache directory so that the source tree is
+// left clean.
+func compressStateDir(inputDir, outputDir string) (string, error) {
+	if !viper.GetBool("compress.in_place") {
+		return outputDir, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("キャッシュディレクトリを取得できません: %w", err)
+	}
+	abs, err := filepath.Abs(inputDir)
+	if err != nil {
+		return "", fmt.Errorf("入力パスの解決に失敗しました: %w", err)
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(cacheDir, "img-cli", hex.EncodeToString(sum[:8])), nil
+}
+
 func compressDirectory(cmd *cobra.Command, inputDir string, opts processor.CompressOptions) error {
 	r := viper.GetBool("compress.recursive")
 	if !r {
 		return fmt.Errorf("ディレクトリを処理するには --recursive (-r) フラグが必要です")
 	}
 
-	outputDir := viper.GetString("compress.output")
-	if outputDir == "" {
-		outputDir = filepath.Clean(inputDir) + "_compressed"
+	outputDir, err := compressOutputPath(inputDir, defaultOutputDir(inputDir, "_compressed"))
+	if err != nil {
+		return err
+	}
+	store, inputDir, outputDir, err := batchStorage(inputDir, outputDir)
+	if err != nil {
+		return err
+	}
+	_, local := store.(processor.LocalStorage)
+	if !local {
+		if err := rejectFlags("compress", "S3 のパス", "incremental", "resume", "backup", "backup-dir"); err != nil {
+			return err
+		}
+	}
+	writeOpts, err := compressWriteOptions(inputDir)
+	if err != nil {
+		return err
+	}
+	memOpts, err := memoryBudgetOptions("compress")
+	if err != nil {
+		return err
+	}
+	policyOpts, err := failurePolicyOptions("compress")
+	if err != nil {
+		return err
+	}
+	retryOpts, err := retryOptions("compress")
+	if err != nil {
+		return err
+	}
+
+	filter, err := scanFilter("compress")
+	if err != nil {
+		return err
+	}
+	report, err := loadReportConfig("compress")
+	if err != nil {
+		return err
+	}
+	scanOpts := []processor.ScanDirectoryOption{
+		processor.WithCompressOptions(opts),
+		processor.WithFilter(filter),
+		processor.WithScanStorage(store),
+		processor.WithScanContext(cmd.Context()),
+	}
+	tmpl, err := outputTemplate("compress")
+	if err != nil {
+		return err
+	}
+	if tmpl != nil {
+		scanOpts = append(scanOpts, processor.WithOutputTemplate(tmpl))
+	}
+	stateDir, err := compressStateDir(inputDir, outputDir)
+	if err != nil {
+		return err
+	}
+	manifest, manifestPath, err := loadManifest(viper.GetBool("compress.incremental"), stateDir)
+	if err != nil {
+		return err
 	}
 
-	items, err := processor.ScanDirectory(inputDir, outputDir, processor.WithCompressOptions(opts))
+	scanOpts = append(scanOpts, processor.WithManifest(manifest))
+
+	items, err := startScan(processor.ScanDirectorySeq(inputDir, outputDir, scanOpts...))
 	if err != nil {
-		return fmt.Errorf("ディレクトリのスキャンに失敗しました: %w", err)
+		return err
+	}
+	defer items.close()
+
+	run := batchRun{
+		opts:         slices.Concat(writeOpts, memOpts, policyOpts, retryOpts, []processor.BatchProcessorOption{processor.WithStorage(store)}),
+		manifest:     manifest,
+		manifestPath: manifestPath,
+		dryRun:       viper.GetBool("compress.dry_run"),
+		report:       report,
+	}
+	run.report.dryRun = run.dryRun
+	run.report.manifest = manifest
+	if manifest != nil {
+		run.opts = append(run.opts, processor.WithInputHashes())
+	}
+	if run.dryRun {
+		run.opts = append(run.opts, processor.WithOutputSink(processor.DiscardSink))
+	} else if local {
+		// The journal is a local file, so runs on S3 cannot be resumed.
+		run.opts = append(run.opts, processor.WithJournal(filepath.Join(stateDir, journalFileName)))
+		if viper.GetBool("compress.resume") {
+			run.opts = append(run.opts, processor.WithResume())
+		}
 	}
 
 	out := cmd.OutOrStdout()
 
-	if len(items) == 0 {
+	if items == nil {
+		if err := run.report.writeReport(nil, 0); err != nil {
+			return err
+		}
+		if manifest != nil && manifest.Skipped() > 0 {
+			_, _ = fmt.Fprintf(out, "前回から変更された画像ファイルはありません (変更なし %d 件)\n", manifest.Skipped())
+			return nil
+		}
 		_, _ = fmt.Fprintln(out, "対象の画像ファイルが見つかりませんでした")
 		return nil
 	}
 
+	process := items.process(cmd.Context())
+	if run.dryRun {
+		return directoryDryRun(cmd, run, "圧縮", process)
+	}
 	if useTUI {
-		return compressDirectoryWithTUI(cmd, items)
+		return compressBatchWithTUI(cmd, run, 0, process)
 	}
-	return compressDirectoryWithText(cmd, items)
+	return compressBatchWithText(cmd, run, "画像ファイルを処理します...", process)
 }
 
-func compressDirectoryWithText(cmd *cobra.Command, items []processor.BatchItem) error {
+// compressBatchWithText prints header, runs process on a batch processor
+// printing each finished image, and prints a summary of the results.
+func compressBatchWithText(cmd *cobra.Command, run batchRun, header string, process func(*processor.DefaultBatchProcessor) ([]processor.BatchResult, error)) error {
 	out := cmd.OutOrStdout()
 	errOut := cmd.ErrOrStderr()
 
-	_, _ = fmt.Fprintf(out, "%d 個の画像ファイルを処理します...\n", len(items))
+	_, _ = fmt.Fprintln(out, header)
 
 	var mu sync.Mutex
-	bp := processor.NewDefaultBatchProcessor(
+	var last processor.Progress
+	bp := processor.NewDefaultBatchProcessor(append(run.opts,
 		processor.WithProgressCallback(func(p processor.Progress) {
 			mu.Lock()
 			defer mu.Unlock()
-			_, _ = fmt.Fprintf(out, "  [%d/%d] %s\n", p.Completed+p.Failed, p.Total, p.Current)
+			last = p
+			_, _ = fmt.Fprintf(out, "  %s %s (%s)\n", tui.Count(p), p.Current, tui.Throughput(p))
 		}),
-	)
+	)...)
 
-	results, err := bp.ProcessBatch(cmd.Context(), items)
+	start := time.Now()
+	results, err := process(bp)
 	if err != nil {
 		return fmt.Errorf("バッチ処理に失敗しました: %w", err)
 	}
+	if err := run.saveManifest(results); err != nil {
+		return err
+	}
+	if err := run.report.writeReport(results, time.Since(start)); err != nil {
+		return err
+	}
 
 	successCount := 0
 	failCount := 0
+	skipCount := 0
+	keptCount := 0
+	abortCount := 0
 	for _, res := range results {
 		if res.IsSuccess() {
 			successCount++
+			if res.Skipped {
+				skipCount++
+			}
+			if res.KeptOriginal {
+				keptCount++
+			}
+		} else if res.Aborted {
+			abortCount++
 		} else {
 			failCount++
 			_, _ = fmt.Fprintf(errOut, "  エラー: %s: %v\n", res.Item.InputPath, res.Error)
 		}
 	}
 
-	_, _ = fmt.Fprintf(out, "完了: 成功 %d, 失敗 %d\n", successCount, failCount)
+	if skipCount > 0 {
+		_, _ = fmt.Fprintf(out, "完了: 成功 %d (スキップ %d), 失敗 %d\n", successCount, skipCount, failCount)
+	} else {
+		_, _ = fmt.Fprintf(out, "完了: 成功 %d, 失敗 %d\n", successCount, failCount)
+	}
+	if keptCount > 0 {
+		_, _ = fmt.Fprintf(out, "  圧縮しても小さくならないため元のファイルを保持: %d 件\n", keptCount)
+	}
+	if abortCount > 0 {
+		_, _ = fmt.Fprintln(out, tui.AbortedMessage(abortCount))
+	}
+	printStats(out, last, results)
+	run.printUnchanged(cmd)
 
 	if failCount > 0 {
 		return fmt.Errorf("%d 件の画像の圧縮に失敗しました", failCount)
@@ -215,20 +665,29 @@ func compressDirectoryWithText(cmd *cobra.Command, items []processor.BatchItem)
 	return nil
 }
 
-func compressDirectoryWithTUI(cmd *cobra.Command, items []processor.BatchItem) error {
+// compressBatchWithTUI runs process on a batch processor of total images,
+// 0 if unknown, showing its progress in the TUI.
+func compressBatchWithTUI(cmd *cobra.Command, run batchRun, total int, process func(*processor.DefaultBatchProcessor) ([]processor.BatchResult, error)) error {
 	m := tui.NewModel()
 	p := tea.NewProgram(m)
 
 	go func() {
-		p.Send(tui.BatchStartMsg{TotalFiles: len(items)})
+		p.Send(tui.BatchStartMsg{TotalFiles: total})
 
-		bp := processor.NewDefaultBatchProcessor(
+		bp := processor.NewDefaultBatchProcessor(append(run.opts,
 			processor.WithProgressCallback(func(prog processor.Progress) {
 				p.Send(tui.ProgressMsg{Progress: prog})
 			}),
-		)
+		)...)
 
-		results, err := bp.ProcessBatch(cmd.Context(), items)
+		start := time.Now()
+		results, err := process(bp)
+		if err == nil {
+			err = run.saveManifest(results)
+		}
+		if err == nil {
+			err = run.report.writeReport(results, time.Since(start))
+		}
 		if err != nil {
 			p.Send(tui.BatchErrorMsg{Err: err})
 			return
@@ -248,6 +707,7 @@ func compressDirectoryWithTUI(cmd *cobra.Command, items []processor.BatchItem) e
 	if fm.Err() != nil {
 		return fmt.Errorf("バッチ処理に失敗しました: %w", fm.Err())
 	}
+	run.printUnchanged(cmd)
 
 	if fm.Failed() > 0 {
 		return fmt.Errorf("%d 件の画像の圧縮に失敗しました", fm.Failed())
@@ -276,10 +736,20 @@ func detectFormat(path string) (processor.ImageFormat, error) {
 	switch ext {
 	case ".jpg", ".jpeg":
 		return processor.FormatJPEG, nil
-	case ".png":
+	case ".png", ".apng":
 		return processor.FormatPNG, nil
 	case ".webp":
 		return processor.FormatWEBP, nil
+	case ".heic", ".heif":
+		return processor.FormatHEIC, nil
+	case ".tif", ".tiff":
+		return processor.FormatTIFF, nil
+	case ".bmp":
+		return processor.FormatBMP, nil
+	case ".svg":
+		return processor.FormatSVG, nil
+	case ".gif":
+		return processor.FormatGIF, nil
 	default:
 		return 0, fmt.Errorf("サポートされていない画像形式です: %s", ext)
 	}
@@ -1,16 +1,26 @@
 package cli
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
 	"image"
 
 	// Register decoders for verification.
 	_ "image/jpeg"
-	_ "image/png"
+	"image/png"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/FrontWorksDev/Loki/internal/s3fake"
+	"github.com/FrontWorksDev/Loki/pkg/processor"
 )
 
 // --- Helper Functions ---
@@ -271,200 +281,1138 @@ func TestE2E_ディレクトリ圧縮_出力パス自動生成(t *testing.T) {
 	}
 }
 
-func TestE2E_空ディレクトリ圧縮(t *testing.T) {
+func TestE2E_ディレクトリ圧縮_レジューム(t *testing.T) {
 	inputDir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "output")
 
-	out, err := executeCompress(t, "compress", inputDir, "-r")
+	setupTestDir(t, inputDir, map[string][]byte{
+		"a.jpg": createTestJPEG(t, 30, 30, 80),
+		"b.png": createTestPNG(t, 30, 30),
+	})
+
+	if _, err := executeCompress(t, "compress", inputDir, "-r", "-o", outputDir); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	entries, err := processor.ReadJournal(filepath.Join(outputDir, journalFileName))
 	if err != nil {
-		t.Fatalf("空ディレクトリでエラーが返されました: %v", err)
+		t.Fatalf("ジャーナルの読み込みに失敗しました: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ジャーナルのエントリ数 = %d, want 2", len(entries))
 	}
 
-	if !strings.Contains(out, "対象の画像ファイルが見つかりませんでした") {
-		t.Errorf("出力に期待メッセージが含まれていません: %s", out)
+	// Simulate an interrupted run: one output is missing.
+	if err := os.Remove(filepath.Join(outputDir, "b.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := executeCompress(t, "compress", inputDir, "-r", "-o", outputDir, "--resume")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
 	}
+	if !strings.Contains(out, "成功 2 (スキップ 1)") {
+		t.Errorf("出力に「成功 2 (スキップ 1)」が含まれていません: %s", out)
+	}
+	verifyImageFile(t, filepath.Join(outputDir, "b.png"), "png")
 }
 
-// --- Step 5: Flag Combination Tests (Table-Driven) ---
+func TestE2E_ディレクトリ圧縮_インクリメンタル(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "output")
+
+	setupTestDir(t, inputDir, map[string][]byte{
+		"a.jpg": createTestJPEG(t, 30, 30, 80),
+		"b.png": createTestPNG(t, 30, 30),
+	})
+
+	if _, err := executeCompress(t, "compress", inputDir, "-r", "-o", outputDir, "--incremental"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, manifestFileName)); err != nil {
+		t.Fatalf("マニフェストが作成されていません: %v", err)
+	}
+
+	out, err := executeCompress(t, "compress", inputDir, "-r", "-o", outputDir, "--incremental")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !strings.Contains(out, "変更なし 2 件") {
+		t.Errorf("出力に「変更なし 2 件」が含まれていません: %s", out)
+	}
+
+	writeTestFile(t, inputDir, "a.jpg", createTestJPEG(t, 40, 40, 80))
+	out, err = executeCompress(t, "compress", inputDir, "-r", "-o", outputDir, "--incremental")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	for _, want := range []string{"画像ファイルを処理します", "成功 1", "変更なし: 1 件をスキップしました"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("出力に %q が含まれていません: %s", want, out)
+		}
+	}
+
+	// Changing the compression options processes everything again.
+	out, err = executeCompress(t, "compress", inputDir, "-r", "-o", outputDir, "--incremental", "-l", "high")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !strings.Contains(out, "成功 2") {
+		t.Errorf("出力に「成功 2」が含まれていません: %s", out)
+	}
+}
+
+func TestE2E_インプレース圧縮(t *testing.T) {
+	inputDir := t.TempDir()
+	original := createTestJPEG(t, 60, 60, 100)
+	setupTestDir(t, inputDir, map[string][]byte{
+		"photo.jpg":     original,
+		"sub/small.jpg": createTestJPEG(t, 30, 30, 20),
+	})
+	backupDir := filepath.Join(t.TempDir(), "backup")
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	t.Setenv("HOME", cacheDir)
+	t.Setenv("LocalAppData", cacheDir)
+
+	out, err := executeCompress(t, "compress", inputDir, "-r", "--in-place", "-q", "60", "--never-grow", "--backup-dir", backupDir, "--incremental")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(inputDir, "photo.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= int64(len(original)) {
+		t.Errorf("置き換え後のサイズ %d が元のサイズ %d 以上です", info.Size(), len(original))
+	}
+	verifyImageFile(t, filepath.Join(inputDir, "photo.jpg"), "jpeg")
+	if _, err := os.Stat(filepath.Join(backupDir, "photo.jpg")); err != nil {
+		t.Errorf("バックアップが保存されていません: %v", err)
+	}
+	if _, err := os.Stat(inputDir + "_compressed"); !os.IsNotExist(err) {
+		t.Error("--in-place で _compressed ディレクトリが作成されています")
+	}
+	if !strings.Contains(out, "元のファイルを保持: 1 件") {
+		t.Errorf("出力に「元のファイルを保持: 1 件」が含まれていません: %s", out)
+	}
+
+	// ジャーナルとマニフェストは入力ディレクトリではなくキャッシュディレクトリに保存される
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{journalFileName, manifestFileName} {
+		if _, err := os.Stat(filepath.Join(inputDir, name)); !os.IsNotExist(err) {
+			t.Errorf("入力ディレクトリに %s が作成されています", name)
+		}
+		if matches, _ := filepath.Glob(filepath.Join(userCacheDir, "img-cli", "*", name)); len(matches) != 1 {
+			t.Errorf("キャッシュディレクトリに %s がありません", name)
+		}
+	}
+}
+
+func TestE2E_インプレース圧縮_単一ファイル(t *testing.T) {
+	inputDir := t.TempDir()
+	original := createTestJPEG(t, 60, 60, 100)
+	setupTestDir(t, inputDir, map[string][]byte{"photo.jpg": original})
+	inputPath := filepath.Join(inputDir, "photo.jpg")
+
+	if _, err := executeCompress(t, "compress", inputPath, "--in-place", "--backup"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	backup, err := os.ReadFile(inputPath + ".bak")
+	if err != nil {
+		t.Fatalf("バックアップが保存されていません: %v", err)
+	}
+	if !bytes.Equal(backup, original) {
+		t.Error("バックアップの内容が元のファイルと異なります")
+	}
+	verifyImageFile(t, inputPath, "jpeg")
+	if _, err := os.Stat(filepath.Join(inputDir, "photo_compressed.jpg")); !os.IsNotExist(err) {
+		t.Error("--in-place で _compressed ファイルが作成されています")
+	}
+}
+
+func TestE2E_インプレース圧縮_不正なフラグ組み合わせ(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{"photo.jpg": createTestJPEG(t, 30, 30, 80)})
+	inputPath := filepath.Join(inputDir, "photo.jpg")
 
-func TestE2E_フラグ組み合わせ(t *testing.T) {
 	tests := []struct {
-		name string
-		args []string
+		name      string
+		args      []string
+		wantInErr string
 	}{
-		{name: "quality_50", args: []string{"--quality", "50"}},
-		{name: "level_low", args: []string{"--level", "low"}},
-		{name: "level_high", args: []string{"--level", "high"}},
-		{name: "quality優先_quality70_level_high", args: []string{"--quality", "70", "--level", "high"}},
-		{name: "quality境界値_1", args: []string{"--quality", "1"}},
-		{name: "quality境界値_100", args: []string{"--quality", "100"}},
+		{
+			name:      "in-placeとoutput",
+			args:      []string{"compress", inputPath, "--in-place", "-o", filepath.Join(inputDir, "x.jpg")},
+			wantInErr: "同時に指定できません",
+		},
+		{
+			name:      "in-placeなしのbackup",
+			args:      []string{"compress", inputPath, "--backup"},
+			wantInErr: "--in-place と併用してください",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tmpDir := t.TempDir()
-			inputPath := filepath.Join(tmpDir, "test.jpg")
-			outputPath := filepath.Join(tmpDir, "out.jpg")
-
-			jpegData := createTestJPEG(t, 80, 80, 95)
-			if err := os.WriteFile(inputPath, jpegData, 0o644); err != nil {
-				t.Fatal(err)
-			}
-
-			args := append([]string{"compress", inputPath, "-o", outputPath}, tt.args...)
-			_, err := executeCompress(t, args...)
-			if err != nil {
-				t.Fatalf("Execute() error = %v", err)
+			_, err := executeCompress(t, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantInErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantInErr)
 			}
-
-			verifyImageFile(t, outputPath, "jpeg")
 		})
 	}
 }
 
-func TestE2E_フラグ組み合わせ_ディレクトリ(t *testing.T) {
+func TestE2E_ディレクトリ圧縮_スキャンフィルタ(t *testing.T) {
+	inputDir := t.TempDir()
+	jpeg := createTestJPEG(t, 20, 20, 80)
+	setupTestDir(t, inputDir, map[string][]byte{
+		"a.jpg":                  jpeg,
+		"icons/b.png":            createTestPNG(t, 20, 20),
+		"icons/deep/c.png":       createTestPNG(t, 20, 20),
+		"node_modules/pkg/d.png": createTestPNG(t, 20, 20),
+		"vendor/e.jpg":           jpeg,
+		"generated/f.jpg":        jpeg,
+		".lokiignore":            []byte("generated/\n"),
+		".gitignore":             []byte("vendor/\n"),
+	})
+
 	tests := []struct {
 		name string
 		args []string
+		want []string
 	}{
-		{name: "recursive_quality_60", args: []string{"-r", "--quality", "60"}},
-		{name: "recursive_level_low", args: []string{"-r", "--level", "low"}},
-		{name: "recursive_level_high", args: []string{"-r", "--level", "high"}},
+		{
+			name: "フィルタなし",
+			want: []string{"a.jpg", "icons/b.png", "icons/deep/c.png", "node_modules/pkg/d.png", "vendor/e.jpg"},
+		},
+		{
+			name: "includeとexclude",
+			args: []string{"--include", "**/*.png", "--exclude", "node_modules/**"},
+			want: []string{"icons/b.png", "icons/deep/c.png"},
+		},
+		{
+			name: "max-depthとgitignore",
+			args: []string{"--max-depth", "2", "--gitignore"},
+			want: []string{"a.jpg", "icons/b.png"},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			inputDir := t.TempDir()
 			outputDir := filepath.Join(t.TempDir(), "output")
+			args := append([]string{"compress", inputDir, "-r", "-o", outputDir}, tt.args...)
+			if _, err := executeCompress(t, args...); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
 
-			setupTestDir(t, inputDir, map[string][]byte{
-				"a.jpg": createTestJPEG(t, 50, 50, 90),
-				"b.png": createTestPNG(t, 50, 50),
+			var got []string
+			err := filepath.WalkDir(outputDir, func(path string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+					return err
+				}
+				rel, _ := filepath.Rel(outputDir, path)
+				got = append(got, filepath.ToSlash(rel))
+				return nil
 			})
-
-			args := append([]string{"compress", inputDir, "-o", outputDir}, tt.args...)
-			_, err := executeCompress(t, args...)
 			if err != nil {
-				t.Fatalf("Execute() error = %v", err)
+				t.Fatal(err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("出力ファイル = %v, want %v", got, tt.want)
 			}
-
-			verifyImageFile(t, filepath.Join(outputDir, "a.jpg"), "jpeg")
-			verifyImageFile(t, filepath.Join(outputDir, "b.png"), "png")
 		})
 	}
 }
 
-// --- Step 6: Error Handling Tests (Table-Driven) ---
+func TestE2E_ディレクトリ圧縮_不正なスキャンフィルタ(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{"a.jpg": createTestJPEG(t, 20, 20, 80)})
 
-func TestE2E_エラーハンドリング(t *testing.T) {
-	// Prepare a valid JPEG for tests that need a real file.
-	tmpDir := t.TempDir()
-	validJPEG := filepath.Join(tmpDir, "valid.jpg")
-	if err := os.WriteFile(validJPEG, createTestJPEG(t, 10, 10, 80), 0o644); err != nil {
-		t.Fatal(err)
-	}
-	bmpFile := filepath.Join(tmpDir, "test.bmp")
-	if err := os.WriteFile(bmpFile, []byte("not a bmp"), 0o644); err != nil {
-		t.Fatal(err)
-	}
-	corruptJPEG := filepath.Join(tmpDir, "corrupt.jpg")
-	if err := os.WriteFile(corruptJPEG, []byte("this is not a jpeg"), 0o644); err != nil {
-		t.Fatal(err)
+	tests := []struct {
+		name      string
+		args      []string
+		wantInErr string
+	}{
+		{name: "symlinks", args: []string{"--symlinks", "always"}, wantInErr: "不正なシンボリックリンクの扱いです"},
+		{name: "max-depth", args: []string{"--max-depth", "-1"}, wantInErr: "--max-depth は0以上"},
+		{name: "include", args: []string{"--include", "[a-"}, wantInErr: "invalid pattern"},
 	}
-	emptyDir := filepath.Join(tmpDir, "emptydir")
-	if err := os.Mkdir(emptyDir, 0o755); err != nil {
-		t.Fatal(err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"compress", inputDir, "-r", "-o", t.TempDir()}, tt.args...)
+			_, err := executeCompress(t, args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantInErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantInErr)
+			}
+		})
 	}
+}
+
+func TestE2E_出力テンプレート(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{
+		"a.jpg":     createTestJPEG(t, 30, 20, 90),
+		"sub/b.png": createTestPNG(t, 30, 20),
+	})
+
+	t.Run("ディレクトリ", func(t *testing.T) {
+		outputDir := filepath.Join(t.TempDir(), "output")
+		if _, err := executeCompress(t, "compress", inputDir, "-r", "-o", outputDir,
+			"--output-template", "{dir}/{name}.{width}x{height}.q{quality}.{ext}"); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		verifyImageFile(t, filepath.Join(outputDir, "a.30x20.q75.jpg"), "jpeg")
+		verifyImageFile(t, filepath.Join(outputDir, "sub", "b.30x20.q75.png"), "png")
+	})
+
+	t.Run("単一ファイル", func(t *testing.T) {
+		out, err := executeCompress(t, "compress", filepath.Join(inputDir, "a.jpg"), "--output-template", "{dir}/min/{name}.{ext}")
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		outPath := filepath.Join(inputDir, "min", "a.jpg")
+		verifyImageFile(t, outPath, "jpeg")
+		if !strings.Contains(out, outPath) {
+			t.Errorf("出力に %s が含まれていません: %s", outPath, out)
+		}
+	})
+}
+
+func TestE2E_出力テンプレート_エラー(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{
+		"a.jpg":     createTestJPEG(t, 20, 20, 80),
+		"sub/a.jpg": createTestJPEG(t, 20, 20, 80),
+	})
 
 	tests := []struct {
 		name      string
 		args      []string
-		wantInErr string // substring expected in error message (empty = just check error is non-nil)
+		wantInErr string
 	}{
 		{
-			name: "引数なし",
-			args: []string{"compress"},
-		},
-		{
-			name: "引数過多",
-			args: []string{"compress", "file1.jpg", "file2.jpg"},
-		},
-		{
-			name: "存在しないファイル",
-			args: []string{"compress", "/nonexistent/path/file.jpg"},
-		},
-		{
-			name: "存在しないディレクトリ",
-			args: []string{"compress", "/nonexistent/dir/", "-r"},
-		},
-		{
-			name: "recursiveなしのディレクトリ",
-			args: []string{"compress", emptyDir},
-		},
-		{
-			name:      "不正なlevel値",
-			args:      []string{"compress", validJPEG, "--level", "ultra"},
-			wantInErr: "不正な圧縮レベル",
-		},
-		{
-			name:      "quality範囲外_0未満",
-			args:      []string{"compress", validJPEG, "--quality", "-1"},
-			wantInErr: "品質は1〜100の範囲",
+			name:      "未知の変数",
+			args:      []string{"compress", inputDir, "-r", "--output-template", "{size}.{ext}"},
+			wantInErr: "不正な出力テンプレートです",
 		},
 		{
-			name:      "quality範囲外_101",
-			args:      []string{"compress", validJPEG, "--quality", "101"},
-			wantInErr: "品質は1〜100の範囲",
+			name:      "出力先の重複",
+			args:      []string{"compress", inputDir, "-r", "-o", t.TempDir(), "--output-template", "{name}.{ext}"},
+			wantInErr: "maps both",
 		},
 		{
-			name:      "非対応フォーマットbmp",
-			args:      []string{"compress", bmpFile},
-			wantInErr: "サポートされていない画像形式",
+			name:      "in-placeとの併用",
+			args:      []string{"compress", inputDir, "-r", "--in-place", "--output-template", "{dir}/{name}.{ext}"},
+			wantInErr: "同時に指定できません",
 		},
 		{
-			name:      "破損画像ファイル",
-			args:      []string{"compress", corruptJPEG},
-			wantInErr: "圧縮に失敗",
+			name:      "outputとの併用",
+			args:      []string{"compress", filepath.Join(inputDir, "a.jpg"), "-o", filepath.Join(inputDir, "x.jpg"), "--output-template", "{name}.{ext}"},
+			wantInErr: "同時に指定できません",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			_, err := executeCompress(t, tt.args...)
-			if err == nil {
-				t.Fatal("エラーが返されるべきですが、nilでした")
-			}
-			if tt.wantInErr != "" && !strings.Contains(err.Error(), tt.wantInErr) {
-				t.Errorf("エラーメッセージに %q が含まれていません: %v", tt.wantInErr, err)
+			if err == nil || !strings.Contains(err.Error(), tt.wantInErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantInErr)
 			}
 		})
 	}
 }
 
-func TestE2E_ディレクトリ圧縮_一部失敗(t *testing.T) {
+func TestE2E_ドライラン(t *testing.T) {
 	inputDir := t.TempDir()
-	outputDir := filepath.Join(t.TempDir(), "output")
-
+	original := createTestJPEG(t, 60, 60, 100)
 	setupTestDir(t, inputDir, map[string][]byte{
-		"good.jpg":    createTestJPEG(t, 50, 50, 90),
-		"corrupt.jpg": []byte("this is not a valid jpeg"),
+		"photo.jpg":    original,
+		"sub/icon.png": createTestPNG(t, 30, 30),
 	})
 
-	out, err := executeCompress(t, "compress", inputDir, "-r", "-o", outputDir)
-
-	// Should return error because some files failed.
-	if err == nil {
-		t.Fatal("一部失敗時にエラーが返されるべきです")
-	}
-
-	// Verify the output reports success and failure counts.
-	if !strings.Contains(out, "成功 1") {
-		t.Errorf("出力に「成功 1」が含まれていません: %s", out)
-	}
-	if !strings.Contains(out, "失敗 1") {
-		t.Errorf("出力に「失敗 1」が含まれていません: %s", out)
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "ディレクトリ", args: []string{"compress", inputDir, "-r", "--dry-run"}},
+		{name: "インプレース", args: []string{"compress", inputDir, "-r", "--in-place", "--backup", "--incremental", "--dry-run"}},
+		{name: "単一ファイル", args: []string{"compress", filepath.Join(inputDir, "photo.jpg"), "--dry-run"}},
 	}
 
-	// The valid file should still be compressed.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := executeCompress(t, tt.args...)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			for _, want := range []string{"ドライラン", filepath.Join(inputDir, "photo.jpg") + ":", "合計:", "削減見込み"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("出力に %q が含まれていません: %s", want, out)
+				}
+			}
+
+			// Nothing may be written next to or inside the input directory.
+			for _, path := range []string{inputDir + "_compressed", filepath.Join(inputDir, "photo_compressed.jpg"), filepath.Join(inputDir, "photo.jpg.bak")} {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("ドライランで %s が作成されています", path)
+				}
+			}
+			entries, err := os.ReadDir(inputDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 {
+				t.Errorf("入力ディレクトリのエントリ数 = %d, want 2", len(entries))
+			}
+			data, err := os.ReadFile(filepath.Join(inputDir, "photo.jpg"))
+			if err != nil || !bytes.Equal(data, original) {
+				t.Error("ドライランで元のファイルが変更されています")
+			}
+		})
+	}
+}
+
+func TestE2E_レポート出力(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{
+		"photo.jpg":    createTestJPEG(t, 60, 60, 100),
+		"sub/icon.png": createTestPNG(t, 30, 30),
+		"broken.jpg":   []byte("not a jpeg"),
+	})
+
+	run := func(t *testing.T, format string) []byte {
+		t.Helper()
+		reportPath := filepath.Join(t.TempDir(), "reports", "report."+format)
+		_, err := executeCompress(t, "compress", inputDir, "-r", "-o", filepath.Join(t.TempDir(), "out"),
+			"--report", format, "--report-file", reportPath)
+		if err == nil || !strings.Contains(err.Error(), "1 件の画像の圧縮に失敗しました") {
+			t.Fatalf("error = %v, want one failure", err)
+		}
+		data, err := os.ReadFile(reportPath)
+		if err != nil {
+			t.Fatalf("レポートが書き込まれていません: %v", err)
+		}
+		return data
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var report batchReport
+		if err := json.Unmarshal(run(t, "json"), &report); err != nil {
+			t.Fatalf("JSONの解析に失敗しました: %v", err)
+		}
+		if report.Command != "compress" || len(report.Items) != 3 {
+			t.Fatalf("report = %+v, want 3 compress items", report)
+		}
+		tot := report.Totals
+		if tot.Files != 3 || tot.Succeeded != 2 || tot.Failed != 1 {
+			t.Errorf("totals = %+v, want 3 files, 2 succeeded, 1 failed", tot)
+		}
+		if tot.OriginalSize == 0 || tot.SavedBytes != tot.OriginalSize-tot.OutputSize {
+			t.Errorf("totals = %+v, want consistent sizes", tot)
+		}
+		for _, it := range report.Items {
+			if strings.HasSuffix(it.Input, "broken.jpg") {
+				if it.Error == "" {
+					t.Errorf("broken.jpg にエラーが記録されていません: %+v", it)
+				}
+			} else if it.Format == "" || it.OutputSize == 0 || it.Output == "" {
+				t.Errorf("item = %+v, want format and sizes", it)
+			} else if it.InputWidth == 0 || it.OutputWidth != it.InputWidth || it.EncodeMS <= 0 {
+				t.Errorf("item = %+v, want dimensions and stage durations", it)
+			}
+		}
+		if tot.FilesPerSecond <= 0 || tot.EncodeMS <= 0 {
+			t.Errorf("totals = %+v, want throughput and stage durations", tot)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		rows, err := csv.NewReader(bytes.NewReader(run(t, "csv"))).ReadAll()
+		if err != nil {
+			t.Fatalf("CSVの解析に失敗しました: %v", err)
+		}
+		if len(rows) != 5 {
+			t.Fatalf("rows = %d, want header + 3 items + TOTAL", len(rows))
+		}
+		if rows[0][0] != "input" || rows[0][7] != "skipped" || rows[0][9] != "kept_original" || rows[0][10] != "aborted" || rows[0][11] != "error" || rows[4][0] != "TOTAL" {
+			t.Errorf("header = %v, last = %v", rows[0], rows[4])
+		}
+	})
+
+	t.Run("junit", func(t *testing.T) {
+		var suites struct {
+			Tests    int `xml:"tests,attr"`
+			Failures int `xml:"failures,attr"`
+			Suites   []struct {
+				Cases []struct {
+					Name    string    `xml:"name,attr"`
+					Failure *struct{} `xml:"failure"`
+				} `xml:"testcase"`
+			} `xml:"testsuite"`
+		}
+		if err := xml.Unmarshal(run(t, "junit"), &suites); err != nil {
+			t.Fatalf("XMLの解析に失敗しました: %v", err)
+		}
+		if suites.Tests != 3 || suites.Failures != 1 || len(suites.Suites) != 1 || len(suites.Suites[0].Cases) != 3 {
+			t.Errorf("junit = %+v, want 3 tests with 1 failure", suites)
+		}
+	})
+}
+
+func TestE2E_レポート出力_スキップ理由(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{"photo.jpg": createTestJPEG(t, 40, 40, 100)})
+	outputDir := filepath.Join(t.TempDir(), "out")
+	if _, err := executeCompress(t, "compress", inputDir, "-r", "-o", outputDir, "--incremental"); err != nil {
+		t.Fatalf("1回目の圧縮に失敗しました: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		flag       string
+		wantReason string
+	}{
+		{name: "マニフェスト", flag: "--incremental", wantReason: "manifest"},
+		{name: "ジャーナル", flag: "--resume", wantReason: "journal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			csvPath, junitPath := filepath.Join(dir, "r.csv"), filepath.Join(dir, "r.xml")
+			for path, format := range map[string]string{csvPath: "csv", junitPath: "junit"} {
+				if _, err := executeCompress(t, "compress", inputDir, "-r", "-o", outputDir, tt.flag, "--report", format, "--report-file", path); err != nil {
+					t.Fatalf("compress error = %v", err)
+				}
+			}
+
+			data, err := os.ReadFile(csvPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+			if err != nil || len(rows) != 3 {
+				t.Fatalf("rows = %v (%v), want header + 1 item + TOTAL", rows, err)
+			}
+			if rows[1][7] != "true" || rows[1][8] != tt.wantReason || rows[2][7] != "1" {
+				t.Errorf("rows = %v, want skipped by %s", rows, tt.wantReason)
+			}
+
+			data, err = os.ReadFile(junitPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := `<skipped message="` + tt.wantReason + `">`
+			if !strings.Contains(string(data), want) {
+				t.Errorf("JUnitに %s がありません:\n%s", want, data)
+			}
+		})
+	}
+}
+
+func TestE2E_レポート出力_不正なフラグ(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{"a.jpg": createTestJPEG(t, 20, 20, 80)})
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantInErr string
+	}{
+		{name: "不正な形式", args: []string{"--report", "xml", "--report-file", "r.xml"}, wantInErr: "不正なレポート形式です"},
+		{name: "report-fileなし", args: []string{"--report", "json"}, wantInErr: "--report-file を指定してください"},
+		{name: "reportなし", args: []string{"--report-file", "r.json"}, wantInErr: "--report (json/csv/junit) を指定してください"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"compress", inputDir, "-r", "-o", t.TempDir()}, tt.args...)
+			_, err := executeCompress(t, args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantInErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantInErr)
+			}
+		})
+	}
+}
+
+func TestE2E_メモリ上限(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{
+		"a.jpg":     createTestJPEG(t, 200, 200, 90),
+		"b.png":     createTestPNG(t, 100, 100),
+		"sub/c.jpg": createTestJPEG(t, 50, 50, 90),
+	})
+
+	t.Run("上限より大きな画像も1枚ずつ処理", func(t *testing.T) {
+		outputDir := filepath.Join(t.TempDir(), "out")
+		out, err := executeCompress(t, "compress", inputDir, "-r", "-o", outputDir, "--memory-limit", "1")
+		if err != nil {
+			t.Fatalf("メモリ上限付きの圧縮でエラーが返されました: %v\n%s", err, out)
+		}
+		if !strings.Contains(out, "成功 3, 失敗 0") {
+			t.Errorf("出力に期待メッセージが含まれていません: %s", out)
+		}
+	})
+
+	t.Run("負の値", func(t *testing.T) {
+		_, err := executeCompress(t, "compress", inputDir, "-r", "-o", t.TempDir(), "--memory-limit", "-1")
+		if err == nil || !strings.Contains(err.Error(), "--memory-limit は0以上で指定してください") {
+			t.Errorf("error = %v, want memory limit error", err)
+		}
+	})
+}
+
+func TestE2E_失敗ポリシー(t *testing.T) {
+	inputDir := t.TempDir()
+	files := map[string][]byte{"a_broken.jpg": []byte("not a jpeg")}
+	for _, name := range []string{"b.jpg", "c.jpg", "d.jpg", "e.jpg"} {
+		files[name] = createTestJPEG(t, 40, 40, 90)
+	}
+	setupTestDir(t, inputDir, files)
+
+	for _, args := range [][]string{{"--fail-fast"}, {"--max-failures", "1"}, {"--max-failures", "10%"}} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			reportPath := filepath.Join(t.TempDir(), "report.json")
+			cmdArgs := append([]string{"compress", inputDir, "-r", "-o", t.TempDir(), "--report", "json", "--report-file", reportPath}, args...)
+			_, err := executeCompress(t, cmdArgs...)
+			if err == nil || !strings.Contains(err.Error(), "1 件の画像の圧縮に失敗しました") {
+				t.Fatalf("error = %v, want one failure", err)
+			}
+
+			data, err := os.ReadFile(reportPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var report batchReport
+			if err := json.Unmarshal(data, &report); err != nil {
+				t.Fatal(err)
+			}
+			// Items already in flight may still finish, so only the totals are fixed.
+			tot := report.Totals
+			if tot.Failed != 1 || tot.Succeeded+tot.Failed+tot.Aborted != 5 {
+				t.Errorf("totals = %+v, want 1 failure and every item accounted for", tot)
+			}
+			for _, it := range report.Items {
+				if it.Aborted && it.Error != processor.ErrBatchAborted.Error() {
+					t.Errorf("aborted item = %+v, want ErrBatchAborted", it)
+				}
+			}
+		})
+	}
+}
+
+func TestE2E_失敗ポリシー_不正なフラグ(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{"a.jpg": createTestJPEG(t, 20, 20, 80)})
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantInErr string
+	}{
+		{name: "同時指定", args: []string{"--fail-fast", "--max-failures", "3"}, wantInErr: "--fail-fast と --max-failures は同時に指定できません"},
+		{name: "0件", args: []string{"--max-failures", "0"}, wantInErr: "不正な --max-failures の値です"},
+		{name: "数値以外", args: []string{"--max-failures", "many"}, wantInErr: "不正な --max-failures の値です"},
+		{name: "100%超", args: []string{"--max-failures", "150%"}, wantInErr: "不正な --max-failures の値です"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"compress", inputDir, "-r", "-o", t.TempDir()}, tt.args...)
+			_, err := executeCompress(t, args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantInErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantInErr)
+			}
+		})
+	}
+}
+
+func TestE2E_リトライ(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{
+		"a.jpg":        createTestJPEG(t, 20, 20, 80),
+		"b_broken.jpg": []byte("not a jpeg"),
+	})
+
+	t.Run("デコードエラーは再試行しない", func(t *testing.T) {
+		reportPath := filepath.Join(t.TempDir(), "report.json")
+		_, err := executeCompress(t, "compress", inputDir, "-r", "-o", t.TempDir(), "--retries", "2", "--report", "json", "--report-file", reportPath)
+		if err == nil || !strings.Contains(err.Error(), "1 件の画像の圧縮に失敗しました") {
+			t.Fatalf("error = %v, want one failure", err)
+		}
+
+		data, err := os.ReadFile(reportPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report batchReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			t.Fatal(err)
+		}
+		for _, it := range report.Items {
+			if it.Attempts != 1 {
+				t.Errorf("%s: attempts = %d, want 1", filepath.Base(it.Input), it.Attempts)
+			}
+		}
+	})
+
+	t.Run("負の値", func(t *testing.T) {
+		_, err := executeCompress(t, "compress", inputDir, "-r", "-o", t.TempDir(), "--retries", "-1")
+		if err == nil || !strings.Contains(err.Error(), "--retries は0以上で指定してください") {
+			t.Errorf("error = %v, want retries error", err)
+		}
+	})
+}
+
+// startFakeS3 serves a fake S3 bucket and points the AWS_* environment variables at it.
+func startFakeS3(t *testing.T) *s3fake.Server {
+	t.Helper()
+	srv := s3fake.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AccessKeyID = "test-key"
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	return srv
+}
+
+func TestE2E_S3(t *testing.T) {
+	srv := startFakeS3(t)
+	srv.Put("bucket", "photos/a.jpg", createTestJPEG(t, 40, 40, 95))
+	srv.Put("bucket", "photos/sub/b.png", createTestPNG(t, 20, 20))
+	srv.Put("bucket", "photos/readme.txt", []byte("not an image"))
+
+	out, err := executeCompress(t, "compress", "s3://bucket/photos", "-r")
+	if err != nil {
+		t.Fatalf("compress error = %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "完了: 成功 2, 失敗 0") {
+		t.Errorf("output = %q, want two successes", out)
+	}
+	for _, key := range []string{"photos_compressed/a.jpg", "photos_compressed/sub/b.png"} {
+		data, ok := srv.Object("bucket", key)
+		if !ok {
+			t.Errorf("%s was not uploaded", key)
+			continue
+		}
+		if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s is not an image: %v", key, err)
+		}
+	}
+	if _, ok := srv.Object("bucket", "photos_compressed/"+journalFileName); ok {
+		t.Error("journal was written to the bucket")
+	}
+
+	t.Run("不正な指定", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			args    []string
+			wantErr string
+		}{
+			{name: "ローカルへの出力", args: []string{"s3://bucket/photos", "-r", "-o", t.TempDir()}, wantErr: "両方とも S3 か両方ともローカル"},
+			{name: "別のバケット", args: []string{"s3://bucket/photos", "-r", "-o", "s3://other/out"}, wantErr: "同じバケット"},
+			{name: "バケットのルート", args: []string{"s3://bucket", "-r"}, wantErr: "--output (-o) で出力先を指定してください"},
+			{name: "バケット名なし", args: []string{"s3:///photos", "-r", "-o", "s3://bucket/out"}, wantErr: "バケット名がありません"},
+			{name: "レジューム", args: []string{"s3://bucket/photos", "-r", "--resume"}, wantErr: "--resume は S3 のパスには使用できません"},
+			{name: "バックアップ", args: []string{"s3://bucket/photos", "-r", "--in-place", "--backup"}, wantErr: "--backup は S3 のパスには使用できません"},
+			{name: "再帰フラグなし", args: []string{"s3://bucket/photos"}, wantErr: "--recursive (-r) フラグが必要です"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := executeCompress(t, append([]string{"compress"}, tt.args...)...)
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+			})
+		}
+	})
+}
+
+// writeTestZIP writes a ZIP archive holding files, in the order of names, to path.
+func writeTestZIP(t *testing.T, path string, names []string, files map[string][]byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestE2E_アーカイブ圧縮(t *testing.T) {
+	dir := t.TempDir()
+	photo := createTestJPEG(t, 64, 64, 100)
+	names := []string{"photos/a.jpg", "photos/list.csv", "photos/b_broken.png", "c.png"}
+	files := map[string][]byte{
+		"photos/a.jpg":        photo,
+		"photos/list.csv":     []byte("sku,name\n1,chair\n"),
+		"photos/b_broken.png": []byte("not a png"),
+		"c.png":               createTestPNG(t, 16, 16),
+	}
+	input := filepath.Join(dir, "photos.zip")
+	writeTestZIP(t, input, names, files)
+
+	output := filepath.Join(dir, "out.zip")
+	out, err := executeCompress(t, "compress", input, "-o", output)
+	if err == nil || !strings.Contains(err.Error(), "1 件の画像の圧縮に失敗しました") {
+		t.Fatalf("error = %v, want one failure\n%s", err, out)
+	}
+	if !strings.Contains(out, "完了: 成功 2, 失敗 1") || !strings.Contains(out, "アーカイブを書き出しました: "+output) {
+		t.Errorf("output = %q", out)
+	}
+
+	zr, err := zip.OpenReader(output)
+	if err != nil {
+		t.Fatalf("output is not a ZIP archive: %v", err)
+	}
+	defer func() { _ = zr.Close() }()
+	if len(zr.File) != len(names) {
+		t.Fatalf("output has %d entries, want %d", len(zr.File), len(names))
+	}
+	for i, f := range zr.File {
+		if f.Name != names[i] {
+			t.Errorf("entry %d = %s, want %s", i, f.Name, names[i])
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		switch f.Name {
+		case "photos/a.jpg":
+			if len(data) >= len(photo) {
+				t.Errorf("photos/a.jpg was not compressed: %d >= %d bytes", len(data), len(photo))
+			}
+		case "photos/list.csv", "photos/b_broken.png":
+			if !bytes.Equal(data, files[f.Name]) {
+				t.Errorf("%s was modified", f.Name)
+			}
+		}
+	}
+}
+
+func TestE2E_アーカイブ圧縮_出力パス自動生成(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "photos.tar.gz")
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	photo := createTestPNG(t, 16, 16)
+	if err := tw.WriteHeader(&tar.Header{Name: "a.png", Mode: 0o644, Size: int64(len(photo))}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = tw.Write(photo)
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(input, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := executeCompress(t, "compress", input); err != nil {
+		t.Fatalf("compress error = %v\n%s", err, out)
+	}
+	if _, err := os.Stat(strings.TrimSuffix(input, ".tar.gz") + "_compressed.tar.gz"); err != nil {
+		t.Errorf("default output missing: %v", err)
+	}
+}
+
+func TestE2E_アーカイブ圧縮_エントリサイズ上限(t *testing.T) {
+	dir := t.TempDir()
+	// Trailing data after IEND makes the entry larger than 1 MiB.
+	large := append(createTestPNG(t, 16, 16), make([]byte, 3<<19)...)
+	small := createTestPNG(t, 16, 16)
+	input := filepath.Join(dir, "photos.zip")
+	writeTestZIP(t, input, []string{"large.png", "small.png"}, map[string][]byte{"large.png": large, "small.png": small})
+
+	output := filepath.Join(dir, "out.zip")
+	out, err := executeCompress(t, "compress", input, "-o", output, "--archive-max-entry-size", "1")
+	if err == nil || !strings.Contains(err.Error(), "1 件の画像の圧縮に失敗しました") {
+		t.Fatalf("error = %v, want one failure\n%s", err, out)
+	}
+	if !strings.Contains(out, "完了: 成功 1, 失敗 1") {
+		t.Errorf("output = %q", out)
+	}
+
+	zr, err := zip.OpenReader(output)
+	if err != nil {
+		t.Fatalf("output is not a ZIP archive: %v", err)
+	}
+	defer func() { _ = zr.Close() }()
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if !bytes.Equal(data, large) {
+		t.Error("large.png was not copied unchanged")
+	}
+}
+
+func TestE2E_アーカイブ圧縮_不正な指定(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photos.zip")
+	writeTestZIP(t, input, []string{"a.png"}, map[string][]byte{"a.png": createTestPNG(t, 8, 8)})
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "別形式の出力", args: []string{input, "-o", filepath.Join(dir, "out.tar")}, wantErr: "同じ形式のアーカイブ (.zip)"},
+		{name: "レジューム", args: []string{input, "--resume"}, wantErr: "--resume は ZIP/TAR アーカイブには使用できません"},
+		{name: "出力テンプレート", args: []string{input, "--output-template", "{name}.{ext}"}, wantErr: "--output-template は ZIP/TAR アーカイブには使用できません"},
+		{name: "負のエントリサイズ上限", args: []string{input, "--archive-max-entry-size", "-1"}, wantErr: "--archive-max-entry-size は0以上で指定してください"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executeCompress(t, append([]string{"compress"}, tt.args...)...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestArchiveOutputPath(t *testing.T) {
+	tests := map[string]string{
+		"photos.zip":        "photos_compressed.zip",
+		"a/photos.TAR":      "a/photos_compressed.TAR",
+		"photos.tar.gz":     "photos_compressed.tar.gz",
+		"photos.backup.tgz": "photos.backup_compressed.tgz",
+	}
+	for input, want := range tests {
+		if got := archiveOutputPath(input); got != want {
+			t.Errorf("archiveOutputPath(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestE2E_空ディレクトリ圧縮(t *testing.T) {
+	inputDir := t.TempDir()
+
+	out, err := executeCompress(t, "compress", inputDir, "-r")
+	if err != nil {
+		t.Fatalf("空ディレクトリでエラーが返されました: %v", err)
+	}
+
+	if !strings.Contains(out, "対象の画像ファイルが見つかりませんでした") {
+		t.Errorf("出力に期待メッセージが含まれていません: %s", out)
+	}
+}
+
+// --- Step 5: Flag Combination Tests (Table-Driven) ---
+
+func TestE2E_フラグ組み合わせ(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "quality_50", args: []string{"--quality", "50"}},
+		{name: "level_low", args: []string{"--level", "low"}},
+		{name: "level_high", args: []string{"--level", "high"}},
+		{name: "quality優先_quality70_level_high", args: []string{"--quality", "70", "--level", "high"}},
+		{name: "quality境界値_1", args: []string{"--quality", "1"}},
+		{name: "quality境界値_100", args: []string{"--quality", "100"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			inputPath := filepath.Join(tmpDir, "test.jpg")
+			outputPath := filepath.Join(tmpDir, "out.jpg")
+
+			jpegData := createTestJPEG(t, 80, 80, 95)
+			if err := os.WriteFile(inputPath, jpegData, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			args := append([]string{"compress", inputPath, "-o", outputPath}, tt.args...)
+			_, err := executeCompress(t, args...)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			verifyImageFile(t, outputPath, "jpeg")
+		})
+	}
+}
+
+func TestE2E_フラグ組み合わせ_ディレクトリ(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "recursive_quality_60", args: []string{"-r", "--quality", "60"}},
+		{name: "recursive_level_low", args: []string{"-r", "--level", "low"}},
+		{name: "recursive_level_high", args: []string{"-r", "--level", "high"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputDir := t.TempDir()
+			outputDir := filepath.Join(t.TempDir(), "output")
+
+			setupTestDir(t, inputDir, map[string][]byte{
+				"a.jpg": createTestJPEG(t, 50, 50, 90),
+				"b.png": createTestPNG(t, 50, 50),
+			})
+
+			args := append([]string{"compress", inputDir, "-o", outputDir}, tt.args...)
+			_, err := executeCompress(t, args...)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			verifyImageFile(t, filepath.Join(outputDir, "a.jpg"), "jpeg")
+			verifyImageFile(t, filepath.Join(outputDir, "b.png"), "png")
+		})
+	}
+}
+
+// --- Step 6: Error Handling Tests (Table-Driven) ---
+
+func TestE2E_エラーハンドリング(t *testing.T) {
+	// Prepare a valid JPEG for tests that need a real file.
+	tmpDir := t.TempDir()
+	validJPEG := filepath.Join(tmpDir, "valid.jpg")
+	if err := os.WriteFile(validJPEG, createTestJPEG(t, 10, 10, 80), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	avifFile := filepath.Join(tmpDir, "test.avif")
+	if err := os.WriteFile(avifFile, []byte("not an avif"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bmpFile := filepath.Join(tmpDir, "test.bmp")
+	if err := os.WriteFile(bmpFile, []byte("not a bmp"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	corruptJPEG := filepath.Join(tmpDir, "corrupt.jpg")
+	if err := os.WriteFile(corruptJPEG, []byte("this is not a jpeg"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	emptyDir := filepath.Join(tmpDir, "emptydir")
+	if err := os.Mkdir(emptyDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantInErr string // substring expected in error message (empty = just check error is non-nil)
+	}{
+		{
+			name: "引数なし",
+			args: []string{"compress"},
+		},
+		{
+			name: "引数過多",
+			args: []string{"compress", "file1.jpg", "file2.jpg"},
+		},
+		{
+			name: "存在しないファイル",
+			args: []string{"compress", "/nonexistent/path/file.jpg"},
+		},
+		{
+			name: "存在しないディレクトリ",
+			args: []string{"compress", "/nonexistent/dir/", "-r"},
+		},
+		{
+			name: "recursiveなしのディレクトリ",
+			args: []string{"compress", emptyDir},
+		},
+		{
+			name:      "不正なlevel値",
+			args:      []string{"compress", validJPEG, "--level", "ultra"},
+			wantInErr: "不正な圧縮レベル",
+		},
+		{
+			name:      "quality範囲外_0未満",
+			args:      []string{"compress", validJPEG, "--quality", "-1"},
+			wantInErr: "品質は1〜100の範囲",
+		},
+		{
+			name:      "quality範囲外_101",
+			args:      []string{"compress", validJPEG, "--quality", "101"},
+			wantInErr: "品質は1〜100の範囲",
+		},
+		{
+			name:      "非対応フォーマットavif",
+			args:      []string{"compress", avifFile},
+			wantInErr: "サポートされていない画像形式",
+		},
+		{
+			name:      "入力専用フォーマットbmp",
+			args:      []string{"compress", bmpFile},
+			wantInErr: "圧縮出力に対応していません",
+		},
+		{
+			name:      "破損画像ファイル",
+			args:      []string{"compress", corruptJPEG},
+			wantInErr: "圧縮に失敗",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executeCompress(t, tt.args...)
+			if err == nil {
+				t.Fatal("エラーが返されるべきですが、nilでした")
+			}
+			if tt.wantInErr != "" && !strings.Contains(err.Error(), tt.wantInErr) {
+				t.Errorf("エラーメッセージに %q が含まれていません: %v", tt.wantInErr, err)
+			}
+		})
+	}
+}
+
+func TestE2E_ディレクトリ圧縮_一部失敗(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "output")
+
+	setupTestDir(t, inputDir, map[string][]byte{
+		"good.jpg":    createTestJPEG(t, 50, 50, 90),
+		"corrupt.jpg": []byte("this is not a valid jpeg"),
+	})
+
+	out, err := executeCompress(t, "compress", inputDir, "-r", "-o", outputDir)
+
+	// Should return error because some files failed.
+	if err == nil {
+		t.Fatal("一部失敗時にエラーが返されるべきです")
+	}
+
+	// Verify the output reports success and failure counts.
+	if !strings.Contains(out, "成功 1") {
+		t.Errorf("出力に「成功 1」が含まれていません: %s", out)
+	}
+	if !strings.Contains(out, "失敗 1") {
+		t.Errorf("出力に「失敗 1」が含まれていません: %s", out)
+	}
+
+	// The valid file should still be compressed.
 	verifyImageFile(t, filepath.Join(outputDir, "good.jpg"), "jpeg")
 }
 
@@ -528,3 +1476,156 @@ func TestE2E_出力検証_PNG圧縮レベル(t *testing.T) {
 		})
 	}
 }
+
+func TestE2E_16bitPNG_ditherで8bit出力(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "deep.png")
+	outputPath := filepath.Join(tmpDir, "output.png")
+
+	src := image.NewNRGBA64(image.Rect(0, 0, 32, 32))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(inputPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := executeCompress(t, "compress", inputPath, "-o", outputPath, "--dither"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	f, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatalf("出力ファイルを開けません: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("画像のデコードに失敗しました: %v", err)
+	}
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		t.Errorf("出力画像が16bitのままです: %T", img)
+	}
+}
+
+func TestE2E_マルチページTIFF圧縮(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "pkg", "processor", "testdata", "multipage.tiff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "scan.tiff")
+	if err := os.WriteFile(inputPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := executeCompress(t, "compress", inputPath); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	outputPath := filepath.Join(tmpDir, "scan_compressed.tiff")
+	verifyImageFile(t, outputPath, "tiff")
+	f, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	pages, err := processor.PageCount(f)
+	if err != nil {
+		t.Fatalf("PageCount() error = %v", err)
+	}
+	if pages != 3 {
+		t.Errorf("ページ数 = %d, want 3", pages)
+	}
+}
+
+// executeStdio executes the root command with stdin as standard input and
+// returns standard output and standard error separately.
+func executeStdio(t *testing.T, stdin []byte, args ...string) (stdout []byte, stderr string, err error) {
+	t.Helper()
+	resetGlobals(t)
+
+	var outBuf, errBuf bytes.Buffer
+	rootCmd.SetIn(bytes.NewReader(stdin))
+	rootCmd.SetOut(&outBuf)
+	rootCmd.SetErr(&errBuf)
+	t.Cleanup(func() {
+		rootCmd.SetIn(nil)
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+	})
+
+	rootCmd.SetArgs(args)
+	err = Execute()
+	return outBuf.Bytes(), errBuf.String(), err
+}
+
+func TestE2E_標準入出力圧縮(t *testing.T) {
+	input := createTestPNG(t, 32, 32)
+
+	stdout, stderr, err := executeStdio(t, input, "compress", "-", "-o", "-")
+	if err != nil {
+		t.Fatalf("compress error = %v\n%s", err, stderr)
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(stdout)); err != nil || format != "png" {
+		t.Fatalf("stdout is not a PNG image: %q, %v", format, err)
+	}
+	if !strings.Contains(stderr, "圧縮完了: 標準入力 → 標準出力") {
+		t.Errorf("stderr = %q, want the summary", stderr)
+	}
+}
+
+func TestE2E_標準入出力圧縮_ファイルとの組み合わせ(t *testing.T) {
+	dir := t.TempDir()
+	photo := createTestJPEG(t, 32, 32, 100)
+	inputPath := filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(inputPath, photo, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("ファイルから標準出力", func(t *testing.T) {
+		stdout, stderr, err := executeStdio(t, nil, "compress", inputPath, "-o", "-")
+		if err != nil {
+			t.Fatalf("compress error = %v\n%s", err, stderr)
+		}
+		if _, format, err := image.DecodeConfig(bytes.NewReader(stdout)); err != nil || format != "jpeg" {
+			t.Errorf("stdout is not a JPEG image: %q, %v", format, err)
+		}
+	})
+
+	t.Run("標準入力からファイル", func(t *testing.T) {
+		outputPath := filepath.Join(dir, "out", "photo.jpg")
+		stdout, stderr, err := executeStdio(t, photo, "compress", "-", "-o", outputPath)
+		if err != nil {
+			t.Fatalf("compress error = %v\n%s", err, stderr)
+		}
+		if len(stdout) != 0 {
+			t.Errorf("stdout = %q, want nothing", stdout)
+		}
+		verifyImageFile(t, outputPath, "jpeg")
+	})
+}
+
+func TestE2E_標準入出力圧縮_エラー(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		stdin   []byte
+		args    []string
+		wantErr string
+	}{
+		{name: "判別できない入力", stdin: []byte("not an image"), args: []string{"-"}, wantErr: "標準入力の画像形式を判別できません"},
+		{name: "インプレース", stdin: createTestPNG(t, 8, 8), args: []string{"-", "--in-place"}, wantErr: "--in-place は 標準入出力には使用できません"},
+		{name: "ディレクトリ", args: []string{dir, "-r", "-o", "-"}, wantErr: "ディレクトリの処理結果は標準出力に書き出せません"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := executeStdio(t, tt.stdin, append([]string{"compress"}, tt.args...)...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
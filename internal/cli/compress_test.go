@@ -106,19 +106,106 @@ func resetGlobals(t *testing.T) {
 		convertOutput = ""
 		convertRecursive = false
 		convertUseTUI = false
+		toSRGB = false
+		dither = false
+		resume = false
+		incremental = false
+		inPlace = false
+		backup = false
+		backupDir = ""
+		neverGrow = false
+		outTemplate = ""
+		dryRun = false
+		convertDryRun = false
+		reportFmt = ""
+		reportFile = ""
+		memoryLimit = 0
+		failFast = false
+		maxFailures = ""
+		retries = 0
+		archiveEntryLimit = 0
+		compressScan = scanFlags{symlinks: "files"}
+		convertScan = scanFlags{symlinks: "files"}
+		convertToSRGB = false
+		convertDither = false
+		convertPages = "first"
+		convertWidth = 0
+		convertHeight = 0
+		convertDPI = 0
+		convertPoster = false
+		convertFrame = 1
+		convertIncremental = false
+		convertOutTemplate = ""
+		convertReport = ""
+		convertReportFile = ""
+		convertMemoryLimit = 0
+		convertFailFast = false
+		convertMaxFailures = ""
+		convertRetries = 0
+		watchTo = ""
+		watchFormat = ""
+		watchQuality = 0
+		watchLevel = "medium"
+		watchRecursive = false
+		watchUseTUI = false
+		watchToSRGB = false
+		watchDither = false
+		watchDebounce = processor.DefaultWatchDebounce
+		infoJSON = false
+		infoRecursive = false
+		infoScan = scanFlags{symlinks: "files"}
+		compareDiff = ""
+		compareMinSSIM = 0
+		compareMinPSNR = 0
+		compareScan = scanFlags{symlinks: "files"}
+		optimizeQuality = 0
+		optimizeLevel = "medium"
+		optimizeOutput = ""
+		optimizeRecursive = false
+		optimizeUseTUI = false
+		optimizeResume = false
+		optimizeIncremental = false
+		optimizeDryRun = false
+		optimizeReport = ""
+		optimizeReportFile = ""
+		optimizeMemoryLimit = 0
+		optimizeFailFast = false
+		optimizeMaxFailures = ""
+		optimizeRetries = 0
+		optimizeScan = scanFlags{symlinks: "files"}
 		cfgFile = ""
 		rootCmd.SetArgs([]string{})
 		// Reset pflag Changed state so flags don't carry over between tests
-		for _, name := range []string{"quality", "level", "output", "recursive", "tui"} {
+		for _, name := range []string{"quality", "level", "output", "recursive", "tui", "srgb", "dither", "resume", "incremental", "in-place", "backup", "backup-dir", "never-grow", "output-template", "dry-run", "report", "report-file", "memory-limit", "fail-fast", "max-failures", "retries", "archive-max-entry-size", "include", "exclude", "max-depth", "gitignore", "symlinks", "skip-hidden"} {
 			if f := compressCmd.Flags().Lookup(name); f != nil {
 				f.Changed = false
 			}
 		}
-		for _, name := range []string{"format", "quality", "level", "output", "recursive", "tui"} {
+		for _, name := range []string{"format", "quality", "level", "output", "recursive", "tui", "srgb", "dither", "pages", "width", "height", "dpi", "poster", "frame", "incremental", "output-template", "dry-run", "report", "report-file", "memory-limit", "fail-fast", "max-failures", "retries", "include", "exclude", "max-depth", "gitignore", "symlinks", "skip-hidden"} {
 			if f := convertCmd.Flags().Lookup(name); f != nil {
 				f.Changed = false
 			}
 		}
+		for _, name := range []string{"to", "format", "quality", "level", "recursive", "tui", "srgb", "dither", "debounce"} {
+			if f := watchCmd.Flags().Lookup(name); f != nil {
+				f.Changed = false
+			}
+		}
+		for _, name := range []string{"json", "recursive", "include", "exclude", "max-depth", "gitignore", "symlinks", "skip-hidden"} {
+			if f := infoCmd.Flags().Lookup(name); f != nil {
+				f.Changed = false
+			}
+		}
+		for _, name := range []string{"diff", "min-ssim", "min-psnr", "include", "exclude", "max-depth", "gitignore", "symlinks", "skip-hidden"} {
+			if f := compareCmd.Flags().Lookup(name); f != nil {
+				f.Changed = false
+			}
+		}
+		for _, name := range []string{"quality", "level", "output", "recursive", "tui", "resume", "incremental", "dry-run", "report", "report-file", "memory-limit", "fail-fast", "max-failures", "retries", "include", "exclude", "max-depth", "gitignore", "symlinks", "skip-hidden"} {
+			if f := optimizeCmd.Flags().Lookup(name); f != nil {
+				f.Changed = false
+			}
+		}
 		if f := rootCmd.PersistentFlags().Lookup("config"); f != nil {
 			f.Changed = false
 		}
@@ -174,9 +261,16 @@ func TestDetectFormat(t *testing.T) {
 		{name: ".PNG大文字", path: "ICON.PNG", want: processor.FormatPNG},
 		{name: ".webp拡張子", path: "image.webp", want: processor.FormatWEBP},
 		{name: ".WEBP大文字", path: "IMAGE.WEBP", want: processor.FormatWEBP},
+		{name: ".heic拡張子", path: "IMG_0001.heic", want: processor.FormatHEIC},
+		{name: ".HEIF大文字", path: "IMG_0001.HEIF", want: processor.FormatHEIC},
 		{name: "パス付き", path: "/path/to/photo.jpg", want: processor.FormatJPEG},
-		{name: "非対応_bmp", path: "file.bmp", wantErr: true},
-		{name: "非対応_gif", path: "file.gif", wantErr: true},
+		{name: ".tiff拡張子", path: "scan.tiff", want: processor.FormatTIFF},
+		{name: ".TIF大文字", path: "SCAN.TIF", want: processor.FormatTIFF},
+		{name: ".bmp拡張子", path: "scan.bmp", want: processor.FormatBMP},
+		{name: ".svg拡張子", path: "icon.svg", want: processor.FormatSVG},
+		{name: ".gif拡張子", path: "anim.gif", want: processor.FormatGIF},
+		{name: ".apng拡張子", path: "anim.apng", want: processor.FormatPNG},
+		{name: "非対応_avif", path: "file.avif", wantErr: true},
 		{name: "拡張子なし", path: "noext", wantErr: true},
 		{name: "空文字", path: "", wantErr: true},
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/FrontWorksDev/Loki/pkg/processor"
 	"github.com/spf13/viper"
 )
 
@@ -19,12 +20,81 @@ func initConfig() {
 	viper.SetDefault("compress.level", "medium")
 	viper.SetDefault("compress.output", "")
 	viper.SetDefault("compress.recursive", false)
+	viper.SetDefault("compress.srgb", false)
+	viper.SetDefault("compress.dither", false)
+	viper.SetDefault("compress.resume", false)
+	viper.SetDefault("compress.incremental", false)
+	viper.SetDefault("compress.in_place", false)
+	viper.SetDefault("compress.backup", false)
+	viper.SetDefault("compress.backup_dir", "")
+	viper.SetDefault("compress.never_grow", false)
+	viper.SetDefault("compress.output_template", "")
+	viper.SetDefault("compress.dry_run", false)
+	viper.SetDefault("compress.report", "")
+	viper.SetDefault("compress.report_file", "")
+	viper.SetDefault("compress.memory_limit", 0)
+	viper.SetDefault("compress.fail_fast", false)
+	viper.SetDefault("compress.max_failures", "")
+	viper.SetDefault("compress.retries", 0)
+	viper.SetDefault("compress.archive_max_entry_size", 0)
+	setScanDefaults("compress")
 
 	viper.SetDefault("convert.format", "")
 	viper.SetDefault("convert.quality", 0)
 	viper.SetDefault("convert.level", "medium")
 	viper.SetDefault("convert.output", "")
 	viper.SetDefault("convert.recursive", false)
+	viper.SetDefault("convert.srgb", false)
+	viper.SetDefault("convert.dither", false)
+	viper.SetDefault("convert.pages", "first")
+	viper.SetDefault("convert.width", 0)
+	viper.SetDefault("convert.height", 0)
+	viper.SetDefault("convert.dpi", 0.0)
+	viper.SetDefault("convert.poster", false)
+	viper.SetDefault("convert.frame", 1)
+	viper.SetDefault("convert.incremental", false)
+	viper.SetDefault("convert.output_template", "")
+	viper.SetDefault("convert.report", "")
+	viper.SetDefault("convert.dry_run", false)
+	viper.SetDefault("convert.report_file", "")
+	viper.SetDefault("convert.memory_limit", 0)
+	viper.SetDefault("convert.fail_fast", false)
+	viper.SetDefault("convert.max_failures", "")
+	viper.SetDefault("convert.retries", 0)
+	setScanDefaults("convert")
+
+	viper.SetDefault("watch.to", "")
+	viper.SetDefault("watch.format", "")
+	viper.SetDefault("watch.quality", 0)
+	viper.SetDefault("watch.level", "medium")
+	viper.SetDefault("watch.recursive", false)
+	viper.SetDefault("watch.srgb", false)
+	viper.SetDefault("watch.dither", false)
+	viper.SetDefault("watch.debounce", processor.DefaultWatchDebounce)
+
+	viper.SetDefault("info.json", false)
+	viper.SetDefault("info.recursive", false)
+	setScanDefaults("info")
+
+	viper.SetDefault("compare.diff", "")
+	viper.SetDefault("compare.min_ssim", 0.0)
+	viper.SetDefault("compare.min_psnr", 0.0)
+	setScanDefaults("compare")
+
+	viper.SetDefault("optimize.quality", 0)
+	viper.SetDefault("optimize.level", "medium")
+	viper.SetDefault("optimize.output", "")
+	viper.SetDefault("optimize.recursive", false)
+	viper.SetDefault("optimize.resume", false)
+	viper.SetDefault("optimize.incremental", false)
+	viper.SetDefault("optimize.dry_run", false)
+	viper.SetDefault("optimize.report", "")
+	viper.SetDefault("optimize.report_file", "")
+	viper.SetDefault("optimize.memory_limit", 0)
+	viper.SetDefault("optimize.fail_fast", false)
+	viper.SetDefault("optimize.max_failures", "")
+	viper.SetDefault("optimize.retries", 0)
+	setScanDefaults("optimize")
 
 	if cfgFile != "" {
 		// Use config file specified by --config flag
@@ -55,4 +125,8 @@ func initConfig() {
 	// This is done here (not in init()) so bindings survive viper.Reset() in tests
 	bindCompressFlags()
 	bindConvertFlags()
+	bindWatchFlags()
+	bindInfoFlags()
+	bindCompareFlags()
+	bindOptimizeFlags()
 }
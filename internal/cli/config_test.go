@@ -13,12 +13,12 @@ func resetFlagsAndViper(t *testing.T) {
 	t.Helper()
 	viper.Reset()
 	cfgFile = ""
-	for _, name := range []string{"quality", "level", "output", "recursive"} {
+	for _, name := range []string{"quality", "level", "output", "recursive", "srgb", "dither", "resume", "incremental", "in-place", "backup", "backup-dir", "never-grow", "output-template", "dry-run", "report", "report-file", "memory-limit", "fail-fast", "max-failures", "retries", "archive-max-entry-size", "include", "exclude", "max-depth", "gitignore", "symlinks", "skip-hidden"} {
 		if f := compressCmd.Flags().Lookup(name); f != nil {
 			f.Changed = false
 		}
 	}
-	for _, name := range []string{"format", "quality", "level", "output", "recursive"} {
+	for _, name := range []string{"format", "quality", "level", "output", "recursive", "srgb", "dither", "pages", "width", "height", "dpi", "poster", "frame", "incremental", "output-template", "report", "report-file", "memory-limit", "fail-fast", "max-failures", "retries", "include", "exclude", "max-depth", "gitignore", "symlinks", "skip-hidden"} {
 		if f := convertCmd.Flags().Lookup(name); f != nil {
 			f.Changed = false
 		}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/FrontWorksDev/Loki/internal/cli/tui"
 	"github.com/FrontWorksDev/Loki/pkg/processor"
@@ -15,12 +17,29 @@ import (
 )
 
 var (
-	convertFormat    string
-	convertQuality   int
-	convertLevel     string
-	convertOutput    string
-	convertRecursive bool
-	convertUseTUI    bool
+	convertFormat      string
+	convertQuality     int
+	convertLevel       string
+	convertOutput      string
+	convertRecursive   bool
+	convertUseTUI      bool
+	convertToSRGB      bool
+	convertDither      bool
+	convertPages       string
+	convertWidth       int
+	convertHeight      int
+	convertDPI         float64
+	convertPoster      bool
+	convertFrame       int
+	convertIncremental bool
+	convertOutTemplate string
+	convertReport      string
+	convertReportFile  string
+	convertMemoryLimit int
+	convertFailFast    bool
+	convertMaxFailures string
+	convertRetries     int
+	convertDryRun      bool
 )
 
 var convertCmd = &cobra.Command{
@@ -28,24 +47,91 @@ var convertCmd = &cobra.Command{
 	Short: "画像ファイルまたはディレクトリのフォーマットを変換する",
 	Long: `画像ファイルまたはディレクトリのフォーマットを変換します。
 
-対応フォーマット: JPEG (.jpg, .jpeg), PNG (.png), WebP (.webp)
+対応フォーマット: JPEG (.jpg, .jpeg), PNG (.png, .apng), WebP (.webp), TIFF (.tif, .tiff), GIF (.gif)
+入力のみ対応: HEIC/HEIF (.heic, .heif), BMP (.bmp), SVG (.svg)
+
+マルチページTIFFは既定で1ページ目のみ変換します。--pages all を指定すると
+ページごとに {name}_p{n}.{ext} として出力します。
+
+SVGは --width/--height で指定したサイズで直接ラスタライズします（片方のみの場合は
+縦横比を維持）。サイズ未指定時は --dpi (既定96) で描画します。ラスター画像は
+--width/--height を指定しても元のサイズのまま変換します。
+外部リソースを参照するSVGは安全のため変換できません。
+
+アニメーションGIF/APNG/アニメーションWebP同士の変換では、フレームの表示時間と
+ループ回数を保持します。--poster を指定すると --frame (既定1) のフレームだけを
+静止画として出力します。JPEG/TIFFへの変換は常に1フレームのみ出力します。
+
+--incremental を指定すると出力先の .img-cli-manifest.json に入力と変換オプションを記録し、
+次回以降は前回から変更のないファイルをスキップします。
+
+ディレクトリ処理では --include/--exclude (globパターン、** は任意の階層に一致)、
+--max-depth、--skip-hidden、--symlinks で対象を絞り込めます。各ディレクトリの
+.lokiignore (--gitignore 指定時は .gitignore も) に一致するファイルは除外します。
+
+--output-template で出力パスを指定できます。ディレクトリ処理では出力先ディレクトリ
+からの相対パス、単一ファイルでは {dir} が入力ファイルのディレクトリになります。
+変数: {dir} {name} {ext} {format} {width} {height} {quality} {hash} {hash8}
+
+--report json|csv|junit と --report-file を指定すると、ファイルごとの入出力パス、
+フォーマット、サイズ、削減率、処理時間、エラーと合計をCI向けの形式で書き出します。
+
+--dry-run を指定すると変換結果を破棄し、ファイルごとと合計の変換後サイズの見込みを
+表示します。出力ファイルとマニフェストは書き込みません。--tui とは同時に指定できません。
+
+入力と --output に s3://bucket/prefix を指定すると、S3互換ストレージ上のオブジェクトを
+ディレクトリとして変換します。接続先と認証情報は AWS_* 環境変数から読み込みます。
+
+入力に - を指定すると標準入力から読み込み、画像形式は内容から判別します。
+--output に - を指定するか標準入力で --output を省略すると、--format の形式で
+標準出力に書き出します。このときメッセージは標準エラー出力にのみ表示します。
 
 例:
   img-cli convert photo.png --format webp
+  img-cli convert photo.heic -f jpeg
+  img-cli convert scan.tiff -f png --pages all
+  img-cli convert icon.svg -f png --width 512
+  img-cli convert anim.gif -f webp
+  img-cli convert anim.gif -f png --poster --frame 3
   img-cli convert photo.jpg -f png -q 90
   img-cli convert images/ -f webp -r
-  img-cli convert images/ -f jpeg -r -o images_jpeg/`,
+  img-cli convert images/ -f jpeg -r -o images_jpeg/
+  img-cli convert images/ -f webp -r --incremental
+  img-cli convert images/ -f webp -r --include '**/*.png' --max-depth 2
+  img-cli convert icons/ -f png -r --width 512 --output-template '{dir}/{name}.{width}w.{ext}'
+  img-cli convert images/ -f webp -r --dry-run
+  img-cli convert images/ -f webp -r --report json --report-file report.json
+  img-cli convert s3://my-bucket/photos -f webp -r -o s3://my-bucket/webp
+  curl -s https://example.com/a.heic | img-cli convert - -f jpeg > a.jpg`,
 	Args: cobra.ExactArgs(1),
 	RunE: runConvert,
 }
 
 func init() {
-	convertCmd.Flags().StringVarP(&convertFormat, "format", "f", "", "出力フォーマット (jpeg/jpg/png/webp) [必須]")
+	convertCmd.Flags().StringVarP(&convertFormat, "format", "f", "", "出力フォーマット (jpeg/jpg/png/webp/tiff/tif/gif) [必須]")
 	convertCmd.Flags().IntVarP(&convertQuality, "quality", "q", 0, "JPEG/WebP品質 (1-100)。0の場合はlevelに基づく")
 	convertCmd.Flags().StringVarP(&convertLevel, "level", "l", "medium", "圧縮レベル (low/medium/high)")
 	convertCmd.Flags().StringVarP(&convertOutput, "output", "o", "", "出力パス (省略時は自動生成)")
 	convertCmd.Flags().BoolVarP(&convertRecursive, "recursive", "r", false, "ディレクトリを再帰的に処理する")
 	convertCmd.Flags().BoolVar(&convertUseTUI, "tui", false, "TUIモードでプログレスバーを表示する")
+	convertCmd.Flags().BoolVar(&convertToSRGB, "srgb", false, "埋め込みICCプロファイルを使ってsRGBに変換する")
+	convertCmd.Flags().BoolVar(&convertDither, "dither", false, "16bit画像をディザリングして8bitに減色する")
+	convertCmd.Flags().StringVar(&convertPages, "pages", "first", "マルチページ画像の変換対象ページ (first/all)")
+	convertCmd.Flags().IntVar(&convertWidth, "width", 0, "SVGの出力の幅 (px)。0の場合は元のサイズまたは縦横比に基づく")
+	convertCmd.Flags().IntVar(&convertHeight, "height", 0, "SVGの出力の高さ (px)。0の場合は元のサイズまたは縦横比に基づく")
+	convertCmd.Flags().Float64Var(&convertDPI, "dpi", 0, "SVGの描画解像度。0の場合は96")
+	convertCmd.Flags().BoolVar(&convertPoster, "poster", false, "アニメーションから1フレームだけを静止画として出力する")
+	convertCmd.Flags().IntVar(&convertFrame, "frame", 1, "--poster やJPEG/TIFF出力で使うアニメーションのフレーム番号 (1始まり)")
+	convertCmd.Flags().BoolVar(&convertIncremental, "incremental", false, "マニフェストを参照して前回から変更のないファイルをスキップする (ディレクトリ処理のみ)")
+	convertCmd.Flags().StringVar(&convertOutTemplate, "output-template", "", "出力パスのテンプレート (例: '{dir}/{name}.{width}w.{ext}')")
+	convertCmd.Flags().StringVar(&convertReport, "report", "", "処理結果のレポート形式 (json/csv/junit)")
+	convertCmd.Flags().StringVar(&convertReportFile, "report-file", "", "レポートの出力先ファイル")
+	convertCmd.Flags().BoolVar(&convertFailFast, "fail-fast", false, "最初の失敗で残りの処理を中止する (ディレクトリ処理のみ)")
+	convertCmd.Flags().StringVar(&convertMaxFailures, "max-failures", "", "失敗が指定件数 (例: 5) または割合 (例: 10%) を超えたら残りの処理を中止する (ディレクトリ処理のみ)")
+	convertCmd.Flags().IntVar(&convertRetries, "retries", 0, "一時的なI/Oエラーで失敗したファイルを再試行する回数 (ディレクトリ処理のみ)")
+	convertCmd.Flags().BoolVar(&convertDryRun, "dry-run", false, "ファイルを書き込まずに変換後のサイズの見込みを表示する")
+	convertCmd.Flags().IntVar(&convertMemoryLimit, "memory-limit", 0, "同時に処理する画像のデコード後の推定メモリ上限 (MiB)。0は無制限")
+	convertScan.register(convertCmd)
 	_ = convertCmd.MarkFlagRequired("format")
 }
 
@@ -57,6 +143,24 @@ func bindConvertFlags() {
 	_ = viper.BindPFlag("convert.level", convertCmd.Flags().Lookup("level"))
 	_ = viper.BindPFlag("convert.output", convertCmd.Flags().Lookup("output"))
 	_ = viper.BindPFlag("convert.recursive", convertCmd.Flags().Lookup("recursive"))
+	_ = viper.BindPFlag("convert.srgb", convertCmd.Flags().Lookup("srgb"))
+	_ = viper.BindPFlag("convert.dither", convertCmd.Flags().Lookup("dither"))
+	_ = viper.BindPFlag("convert.pages", convertCmd.Flags().Lookup("pages"))
+	_ = viper.BindPFlag("convert.width", convertCmd.Flags().Lookup("width"))
+	_ = viper.BindPFlag("convert.height", convertCmd.Flags().Lookup("height"))
+	_ = viper.BindPFlag("convert.dpi", convertCmd.Flags().Lookup("dpi"))
+	_ = viper.BindPFlag("convert.poster", convertCmd.Flags().Lookup("poster"))
+	_ = viper.BindPFlag("convert.frame", convertCmd.Flags().Lookup("frame"))
+	_ = viper.BindPFlag("convert.incremental", convertCmd.Flags().Lookup("incremental"))
+	_ = viper.BindPFlag("convert.output_template", convertCmd.Flags().Lookup("output-template"))
+	_ = viper.BindPFlag("convert.report", convertCmd.Flags().Lookup("report"))
+	_ = viper.BindPFlag("convert.dry_run", convertCmd.Flags().Lookup("dry-run"))
+	_ = viper.BindPFlag("convert.report_file", convertCmd.Flags().Lookup("report-file"))
+	_ = viper.BindPFlag("convert.memory_limit", convertCmd.Flags().Lookup("memory-limit"))
+	_ = viper.BindPFlag("convert.fail_fast", convertCmd.Flags().Lookup("fail-fast"))
+	_ = viper.BindPFlag("convert.max_failures", convertCmd.Flags().Lookup("max-failures"))
+	_ = viper.BindPFlag("convert.retries", convertCmd.Flags().Lookup("retries"))
+	bindScanFlags(convertCmd, "convert")
 }
 
 // parseImageFormat parses a string into an ImageFormat.
@@ -68,20 +172,44 @@ func parseImageFormat(s string) (processor.ImageFormat, error) {
 		return processor.FormatPNG, nil
 	case "webp":
 		return processor.FormatWEBP, nil
+	case "tiff", "tif":
+		return processor.FormatTIFF, nil
+	case "gif":
+		return processor.FormatGIF, nil
 	default:
-		return 0, fmt.Errorf("不正なフォーマットです: %q (jpeg/jpg/png/webp を指定してください)", s)
+		return 0, fmt.Errorf("不正なフォーマットです: %q (jpeg/jpg/png/webp/tiff/tif/gif を指定してください)", s)
+	}
+}
+
+// parsePages reports whether all pages of multi-page inputs should be converted.
+func parsePages(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "first":
+		return false, nil
+	case "all":
+		return true, nil
+	default:
+		return false, fmt.Errorf("不正なページ指定です: %q (first/all を指定してください)", s)
 	}
 }
 
 func runConvert(cmd *cobra.Command, args []string) error {
 	inputPath := args[0]
 
-	info, err := os.Stat(inputPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("入力パスが存在しません: %s", inputPath)
+	// S3 URIs name a prefix of a bucket and are always processed as directories.
+	isDir := isS3URI(inputPath)
+	if !isDir && inputPath != stdioPath {
+		info, err := os.Stat(inputPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("入力パスが存在しません: %s", inputPath)
+			}
+			return fmt.Errorf("入力パスの確認に失敗しました: %w", err)
 		}
-		return fmt.Errorf("入力パスの確認に失敗しました: %w", err)
+		isDir = info.IsDir()
+	}
+	if err := rejectTUIDryRun(convertUseTUI, viper.GetBool("convert.dry_run")); err != nil {
+		return err
 	}
 
 	f := viper.GetString("convert.format")
@@ -102,21 +230,56 @@ func runConvert(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("品質は1〜100の範囲で指定してください (指定値: %d)", q)
 	}
 
+	allPages, err := parsePages(viper.GetString("convert.pages"))
+	if err != nil {
+		return err
+	}
+
+	width := viper.GetInt("convert.width")
+	height := viper.GetInt("convert.height")
+	if width < 0 || height < 0 {
+		return fmt.Errorf("幅と高さは0以上で指定してください (指定値: %dx%d)", width, height)
+	}
+
+	dpi := viper.GetFloat64("convert.dpi")
+	if dpi < 0 {
+		return fmt.Errorf("DPIは0以上で指定してください (指定値: %g)", dpi)
+	}
+
+	frame := viper.GetInt("convert.frame")
+	if frame < 1 {
+		return fmt.Errorf("フレーム番号は1以上で指定してください (指定値: %d)", frame)
+	}
+
 	opts := processor.ConvertOptions{
 		Format: targetFormat,
 		CompressOptions: processor.CompressOptions{
-			Quality: q,
-			Level:   compLevel,
+			Quality:       q,
+			Level:         compLevel,
+			ConvertToSRGB: viper.GetBool("convert.srgb"),
+			DitherTo8Bit:  viper.GetBool("convert.dither"),
+			Width:         width,
+			Height:        height,
+			DPI:           dpi,
+			Page:          frame - 1,
+			Poster:        viper.GetBool("convert.poster"),
 		},
 	}
 
-	if info.IsDir() {
-		return convertDirectory(cmd, inputPath, targetFormat, opts)
+	if usesStdio(inputPath, viper.GetString("convert.output")) {
+		if isDir {
+			return fmt.Errorf("ディレクトリの処理結果は標準出力に書き出せません")
+		}
+		return convertStdio(cmd, inputPath, targetFormat, opts, allPages)
 	}
-	return convertSingleFile(cmd, inputPath, targetFormat, opts)
+
+	if isDir {
+		return convertDirectory(cmd, inputPath, targetFormat, opts, allPages)
+	}
+	return convertSingleFile(cmd, inputPath, targetFormat, opts, allPages)
 }
 
-func convertSingleFile(cmd *cobra.Command, inputPath string, targetFormat processor.ImageFormat, opts processor.ConvertOptions) error {
+func convertSingleFile(cmd *cobra.Command, inputPath string, targetFormat processor.ImageFormat, opts processor.ConvertOptions, allPages bool) error {
 	srcFormat, err := detectFormat(inputPath)
 	if err != nil {
 		return err
@@ -126,58 +289,89 @@ func convertSingleFile(cmd *cobra.Command, inputPath string, targetFormat proces
 		return fmt.Errorf("入力ファイルは既に%sフォーマットです。同一フォーマットの圧縮にはcompressコマンドを使用してください", targetFormat)
 	}
 
+	tmpl, err := outputTemplate("convert")
+	if err != nil {
+		return err
+	}
 	outputPath := viper.GetString("convert.output")
-	if outputPath == "" {
+	switch {
+	case tmpl != nil:
+		if outputPath != "" {
+			return fmt.Errorf("--output-template と --output は同時に指定できません")
+		}
+		if outputPath, err = tmpl.Expand("", inputPath, targetFormat, opts.CompressOptions); err != nil {
+			return fmt.Errorf("出力パスの生成に失敗しました: %w", err)
+		}
+	case outputPath == "":
 		outputPath = defaultConvertOutputPath(inputPath, targetFormat)
 	}
 
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
-		return fmt.Errorf("出力ディレクトリの作成に失敗しました: %w", err)
-	}
-
-	inFile, err := os.Open(inputPath)
+	report, err := loadReportConfig("convert")
 	if err != nil {
-		return fmt.Errorf("入力ファイルを開けません: %w", err)
+		return err
 	}
-	defer func() { _ = inFile.Close() }()
+	dry := viper.GetBool("convert.dry_run")
+	report.dryRun = dry
 
-	outFile, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("出力ファイルの作成に失敗しました: %w", err)
+	pages := 1
+	if allPages {
+		pages, err = countPages(inputPath)
+		if err != nil {
+			return err
+		}
 	}
 
-	// Select processor based on output format.
-	var proc processor.Processor
-	switch targetFormat {
-	case processor.FormatJPEG:
-		proc = processor.NewJPEGProcessor()
-	case processor.FormatPNG:
-		proc = processor.NewPNGProcessor()
-	case processor.FormatWEBP:
-		proc = processor.NewWEBPProcessor()
+	bpOpts := []processor.BatchProcessorOption{processor.WithMaxWorkers(1), processor.WithFailFast()}
+	if dry {
+		bpOpts = append(bpOpts, processor.WithOutputSink(processor.DiscardSink))
 	}
 
-	result, err := proc.Convert(cmd.Context(), inFile, outFile, opts)
+	start := time.Now()
+	bp := processor.NewDefaultBatchProcessor(bpOpts...)
+	results, err := bp.ProcessBatch(cmd.Context(), processor.PageItems(inputPath, outputPath, pages, opts))
 	if err != nil {
-		_ = outFile.Close()
-		_ = os.Remove(outputPath)
 		return fmt.Errorf("変換に失敗しました: %w", err)
 	}
-
-	if err := outFile.Close(); err != nil {
-		_ = os.Remove(outputPath)
-		return fmt.Errorf("出力ファイルの書き込みに失敗しました: %w", err)
+	if err := report.writeReport(results, time.Since(start)); err != nil {
+		return err
 	}
 
 	out := cmd.OutOrStdout()
-	_, _ = fmt.Fprintf(out, "変換完了: %s → %s\n", inputPath, outputPath)
-	_, _ = fmt.Fprintf(out, "  元サイズ: %d bytes\n", result.OriginalSize)
-	_, _ = fmt.Fprintf(out, "  変換後: %d bytes\n", result.CompressedSize)
-	_, _ = fmt.Fprintf(out, "  フォーマット: %s → %s\n", srcFormat, targetFormat)
+	for _, res := range results {
+		if res.Error != nil {
+			return fmt.Errorf("変換に失敗しました: %w", res.Error)
+		}
+		if dry {
+			continue
+		}
+		_, _ = fmt.Fprintf(out, "変換完了: %s → %s\n", inputPath, res.Item.OutputPath)
+		_, _ = fmt.Fprintf(out, "  元サイズ: %d bytes\n", res.Result.OriginalSize)
+		_, _ = fmt.Fprintf(out, "  変換後: %d bytes\n", res.Result.CompressedSize)
+		_, _ = fmt.Fprintf(out, "  フォーマット: %s → %s\n", srcFormat, targetFormat)
+	}
 
+	if dry {
+		_, _ = fmt.Fprintln(out, dryRunHeader)
+		printDryRun(out, results)
+	}
 	return nil
 }
 
+// countPages returns the number of pages in the image file at path.
+func countPages(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("入力ファイルを開けません: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	pages, err := processor.PageCount(f)
+	if err != nil {
+		return 0, fmt.Errorf("ページ数の取得に失敗しました: %w", err)
+	}
+	return pages, nil
+}
+
 // defaultConvertOutputPath generates a default output path by changing the extension to the target format.
 func defaultConvertOutputPath(inputPath string, format processor.ImageFormat) string {
 	ext := filepath.Ext(inputPath)
@@ -185,7 +379,7 @@ func defaultConvertOutputPath(inputPath string, format processor.ImageFormat) st
 	return base + format.Extension()
 }
 
-func convertDirectory(cmd *cobra.Command, inputDir string, targetFormat processor.ImageFormat, opts processor.ConvertOptions) error {
+func convertDirectory(cmd *cobra.Command, inputDir string, targetFormat processor.ImageFormat, opts processor.ConvertOptions, allPages bool) error {
 	r := viper.GetBool("convert.recursive")
 	if !r {
 		return fmt.Errorf("ディレクトリを処理するには --recursive (-r) フラグが必要です")
@@ -193,52 +387,144 @@ func convertDirectory(cmd *cobra.Command, inputDir string, targetFormat processo
 
 	outputDir := viper.GetString("convert.output")
 	if outputDir == "" {
-		outputDir = filepath.Clean(inputDir) + "_converted"
+		outputDir = defaultOutputDir(inputDir, "_converted")
+	}
+	store, inputDir, outputDir, err := batchStorage(inputDir, outputDir)
+	if err != nil {
+		return err
+	}
+	if _, local := store.(processor.LocalStorage); !local {
+		if err := rejectFlags("convert", "S3 のパス", "incremental"); err != nil {
+			return err
+		}
 	}
 
-	items, err := processor.ScanDirectoryForConvert(inputDir, outputDir, targetFormat, processor.WithConvertOptions(opts))
+	filter, err := scanFilter("convert")
 	if err != nil {
-		return fmt.Errorf("ディレクトリのスキャンに失敗しました: %w", err)
+		return err
+	}
+	report, err := loadReportConfig("convert")
+	if err != nil {
+		return err
+	}
+	memOpts, err := memoryBudgetOptions("convert")
+	if err != nil {
+		return err
+	}
+	policyOpts, err := failurePolicyOptions("convert")
+	if err != nil {
+		return err
+	}
+	retryOpts, err := retryOptions("convert")
+	if err != nil {
+		return err
+	}
+	manifest, manifestPath, err := loadManifest(viper.GetBool("convert.incremental"), outputDir)
+	if err != nil {
+		return err
+	}
+
+	scanOpts := []processor.ScanDirectoryForConvertOption{
+		processor.WithConvertOptions(opts),
+		processor.WithConvertManifest(manifest),
+		processor.WithConvertFilter(filter),
+		processor.WithConvertScanStorage(store),
+		processor.WithConvertScanContext(cmd.Context()),
+	}
+	if allPages {
+		scanOpts = append(scanOpts, processor.WithAllPages())
+	}
+	tmpl, err := outputTemplate("convert")
+	if err != nil {
+		return err
+	}
+	if tmpl != nil {
+		scanOpts = append(scanOpts, processor.WithConvertOutputTemplate(tmpl))
+	}
+
+	items, err := startScan(processor.ScanDirectoryForConvertSeq(inputDir, outputDir, targetFormat, scanOpts...))
+	if err != nil {
+		return err
+	}
+	defer items.close()
+
+	run := batchRun{
+		opts:         slices.Concat(memOpts, policyOpts, retryOpts, []processor.BatchProcessorOption{processor.WithStorage(store)}),
+		manifest:     manifest,
+		manifestPath: manifestPath,
+		dryRun:       viper.GetBool("convert.dry_run"),
+		report:       report,
+	}
+	run.report.dryRun = run.dryRun
+	run.report.manifest = manifest
+	if manifest != nil {
+		run.opts = append(run.opts, processor.WithInputHashes())
+	}
+	if run.dryRun {
+		run.opts = append(run.opts, processor.WithOutputSink(processor.DiscardSink))
 	}
 
 	out := cmd.OutOrStdout()
 
-	if len(items) == 0 {
+	if items == nil {
+		if err := run.report.writeReport(nil, 0); err != nil {
+			return err
+		}
+		if manifest != nil && manifest.Skipped() > 0 {
+			_, _ = fmt.Fprintf(out, "前回から変更された画像ファイルはありません (変更なし %d 件)\n", manifest.Skipped())
+			return nil
+		}
 		_, _ = fmt.Fprintln(out, "変換対象の画像ファイルが見つかりませんでした")
 		return nil
 	}
 
+	process := items.process(cmd.Context())
+	if run.dryRun {
+		return directoryDryRun(cmd, run, "変換", process)
+	}
 	if convertUseTUI {
-		return convertDirectoryWithTUI(cmd, items)
+		return convertDirectoryWithTUI(cmd, run, process)
 	}
-	return convertDirectoryWithText(cmd, items)
+	return convertDirectoryWithText(cmd, run, process)
 }
 
-func convertDirectoryWithText(cmd *cobra.Command, items []processor.BatchConvertItem) error {
+func convertDirectoryWithText(cmd *cobra.Command, run batchRun, process func(*processor.DefaultBatchProcessor) ([]processor.BatchResult, error)) error {
 	out := cmd.OutOrStdout()
 	errOut := cmd.ErrOrStderr()
 
-	_, _ = fmt.Fprintf(out, "%d 個の画像ファイルを変換します...\n", len(items))
+	_, _ = fmt.Fprintln(out, "画像ファイルを変換します...")
 
 	var mu sync.Mutex
-	bp := processor.NewDefaultBatchProcessor(
+	var last processor.Progress
+	bp := processor.NewDefaultBatchProcessor(append(run.opts,
 		processor.WithProgressCallback(func(p processor.Progress) {
 			mu.Lock()
 			defer mu.Unlock()
-			_, _ = fmt.Fprintf(out, "  [%d/%d] %s\n", p.Completed+p.Failed, p.Total, p.Current)
+			last = p
+			_, _ = fmt.Fprintf(out, "  %s %s (%s)\n", tui.Count(p), p.Current, tui.Throughput(p))
 		}),
-	)
+	)...)
 
-	results, err := bp.ProcessBatchConvert(cmd.Context(), items)
+	start := time.Now()
+	results, err := process(bp)
 	if err != nil {
 		return fmt.Errorf("バッチ変換に失敗しました: %w", err)
 	}
+	if err := run.saveManifest(results); err != nil {
+		return err
+	}
+	if err := run.report.writeReport(results, time.Since(start)); err != nil {
+		return err
+	}
 
 	successCount := 0
 	failCount := 0
+	abortCount := 0
 	for _, res := range results {
 		if res.IsSuccess() {
 			successCount++
+		} else if res.Aborted {
+			abortCount++
 		} else {
 			failCount++
 			_, _ = fmt.Fprintf(errOut, "  エラー: %s: %v\n", res.Item.InputPath, res.Error)
@@ -246,6 +532,11 @@ func convertDirectoryWithText(cmd *cobra.Command, items []processor.BatchConvert
 	}
 
 	_, _ = fmt.Fprintf(out, "完了: 成功 %d, 失敗 %d\n", successCount, failCount)
+	if abortCount > 0 {
+		_, _ = fmt.Fprintln(out, tui.AbortedMessage(abortCount))
+	}
+	printStats(out, last, results)
+	run.printUnchanged(cmd)
 
 	if failCount > 0 {
 		return fmt.Errorf("%d 件の画像の変換に失敗しました", failCount)
@@ -254,43 +545,34 @@ func convertDirectoryWithText(cmd *cobra.Command, items []processor.BatchConvert
 	return nil
 }
 
-// convertResultsToBatchResults converts BatchConvertResult slice to BatchResult slice for TUI compatibility.
-func convertResultsToBatchResults(results []processor.BatchConvertResult) []processor.BatchResult {
-	batchResults := make([]processor.BatchResult, len(results))
-	for i, r := range results {
-		batchResults[i] = processor.BatchResult{
-			Item: processor.BatchItem{
-				InputPath:  r.Item.InputPath,
-				OutputPath: r.Item.OutputPath,
-			},
-			Result: r.Result,
-			Error:  r.Error,
-		}
-	}
-	return batchResults
-}
-
-func convertDirectoryWithTUI(cmd *cobra.Command, items []processor.BatchConvertItem) error {
+func convertDirectoryWithTUI(cmd *cobra.Command, run batchRun, process func(*processor.DefaultBatchProcessor) ([]processor.BatchResult, error)) error {
 	m := tui.NewModel()
 	p := tea.NewProgram(m)
 
 	go func() {
-		p.Send(tui.BatchStartMsg{TotalFiles: len(items)})
+		p.Send(tui.BatchStartMsg{})
 
-		bp := processor.NewDefaultBatchProcessor(
+		bp := processor.NewDefaultBatchProcessor(append(run.opts,
 			processor.WithProgressCallback(func(prog processor.Progress) {
 				p.Send(tui.ProgressMsg{Progress: prog})
 			}),
-		)
+		)...)
 
-		results, err := bp.ProcessBatchConvert(cmd.Context(), items)
+		start := time.Now()
+		results, err := process(bp)
+		if err == nil {
+			err = run.saveManifest(results)
+		}
+		if err == nil {
+			err = run.report.writeReport(results, time.Since(start))
+		}
 		if err != nil {
 			p.Send(tui.BatchErrorMsg{Err: err})
 			return
 		}
 
 		p.Send(tui.BatchCompleteMsg{
-			Results: convertResultsToBatchResults(results),
+			Results: results,
 		})
 	}()
 
@@ -303,6 +585,7 @@ func convertDirectoryWithTUI(cmd *cobra.Command, items []processor.BatchConvertI
 	if fm.Err() != nil {
 		return fmt.Errorf("バッチ変換に失敗しました: %w", fm.Err())
 	}
+	run.printUnchanged(cmd)
 
 	if fm.Failed() > 0 {
 		return fmt.Errorf("%d 件の画像の変換に失敗しました", fm.Failed())
@@ -2,10 +2,17 @@ package cli
 
 import (
 	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/gif"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	"golang.org/x/image/bmp"
 )
 
 // executeConvert resets globals, sets args, executes the root command and
@@ -277,6 +284,138 @@ func TestE2E_Convert_ディレクトリ変換_同一フォーマットスキッ
 	}
 }
 
+func TestE2E_Convert_ディレクトリ変換_インクリメンタル(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "output")
+
+	setupTestDir(t, inputDir, map[string][]byte{
+		"photo.jpg": createTestJPEG(t, 30, 30, 80),
+		"icon.png":  createTestPNG(t, 30, 30),
+	})
+
+	for run, want := range []string{"成功 2", "変更なし 2 件"} {
+		out, err := executeConvert(t, "convert", inputDir, "-f", "webp", "-r", "-o", outputDir, "--incremental")
+		if err != nil {
+			t.Fatalf("run %d: Execute() error = %v", run, err)
+		}
+		if !strings.Contains(out, want) {
+			t.Errorf("run %d: 出力に %q が含まれていません: %s", run, want, out)
+		}
+	}
+}
+
+func TestE2E_Convert_ディレクトリ変換_スキャンフィルタ(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "output")
+
+	setupTestDir(t, inputDir, map[string][]byte{
+		"photo.jpg":       createTestJPEG(t, 30, 30, 80),
+		".cache/tmp.jpg":  createTestJPEG(t, 30, 30, 80),
+		"sub/nested.png":  createTestPNG(t, 30, 30),
+		"sub/skip_me.png": createTestPNG(t, 30, 30),
+	})
+
+	out, err := executeConvert(t, "convert", inputDir, "-f", "webp", "-r", "-o", outputDir,
+		"--skip-hidden", "--exclude", "skip_*")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !strings.Contains(out, "成功 2") {
+		t.Errorf("出力に「成功 2」が含まれていません: %s", out)
+	}
+	for _, rel := range []string{".cache/tmp.webp", "sub/skip_me.webp"} {
+		if _, err := os.Stat(filepath.Join(outputDir, rel)); !os.IsNotExist(err) {
+			t.Errorf("除外したファイルが出力されています: %s", rel)
+		}
+	}
+}
+
+func TestE2E_Convert_出力テンプレート(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "output")
+	setupTestDir(t, inputDir, map[string][]byte{
+		"photo.jpg":    createTestJPEG(t, 40, 20, 80),
+		"sub/icon.svg": []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 32 16"><rect width="32" height="16" fill="#f00"/></svg>`),
+	})
+
+	if _, err := executeConvert(t, "convert", inputDir, "-f", "webp", "-r", "-o", outputDir, "--width", "20",
+		"--output-template", "{format}/{dir}/{name}.{width}w.{ext}"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	// --width はSVGの描画サイズにだけ適用される
+	verifyImageFile(t, filepath.Join(outputDir, "webp", "photo.40w.webp"), "webp")
+	verifyImageFile(t, filepath.Join(outputDir, "webp", "sub", "icon.20w.webp"), "webp")
+}
+
+func TestE2E_Convert_レポート出力(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{
+		"photo.jpg": createTestJPEG(t, 30, 30, 80),
+		"icon.png":  createTestPNG(t, 30, 30),
+	})
+
+	tests := []struct {
+		name  string
+		input string
+		want  int
+	}{
+		{name: "ディレクトリ", input: inputDir, want: 2},
+		{name: "単一ファイル", input: filepath.Join(inputDir, "photo.jpg"), want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reportPath := filepath.Join(t.TempDir(), "report.json")
+			if _, err := executeConvert(t, "convert", tt.input, "-f", "webp", "-r", "-o", filepath.Join(t.TempDir(), "out.webp"),
+				"--report", "json", "--report-file", reportPath); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			data, err := os.ReadFile(reportPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var report batchReport
+			if err := json.Unmarshal(data, &report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Command != "convert" || report.Totals.Succeeded != tt.want {
+				t.Errorf("report = %+v, want %d converted items", report, tt.want)
+			}
+			for _, it := range report.Items {
+				if it.Format != "webp" {
+					t.Errorf("item format = %q, want webp", it.Format)
+				}
+			}
+		})
+	}
+}
+
+func TestE2E_Convert_S3(t *testing.T) {
+	srv := startFakeS3(t)
+	srv.Put("bucket", "in/a.jpg", createTestJPEG(t, 20, 20, 90))
+	srv.Put("bucket", "in/b.png", createTestPNG(t, 20, 20))
+
+	out, err := executeConvert(t, "convert", "s3://bucket/in/", "-f", "png", "-r", "-o", "s3://bucket/out")
+	if err != nil {
+		t.Fatalf("convert error = %v\n%s", err, out)
+	}
+	data, ok := srv.Object("bucket", "out/a.png")
+	if !ok {
+		t.Fatalf("out/a.png was not uploaded; keys = %v", srv.Keys("bucket"))
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || format != "png" {
+		t.Errorf("out/a.png format = %q, %v, want png", format, err)
+	}
+	if _, ok := srv.Object("bucket", "out/b.png"); ok {
+		t.Error("an input already in the target format was converted")
+	}
+
+	_, err = executeConvert(t, "convert", "s3://bucket/in", "-f", "png", "-r", "--incremental")
+	if err == nil || !strings.Contains(err.Error(), "--incremental は S3 のパスには使用できません") {
+		t.Errorf("error = %v, want incremental to be rejected", err)
+	}
+}
+
 func TestE2E_Convert_空ディレクトリ(t *testing.T) {
 	inputDir := t.TempDir()
 
@@ -290,6 +429,56 @@ func TestE2E_Convert_空ディレクトリ(t *testing.T) {
 	}
 }
 
+func TestE2E_Convert_ドライラン(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{
+		"photo.jpg":    createTestJPEG(t, 60, 60, 100),
+		"sub/icon.png": createTestPNG(t, 30, 30),
+	})
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "ディレクトリ", args: []string{"convert", inputDir, "-f", "webp", "-r", "--incremental", "--dry-run"}},
+		{name: "単一ファイル", args: []string{"convert", filepath.Join(inputDir, "photo.jpg"), "-f", "webp", "--dry-run"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := executeConvert(t, tt.args...)
+			if err != nil {
+				t.Fatalf("Execute() error = %v\noutput:\n%s", err, out)
+			}
+			for _, want := range []string{"ドライラン", filepath.Join(inputDir, "photo.jpg") + ":", "合計:"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("出力に %q が含まれていません: %s", want, out)
+				}
+			}
+			for _, path := range []string{inputDir + "_converted", filepath.Join(inputDir, "photo.webp")} {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("ドライランで %s が作成されています", path)
+				}
+			}
+		})
+	}
+}
+
+func TestE2E_TUIとドライランの併用エラー(t *testing.T) {
+	inputDir := t.TempDir()
+	setupTestDir(t, inputDir, map[string][]byte{"photo.jpg": createTestJPEG(t, 10, 10, 90)})
+
+	for _, args := range [][]string{
+		{"compress", inputDir, "-r", "--tui", "--dry-run"},
+		{"convert", inputDir, "-f", "webp", "-r", "--tui", "--dry-run"},
+	} {
+		_, err := executeConvert(t, args...)
+		if err == nil || !strings.Contains(err.Error(), "--tui と --dry-run は同時に指定できません") {
+			t.Errorf("%s: error = %v, want --tui/--dry-run conflict", args[0], err)
+		}
+	}
+}
+
 func TestE2E_Convert_ディレクトリ変換_出力パス自動生成(t *testing.T) {
 	base := t.TempDir()
 	inputDir := filepath.Join(base, "images")
@@ -385,8 +574,8 @@ func TestE2E_Convert_エラーハンドリング(t *testing.T) {
 	if err := os.WriteFile(validJPEG, createTestJPEG(t, 10, 10, 80), 0o644); err != nil {
 		t.Fatal(err)
 	}
-	bmpFile := filepath.Join(tmpDir, "test.bmp")
-	if err := os.WriteFile(bmpFile, []byte("not a bmp"), 0o644); err != nil {
+	avifFile := filepath.Join(tmpDir, "test.avif")
+	if err := os.WriteFile(avifFile, []byte("not an avif"), 0o644); err != nil {
 		t.Fatal(err)
 	}
 	emptyDir := filepath.Join(tmpDir, "emptydir")
@@ -422,8 +611,28 @@ func TestE2E_Convert_エラーハンドリング(t *testing.T) {
 			wantInErr: "品質は1〜100の範囲",
 		},
 		{
-			name:      "非対応フォーマットbmp",
-			args:      []string{"convert", bmpFile, "-f", "png"},
+			name:      "負の幅",
+			args:      []string{"convert", validJPEG, "-f", "png", "--width", "-1"},
+			wantInErr: "幅と高さは0以上",
+		},
+		{
+			name:      "負のDPI",
+			args:      []string{"convert", validJPEG, "-f", "png", "--dpi", "-1"},
+			wantInErr: "DPIは0以上",
+		},
+		{
+			name:      "不正なframe値",
+			args:      []string{"convert", validJPEG, "-f", "png", "--frame", "0"},
+			wantInErr: "フレーム番号は1以上",
+		},
+		{
+			name:      "不正なpages値",
+			args:      []string{"convert", validJPEG, "-f", "png", "--pages", "odd"},
+			wantInErr: "不正なページ指定",
+		},
+		{
+			name:      "非対応フォーマットavif",
+			args:      []string{"convert", avifFile, "-f", "png"},
 			wantInErr: "サポートされていない画像形式",
 		},
 		{
@@ -445,3 +654,312 @@ func TestE2E_Convert_エラーハンドリング(t *testing.T) {
 		})
 	}
 }
+
+func TestE2E_Convert_HEIC_to_JPEG(t *testing.T) {
+	heicData, err := os.ReadFile(filepath.Join("..", "..", "pkg", "processor", "testdata", "sample.heic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "IMG_0001.heic")
+	if err := os.WriteFile(inputPath, heicData, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := executeConvert(t, "convert", inputPath, "-f", "jpeg")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	verifyImageFile(t, filepath.Join(tmpDir, "IMG_0001.jpg"), "jpeg")
+
+	if !strings.Contains(out, "heic → jpeg") {
+		t.Errorf("出力にフォーマット変換情報が含まれていません: %s", out)
+	}
+}
+
+func TestE2E_Compress_HEICは非対応(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "IMG_0001.heic")
+	if err := os.WriteFile(inputPath, []byte("dummy"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := executeCompress(t, "compress", inputPath)
+	if err == nil {
+		t.Fatal("HEICの圧縮はエラーになるべきです")
+	}
+	if !strings.Contains(err.Error(), "convert") {
+		t.Errorf("エラーメッセージにconvertコマンドの案内が含まれていません: %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(tmpDir, "IMG_0001_compressed.heic")); !os.IsNotExist(statErr) {
+		t.Error("出力ファイルが作成されるべきではありません")
+	}
+}
+
+// loadMultipageTIFF reads the 3-page TIFF sample from the processor testdata.
+func loadMultipageTIFF(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "pkg", "processor", "testdata", "multipage.tiff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestE2E_Convert_TIFF_1ページ目のみ(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "scan.tiff")
+	if err := os.WriteFile(inputPath, loadMultipageTIFF(t), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := executeConvert(t, "convert", inputPath, "-f", "png"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	verifyImageFile(t, filepath.Join(tmpDir, "scan.png"), "png")
+	if _, err := os.Stat(filepath.Join(tmpDir, "scan_p2.png")); !os.IsNotExist(err) {
+		t.Error("--pages first では2ページ目を出力するべきではありません")
+	}
+}
+
+func TestE2E_Convert_TIFF_全ページ(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "scan.tiff")
+	if err := os.WriteFile(inputPath, loadMultipageTIFF(t), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := executeConvert(t, "convert", inputPath, "-f", "jpeg", "--pages", "all")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	for _, name := range []string{"scan_p1.jpg", "scan_p2.jpg", "scan_p3.jpg"} {
+		verifyImageFile(t, filepath.Join(tmpDir, name), "jpeg")
+	}
+	if !strings.Contains(out, "tiff → jpeg") {
+		t.Errorf("出力にフォーマット変換情報が含まれていません: %s", out)
+	}
+}
+
+func TestE2E_Convert_ディレクトリ変換_TIFF全ページとBMP(t *testing.T) {
+	inputDir := filepath.Join(t.TempDir(), "scans")
+	outputDir := filepath.Join(t.TempDir(), "out")
+	var bmpBuf bytes.Buffer
+	if err := bmp.Encode(&bmpBuf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	setupTestDir(t, inputDir, map[string][]byte{
+		"scan.tif": loadMultipageTIFF(t),
+		"old.bmp":  bmpBuf.Bytes(),
+	})
+
+	if _, err := executeConvert(t, "convert", inputDir, "-f", "png", "-r", "-o", outputDir, "--pages", "all"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	for _, name := range []string{"scan_p1.png", "scan_p2.png", "scan_p3.png", "old.png"} {
+		verifyImageFile(t, filepath.Join(outputDir, name), "png")
+	}
+}
+
+func TestE2E_Convert_PNG_to_TIFF(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "photo.png")
+	if err := os.WriteFile(inputPath, createTestPNG(t, 10, 10), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := executeConvert(t, "convert", inputPath, "-f", "tif"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	verifyImageFile(t, filepath.Join(tmpDir, "photo.tiff"), "tiff")
+}
+
+func TestE2E_Convert_SVG_to_PNG_幅指定(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "icon.svg")
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 32 16"><rect width="32" height="16" fill="#f00"/></svg>`
+	if err := os.WriteFile(inputPath, []byte(svg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := executeConvert(t, "convert", inputPath, "-f", "png", "--width", "512")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	outputPath := filepath.Join(tmpDir, "icon.png")
+	verifyImageFile(t, outputPath, "png")
+	f, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 512 || cfg.Height != 256 {
+		t.Errorf("出力サイズ = %dx%d, want 512x256", cfg.Width, cfg.Height)
+	}
+	if !strings.Contains(out, "svg → png") {
+		t.Errorf("出力にフォーマット変換情報が含まれていません: %s", out)
+	}
+}
+
+func TestE2E_Convert_SVG_外部参照は拒否(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "logo.svg")
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><image href="file:///etc/passwd" width="10" height="10"/></svg>`
+	if err := os.WriteFile(inputPath, []byte(svg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := executeConvert(t, "convert", inputPath, "-f", "png")
+	if err == nil {
+		t.Fatal("外部参照を含むSVGはエラーになるべきです")
+	}
+	if !strings.Contains(err.Error(), "external references") {
+		t.Errorf("エラーメッセージに外部参照の情報が含まれていません: %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(tmpDir, "logo.png")); !os.IsNotExist(statErr) {
+		t.Error("出力ファイルが作成されるべきではありません")
+	}
+}
+
+// createTestAnimatedGIF creates an animated GIF with the given number of frames,
+// each filled with a different gray level and shown for 100ms.
+func createTestAnimatedGIF(t *testing.T, frames int) []byte {
+	t.Helper()
+	pal := color.Palette{color.Black, color.Gray{Y: 128}, color.White}
+	g := &gif.GIF{}
+	for i := range frames {
+		img := image.NewPaletted(image.Rect(0, 0, 12, 8), pal)
+		for p := range img.Pix {
+			img.Pix[p] = uint8(i % len(pal))
+		}
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// frameCount returns the number of animation frames in the image file at path.
+func frameCount(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	anim, err := processor.DecodeAnimation(f)
+	if err != nil {
+		t.Fatalf("アニメーションのデコードに失敗しました (%s): %v", path, err)
+	}
+	return len(anim.Frames)
+}
+
+func TestE2E_Convert_アニメーションGIF_フレーム保持(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		output string
+	}{
+		{name: "WebP", format: "webp", output: "anim.webp"},
+		{name: "APNG", format: "png", output: "anim.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			inputPath := filepath.Join(tmpDir, "anim.gif")
+			if err := os.WriteFile(inputPath, createTestAnimatedGIF(t, 3), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := executeConvert(t, "convert", inputPath, "-f", tt.format)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if got := frameCount(t, filepath.Join(tmpDir, tt.output)); got != 3 {
+				t.Errorf("フレーム数 = %d, want 3", got)
+			}
+			if !strings.Contains(out, "gif → "+tt.format) {
+				t.Errorf("出力にフォーマット変換情報が含まれていません: %s", out)
+			}
+		})
+	}
+}
+
+func TestE2E_Convert_アニメーション_ポスター画像(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "anim.gif")
+	if err := os.WriteFile(inputPath, createTestAnimatedGIF(t, 3), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := executeConvert(t, "convert", inputPath, "-f", "png", "--poster", "--frame", "3"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	outputPath := filepath.Join(tmpDir, "anim.png")
+	if got := frameCount(t, outputPath); got != 1 {
+		t.Errorf("フレーム数 = %d, want 1", got)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r>>8 != 255 {
+		t.Errorf("3フレーム目(白)が出力されていません: r = %d", r>>8)
+	}
+}
+
+func TestE2E_Compress_アニメーションGIF(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "anim.gif")
+	if err := os.WriteFile(inputPath, createTestAnimatedGIF(t, 4), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := executeConvert(t, "compress", inputPath); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	outputPath := filepath.Join(tmpDir, "anim_compressed.gif")
+	verifyImageFile(t, outputPath, "gif")
+	if got := frameCount(t, outputPath); got != 4 {
+		t.Errorf("フレーム数 = %d, want 4", got)
+	}
+}
+
+func TestE2E_Convert_標準入出力(t *testing.T) {
+	stdout, stderr, err := executeStdio(t, createTestJPEG(t, 16, 16, 90), "convert", "-", "-f", "png", "-o", "-")
+	if err != nil {
+		t.Fatalf("convert error = %v\n%s", err, stderr)
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(stdout)); err != nil || format != "png" {
+		t.Fatalf("stdout is not a PNG image: %q, %v", format, err)
+	}
+	if !strings.Contains(stderr, "変換完了: 標準入力 → 標準出力") || !strings.Contains(stderr, "jpeg → png") {
+		t.Errorf("stderr = %q, want the summary", stderr)
+	}
+
+	_, _, err = executeStdio(t, createTestJPEG(t, 16, 16, 90), "convert", "-", "-f", "png", "--pages", "all")
+	if err == nil || !strings.Contains(err.Error(), "--pages all は標準入出力には使用できません") {
+		t.Errorf("--pages all error = %v", err)
+	}
+}
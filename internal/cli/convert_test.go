@@ -2,7 +2,6 @@ package cli
 
 import (
 	"bytes"
-	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -27,6 +26,8 @@ func TestParseImageFormat(t *testing.T) {
 		{name: "大文字JPG", input: "JPG", want: processor.FormatJPEG},
 		{name: "大文字PNG", input: "PNG", want: processor.FormatPNG},
 		{name: "大文字WEBP", input: "WEBP", want: processor.FormatWEBP},
+		{name: "tiff", input: "tiff", want: processor.FormatTIFF},
+		{name: "tif", input: "tif", want: processor.FormatTIFF},
 		{name: "混合大文字Jpeg", input: "Jpeg", want: processor.FormatJPEG},
 		{name: "不正な値", input: "bmp", wantErr: true},
 		{name: "空文字", input: "", wantErr: true},
@@ -91,7 +92,7 @@ func TestConvertSingleFile_PNG_to_JPEG(t *testing.T) {
 		Format:          processor.FormatJPEG,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertSingleFile(cmd, inputPath, processor.FormatJPEG, opts)
+	err := convertSingleFile(cmd, inputPath, processor.FormatJPEG, opts, false)
 	if err != nil {
 		t.Fatalf("convertSingleFile() error = %v", err)
 	}
@@ -119,7 +120,7 @@ func TestConvertSingleFile_JPEG_to_PNG(t *testing.T) {
 		Format:          processor.FormatPNG,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertSingleFile(cmd, inputPath, processor.FormatPNG, opts)
+	err := convertSingleFile(cmd, inputPath, processor.FormatPNG, opts, false)
 	if err != nil {
 		t.Fatalf("convertSingleFile() error = %v", err)
 	}
@@ -147,7 +148,7 @@ func TestConvertSingleFile_PNG_to_WebP(t *testing.T) {
 		Format:          processor.FormatWEBP,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertSingleFile(cmd, inputPath, processor.FormatWEBP, opts)
+	err := convertSingleFile(cmd, inputPath, processor.FormatWEBP, opts, false)
 	if err != nil {
 		t.Fatalf("convertSingleFile() error = %v", err)
 	}
@@ -175,7 +176,7 @@ func TestConvertSingleFile_JPEG_to_WebP(t *testing.T) {
 		Format:          processor.FormatWEBP,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertSingleFile(cmd, inputPath, processor.FormatWEBP, opts)
+	err := convertSingleFile(cmd, inputPath, processor.FormatWEBP, opts, false)
 	if err != nil {
 		t.Fatalf("convertSingleFile() error = %v", err)
 	}
@@ -200,7 +201,7 @@ func TestConvertSingleFile_同一フォーマットエラー(t *testing.T) {
 		Format:          processor.FormatJPEG,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertSingleFile(cmd, inputPath, processor.FormatJPEG, opts)
+	err := convertSingleFile(cmd, inputPath, processor.FormatJPEG, opts, false)
 	if err == nil {
 		t.Fatal("同一フォーマットでエラーが返されるべき")
 	}
@@ -227,7 +228,7 @@ func TestConvertSingleFile_WebP_to_JPEG(t *testing.T) {
 		Format:          processor.FormatJPEG,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertSingleFile(cmd, inputPath, processor.FormatJPEG, opts)
+	err := convertSingleFile(cmd, inputPath, processor.FormatJPEG, opts, false)
 	if err != nil {
 		t.Fatalf("convertSingleFile() error = %v", err)
 	}
@@ -255,7 +256,7 @@ func TestConvertSingleFile_WebP_to_PNG(t *testing.T) {
 		Format:          processor.FormatPNG,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertSingleFile(cmd, inputPath, processor.FormatPNG, opts)
+	err := convertSingleFile(cmd, inputPath, processor.FormatPNG, opts, false)
 	if err != nil {
 		t.Fatalf("convertSingleFile() error = %v", err)
 	}
@@ -282,7 +283,7 @@ func TestConvertSingleFile_破損画像(t *testing.T) {
 		Format:          processor.FormatPNG,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertSingleFile(cmd, inputPath, processor.FormatPNG, opts)
+	err := convertSingleFile(cmd, inputPath, processor.FormatPNG, opts, false)
 	if err == nil {
 		t.Fatal("破損画像でエラーが返されるべき")
 	}
@@ -314,7 +315,7 @@ func TestConvertSingleFile_出力パス自動生成(t *testing.T) {
 		Format:          processor.FormatJPEG,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertSingleFile(cmd, inputPath, processor.FormatJPEG, opts)
+	err := convertSingleFile(cmd, inputPath, processor.FormatJPEG, opts, false)
 	if err != nil {
 		t.Fatalf("convertSingleFile() error = %v", err)
 	}
@@ -340,7 +341,7 @@ func TestConvertSingleFile_PNG同一フォーマット(t *testing.T) {
 		Format:          processor.FormatPNG,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertSingleFile(cmd, inputPath, processor.FormatPNG, opts)
+	err := convertSingleFile(cmd, inputPath, processor.FormatPNG, opts, false)
 	if err == nil {
 		t.Fatal("同一フォーマットでエラーが返されるべき")
 	}
@@ -361,7 +362,7 @@ func TestConvertSingleFile_WebP同一フォーマット(t *testing.T) {
 		Format:          processor.FormatWEBP,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertSingleFile(cmd, inputPath, processor.FormatWEBP, opts)
+	err := convertSingleFile(cmd, inputPath, processor.FormatWEBP, opts, false)
 	if err == nil {
 		t.Fatal("同一フォーマットでエラーが返されるべき")
 	}
@@ -471,62 +472,6 @@ func TestRunConvert_ディレクトリ成功(t *testing.T) {
 	}
 }
 
-func TestConvertResultsToBatchResults(t *testing.T) {
-	results := []processor.BatchConvertResult{
-		{
-			Item: processor.BatchConvertItem{
-				InputPath:  "/input/a.jpg",
-				OutputPath: "/output/a.png",
-			},
-			Result: &processor.Result{
-				OriginalSize:   1000,
-				CompressedSize: 800,
-				Format:         processor.FormatPNG,
-			},
-		},
-		{
-			Item: processor.BatchConvertItem{
-				InputPath:  "/input/b.png",
-				OutputPath: "/output/b.webp",
-			},
-			Error: fmt.Errorf("test error"),
-		},
-	}
-
-	batchResults := convertResultsToBatchResults(results)
-
-	if len(batchResults) != 2 {
-		t.Fatalf("convertResultsToBatchResults() returned %d results, want 2", len(batchResults))
-	}
-
-	if batchResults[0].Item.InputPath != "/input/a.jpg" {
-		t.Errorf("InputPath = %q, want %q", batchResults[0].Item.InputPath, "/input/a.jpg")
-	}
-	if batchResults[0].Item.OutputPath != "/output/a.png" {
-		t.Errorf("OutputPath = %q, want %q", batchResults[0].Item.OutputPath, "/output/a.png")
-	}
-	if batchResults[0].Result == nil {
-		t.Error("Result should not be nil")
-	}
-	if batchResults[0].Error != nil {
-		t.Errorf("Error should be nil, got %v", batchResults[0].Error)
-	}
-
-	if batchResults[1].Error == nil {
-		t.Error("Error should not be nil")
-	}
-	if batchResults[1].Result != nil {
-		t.Error("Result should be nil for failed item")
-	}
-}
-
-func TestConvertResultsToBatchResults_空(t *testing.T) {
-	batchResults := convertResultsToBatchResults([]processor.BatchConvertResult{})
-	if len(batchResults) != 0 {
-		t.Errorf("convertResultsToBatchResults() returned %d results, want 0", len(batchResults))
-	}
-}
-
 func TestConvertDirectory_recursiveなしエラー(t *testing.T) {
 	resetGlobals(t)
 
@@ -538,7 +483,7 @@ func TestConvertDirectory_recursiveなしエラー(t *testing.T) {
 		Format:          processor.FormatWEBP,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertDirectory(cmd, tmpDir, processor.FormatWEBP, opts)
+	err := convertDirectory(cmd, tmpDir, processor.FormatWEBP, opts, false)
 	if err == nil {
 		t.Fatal("recursiveなしでエラーが返されるべき")
 	}
@@ -559,7 +504,7 @@ func TestConvertDirectory_空ディレクトリ(t *testing.T) {
 		Format:          processor.FormatWEBP,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertDirectory(cmd, tmpDir, processor.FormatWEBP, opts)
+	err := convertDirectory(cmd, tmpDir, processor.FormatWEBP, opts, false)
 	if err != nil {
 		t.Fatalf("空ディレクトリでエラーが返されるべきではない: %v", err)
 	}
@@ -587,7 +532,7 @@ func TestConvertDirectory_出力パス自動生成(t *testing.T) {
 		Format:          processor.FormatPNG,
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
-	err := convertDirectory(cmd, inputDir, processor.FormatPNG, opts)
+	err := convertDirectory(cmd, inputDir, processor.FormatPNG, opts, false)
 	if err != nil {
 		t.Fatalf("convertDirectory() error = %v", err)
 	}
@@ -616,7 +561,7 @@ func TestConvertDirectory_同一フォーマットのみ(t *testing.T) {
 		CompressOptions: processor.DefaultCompressOptions(),
 	}
 	// All files are webp and target is webp, so all should be skipped.
-	err := convertDirectory(cmd, inputDir, processor.FormatWEBP, opts)
+	err := convertDirectory(cmd, inputDir, processor.FormatWEBP, opts, false)
 	if err != nil {
 		t.Fatalf("convertDirectory() error = %v", err)
 	}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/FrontWorksDev/Loki/internal/cli/tui"
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	"github.com/spf13/cobra"
+)
+
+// dryRunHeader is printed before the projected results of --dry-run.
+const dryRunHeader = "ドライラン: ファイルは書き込みません"
+
+// rejectTUIDryRun rejects --tui together with --dry-run, which prints its
+// projection as text once the batch is done.
+func rejectTUIDryRun(useTUI, dry bool) error {
+	if useTUI && dry {
+		return fmt.Errorf("--tui と --dry-run は同時に指定できません")
+	}
+	return nil
+}
+
+// directoryDryRun runs a batch with process, whose outputs are discarded by
+// run's options, and prints the projected results. verb names the operation
+// in error messages.
+func directoryDryRun(cmd *cobra.Command, run batchRun, verb string, process func(*processor.DefaultBatchProcessor) ([]processor.BatchResult, error)) error {
+	out := cmd.OutOrStdout()
+	_, _ = fmt.Fprintln(out, dryRunHeader)
+	_, _ = fmt.Fprintln(out, "画像ファイルを試算します...")
+
+	start := time.Now()
+	results, err := process(processor.NewDefaultBatchProcessor(run.opts...))
+	if err != nil {
+		return fmt.Errorf("バッチ処理に失敗しました: %w", err)
+	}
+	if err := run.report.writeReport(results, time.Since(start)); err != nil {
+		return err
+	}
+
+	failCount := printDryRun(out, results)
+	for _, res := range results {
+		if !res.IsSuccess() && !res.Aborted {
+			_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "  エラー: %s: %v\n", res.Item.InputPath, res.Error)
+		}
+	}
+	run.printUnchanged(cmd)
+
+	if failCount > 0 {
+		return fmt.Errorf("%d 件の画像の%sに失敗しました", failCount, verb)
+	}
+	return nil
+}
+
+// printDryRun prints the projected size of each successful result and the
+// total savings, returning the number of failed results. Results aborted by
+// the failure policy are counted separately.
+func printDryRun(out io.Writer, results []processor.BatchResult) int {
+	var total processor.Result
+	failCount := 0
+	abortCount := 0
+	for _, res := range results {
+		if res.Aborted {
+			abortCount++
+			continue
+		}
+		if !res.IsSuccess() {
+			failCount++
+			continue
+		}
+		r := res.Result
+		total.OriginalSize += r.OriginalSize
+		total.CompressedSize += r.CompressedSize
+		note := ""
+		if res.KeptOriginal {
+			note = " (元のファイルを保持)"
+		}
+		_, _ = fmt.Fprintf(out, "  %s: %d → %d bytes (削減率 %.1f%%)%s\n",
+			res.Item.InputPath, r.OriginalSize, r.CompressedSize, r.SavedPercentage(), note)
+	}
+	_, _ = fmt.Fprintf(out, "合計: %d → %d bytes (削減見込み %d bytes, %.1f%%)\n",
+		total.OriginalSize, total.CompressedSize, total.SavedBytes(), total.SavedPercentage())
+	if failCount > 0 {
+		_, _ = fmt.Fprintf(out, "失敗: %d 件\n", failCount)
+	}
+	if abortCount > 0 {
+		_, _ = fmt.Fprintln(out, tui.AbortedMessage(abortCount))
+	}
+	return failCount
+}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	infoJSON      bool
+	infoRecursive bool
+	infoScan      scanFlags
+)
+
+var infoCmd = &cobra.Command{
+	Use:   "info <path>",
+	Short: "画像の形式や寸法などの情報を表示する",
+	Long: `画像の実際の形式、寸法、カラーモデル、ビット深度、アルファの有無、EXIFの向き、
+埋め込みICCプロファイル、プログレッシブ/インターレースの有無、推定JPEG品質を表示します。
+画像はヘッダーだけを読み取り、画素データはデコードしません。
+
+ディレクトリを指定すると直下の画像を、--recursive (-r) を指定するとサブディレクトリを含む
+すべての画像を一覧表示します。--json を指定すると、ファイルはオブジェクト、ディレクトリは
+配列のJSONで出力します。入力に - を指定すると標準入力から読み込みます。`,
+	Args: cobra.ExactArgs(1),
+	RunE: runInfo,
+}
+
+func init() {
+	infoCmd.Flags().BoolVar(&infoJSON, "json", false, "JSON形式で出力する")
+	infoCmd.Flags().BoolVarP(&infoRecursive, "recursive", "r", false, "サブディレクトリの画像も表示する")
+	infoScan.register(infoCmd)
+}
+
+// bindInfoFlags binds info command flags to Viper keys.
+// Called from initConfig() so bindings are re-established after viper.Reset().
+func bindInfoFlags() {
+	_ = viper.BindPFlag("info.json", infoCmd.Flags().Lookup("json"))
+	_ = viper.BindPFlag("info.recursive", infoCmd.Flags().Lookup("recursive"))
+	bindScanFlags(infoCmd, "info")
+}
+
+// infoEntry is the output of one image: its information or the error that
+// prevented reading it.
+type infoEntry struct {
+	Path string `json:"path"`
+	*processor.ImageInfo
+	Error string `json:"error,omitempty"`
+}
+
+func runInfo(cmd *cobra.Command, args []string) error {
+	path := args[0]
+	if path == stdioPath {
+		data, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("標準入力の読み込みに失敗しました: %w", err)
+		}
+		return infoSingleFile(cmd, stdioName(path, true), bytes.NewReader(data))
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("入力パスが存在しません: %s", path)
+		}
+		return fmt.Errorf("入力パスの確認に失敗しました: %w", err)
+	}
+	if fi.IsDir() {
+		return infoDirectory(cmd, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("入力ファイルを開けません: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	return infoSingleFile(cmd, path, f)
+}
+
+func infoSingleFile(cmd *cobra.Command, name string, r io.Reader) error {
+	info, err := processor.Inspect(r)
+	if err != nil {
+		return fmt.Errorf("画像情報の取得に失敗しました: %w", err)
+	}
+	entry := infoEntry{Path: name, ImageInfo: info}
+	if viper.GetBool("info.json") {
+		return writeInfoJSON(cmd.OutOrStdout(), entry)
+	}
+	writeInfoText(cmd.OutOrStdout(), entry)
+	return nil
+}
+
+func infoDirectory(cmd *cobra.Command, dir string) error {
+	filter, err := scanFilter("info")
+	if err != nil {
+		return err
+	}
+	if !viper.GetBool("info.recursive") {
+		filter.MaxDepth = 1
+	}
+	paths, err := processor.ScanImages(dir, filter)
+	if err != nil {
+		return fmt.Errorf("ディレクトリのスキャンに失敗しました: %w", err)
+	}
+
+	entries := make([]infoEntry, 0, len(paths))
+	failed := 0
+	for _, path := range paths {
+		entry := infoEntry{Path: path}
+		if entry.ImageInfo, err = inspectFile(path); err != nil {
+			entry.Error = err.Error()
+			failed++
+		}
+		entries = append(entries, entry)
+	}
+
+	out := cmd.OutOrStdout()
+	if viper.GetBool("info.json") {
+		if err := writeInfoJSON(out, entries); err != nil {
+			return err
+		}
+	} else {
+		for i, entry := range entries {
+			if i > 0 {
+				_, _ = fmt.Fprintln(out)
+			}
+			writeInfoText(out, entry)
+		}
+		if len(entries) == 0 {
+			_, _ = fmt.Fprintln(out, "画像ファイルが見つかりませんでした")
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 件の画像の情報取得に失敗しました", failed)
+	}
+	return nil
+}
+
+// inspectFile inspects the image at path.
+func inspectFile(path string) (*processor.ImageInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return processor.Inspect(f)
+}
+
+// writeInfoJSON writes v as indented JSON.
+func writeInfoJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("JSONの出力に失敗しました: %w", err)
+	}
+	return nil
+}
+
+// writeInfoText writes entry as human-readable lines.
+func writeInfoText(w io.Writer, entry infoEntry) {
+	_, _ = fmt.Fprintln(w, entry.Path)
+	if entry.Error != "" {
+		_, _ = fmt.Fprintf(w, "  エラー: %s\n", entry.Error)
+		return
+	}
+	info := entry.ImageInfo
+	_, _ = fmt.Fprintf(w, "  形式: %s\n", info.Format)
+	_, _ = fmt.Fprintf(w, "  サイズ: %d bytes\n", info.Size)
+	_, _ = fmt.Fprintf(w, "  寸法: %dx%d\n", info.Width, info.Height)
+	_, _ = fmt.Fprintf(w, "  カラーモデル: %s (%d bit)\n", info.ColorModel, info.BitDepth)
+	_, _ = fmt.Fprintf(w, "  アルファ: %s\n", yesNo(info.HasAlpha))
+	if info.Orientation != 0 {
+		_, _ = fmt.Fprintf(w, "  EXIFの向き: %d\n", info.Orientation)
+	} else {
+		_, _ = fmt.Fprintln(w, "  EXIFの向き: なし")
+	}
+	switch {
+	case info.ICCProfile != "":
+		_, _ = fmt.Fprintf(w, "  ICCプロファイル: %s\n", info.ICCProfile)
+	case info.HasICCProfile:
+		_, _ = fmt.Fprintln(w, "  ICCプロファイル: あり")
+	default:
+		_, _ = fmt.Fprintln(w, "  ICCプロファイル: なし")
+	}
+	_, _ = fmt.Fprintf(w, "  プログレッシブ/インターレース: %s\n", yesNo(info.Progressive))
+	if info.JPEGQuality != 0 {
+		_, _ = fmt.Fprintf(w, "  推定JPEG品質: %d\n", info.JPEGQuality)
+	}
+	if info.Frames > 1 {
+		_, _ = fmt.Fprintf(w, "  フレーム数: %d\n", info.Frames)
+	}
+}
+
+// yesNo returns "あり" or "なし".
+func yesNo(b bool) string {
+	if b {
+		return "あり"
+	}
+	return "なし"
+}
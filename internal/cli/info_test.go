@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestE2E_情報表示_ファイル(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "photo.jpg", createTestJPEG(t, 40, 30, 80))
+
+	out, err := executeCompress(t, "info", filepath.Join(dir, "photo.jpg"))
+	if err != nil {
+		t.Fatalf("info error = %v\noutput:\n%s", err, out)
+	}
+	for _, want := range []string{"形式: jpeg", "寸法: 40x30", "カラーモデル: ycbcr (8 bit)", "アルファ: なし", "ICCプロファイル: なし", "推定JPEG品質: 80"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("出力に %q がありません:\n%s", want, out)
+		}
+	}
+}
+
+func TestE2E_情報表示_JSON(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.png", createTestPNG(t, 20, 10))
+
+	out, err := executeCompress(t, "info", "--json", filepath.Join(dir, "a.png"))
+	if err != nil {
+		t.Fatalf("info error = %v\noutput:\n%s", err, out)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("JSONとして解析できません: %v\n%s", err, out)
+	}
+	if got["format"] != "png" || got["width"] != float64(20) || got["height"] != float64(10) || got["color_model"] != "rgb" {
+		t.Errorf("JSON = %v", got)
+	}
+	if got["path"] != filepath.Join(dir, "a.png") {
+		t.Errorf("path = %v", got["path"])
+	}
+}
+
+func TestE2E_情報表示_ディレクトリ(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.png", createTestPNG(t, 8, 8))
+	writeTestFile(t, dir, "b.jpg", []byte("not a jpeg"))
+	writeTestFile(t, dir, "notes.txt", []byte("not an image"))
+	writeTestFile(t, dir, "sub/c.webp", createTestWEBP(t, 8, 8, 80))
+
+	stdout, _, err := executeStdio(t, nil, "info", "--json", dir)
+	if err == nil || !strings.Contains(err.Error(), "1 件の画像の情報取得に失敗しました") {
+		t.Errorf("error = %v, want a failure count", err)
+	}
+	var entries []map[string]any
+	// Cobra prints the usage after the JSON since the test sets the output.
+	if err := json.NewDecoder(bytes.NewReader(stdout)).Decode(&entries); err != nil {
+		t.Fatalf("JSONとして解析できません: %v\n%s", err, stdout)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("len(entries) = %d, want 2 (サブディレクトリは -r なしでは対象外)", len(entries))
+	}
+	if entries[0]["format"] != "png" || entries[1]["error"] == nil {
+		t.Errorf("entries = %v", entries)
+	}
+}
+
+func TestE2E_情報表示_ディレクトリ再帰(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.png", createTestPNG(t, 8, 8))
+	writeTestFile(t, dir, "b.jpg", []byte("not a jpeg"))
+	writeTestFile(t, dir, "sub/c.webp", createTestWEBP(t, 8, 8, 80))
+
+	out, err := executeCompress(t, "info", "-r", "--exclude", "*.jpg", dir)
+	if err != nil {
+		t.Fatalf("info error = %v\noutput:\n%s", err, out)
+	}
+	for _, want := range []string{filepath.Join(dir, "a.png"), filepath.Join(dir, "sub", "c.webp"), "形式: webp"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("出力に %q がありません:\n%s", want, out)
+		}
+	}
+}
+
+func TestE2E_情報表示_標準入力(t *testing.T) {
+	stdout, _, err := executeStdio(t, createTestPNG(t, 12, 6), "info", "-")
+	if err != nil {
+		t.Fatalf("info error = %v", err)
+	}
+	if out := string(stdout); !strings.Contains(out, "標準入力") || !strings.Contains(out, "寸法: 12x6") {
+		t.Errorf("出力が不正です:\n%s", out)
+	}
+}
+
+func TestE2E_情報表示_エラー(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "broken.png", []byte("not a png"))
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "存在しないパス", args: []string{"info", filepath.Join(dir, "missing.png")}, wantErr: "入力パスが存在しません"},
+		{name: "画像でないファイル", args: []string{"info", filepath.Join(dir, "broken.png")}, wantErr: "画像情報の取得に失敗しました"},
+		{name: "不正な深さ", args: []string{"info", dir, "--max-depth", "-1"}, wantErr: "--max-depth は0以上で指定してください"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executeCompress(t, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
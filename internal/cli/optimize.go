@@ -0,0 +1,439 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FrontWorksDev/Loki/internal/cli/tui"
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	optimizeQuality     int
+	optimizeLevel       string
+	optimizeOutput      string
+	optimizeRecursive   bool
+	optimizeUseTUI      bool
+	optimizeResume      bool
+	optimizeIncremental bool
+	optimizeDryRun      bool
+	optimizeReport      string
+	optimizeReportFile  string
+	optimizeMemoryLimit int
+	optimizeFailFast    bool
+	optimizeMaxFailures string
+	optimizeRetries     int
+	optimizeScan        scanFlags
+)
+
+var optimizeCmd = &cobra.Command{
+	Use:   "optimize <input-path>",
+	Short: "画像ごとに最も小さくなる出力フォーマットを選んで変換する",
+	Long: `画像をJPEG、WebP、PNGのそれぞれで同じ品質設定でエンコードし、最も小さいものを出力します。
+選ばれたフォーマットと各候補のサイズを表示します。
+
+スクリーンショットや線画のように劣化なしで保存された画像 (PNG/GIF/BMP/TIFF/SVG/
+ロスレスWebP) は、画質を損なわないようPNGとロスレスWebPだけを候補にします。
+ただし色数の多い写真のような画像はJPEGやWebPも候補にします。
+透過を含む画像とアニメーションはJPEGを候補から外し、アニメーションはAPNGまたは
+アニメーションWebPとして保持します。JPEG/PNG/WebP/GIFの入力がどの候補よりも
+小さい場合は、元のファイルをそのまま出力します。
+
+出力ファイルの拡張子は選ばれたフォーマットに合わせます。--output を指定した場合も
+拡張子は置き換えます。ディレクトリを処理するには --recursive (-r) が必要で、
+出力先 (省略時は {dir}_optimized) に同じ相対パスで並列に書き出します。
+a.jpg と a.png のように拡張子だけが異なるファイルは出力先が衝突するため、
+スキャン時にエラーになります。
+
+ディレクトリ処理では完了したファイルを出力先の .img-cli-journal.jsonl に記録し、
+中断後に --resume を付けて再実行すると完了済みのファイルをスキップします。
+--incremental を指定すると出力先の .img-cli-manifest.json に入力とオプションを記録し、
+次回以降は前回から変更のないファイルをスキップします。
+
+--dry-run を指定すると最適化結果を破棄し、ファイルごとと合計の最適化後サイズの見込みを
+表示します。出力ファイル、ジャーナル、マニフェストは書き込みません。--tui とは同時に指定できません。
+
+--report json|csv|junit と --report-file を指定すると、ファイルごとの入出力パス、
+フォーマット、サイズ、削減率、処理時間、エラーと合計をCI向けの形式で書き出します。
+
+例:
+  img-cli optimize screenshot.png
+  img-cli optimize photo.jpg -q 80 -o out/photo
+  img-cli optimize images/ -r
+  img-cli optimize images/ -r -o images_optimized/ --include '**/*.png'
+  img-cli optimize images/ -r --incremental
+  img-cli optimize images/ -r --dry-run`,
+	Args: cobra.ExactArgs(1),
+	RunE: runOptimize,
+}
+
+func init() {
+	optimizeCmd.Flags().IntVarP(&optimizeQuality, "quality", "q", 0, "JPEG/WebP品質 (1-100)。0の場合はlevelに基づく")
+	optimizeCmd.Flags().StringVarP(&optimizeLevel, "level", "l", "medium", "圧縮レベル (low/medium/high)")
+	optimizeCmd.Flags().StringVarP(&optimizeOutput, "output", "o", "", "出力パス (省略時は自動生成。拡張子は選ばれたフォーマットに置き換える)")
+	optimizeCmd.Flags().BoolVarP(&optimizeRecursive, "recursive", "r", false, "ディレクトリを再帰的に処理する")
+	optimizeCmd.Flags().BoolVar(&optimizeUseTUI, "tui", false, "TUIモードでプログレスバーを表示する")
+	optimizeCmd.Flags().BoolVar(&optimizeResume, "resume", false, "ジャーナルを参照して前回完了したファイルをスキップする (ディレクトリ処理のみ)")
+	optimizeCmd.Flags().BoolVar(&optimizeIncremental, "incremental", false, "マニフェストを参照して前回から変更のないファイルをスキップする (ディレクトリ処理のみ)")
+	optimizeCmd.Flags().BoolVar(&optimizeDryRun, "dry-run", false, "ファイルを書き込まずに最適化後のサイズの見込みを表示する")
+	optimizeCmd.Flags().StringVar(&optimizeReport, "report", "", "処理結果のレポート形式 (json/csv/junit)")
+	optimizeCmd.Flags().StringVar(&optimizeReportFile, "report-file", "", "レポートの出力先ファイル")
+	optimizeCmd.Flags().BoolVar(&optimizeFailFast, "fail-fast", false, "最初の失敗で残りの処理を中止する (ディレクトリ処理のみ)")
+	optimizeCmd.Flags().StringVar(&optimizeMaxFailures, "max-failures", "", "失敗が指定件数 (例: 5) または割合 (例: 10%) を超えたら残りの処理を中止する (ディレクトリ処理のみ)")
+	optimizeCmd.Flags().IntVar(&optimizeRetries, "retries", 0, "一時的なI/Oエラーで失敗したファイルを再試行する回数 (ディレクトリ処理のみ)")
+	optimizeCmd.Flags().IntVar(&optimizeMemoryLimit, "memory-limit", 0, "同時に処理する画像のデコード後の推定メモリ上限 (MiB)。0は無制限")
+	optimizeScan.register(optimizeCmd)
+}
+
+// bindOptimizeFlags binds optimize command flags to Viper keys.
+// Called from initConfig() so bindings are re-established after viper.Reset().
+func bindOptimizeFlags() {
+	_ = viper.BindPFlag("optimize.quality", optimizeCmd.Flags().Lookup("quality"))
+	_ = viper.BindPFlag("optimize.level", optimizeCmd.Flags().Lookup("level"))
+	_ = viper.BindPFlag("optimize.output", optimizeCmd.Flags().Lookup("output"))
+	_ = viper.BindPFlag("optimize.recursive", optimizeCmd.Flags().Lookup("recursive"))
+	_ = viper.BindPFlag("optimize.resume", optimizeCmd.Flags().Lookup("resume"))
+	_ = viper.BindPFlag("optimize.incremental", optimizeCmd.Flags().Lookup("incremental"))
+	_ = viper.BindPFlag("optimize.dry_run", optimizeCmd.Flags().Lookup("dry-run"))
+	_ = viper.BindPFlag("optimize.report", optimizeCmd.Flags().Lookup("report"))
+	_ = viper.BindPFlag("optimize.report_file", optimizeCmd.Flags().Lookup("report-file"))
+	_ = viper.BindPFlag("optimize.memory_limit", optimizeCmd.Flags().Lookup("memory-limit"))
+	_ = viper.BindPFlag("optimize.fail_fast", optimizeCmd.Flags().Lookup("fail-fast"))
+	_ = viper.BindPFlag("optimize.max_failures", optimizeCmd.Flags().Lookup("max-failures"))
+	_ = viper.BindPFlag("optimize.retries", optimizeCmd.Flags().Lookup("retries"))
+	bindScanFlags(optimizeCmd, "optimize")
+}
+
+func runOptimize(cmd *cobra.Command, args []string) error {
+	inputPath := args[0]
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("入力パスが存在しません: %s", inputPath)
+		}
+		return fmt.Errorf("入力パスの確認に失敗しました: %w", err)
+	}
+	if err := rejectTUIDryRun(optimizeUseTUI, viper.GetBool("optimize.dry_run")); err != nil {
+		return err
+	}
+
+	q := viper.GetInt("optimize.quality")
+	if q != 0 && (q < 1 || q > 100) {
+		return fmt.Errorf("品質は1〜100の範囲で指定してください (指定値: %d)", q)
+	}
+	level, err := parseCompressionLevel(viper.GetString("optimize.level"))
+	if err != nil {
+		return err
+	}
+	opts := processor.CompressOptions{Quality: q, Level: level}
+
+	if info.IsDir() {
+		return optimizeDirectory(cmd, inputPath, opts)
+	}
+	return optimizeSingleFile(cmd, inputPath, opts)
+}
+
+func optimizeSingleFile(cmd *cobra.Command, inputPath string, opts processor.CompressOptions) error {
+	outputPath := viper.GetString("optimize.output")
+	if outputPath == "" {
+		outputPath = strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + "_optimized"
+	}
+	// The extension is replaced by that of the chosen format.
+	base := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+
+	report, err := loadReportConfig("optimize")
+	if err != nil {
+		return err
+	}
+	batchOpts := []processor.BatchProcessorOption{processor.WithMaxWorkers(1)}
+	dry := viper.GetBool("optimize.dry_run")
+	if dry {
+		batchOpts = append(batchOpts, processor.WithOutputSink(processor.DiscardSink))
+		report.dryRun = true
+	}
+
+	start := time.Now()
+	results, err := processor.NewDefaultBatchProcessor(batchOpts...).ProcessBatch(cmd.Context(), []processor.BatchItem{
+		processor.OptimizeItem(inputPath, base, opts),
+	})
+	if err != nil {
+		return fmt.Errorf("最適化に失敗しました: %w", err)
+	}
+	if err := report.writeReport(results, time.Since(start)); err != nil {
+		return err
+	}
+	res := results[0]
+	if res.Error != nil {
+		return fmt.Errorf("最適化に失敗しました: %w", res.Error)
+	}
+	result := res.Result
+
+	out := cmd.OutOrStdout()
+	if dry {
+		_, _ = fmt.Fprintln(out, dryRunHeader)
+		printDryRun(out, results)
+		_, _ = fmt.Fprintf(out, "  フォーマット: %s\n", result.Format)
+		_, _ = fmt.Fprintf(out, "  候補: %s\n", formatCandidates(result))
+		return nil
+	}
+	_, _ = fmt.Fprintf(out, "最適化完了: %s → %s\n", inputPath, res.OutputPath())
+	_, _ = fmt.Fprintf(out, "  元サイズ: %d bytes\n", result.OriginalSize)
+	_, _ = fmt.Fprintf(out, "  最適化後: %d bytes\n", result.CompressedSize)
+	_, _ = fmt.Fprintf(out, "  フォーマット: %s\n", result.Format)
+	_, _ = fmt.Fprintf(out, "  候補: %s\n", formatCandidates(result))
+	if res.KeptOriginal {
+		_, _ = fmt.Fprintln(out, "  どの候補よりも小さいため元のファイルをそのまま出力しました")
+	}
+	return nil
+}
+
+func optimizeDirectory(cmd *cobra.Command, inputDir string, opts processor.CompressOptions) error {
+	if !viper.GetBool("optimize.recursive") {
+		return fmt.Errorf("ディレクトリを処理するには --recursive (-r) フラグが必要です")
+	}
+	outputDir := viper.GetString("optimize.output")
+	if outputDir == "" {
+		outputDir = defaultOutputDir(inputDir, "_optimized")
+	}
+
+	filter, err := scanFilter("optimize")
+	if err != nil {
+		return err
+	}
+	// An output directory inside the input one must not be optimized again.
+	if rel, err := filepath.Rel(inputDir, outputDir); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		filter.Exclude = append(filter.Exclude, filepath.ToSlash(rel)+"/")
+	}
+	report, err := loadReportConfig("optimize")
+	if err != nil {
+		return err
+	}
+	memOpts, err := memoryBudgetOptions("optimize")
+	if err != nil {
+		return err
+	}
+	policyOpts, err := failurePolicyOptions("optimize")
+	if err != nil {
+		return err
+	}
+	retryOpts, err := retryOptions("optimize")
+	if err != nil {
+		return err
+	}
+	manifest, manifestPath, err := loadManifest(viper.GetBool("optimize.incremental"), outputDir)
+	if err != nil {
+		return err
+	}
+
+	items, err := startScan(processor.ScanDirectorySeq(inputDir, outputDir,
+		processor.WithCompressOptions(opts),
+		processor.WithFilter(filter),
+		processor.WithManifest(manifest),
+		processor.WithScanContext(cmd.Context()),
+		processor.WithOptimize(),
+	))
+	if err != nil {
+		return err
+	}
+	defer items.close()
+
+	run := batchRun{
+		opts:         slices.Concat(memOpts, policyOpts, retryOpts),
+		manifest:     manifest,
+		manifestPath: manifestPath,
+		dryRun:       viper.GetBool("optimize.dry_run"),
+		report:       report,
+	}
+	run.report.dryRun = run.dryRun
+	run.report.manifest = manifest
+	if manifest != nil {
+		run.opts = append(run.opts, processor.WithInputHashes())
+	}
+	if run.dryRun {
+		run.opts = append(run.opts, processor.WithOutputSink(processor.DiscardSink))
+	} else {
+		run.opts = append(run.opts, processor.WithJournal(filepath.Join(outputDir, journalFileName)))
+		if viper.GetBool("optimize.resume") {
+			run.opts = append(run.opts, processor.WithResume())
+		}
+	}
+
+	out := cmd.OutOrStdout()
+
+	if items == nil {
+		if err := run.report.writeReport(nil, 0); err != nil {
+			return err
+		}
+		if manifest != nil && manifest.Skipped() > 0 {
+			_, _ = fmt.Fprintf(out, "前回から変更された画像ファイルはありません (変更なし %d 件)\n", manifest.Skipped())
+			return nil
+		}
+		_, _ = fmt.Fprintln(out, "最適化対象の画像ファイルが見つかりませんでした")
+		return nil
+	}
+
+	process := items.process(cmd.Context())
+	if run.dryRun {
+		return directoryDryRun(cmd, run, "最適化", process)
+	}
+	if optimizeUseTUI {
+		return optimizeDirectoryWithTUI(cmd, run, process)
+	}
+	return optimizeDirectoryWithText(cmd, inputDir, outputDir, run, process)
+}
+
+func optimizeDirectoryWithText(cmd *cobra.Command, inputDir, outputDir string, run batchRun, process func(*processor.DefaultBatchProcessor) ([]processor.BatchResult, error)) error {
+	out := cmd.OutOrStdout()
+	errOut := cmd.ErrOrStderr()
+
+	_, _ = fmt.Fprintln(out, "画像ファイルを最適化します...")
+
+	var mu sync.Mutex
+	var last processor.Progress
+	bp := processor.NewDefaultBatchProcessor(append(run.opts,
+		processor.WithProgressCallback(func(p processor.Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			last = p
+			_, _ = fmt.Fprintf(out, "  %s %s (%s)\n", tui.Count(p), p.Current, tui.Throughput(p))
+		}),
+	)...)
+
+	start := time.Now()
+	results, err := process(bp)
+	if err != nil {
+		return fmt.Errorf("バッチ処理に失敗しました: %w", err)
+	}
+	if err := run.saveManifest(results); err != nil {
+		return err
+	}
+	if err := run.report.writeReport(results, time.Since(start)); err != nil {
+		return err
+	}
+
+	var succeeded, failed, skipped, kept, aborted int
+	var originalTotal, optimizedTotal int64
+	for _, res := range results {
+		switch {
+		case res.IsSuccess():
+			succeeded++
+			originalTotal += res.Result.OriginalSize
+			optimizedTotal += res.Result.CompressedSize
+			if res.Skipped {
+				skipped++
+				continue
+			}
+			if res.KeptOriginal {
+				kept++
+			}
+			rel, _ := filepath.Rel(inputDir, res.Item.InputPath)
+			outRel, _ := filepath.Rel(outputDir, res.OutputPath())
+			_, _ = fmt.Fprintf(out, "  %s → %s (%s)\n", rel, outRel, formatCandidates(res.Result))
+		case res.Aborted:
+			aborted++
+		default:
+			failed++
+			_, _ = fmt.Fprintf(errOut, "  エラー: %s: %v\n", res.Item.InputPath, res.Error)
+		}
+	}
+
+	if skipped > 0 {
+		_, _ = fmt.Fprintf(out, "完了: 成功 %d (スキップ %d), 失敗 %d\n", succeeded, skipped, failed)
+	} else {
+		_, _ = fmt.Fprintf(out, "完了: 成功 %d, 失敗 %d\n", succeeded, failed)
+	}
+	_, _ = fmt.Fprintf(out, "  合計: %d → %d bytes\n", originalTotal, optimizedTotal)
+	if kept > 0 {
+		_, _ = fmt.Fprintf(out, "  どの候補よりも小さいため元のファイルを保持: %d 件\n", kept)
+	}
+	if aborted > 0 {
+		_, _ = fmt.Fprintln(out, tui.AbortedMessage(aborted))
+	}
+	printStats(out, last, results)
+	run.printUnchanged(cmd)
+
+	if failed > 0 {
+		return fmt.Errorf("%d 件の画像の最適化に失敗しました", failed)
+	}
+	return nil
+}
+
+func optimizeDirectoryWithTUI(cmd *cobra.Command, run batchRun, process func(*processor.DefaultBatchProcessor) ([]processor.BatchResult, error)) error {
+	m := tui.NewModel()
+	p := tea.NewProgram(m)
+
+	go func() {
+		p.Send(tui.BatchStartMsg{})
+
+		bp := processor.NewDefaultBatchProcessor(append(run.opts,
+			processor.WithProgressCallback(func(prog processor.Progress) {
+				p.Send(tui.ProgressMsg{Progress: prog})
+			}),
+		)...)
+
+		start := time.Now()
+		results, err := process(bp)
+		if err == nil {
+			err = run.saveManifest(results)
+		}
+		if err == nil {
+			err = run.report.writeReport(results, time.Since(start))
+		}
+		if err != nil {
+			p.Send(tui.BatchErrorMsg{Err: err})
+			return
+		}
+
+		p.Send(tui.BatchCompleteMsg{
+			Results: results,
+		})
+	}()
+
+	finalModel, err := p.Run()
+	if err != nil {
+		return fmt.Errorf("TUIの実行に失敗しました: %w", err)
+	}
+
+	fm := finalModel.(tui.Model)
+	if fm.Err() != nil {
+		return fmt.Errorf("バッチ処理に失敗しました: %w", fm.Err())
+	}
+	run.printUnchanged(cmd)
+
+	if fm.Failed() > 0 {
+		return fmt.Errorf("%d 件の画像の最適化に失敗しました", fm.Failed())
+	}
+	return nil
+}
+
+// formatCandidates formats the encodings tried by Optimize, marking the
+// chosen one. A kept original is only listed when it was chosen.
+func formatCandidates(result *processor.Result) string {
+	parts := make([]string, 0, len(result.Candidates))
+	// The original, when kept, was chosen over an encoding of the same size.
+	chosen := slices.ContainsFunc(result.Candidates, func(c processor.Candidate) bool { return c.Original })
+	for _, c := range result.Candidates {
+		name := c.Format.String()
+		switch {
+		case c.Original:
+			name = "元のファイル (" + name + ")"
+		case c.Lossless && c.Format == processor.FormatWEBP:
+			name += " (ロスレス)"
+		}
+		s := fmt.Sprintf("%s %d bytes", name, c.Size)
+		if c.Original || !chosen && c.Format == result.Format && c.Size == result.CompressedSize {
+			s += " [採用]"
+			chosen = true
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestE2E_最適化_ファイル(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "photo.jpg", createTestJPEG(t, 64, 48, 90))
+
+	out, err := executeCompress(t, "optimize", filepath.Join(dir, "photo.jpg"), "-q", "80")
+	if err != nil {
+		t.Fatalf("optimize error = %v\noutput:\n%s", err, out)
+	}
+	for _, want := range []string{"最適化完了: ", "元サイズ: ", "フォーマット: ", "候補: jpeg ", "webp ", "png ", "[採用]"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("出力に %q がありません:\n%s", want, out)
+		}
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "photo_optimized.*"))
+	if len(matches) != 1 {
+		t.Fatalf("出力ファイル = %v, want 1 file", matches)
+	}
+	ext := filepath.Ext(matches[0])
+	verifyImageFile(t, matches[0], map[string]string{".jpg": "jpeg", ".webp": "webp", ".png": "png"}[ext])
+}
+
+func TestE2E_最適化_ロスレス入力(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "shot.png", createTestPNG(t, 32, 32))
+	output := filepath.Join(dir, "out", "shot")
+
+	out, err := executeCompress(t, "optimize", filepath.Join(dir, "shot.png"), "-o", output)
+	if err != nil {
+		t.Fatalf("optimize error = %v\noutput:\n%s", err, out)
+	}
+	if strings.Contains(out, "jpeg ") || !strings.Contains(out, "webp (ロスレス) ") {
+		t.Errorf("ロスレス入力の候補が不正です:\n%s", out)
+	}
+	matches, _ := filepath.Glob(output + ".*")
+	if len(matches) != 1 {
+		t.Fatalf("出力ファイル = %v, want 1 file", matches)
+	}
+}
+
+func TestE2E_最適化_ディレクトリ(t *testing.T) {
+	root := t.TempDir()
+	input := filepath.Join(root, "images")
+	writeTestFile(t, input, "a.jpg", createTestJPEG(t, 32, 32, 90))
+	writeTestFile(t, input, "sub/b.png", createTestPNG(t, 32, 32))
+
+	out, err := executeCompress(t, "optimize", input, "-r")
+	if err != nil {
+		t.Fatalf("optimize error = %v\noutput:\n%s", err, out)
+	}
+	if !strings.Contains(out, "完了: 成功 2, 失敗 0") {
+		t.Errorf("出力に完了メッセージがありません:\n%s", out)
+	}
+	for _, name := range []string{"a", filepath.Join("sub", "b")} {
+		matches, _ := filepath.Glob(filepath.Join(input+"_optimized", name+".*"))
+		if len(matches) != 1 {
+			t.Errorf("%s の出力ファイル = %v, want 1 file", name, matches)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(input, "a_optimized.jpg")); err == nil {
+		t.Error("入力ディレクトリに出力が書き込まれています")
+	}
+}
+
+func TestE2E_最適化_エラー(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.png", createTestPNG(t, 10, 10))
+	writeTestFile(t, dir, "broken.png", []byte("not an image"))
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "存在しないパス", args: []string{"optimize", filepath.Join(dir, "missing.png")}, wantErr: "入力パスが存在しません"},
+		{name: "品質範囲外", args: []string{"optimize", filepath.Join(dir, "a.png"), "-q", "101"}, wantErr: "品質は1〜100の範囲で指定してください"},
+		{name: "ディレクトリで-rなし", args: []string{"optimize", dir}, wantErr: "--recursive (-r) フラグが必要です"},
+		{name: "不正な画像", args: []string{"optimize", filepath.Join(dir, "broken.png")}, wantErr: "最適化に失敗しました"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executeCompress(t, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestE2E_最適化_元のファイルを保持(t *testing.T) {
+	dir := t.TempDir()
+	// A small animated GIF is smaller than its APNG and animated WebP encodings.
+	pal := color.Palette{color.Black, color.White, color.Gray{Y: 128}}
+	g := &gif.GIF{}
+	for i := range pal {
+		img := image.NewPaletted(image.Rect(0, 0, 8, 8), pal)
+		for p := range img.Pix {
+			img.Pix[p] = uint8(i)
+		}
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "tiny.gif", buf.Bytes())
+
+	out, err := executeCompress(t, "optimize", filepath.Join(dir, "tiny.gif"))
+	if err != nil {
+		t.Fatalf("optimize error = %v\noutput:\n%s", err, out)
+	}
+	if !strings.Contains(out, "元のファイル (gif) ") || !strings.Contains(out, "元のファイルをそのまま出力しました") {
+		t.Errorf("元のファイルを保持した旨が出力にありません:\n%s", out)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "tiny_optimized.gif"))
+	if err != nil || !bytes.Equal(data, buf.Bytes()) {
+		t.Errorf("出力が元のファイルと一致しません (err = %v)", err)
+	}
+}
+
+func TestE2E_最適化_ディレクトリの出力衝突(t *testing.T) {
+	input := t.TempDir()
+	writeTestFile(t, input, "a.jpg", createTestJPEG(t, 16, 16, 90))
+	writeTestFile(t, input, "a.png", createTestPNG(t, 16, 16))
+
+	_, err := executeCompress(t, "optimize", input, "-r", "-o", filepath.Join(t.TempDir(), "out"))
+	if err == nil || !strings.Contains(err.Error(), "an earlier input") {
+		t.Errorf("error = %v, want an output collision", err)
+	}
+}
+
+func TestE2E_最適化_ディレクトリの再開とドライラン(t *testing.T) {
+	input := t.TempDir()
+	output := filepath.Join(t.TempDir(), "out")
+	writeTestFile(t, input, "a.jpg", createTestJPEG(t, 32, 32, 90))
+	writeTestFile(t, input, "b.png", createTestPNG(t, 32, 32))
+
+	// Each run is a subtest so that its flags are reset before the next one.
+	t.Run("ドライラン", func(t *testing.T) {
+		out, err := executeCompress(t, "optimize", input, "-r", "-o", output, "--dry-run")
+		if err != nil {
+			t.Fatalf("optimize --dry-run error = %v\noutput:\n%s", err, out)
+		}
+		if !strings.Contains(out, dryRunHeader) {
+			t.Errorf("出力にドライランの見出しがありません:\n%s", out)
+		}
+		if _, err := os.Stat(output); !os.IsNotExist(err) {
+			t.Errorf("--dry-run で出力先が作成されました: %v", err)
+		}
+	})
+	t.Run("実行", func(t *testing.T) {
+		if out, err := executeCompress(t, "optimize", input, "-r", "-o", output); err != nil {
+			t.Fatalf("optimize error = %v\noutput:\n%s", err, out)
+		}
+		if _, err := os.Stat(filepath.Join(output, journalFileName)); err != nil {
+			t.Errorf("ジャーナルが書き込まれていません: %v", err)
+		}
+	})
+	t.Run("再開", func(t *testing.T) {
+		out, err := executeCompress(t, "optimize", input, "-r", "-o", output, "--resume")
+		if err != nil {
+			t.Fatalf("optimize --resume error = %v\noutput:\n%s", err, out)
+		}
+		if !strings.Contains(out, "完了: 成功 2 (スキップ 2), 失敗 0") {
+			t.Errorf("再開時に完了済みのファイルがスキップされていません:\n%s", out)
+		}
+	})
+}
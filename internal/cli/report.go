@@ -0,0 +1,369 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	"github.com/spf13/viper"
+)
+
+// Report formats accepted by --report.
+const (
+	reportJSON  = "json"
+	reportCSV   = "csv"
+	reportJUnit = "junit"
+)
+
+// reportConfig selects the machine-readable report written after a batch.
+type reportConfig struct {
+	// command is the subcommand name, e.g. "compress".
+	command string
+	// format is one of the report formats, empty when no report is requested.
+	format string
+	path   string
+	dryRun bool
+	// manifest lists the items left out by the incremental scan, which are
+	// reported as skipped. It is nil without --incremental.
+	manifest *processor.Manifest
+}
+
+// loadReportConfig reads --report and --report-file of command from Viper.
+func loadReportConfig(command string) (reportConfig, error) {
+	rc := reportConfig{
+		command: command,
+		format:  strings.ToLower(viper.GetString(command + ".report")),
+		path:    viper.GetString(command + ".report_file"),
+	}
+	switch rc.format {
+	case "":
+		if rc.path != "" {
+			return rc, fmt.Errorf("--report-file には --report (json/csv/junit) を指定してください")
+		}
+	case reportJSON, reportCSV, reportJUnit:
+		if rc.path == "" {
+			return rc, fmt.Errorf("--report には --report-file を指定してください")
+		}
+	default:
+		return rc, fmt.Errorf("不正なレポート形式です: %q (json/csv/junit を指定してください)", rc.format)
+	}
+	return rc, nil
+}
+
+// Reasons an item was skipped, reported as skip_reason.
+const (
+	// skipJournal marks items completed by a previous run and skipped by --resume.
+	skipJournal = "journal"
+	// skipManifest marks unchanged items left out by --incremental.
+	skipManifest = "manifest"
+)
+
+// reportItem is the report entry of one BatchResult.
+type reportItem struct {
+	Input        string  `json:"input"`
+	Output       string  `json:"output"`
+	Format       string  `json:"format,omitempty"`
+	OriginalSize int64   `json:"original_size"`
+	OutputSize   int64   `json:"output_size"`
+	SavedPercent float64 `json:"saved_percent"`
+	DurationMS   float64 `json:"duration_ms"`
+	DecodeMS     float64 `json:"decode_ms,omitempty"`
+	TransformMS  float64 `json:"transform_ms,omitempty"`
+	EncodeMS     float64 `json:"encode_ms,omitempty"`
+	InputWidth   int     `json:"input_width,omitempty"`
+	InputHeight  int     `json:"input_height,omitempty"`
+	OutputWidth  int     `json:"output_width,omitempty"`
+	OutputHeight int     `json:"output_height,omitempty"`
+	Skipped      bool    `json:"skipped,omitempty"`
+	SkipReason   string  `json:"skip_reason,omitempty"`
+	KeptOriginal bool    `json:"kept_original,omitempty"`
+	Aborted      bool    `json:"aborted,omitempty"`
+	Attempts     int     `json:"attempts,omitempty"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// reportTotals aggregates the items of a report. Sizes and stage durations
+// only count successful items; throughput is measured over the whole batch.
+// Items aborted by the failure policy are counted in Aborted, not in Failed.
+// Items left out by the incremental scan are only counted in Files and Skipped.
+type reportTotals struct {
+	Files          int     `json:"files"`
+	Succeeded      int     `json:"succeeded"`
+	Failed         int     `json:"failed"`
+	Skipped        int     `json:"skipped"`
+	Aborted        int     `json:"aborted"`
+	OriginalSize   int64   `json:"original_size"`
+	OutputSize     int64   `json:"output_size"`
+	SavedBytes     int64   `json:"saved_bytes"`
+	SavedPercent   float64 `json:"saved_percent"`
+	DurationMS     float64 `json:"duration_ms"`
+	DecodeMS       float64 `json:"decode_ms"`
+	TransformMS    float64 `json:"transform_ms"`
+	EncodeMS       float64 `json:"encode_ms"`
+	FilesPerSecond float64 `json:"files_per_second"`
+	MBPerSecond    float64 `json:"mb_per_second"`
+}
+
+// batchReport is the machine-readable summary of a batch.
+type batchReport struct {
+	Command string       `json:"command"`
+	DryRun  bool         `json:"dry_run,omitempty"`
+	Items   []reportItem `json:"items"`
+	Totals  reportTotals `json:"totals"`
+}
+
+// newBatchReport builds the report of results. elapsed is the wall-clock time of the whole batch.
+func newBatchReport(rc reportConfig, results []processor.BatchResult, elapsed time.Duration) batchReport {
+	r := batchReport{Command: rc.command, DryRun: rc.dryRun, Items: make([]reportItem, 0, len(results))}
+	var total processor.Result
+	var stages processor.Stats
+	for _, res := range results {
+		item := reportItem{
+			Input:        res.Item.InputPath,
+			Output:       res.OutputPath(),
+			DurationMS:   milliseconds(res.Duration),
+			Skipped:      res.Skipped,
+			KeptOriginal: res.KeptOriginal,
+			Aborted:      res.Aborted,
+			Attempts:     res.Attempts,
+		}
+		if res.IsSuccess() {
+			item.Format = res.Result.Format.String()
+			item.OriginalSize = res.Result.OriginalSize
+			item.OutputSize = res.Result.CompressedSize
+			item.SavedPercent = round2(res.Result.SavedPercentage())
+			st := res.Result.Stats
+			item.DecodeMS = milliseconds(st.DecodeDuration)
+			item.TransformMS = milliseconds(st.TransformDuration)
+			item.EncodeMS = milliseconds(st.EncodeDuration)
+			item.InputWidth, item.InputHeight = st.InputWidth, st.InputHeight
+			item.OutputWidth, item.OutputHeight = st.OutputWidth, st.OutputHeight
+			stages.Add(st)
+			total.OriginalSize += res.Result.OriginalSize
+			total.CompressedSize += res.Result.CompressedSize
+			r.Totals.Succeeded++
+			if res.Skipped {
+				item.SkipReason = skipJournal
+				r.Totals.Skipped++
+			}
+		} else {
+			if res.Error != nil {
+				item.Error = res.Error.Error()
+			}
+			if res.Aborted {
+				r.Totals.Aborted++
+			} else {
+				r.Totals.Failed++
+			}
+		}
+		r.Items = append(r.Items, item)
+	}
+	if rc.manifest != nil {
+		for _, e := range rc.manifest.SkippedEntries() {
+			r.Items = append(r.Items, reportItem{Input: e.InputPath, Output: e.OutputPath, Skipped: true, SkipReason: skipManifest})
+			r.Totals.Skipped++
+		}
+	}
+	r.Totals.Files = len(r.Items)
+	r.Totals.OriginalSize = total.OriginalSize
+	r.Totals.OutputSize = total.CompressedSize
+	r.Totals.SavedBytes = total.SavedBytes()
+	r.Totals.SavedPercent = round2(total.SavedPercentage())
+	r.Totals.DurationMS = milliseconds(elapsed)
+	r.Totals.DecodeMS = milliseconds(stages.DecodeDuration)
+	r.Totals.TransformMS = milliseconds(stages.TransformDuration)
+	r.Totals.EncodeMS = milliseconds(stages.EncodeDuration)
+	if secs := elapsed.Seconds(); secs > 0 {
+		r.Totals.FilesPerSecond = round2(float64(r.Totals.Files) / secs)
+		r.Totals.MBPerSecond = round2(float64(total.OriginalSize) / 1e6 / secs)
+	}
+	return r
+}
+
+// writeReport writes the report of results to the configured file. It does
+// nothing when no report was requested.
+func (rc reportConfig) writeReport(results []processor.BatchResult, elapsed time.Duration) error {
+	if rc.format == "" {
+		return nil
+	}
+	if dir := filepath.Dir(rc.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("レポートの出力ディレクトリの作成に失敗しました: %w", err)
+		}
+	}
+	f, err := os.Create(rc.path)
+	if err != nil {
+		return fmt.Errorf("レポートファイルの作成に失敗しました: %w", err)
+	}
+
+	r := newBatchReport(rc, results, elapsed)
+	switch rc.format {
+	case reportJSON:
+		err = r.writeJSON(f)
+	case reportCSV:
+		err = r.writeCSV(f)
+	case reportJUnit:
+		err = r.writeJUnit(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("レポートの書き込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+func (r batchReport) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// writeCSV writes one row per item followed by a "TOTAL" row with the
+// aggregates. The TOTAL row holds the number of items in the skipped,
+// kept_original and aborted columns.
+func (r batchReport) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"input", "output", "format", "original_size", "output_size", "saved_percent", "duration_ms", "skipped", "skip_reason", "kept_original", "aborted", "error"})
+	kept := 0
+	for _, it := range r.Items {
+		if it.KeptOriginal {
+			kept++
+		}
+		_ = cw.Write([]string{
+			it.Input, it.Output, it.Format,
+			strconv.FormatInt(it.OriginalSize, 10), strconv.FormatInt(it.OutputSize, 10),
+			formatFloat(it.SavedPercent), formatFloat(it.DurationMS),
+			strconv.FormatBool(it.Skipped), it.SkipReason, strconv.FormatBool(it.KeptOriginal), strconv.FormatBool(it.Aborted),
+			it.Error,
+		})
+	}
+	t := r.Totals
+	_ = cw.Write([]string{
+		"TOTAL", "", "",
+		strconv.FormatInt(t.OriginalSize, 10), strconv.FormatInt(t.OutputSize, 10),
+		formatFloat(t.SavedPercent), formatFloat(t.DurationMS),
+		strconv.Itoa(t.Skipped), "", strconv.Itoa(kept), strconv.Itoa(t.Aborted),
+		"",
+	})
+	cw.Flush()
+	return cw.Error()
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnit writes the report as a JUnit XML test suite with one test case
+// per item. The aggregates are stored as suite properties.
+func (r batchReport) writeJUnit(w io.Writer) error {
+	t := r.Totals
+	suite := junitTestSuite{
+		Name:     "img-cli " + r.Command,
+		Tests:    t.Files,
+		Failures: t.Failed,
+		Skipped:  t.Skipped + t.Aborted,
+		Time:     seconds(t.DurationMS),
+		Properties: []junitProperty{
+			{Name: "original_size", Value: strconv.FormatInt(t.OriginalSize, 10)},
+			{Name: "output_size", Value: strconv.FormatInt(t.OutputSize, 10)},
+			{Name: "saved_bytes", Value: strconv.FormatInt(t.SavedBytes, 10)},
+			{Name: "saved_percent", Value: formatFloat(t.SavedPercent)},
+		},
+	}
+	for _, it := range r.Items {
+		tc := junitTestCase{ClassName: r.Command, Name: it.Input, Time: seconds(it.DurationMS)}
+		switch {
+		case it.Aborted:
+			tc.Skipped = &junitMessage{Message: it.Error}
+		case it.Error != "":
+			tc.Failure = &junitMessage{Message: it.Error}
+		case it.Skipped:
+			tc.Skipped = &junitMessage{Message: it.SkipReason}
+		default:
+			tc.SystemOut = fmt.Sprintf("%s: %d -> %d bytes (%s%%)", it.Output, it.OriginalSize, it.OutputSize, formatFloat(it.SavedPercent))
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	doc := junitTestSuites{
+		Name:     "img-cli",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// milliseconds returns d in milliseconds with microsecond precision.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// seconds formats a duration in milliseconds as seconds for JUnit.
+func seconds(ms float64) string {
+	return strconv.FormatFloat(ms/1000, 'f', 3, 64)
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
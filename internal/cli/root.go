@@ -15,6 +15,10 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "設定ファイルのパス (デフォルト: ~/.image-compresser.yaml)")
 	rootCmd.AddCommand(compressCmd)
 	rootCmd.AddCommand(convertCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(infoCmd)
+	rootCmd.AddCommand(compareCmd)
+	rootCmd.AddCommand(optimizeCmd)
 }
 
 // Execute runs the root command.
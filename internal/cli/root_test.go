@@ -25,7 +25,7 @@ func TestExecute_バージョン表示(t *testing.T) {
 }
 
 func TestRootCmd_サブコマンド存在確認(t *testing.T) {
-	expected := []string{"compress", "convert"}
+	expected := []string{"compress", "convert", "watch", "info", "compare", "optimize"}
 	for _, name := range expected {
 		found := false
 		for _, cmd := range rootCmd.Commands() {
@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// lokiIgnoreFile is the ignore file always honored by directory scans.
+const lokiIgnoreFile = ".lokiignore"
+
+// scanFlags holds the directory scan filter flags shared by compress and convert.
+type scanFlags struct {
+	include    []string
+	exclude    []string
+	maxDepth   int
+	gitignore  bool
+	symlinks   string
+	skipHidden bool
+}
+
+var (
+	compressScan scanFlags
+	convertScan  scanFlags
+)
+
+// register adds the scan filter flags to cmd.
+func (f *scanFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&f.include, "include", nil, "対象にするファイルのglobパターン (例: '**/*.png')。複数指定可")
+	cmd.Flags().StringSliceVar(&f.exclude, "exclude", nil, "除外するファイル・ディレクトリのglobパターン (例: 'node_modules/**')。複数指定可")
+	cmd.Flags().IntVar(&f.maxDepth, "max-depth", 0, "走査するディレクトリの深さ。1は直下のファイルのみ、0は無制限")
+	cmd.Flags().BoolVar(&f.gitignore, "gitignore", false, ".gitignore に一致するファイルを除外する (.lokiignore は常に参照)")
+	cmd.Flags().StringVar(&f.symlinks, "symlinks", "files", "シンボリックリンクの扱い (files/follow/skip)")
+	cmd.Flags().BoolVar(&f.skipHidden, "skip-hidden", false, "ドットで始まる隠しファイル・ディレクトリを除外する")
+}
+
+// bindScanFlags binds the scan filter flags of cmd to Viper keys under prefix.
+func bindScanFlags(cmd *cobra.Command, prefix string) {
+	_ = viper.BindPFlag(prefix+".include", cmd.Flags().Lookup("include"))
+	_ = viper.BindPFlag(prefix+".exclude", cmd.Flags().Lookup("exclude"))
+	_ = viper.BindPFlag(prefix+".max_depth", cmd.Flags().Lookup("max-depth"))
+	_ = viper.BindPFlag(prefix+".gitignore", cmd.Flags().Lookup("gitignore"))
+	_ = viper.BindPFlag(prefix+".symlinks", cmd.Flags().Lookup("symlinks"))
+	_ = viper.BindPFlag(prefix+".skip_hidden", cmd.Flags().Lookup("skip-hidden"))
+}
+
+// setScanDefaults sets the defaults of the scan filter keys under prefix.
+func setScanDefaults(prefix string) {
+	viper.SetDefault(prefix+".include", []string{})
+	viper.SetDefault(prefix+".exclude", []string{})
+	viper.SetDefault(prefix+".max_depth", 0)
+	viper.SetDefault(prefix+".gitignore", false)
+	viper.SetDefault(prefix+".symlinks", "files")
+	viper.SetDefault(prefix+".skip_hidden", false)
+}
+
+// scanFilter builds the scan filter from the Viper keys under prefix.
+func scanFilter(prefix string) (processor.ScanFilter, error) {
+	f := processor.ScanFilter{
+		Include:     viper.GetStringSlice(prefix + ".include"),
+		Exclude:     viper.GetStringSlice(prefix + ".exclude"),
+		MaxDepth:    viper.GetInt(prefix + ".max_depth"),
+		IgnoreFiles: []string{lokiIgnoreFile},
+		SkipHidden:  viper.GetBool(prefix + ".skip_hidden"),
+	}
+	if f.MaxDepth < 0 {
+		return f, fmt.Errorf("--max-depth は0以上で指定してください (指定値: %d)", f.MaxDepth)
+	}
+	if viper.GetBool(prefix + ".gitignore") {
+		f.IgnoreFiles = append([]string{".gitignore"}, f.IgnoreFiles...)
+	}
+
+	switch s := viper.GetString(prefix + ".symlinks"); strings.ToLower(s) {
+	case "files", "":
+		f.Symlinks = processor.SymlinkFiles
+	case "follow":
+		f.Symlinks = processor.SymlinkFollow
+	case "skip":
+		f.Symlinks = processor.SymlinkSkip
+	default:
+		return f, fmt.Errorf("不正なシンボリックリンクの扱いです: %q (files/follow/skip を指定してください)", s)
+	}
+	return f, nil
+}
+
+// outputTemplate parses the output path template under prefix, returning nil when unset.
+func outputTemplate(prefix string) (*processor.OutputTemplate, error) {
+	s := viper.GetString(prefix + ".output_template")
+	if s == "" {
+		return nil, nil
+	}
+	t, err := processor.ParseOutputTemplate(s)
+	if err != nil {
+		return nil, fmt.Errorf("不正な出力テンプレートです: %w", err)
+	}
+	return t, nil
+}
+
+// itemStream is a directory scan feeding a batch while it runs, so that
+// processing starts before the whole tree is scanned and the items are never
+// held at once.
+type itemStream struct {
+	first   processor.BatchItem
+	next    func() (processor.BatchItem, bool)
+	stop    func()
+	scanErr func() error
+}
+
+// startScan starts the scan seq, whose error is reported by scanErr, and
+// waits for its first item so that an empty scan is known up front. It
+// returns nil if the scan found no item. Call close once the stream is done.
+func startScan(seq iter.Seq[processor.BatchItem], scanErr func() error) (*itemStream, error) {
+	next, stop := iter.Pull(seq)
+	first, ok := next()
+	if !ok {
+		stop()
+		if err := scanErr(); err != nil {
+			return nil, fmt.Errorf("ディレクトリのスキャンに失敗しました: %w", err)
+		}
+		return nil, nil
+	}
+	return &itemStream{first: first, next: next, stop: stop, scanErr: scanErr}, nil
+}
+
+// close stops the scan if it is still running. s may be nil.
+func (s *itemStream) close() {
+	if s != nil {
+		s.stop()
+	}
+}
+
+// items yields every scanned item, the first one included.
+func (s *itemStream) items(yield func(processor.BatchItem) bool) {
+	for item, ok := s.first, true; ok; item, ok = s.next() {
+		if !yield(item) {
+			return
+		}
+	}
+}
+
+// process returns a batch process running the scanned items with
+// ProcessStream. The results are sorted by path, since they are yielded in
+// completion order.
+func (s *itemStream) process(ctx context.Context) func(*processor.DefaultBatchProcessor) ([]processor.BatchResult, error) {
+	return func(bp *processor.DefaultBatchProcessor) ([]processor.BatchResult, error) {
+		seq, streamErr := bp.ProcessStream(ctx, s.items)
+		var results []processor.BatchResult
+		for res := range seq {
+			results = append(results, res)
+		}
+		if err := streamErr(); err != nil {
+			return nil, err
+		}
+		if err := s.scanErr(); err != nil {
+			return nil, fmt.Errorf("ディレクトリのスキャンに失敗しました: %w", err)
+		}
+		slices.SortFunc(results, func(a, b processor.BatchResult) int {
+			return cmp.Or(cmp.Compare(a.Item.InputPath, b.Item.InputPath), cmp.Compare(a.Item.OutputPath, b.Item.OutputPath))
+		})
+		return results, nil
+	}
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/FrontWorksDev/Loki/internal/cli/tui"
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+)
+
+// printStats prints the elapsed time and throughput of the last progress
+// update, followed by the stage durations summed over the processed items.
+// Items restored from the journal are excluded from the breakdown.
+func printStats(out io.Writer, last processor.Progress, results []processor.BatchResult) {
+	var stages processor.Stats
+	for _, res := range results {
+		if res.IsSuccess() && !res.Skipped {
+			stages.Add(res.Result.Stats)
+		}
+	}
+	_, _ = fmt.Fprintf(out, "処理時間: %s (%s)\n", last.Elapsed.Round(time.Millisecond), tui.Throughput(last))
+	_, _ = fmt.Fprintf(out, "  内訳: %s\n", tui.Stages(stages))
+}
@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// stdioPath names standard input as the input and standard output as the
+// output, so the commands can be used in shell pipelines.
+const stdioPath = "-"
+
+// stdioName returns the name shown for path in messages.
+func stdioName(path string, input bool) string {
+	switch {
+	case path != stdioPath:
+		return path
+	case input:
+		return "標準入力"
+	default:
+		return "標準出力"
+	}
+}
+
+// usesStdio reports whether a single-image run reads standard input or
+// writes standard output. Input from standard input is written to standard
+// output unless --output names a file.
+func usesStdio(inputPath, outputPath string) bool {
+	return inputPath == stdioPath || outputPath == stdioPath
+}
+
+// readStdioInput reads the image at inputPath, or standard input for "-",
+// and returns it with its format. Standard input has no extension, so its
+// format is detected from the content.
+func readStdioInput(cmd *cobra.Command, inputPath string) ([]byte, processor.ImageFormat, error) {
+	if inputPath != stdioPath {
+		format, err := detectFormat(inputPath)
+		if err != nil {
+			return nil, 0, err
+		}
+		data, err := os.ReadFile(inputPath)
+		if err != nil {
+			return nil, 0, fmt.Errorf("入力ファイルを開けません: %w", err)
+		}
+		return data, format, nil
+	}
+
+	data, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return nil, 0, fmt.Errorf("標準入力の読み込みに失敗しました: %w", err)
+	}
+	format, err := processor.DetectFormat(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("標準入力の画像形式を判別できません: %w", err)
+	}
+	return data, format, nil
+}
+
+// writeStdioOutput writes data to standard output for "-", or atomically to
+// the file at outputPath.
+func writeStdioOutput(cmd *cobra.Command, outputPath string, data []byte) error {
+	if outputPath == stdioPath {
+		if _, err := cmd.OutOrStdout().Write(data); err != nil {
+			return fmt.Errorf("標準出力への書き込みに失敗しました: %w", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+		return fmt.Errorf("出力ディレクトリの作成に失敗しました: %w", err)
+	}
+	w, err := processor.LocalStorage{}.Create(cmd.Context(), outputPath)
+	if err != nil {
+		return fmt.Errorf("出力ファイルの作成に失敗しました: %w", err)
+	}
+	_, err = w.Write(data)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("出力ファイルの書き込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// compressStdio compresses one image read from inputPath or standard input
+// and writes it to the --output file or standard output. The output keeps
+// the input format; messages go to standard error so that standard output
+// only carries the image.
+func compressStdio(cmd *cobra.Command, inputPath string, opts processor.CompressOptions) error {
+	if err := rejectFlags("compress", "標準入出力", "in-place", "backup", "backup-dir", "output-template", "resume", "incremental"); err != nil {
+		return err
+	}
+	outputPath := viper.GetString("compress.output")
+	if outputPath == "" {
+		outputPath = stdioPath
+	}
+	report, err := loadReportConfig("compress")
+	if err != nil {
+		return err
+	}
+	dry := viper.GetBool("compress.dry_run")
+	report.dryRun = dry
+
+	data, format, err := readStdioInput(cmd, inputPath)
+	if err != nil {
+		return err
+	}
+	if !format.CanEncode() {
+		return fmt.Errorf("%sフォーマットは圧縮出力に対応していません。convertコマンドで変換してください", format)
+	}
+
+	start := time.Now()
+	var buf bytes.Buffer
+	result, err := processor.CompressPipeline(format, opts).Run(cmd.Context(), bytes.NewReader(data), &buf)
+	res := processor.BatchResult{
+		Item:     processor.BatchItem{InputPath: inputPath, OutputPath: outputPath, Options: opts},
+		Result:   result,
+		Error:    err,
+		Duration: time.Since(start),
+	}
+	if err == nil && viper.GetBool("compress.never_grow") && result.CompressedSize >= result.OriginalSize {
+		buf.Reset()
+		buf.Write(data)
+		result.CompressedSize = result.OriginalSize
+		res.KeptOriginal = true
+	}
+	if rerr := report.writeReport([]processor.BatchResult{res}, time.Since(start)); rerr != nil {
+		return rerr
+	}
+	if err != nil {
+		return fmt.Errorf("圧縮に失敗しました: %w", err)
+	}
+
+	out := cmd.ErrOrStderr()
+	if dry {
+		res.Item.InputPath = stdioName(inputPath, true)
+		_, _ = fmt.Fprintln(out, dryRunHeader)
+		printDryRun(out, []processor.BatchResult{res})
+		return nil
+	}
+	if err := writeStdioOutput(cmd, outputPath, buf.Bytes()); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(out, "圧縮完了: %s → %s\n", stdioName(inputPath, true), stdioName(outputPath, false))
+	_, _ = fmt.Fprintf(out, "  元サイズ: %d bytes\n", result.OriginalSize)
+	_, _ = fmt.Fprintf(out, "  圧縮後: %d bytes\n", result.CompressedSize)
+	_, _ = fmt.Fprintf(out, "  削減率: %.1f%%\n", result.SavedPercentage())
+	if res.KeptOriginal {
+		_, _ = fmt.Fprintln(out, "  圧縮しても小さくならないため元のファイルを保持しました")
+	}
+	return nil
+}
+
+// convertStdio converts one image read from inputPath or standard input to
+// targetFormat and writes it to the --output file or standard output, with
+// messages on standard error.
+func convertStdio(cmd *cobra.Command, inputPath string, targetFormat processor.ImageFormat, opts processor.ConvertOptions, allPages bool) error {
+	if err := rejectFlags("convert", "標準入出力", "output-template", "incremental"); err != nil {
+		return err
+	}
+	if allPages {
+		return fmt.Errorf("--pages all は標準入出力には使用できません")
+	}
+	outputPath := viper.GetString("convert.output")
+	if outputPath == "" {
+		outputPath = stdioPath
+	}
+	report, err := loadReportConfig("convert")
+	if err != nil {
+		return err
+	}
+	dry := viper.GetBool("convert.dry_run")
+	report.dryRun = dry
+
+	data, srcFormat, err := readStdioInput(cmd, inputPath)
+	if err != nil {
+		return err
+	}
+	if srcFormat == targetFormat {
+		return fmt.Errorf("入力ファイルは既に%sフォーマットです。同一フォーマットの圧縮にはcompressコマンドを使用してください", targetFormat)
+	}
+
+	start := time.Now()
+	var buf bytes.Buffer
+	result, err := processor.ConvertPipeline(opts).Run(cmd.Context(), bytes.NewReader(data), &buf)
+	res := processor.BatchResult{
+		Item:     processor.BatchItem{InputPath: inputPath, OutputPath: outputPath},
+		Result:   result,
+		Error:    err,
+		Duration: time.Since(start),
+	}
+	if rerr := report.writeReport([]processor.BatchResult{res}, time.Since(start)); rerr != nil {
+		return rerr
+	}
+	if err != nil {
+		return fmt.Errorf("変換に失敗しました: %w", err)
+	}
+
+	out := cmd.ErrOrStderr()
+	if dry {
+		res.Item.InputPath = stdioName(inputPath, true)
+		_, _ = fmt.Fprintln(out, dryRunHeader)
+		printDryRun(out, []processor.BatchResult{res})
+		return nil
+	}
+	if err := writeStdioOutput(cmd, outputPath, buf.Bytes()); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(out, "変換完了: %s → %s\n", stdioName(inputPath, true), stdioName(outputPath, false))
+	_, _ = fmt.Fprintf(out, "  元サイズ: %d bytes\n", result.OriginalSize)
+	_, _ = fmt.Fprintf(out, "  変換後: %d bytes\n", result.CompressedSize)
+	_, _ = fmt.Fprintf(out, "  フォーマット: %s → %s\n", srcFormat, targetFormat)
+	return nil
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	"github.com/spf13/viper"
+)
+
+// s3Scheme is the prefix of paths naming a directory of an S3-compatible
+// bucket, as in "s3://bucket/prefix".
+const s3Scheme = "s3://"
+
+// isS3URI reports whether p names a location in an S3-compatible bucket.
+func isS3URI(p string) bool {
+	return strings.HasPrefix(p, s3Scheme)
+}
+
+// parseS3URI splits an s3://bucket/prefix URI into the bucket and the prefix,
+// without leading or trailing slashes.
+func parseS3URI(uri string) (bucket, prefix string, err error) {
+	bucket, prefix, _ = strings.Cut(strings.TrimPrefix(uri, s3Scheme), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("S3 の URI にバケット名がありません: %s", uri)
+	}
+	return bucket, strings.Trim(prefix, "/"), nil
+}
+
+// defaultOutputDir returns inputDir with suffix appended, or "" when inputDir
+// is the root of a bucket, which has no sibling to write to.
+func defaultOutputDir(inputDir, suffix string) string {
+	if isS3URI(inputDir) {
+		if _, prefix, err := parseS3URI(inputDir); err != nil || prefix == "" {
+			return ""
+		}
+		return strings.TrimRight(inputDir, "/") + suffix
+	}
+	return filepath.Clean(inputDir) + suffix
+}
+
+// batchStorage returns the storage holding inputDir and outputDir and their
+// paths within it. Local paths use the local file system; s3:// URIs use the
+// bucket they name, configured from the AWS_* environment variables. Input
+// and output must be in the same storage.
+func batchStorage(inputDir, outputDir string) (processor.Storage, string, string, error) {
+	if outputDir == "" {
+		return nil, "", "", fmt.Errorf("バケットのルートを処理するには --output (-o) で出力先を指定してください")
+	}
+	if !isS3URI(inputDir) && !isS3URI(outputDir) {
+		return processor.LocalStorage{}, inputDir, outputDir, nil
+	}
+	if !isS3URI(inputDir) || !isS3URI(outputDir) {
+		return nil, "", "", fmt.Errorf("入力と出力は両方とも S3 か両方ともローカルのパスを指定してください")
+	}
+
+	bucket, inPrefix, err := parseS3URI(inputDir)
+	if err != nil {
+		return nil, "", "", err
+	}
+	outBucket, outPrefix, err := parseS3URI(outputDir)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if outBucket != bucket {
+		return nil, "", "", fmt.Errorf("入力と出力は同じバケットを指定してください (%s, %s)", bucket, outBucket)
+	}
+
+	s, err := processor.NewS3Storage(s3ConfigFromEnv(bucket))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("S3 の設定が不正です: %w", err)
+	}
+	return s, inPrefix, outPrefix, nil
+}
+
+// s3ConfigFromEnv returns the configuration of bucket from the environment
+// variables used by the AWS CLI.
+func s3ConfigFromEnv(bucket string) processor.S3Config {
+	return processor.S3Config{
+		Bucket:          bucket,
+		Region:          firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		Endpoint:        firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// firstEnv returns the first non-empty environment variable of names.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// rejectFlags rejects the flags under prefix that cannot be used with target,
+// e.g. the ones needing local files for S3 paths.
+func rejectFlags(prefix, target string, flags ...string) error {
+	for _, flag := range flags {
+		key := prefix + "." + strings.ReplaceAll(flag, "-", "_")
+		if v := viper.GetString(key); v != "" && v != "false" {
+			return fmt.Errorf("--%s は %sには使用できません", flag, target)
+		}
+	}
+	return nil
+}
@@ -22,3 +22,8 @@ type BatchCompleteMsg struct {
 type BatchErrorMsg struct {
 	Err error
 }
+
+// WatchResultMsg notifies the watch TUI that a file has been processed.
+type WatchResultMsg struct {
+	Result processor.BatchResult
+}
@@ -3,7 +3,9 @@ package tui
 import (
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/FrontWorksDev/Loki/pkg/processor"
 	"github.com/charmbracelet/bubbles/progress"
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -29,7 +31,11 @@ type Model struct {
 	totalFiles  int
 	completed   int
 	failed      int
+	skipped     int
+	aborted     int
 	currentFile string
+	last        processor.Progress
+	stages      processor.Stats
 	results     []BatchResultInfo
 	err         error
 }
@@ -81,10 +87,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		p := msg.Progress
 		m.completed = p.Completed
 		m.failed = p.Failed
+		m.skipped = p.Skipped
+		m.aborted = p.Aborted
 		m.currentFile = p.Current
+		m.last = p
+		if p.Total > 0 {
+			m.totalFiles = p.Total
+		}
 		var percent float64
 		if m.totalFiles > 0 {
-			percent = float64(m.completed+m.failed) / float64(m.totalFiles)
+			percent = float64(m.last.Finished()) / float64(m.totalFiles)
 		}
 		cmd := m.progress.SetPercent(percent)
 		return m, cmd
@@ -92,8 +104,12 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case BatchCompleteMsg:
 		m.state = StateCompleted
 		m.results = make([]BatchResultInfo, 0)
+		m.stages = processor.Stats{}
 		for _, r := range msg.Results {
-			if r.Error != nil {
+			if r.Result != nil && !r.Skipped {
+				m.stages.Add(r.Result.Stats)
+			}
+			if r.Error != nil && !r.Aborted {
 				m.results = append(m.results, BatchResultInfo{
 					InputPath: r.Item.InputPath,
 					Error:     r.Error.Error(),
@@ -126,17 +142,26 @@ func (m Model) View() string {
 		b.WriteString("\n  処理を開始しています...\n\n")
 
 	case StateProcessing:
-		processed := m.completed + m.failed
 		b.WriteString("\n")
 		b.WriteString("  " + m.progress.View() + "\n\n")
-		fmt.Fprintf(&b, "  [%d/%d] %s\n\n", processed, m.totalFiles, m.currentFile)
+		fmt.Fprintf(&b, "  %s %s\n", count(m.last.Finished(), m.totalFiles), m.currentFile)
+		fmt.Fprintf(&b, "  %s\n\n", Throughput(m.last))
 
 	case StateCompleted:
 		successCount := m.completed
-		failCount := m.failed
+		failCount := m.Failed()
 		b.WriteString("\n")
 		b.WriteString("  " + m.progress.View() + "\n\n")
-		fmt.Fprintf(&b, "  完了: 成功 %d, 失敗 %d\n", successCount, failCount)
+		if m.skipped > 0 {
+			fmt.Fprintf(&b, "  完了: 成功 %d (スキップ %d), 失敗 %d\n", successCount, m.skipped, failCount)
+		} else {
+			fmt.Fprintf(&b, "  完了: 成功 %d, 失敗 %d\n", successCount, failCount)
+		}
+		if m.aborted > 0 {
+			fmt.Fprintf(&b, "  %s\n", AbortedMessage(m.aborted))
+		}
+		fmt.Fprintf(&b, "  処理時間: %s (%s)\n", m.last.Elapsed.Round(time.Millisecond), Throughput(m.last))
+		fmt.Fprintf(&b, "  内訳: %s\n", Stages(m.stages))
 		if len(m.results) > 0 {
 			b.WriteString("\n  失敗ファイル:\n")
 			for _, r := range m.results {
@@ -157,7 +182,7 @@ func (m Model) State() State {
 	return m.state
 }
 
-// TotalFiles returns the total number of files to process.
+// TotalFiles returns the total number of files to process, 0 while unknown.
 func (m Model) TotalFiles() int {
 	return m.totalFiles
 }
@@ -167,11 +192,17 @@ func (m Model) Completed() int {
 	return m.completed
 }
 
-// Failed returns the number of failed files.
+// Failed returns the number of failed files, not counting the files aborted
+// by the failure policy.
 func (m Model) Failed() int {
 	return m.failed
 }
 
+// Aborted returns the number of files left unprocessed because the failure policy stopped the batch.
+func (m Model) Aborted() int {
+	return m.aborted
+}
+
 // CurrentFile returns the currently processing file name.
 func (m Model) CurrentFile() string {
 	return m.currentFile
@@ -181,3 +212,40 @@ func (m Model) CurrentFile() string {
 func (m Model) Err() error {
 	return m.err
 }
+
+// Throughput formats the rate and estimated remaining time of p, e.g.
+// "12.5 files/s, 3.40 MB/s, 残り 8s". The ETA is omitted once all files are done.
+func Throughput(p processor.Progress) string {
+	s := fmt.Sprintf("%.1f files/s, %.2f MB/s", p.FilesPerSecond, p.BytesPerSecond/1e6)
+	if p.Finished() < p.Total {
+		s += ", 残り " + p.ETA.Round(time.Second).String()
+	}
+	return s
+}
+
+// Count formats the number of files p has finished, e.g. "[3/10]", or
+// "[3]" when the total is unknown.
+func Count(p processor.Progress) string {
+	return count(p.Finished(), p.Total)
+}
+
+func count(done, total int) string {
+	if total <= 0 {
+		return fmt.Sprintf("[%d]", done)
+	}
+	return fmt.Sprintf("[%d/%d]", done, total)
+}
+
+// Stages formats the summed stage durations of st, e.g.
+// "デコード 120ms, 変換 4ms, エンコード 310ms".
+func Stages(st processor.Stats) string {
+	return fmt.Sprintf("デコード %s, 変換 %s, エンコード %s",
+		st.DecodeDuration.Round(time.Millisecond),
+		st.TransformDuration.Round(time.Millisecond),
+		st.EncodeDuration.Round(time.Millisecond))
+}
+
+// AbortedMessage reports that n files were left unprocessed by the failure policy.
+func AbortedMessage(n int) string {
+	return fmt.Sprintf("失敗が上限に達したため %d 件の処理を中止しました", n)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/FrontWorksDev/Loki/pkg/processor"
 	tea "github.com/charmbracelet/bubbletea"
@@ -92,6 +93,33 @@ func TestModel_ProgressMsg(t *testing.T) {
 	}
 }
 
+func TestModel_ProgressMsg_総数不明(t *testing.T) {
+	m := NewModel()
+	started, _ := m.Update(BatchStartMsg{})
+	updated, _ := started.(Model).Update(ProgressMsg{Progress: processor.Progress{Completed: 2, Current: "a.jpg"}})
+	um := updated.(Model)
+	if um.TotalFiles() != 0 {
+		t.Errorf("TotalFiles() = %d, want 0", um.TotalFiles())
+	}
+	if view := um.View(); !strings.Contains(view, "[2] a.jpg") {
+		t.Errorf("View() = %q, want it to contain %q", view, "[2] a.jpg")
+	}
+
+	updated, _ = um.Update(ProgressMsg{Progress: processor.Progress{Total: 4, Completed: 3, Current: "b.jpg"}})
+	if got := updated.(Model).TotalFiles(); got != 4 {
+		t.Errorf("TotalFiles() after a progress with a total = %d, want 4", got)
+	}
+}
+
+func TestCount(t *testing.T) {
+	if got := Count(processor.Progress{Total: 5, Completed: 2, Failed: 1}); got != "[3/5]" {
+		t.Errorf("Count() = %q, want [3/5]", got)
+	}
+	if got := Count(processor.Progress{Completed: 2}); got != "[2]" {
+		t.Errorf("Count() without a total = %q, want [2]", got)
+	}
+}
+
 func TestModel_BatchCompleteMsg(t *testing.T) {
 	m := NewModel()
 	started, _ := m.Update(BatchStartMsg{TotalFiles: 3})
@@ -183,11 +211,12 @@ func TestModel_View(t *testing.T) {
 				updated, _ = m.Update(ProgressMsg{
 					Progress: processor.Progress{
 						Total: 10, Completed: 3, Failed: 0, Current: "photo.jpg",
+						FilesPerSecond: 1.5, BytesPerSecond: 2_500_000, ETA: 4700 * time.Millisecond,
 					},
 				})
 				return updated.(Model)
 			},
-			contains: []string{"[3/10]", "photo.jpg"},
+			contains: []string{"[3/10]", "photo.jpg", "1.5 files/s", "2.50 MB/s", "残り 5s"},
 		},
 		{
 			name: "Completed状態",
@@ -199,12 +228,32 @@ func TestModel_View(t *testing.T) {
 					Progress: processor.Progress{Total: 2, Completed: 2, Failed: 0, Current: "b.jpg"},
 				})
 				m = updated.(Model)
+				updated, _ = m.Update(BatchCompleteMsg{
+					Results: []processor.BatchResult{
+						{Result: &processor.Result{Stats: processor.Stats{DecodeDuration: 12 * time.Millisecond, EncodeDuration: 30 * time.Millisecond}}},
+						{Result: &processor.Result{Stats: processor.Stats{DecodeDuration: 8 * time.Millisecond, EncodeDuration: 10 * time.Millisecond}}},
+					},
+				})
+				return updated.(Model)
+			},
+			contains: []string{"完了", "成功 2", "失敗 0", "処理時間", "デコード 20ms", "エンコード 40ms"},
+		},
+		{
+			name: "Completed状態_スキップあり",
+			setup: func() Model {
+				m := NewModel()
+				updated, _ := m.Update(BatchStartMsg{TotalFiles: 3})
+				m = updated.(Model)
+				updated, _ = m.Update(ProgressMsg{
+					Progress: processor.Progress{Total: 3, Completed: 3, Skipped: 2, Current: "c.jpg"},
+				})
+				m = updated.(Model)
 				updated, _ = m.Update(BatchCompleteMsg{
 					Results: []processor.BatchResult{},
 				})
 				return updated.(Model)
 			},
-			contains: []string{"完了", "成功 2", "失敗 0"},
+			contains: []string{"成功 3 (スキップ 2)", "失敗 0"},
 		},
 		{
 			name: "Completed状態_失敗あり",
@@ -225,6 +274,26 @@ func TestModel_View(t *testing.T) {
 			},
 			contains: []string{"完了", "成功 1", "失敗 1", "失敗ファイル", "bad.jpg", "decode error"},
 		},
+		{
+			name: "Completed状態_中止あり",
+			setup: func() Model {
+				m := NewModel()
+				updated, _ := m.Update(BatchStartMsg{TotalFiles: 4})
+				m = updated.(Model)
+				updated, _ = m.Update(ProgressMsg{
+					Progress: processor.Progress{Total: 4, Completed: 1, Failed: 1, Aborted: 2, Current: "d.jpg"},
+				})
+				m = updated.(Model)
+				updated, _ = m.Update(BatchCompleteMsg{
+					Results: []processor.BatchResult{
+						{Item: processor.BatchItem{InputPath: "bad.jpg"}, Error: errors.New("decode error")},
+						{Item: processor.BatchItem{InputPath: "c.jpg"}, Error: processor.ErrBatchAborted, Aborted: true},
+					},
+				})
+				return updated.(Model)
+			},
+			contains: []string{"成功 1", "失敗 1", "2 件の処理を中止しました", "bad.jpg"},
+		},
 		{
 			name: "Error状態",
 			setup: func() Model {
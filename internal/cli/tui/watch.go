@@ -0,0 +1,113 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// watchHistory is the number of recent results shown by WatchModel.
+const watchHistory = 10
+
+// WatchModel is the Bubble Tea model for watch mode. It shows the running
+// totals and the most recent results until the user quits.
+type WatchModel struct {
+	dir       string
+	outputDir string
+	succeeded int
+	failed    int
+	saved     int64
+	recent    []string
+	err       error
+}
+
+// NewWatchModel creates a watch model for dir writing to outputDir.
+func NewWatchModel(dir, outputDir string) WatchModel {
+	return WatchModel{dir: dir, outputDir: outputDir}
+}
+
+// Init implements tea.Model.
+func (m WatchModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model.
+func (m WatchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c", "esc":
+			return m, tea.Quit
+		}
+
+	case WatchResultMsg:
+		r := msg.Result
+		if r.IsSuccess() {
+			m.succeeded++
+			m.saved += r.Result.OriginalSize - r.Result.CompressedSize
+		} else {
+			m.failed++
+		}
+		m.recent = append([]string{WatchLine(r)}, m.recent...)
+		if len(m.recent) > watchHistory {
+			m.recent = m.recent[:watchHistory]
+		}
+		return m, nil
+
+	case BatchErrorMsg:
+		m.err = msg.Err
+		return m, tea.Quit
+	}
+
+	return m, nil
+}
+
+// View implements tea.Model.
+func (m WatchModel) View() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "\n  監視中: %s → %s\n", m.dir, m.outputDir)
+	fmt.Fprintf(&b, "  成功 %d, 失敗 %d, 削減 %d bytes\n\n", m.succeeded, m.failed, m.saved)
+	if len(m.recent) == 0 {
+		b.WriteString("  ファイルの追加・更新を待っています...\n")
+	}
+	for _, line := range m.recent {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	b.WriteString("\n  qキーで終了\n\n")
+
+	return b.String()
+}
+
+// Succeeded returns the number of files processed successfully.
+func (m WatchModel) Succeeded() int {
+	return m.succeeded
+}
+
+// Failed returns the number of files that failed.
+func (m WatchModel) Failed() int {
+	return m.failed
+}
+
+// Recent returns the lines of the most recent results, newest first.
+func (m WatchModel) Recent() []string {
+	return m.recent
+}
+
+// Err returns the error that stopped watching, if any.
+func (m WatchModel) Err() error {
+	return m.err
+}
+
+// WatchLine formats one result of watch mode, e.g.
+// "photo.png → out/photo.png (52340 → 20110 bytes, 61.6% 削減)".
+func WatchLine(r processor.BatchResult) string {
+	if !r.IsSuccess() {
+		return fmt.Sprintf("エラー: %s: %v", r.Item.InputPath, r.Error)
+	}
+	return fmt.Sprintf("%s → %s (%d → %d bytes, %.1f%% 削減)",
+		r.Item.InputPath, r.Item.OutputPath,
+		r.Result.OriginalSize, r.Result.CompressedSize, r.Result.SavedPercentage())
+}
@@ -0,0 +1,73 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestWatchModel_WatchResultMsg(t *testing.T) {
+	var m tea.Model = NewWatchModel("in", "out")
+	if !strings.Contains(m.View(), "待っています") {
+		t.Errorf("View() = %q, want waiting message", m.View())
+	}
+
+	for i := range watchHistory + 2 {
+		m, _ = m.Update(WatchResultMsg{Result: processor.BatchResult{
+			Item:   processor.BatchItem{InputPath: fmt.Sprintf("in/%d.png", i), OutputPath: fmt.Sprintf("out/%d.png", i)},
+			Result: &processor.Result{OriginalSize: 1000, CompressedSize: 400},
+		}})
+	}
+	m, _ = m.Update(WatchResultMsg{Result: processor.BatchResult{
+		Item:  processor.BatchItem{InputPath: "in/broken.png"},
+		Error: errors.New("decode failed"),
+	}})
+
+	wm := m.(WatchModel)
+	if wm.Succeeded() != watchHistory+2 || wm.Failed() != 1 {
+		t.Errorf("Succeeded() = %d, Failed() = %d, want %d and 1", wm.Succeeded(), wm.Failed(), watchHistory+2)
+	}
+	recent := wm.Recent()
+	if len(recent) != watchHistory {
+		t.Fatalf("len(Recent()) = %d, want %d", len(recent), watchHistory)
+	}
+	if recent[0] != "エラー: in/broken.png: decode failed" {
+		t.Errorf("Recent()[0] = %q, want the newest result", recent[0])
+	}
+	if recent[1] != "in/11.png → out/11.png (1000 → 400 bytes, 60.0% 削減)" {
+		t.Errorf("Recent()[1] = %q", recent[1])
+	}
+
+	view := wm.View()
+	for _, want := range []string{"監視中: in → out", "成功 12, 失敗 1, 削減 7200 bytes", "in/11.png"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("View() does not contain %q:\n%s", want, view)
+		}
+	}
+	if strings.Contains(view, "in/0.png") {
+		t.Errorf("View() shows a result beyond the history:\n%s", view)
+	}
+}
+
+func TestWatchModel_BatchErrorMsg(t *testing.T) {
+	m := NewWatchModel("in", "out")
+	updated, cmd := m.Update(BatchErrorMsg{Err: errors.New("watch failed")})
+	if cmd == nil {
+		t.Error("BatchErrorMsg should quit")
+	}
+	if err := updated.(WatchModel).Err(); err == nil || err.Error() != "watch failed" {
+		t.Errorf("Err() = %v, want watch failed", err)
+	}
+}
+
+func TestWatchModel_Quit(t *testing.T) {
+	m := NewWatchModel("in", "out")
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")})
+	if cmd == nil {
+		t.Error("q key should quit")
+	}
+}
@@ -0,0 +1,391 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/FrontWorksDev/Loki/internal/cli/tui"
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	watchTo        string
+	watchFormat    string
+	watchQuality   int
+	watchLevel     string
+	watchRecursive bool
+	watchUseTUI    bool
+	watchToSRGB    bool
+	watchDither    bool
+	watchDebounce  time.Duration
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <dir>",
+	Short: "ディレクトリを監視して追加・更新された画像を自動で圧縮する",
+	Long: `ディレクトリを監視し、追加・更新された画像ファイルを自動で圧縮または変換します。
+
+--format を省略すると compress と同じく元の形式のまま圧縮し、指定すると
+その形式に変換します。出力先は --to で指定します (省略時は {dir}_compressed
+または {dir}_converted)。入力ディレクトリからの相対パスを保ったまま書き出します。
+
+書き込み中のファイルを途中で処理しないよう、最後の変更から --debounce の間
+(既定 500ms) 変更がなくなってから処理します。出力先ディレクトリ、ドットで始まる
+隠しファイル、自身が書き出したファイルへの変更は無視します。起動前からある
+ファイルは処理しません。Ctrl+C (--tui では q キー) で終了します。
+
+例:
+  img-cli watch exports/ --to optimized/
+  img-cli watch exports/ --to optimized/ -r -q 80
+  img-cli watch exports/ --to webp/ -f webp --tui`,
+	Args: cobra.ExactArgs(1),
+	RunE: runWatch,
+}
+
+func init() {
+	watchCmd.Flags().StringVar(&watchTo, "to", "", "出力先ディレクトリ (省略時は自動生成)")
+	watchCmd.Flags().StringVarP(&watchFormat, "format", "f", "", "変換する出力フォーマット (jpeg/jpg/png/webp/tiff/tif/gif)。省略時は元の形式のまま圧縮する")
+	watchCmd.Flags().IntVarP(&watchQuality, "quality", "q", 0, "JPEG/WebP品質 (1-100)。0の場合はlevelに基づく")
+	watchCmd.Flags().StringVarP(&watchLevel, "level", "l", "medium", "圧縮レベル (low/medium/high)")
+	watchCmd.Flags().BoolVarP(&watchRecursive, "recursive", "r", false, "サブディレクトリも監視する")
+	watchCmd.Flags().BoolVar(&watchUseTUI, "tui", false, "TUIモードで最近の処理結果を表示する")
+	watchCmd.Flags().BoolVar(&watchToSRGB, "srgb", false, "埋め込みICCプロファイルを使ってsRGBに変換する")
+	watchCmd.Flags().BoolVar(&watchDither, "dither", false, "16bit画像をディザリングして8bitに減色する")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", processor.DefaultWatchDebounce, "最後の変更から処理を始めるまでの待ち時間")
+}
+
+// bindWatchFlags binds watch command flags to Viper keys.
+// Called from initConfig() so bindings are re-established after viper.Reset().
+func bindWatchFlags() {
+	_ = viper.BindPFlag("watch.to", watchCmd.Flags().Lookup("to"))
+	_ = viper.BindPFlag("watch.format", watchCmd.Flags().Lookup("format"))
+	_ = viper.BindPFlag("watch.quality", watchCmd.Flags().Lookup("quality"))
+	_ = viper.BindPFlag("watch.level", watchCmd.Flags().Lookup("level"))
+	_ = viper.BindPFlag("watch.recursive", watchCmd.Flags().Lookup("recursive"))
+	_ = viper.BindPFlag("watch.srgb", watchCmd.Flags().Lookup("srgb"))
+	_ = viper.BindPFlag("watch.dither", watchCmd.Flags().Lookup("dither"))
+	_ = viper.BindPFlag("watch.debounce", watchCmd.Flags().Lookup("debounce"))
+}
+
+// watchRun holds the settings of a watch run.
+type watchRun struct {
+	inputDir  string
+	outputDir string
+	// convert is true when --format is set; the files are then converted
+	// to opts.Format instead of compressed in their own format.
+	convert bool
+	opts    processor.ConvertOptions
+	outputs *ownOutputs
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	inputDir := args[0]
+	info, err := os.Stat(inputDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("入力パスが存在しません: %s", inputDir)
+		}
+		return fmt.Errorf("入力パスの確認に失敗しました: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("監視するディレクトリを指定してください: %s", inputDir)
+	}
+
+	q := viper.GetInt("watch.quality")
+	if q != 0 && (q < 1 || q > 100) {
+		return fmt.Errorf("品質は1〜100の範囲で指定してください (指定値: %d)", q)
+	}
+	compLevel, err := parseCompressionLevel(viper.GetString("watch.level"))
+	if err != nil {
+		return err
+	}
+	debounce := viper.GetDuration("watch.debounce")
+	if debounce <= 0 {
+		return fmt.Errorf("--debounce は0より大きい値で指定してください (指定値: %s)", debounce)
+	}
+
+	run := watchRun{
+		opts: processor.ConvertOptions{
+			CompressOptions: processor.CompressOptions{
+				Quality:       q,
+				Level:         compLevel,
+				ConvertToSRGB: viper.GetBool("watch.srgb"),
+				DitherTo8Bit:  viper.GetBool("watch.dither"),
+			},
+		},
+	}
+	suffix := "_compressed"
+	if f := viper.GetString("watch.format"); f != "" {
+		if run.opts.Format, err = parseImageFormat(f); err != nil {
+			return err
+		}
+		run.convert = true
+		suffix = "_converted"
+	}
+	outputDir := viper.GetString("watch.to")
+	if outputDir == "" {
+		outputDir = defaultOutputDir(inputDir, suffix)
+	}
+	if run.inputDir, err = filepath.Abs(inputDir); err != nil {
+		return fmt.Errorf("入力パスの確認に失敗しました: %w", err)
+	}
+	if run.outputDir, err = filepath.Abs(outputDir); err != nil {
+		return fmt.Errorf("出力パスの確認に失敗しました: %w", err)
+	}
+	run.outputs = newOwnOutputs(run.outputDir == run.inputDir)
+
+	watchOpts := []processor.WatchOption{processor.WithWatchDebounce(debounce)}
+	if rel, err := filepath.Rel(run.inputDir, run.outputDir); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		// Outputs written into the watched directory itself are told apart by run.outputs.
+		watchOpts = append(watchOpts, processor.WithWatchIgnore(run.outputDir))
+	}
+	if viper.GetBool("watch.recursive") {
+		watchOpts = append(watchOpts, processor.WithWatchRecursive())
+	}
+	watcher, err := processor.NewWatcher(run.inputDir, watchOpts...)
+	if err != nil {
+		return fmt.Errorf("ディレクトリの監視を開始できません: %w", err)
+	}
+	defer func() { _ = watcher.Close() }()
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if watchUseTUI {
+		return watchWithTUI(ctx, run, watcher)
+	}
+	return watchWithText(ctx, cmd, run, watcher)
+}
+
+func watchWithText(ctx context.Context, cmd *cobra.Command, run watchRun, watcher *processor.Watcher) error {
+	out := cmd.OutOrStdout()
+	errOut := cmd.ErrOrStderr()
+
+	_, _ = fmt.Fprintf(out, "監視中: %s → %s (Ctrl+Cで終了)\n", run.inputDir, run.outputDir)
+
+	succeeded, failed := 0, 0
+	results, streamErr := run.process(ctx, watcher)
+	for res := range results {
+		w := out
+		if res.IsSuccess() {
+			succeeded++
+		} else {
+			failed++
+			w = errOut
+		}
+		_, _ = fmt.Fprintf(w, "  %s [成功 %d, 失敗 %d]\n", tui.WatchLine(res), succeeded, failed)
+	}
+	if err := errors.Join(streamErr(), watcher.Err()); err != nil {
+		return fmt.Errorf("ディレクトリの監視に失敗しました: %w", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "監視を終了しました: 成功 %d, 失敗 %d\n", succeeded, failed)
+	return nil
+}
+
+func watchWithTUI(ctx context.Context, run watchRun, watcher *processor.Watcher) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p := tea.NewProgram(tui.NewWatchModel(run.inputDir, run.outputDir))
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		results, streamErr := run.process(ctx, watcher)
+		for res := range results {
+			p.Send(tui.WatchResultMsg{Result: res})
+		}
+		if err := errors.Join(streamErr(), watcher.Err()); err != nil {
+			p.Send(tui.BatchErrorMsg{Err: err})
+			return
+		}
+		// Quit when watching ends on a signal rather than from the TUI.
+		p.Quit()
+	})
+
+	finalModel, err := p.Run()
+	cancel()
+	wg.Wait()
+	if err != nil {
+		return fmt.Errorf("TUIの実行に失敗しました: %w", err)
+	}
+
+	fm := finalModel.(tui.WatchModel)
+	if fm.Err() != nil {
+		return fmt.Errorf("ディレクトリの監視に失敗しました: %w", fm.Err())
+	}
+	return nil
+}
+
+// process compresses or converts every file yielded by watcher on the batch
+// workers and yields the results as they complete. A file changed while its
+// output was being written is requeued once the write is done. Results of
+// items cancelled because watching stopped are left out.
+func (r watchRun) process(ctx context.Context, watcher *processor.Watcher) (iter.Seq[processor.BatchResult], func() error) {
+	items := func(yield func(processor.BatchItem) bool) {
+		for path := range watcher.Files(ctx) {
+			if item, ok := r.item(path); ok && !yield(item) {
+				return
+			}
+		}
+	}
+	results, streamErr := processor.NewDefaultBatchProcessor().ProcessStream(ctx, items)
+
+	seq := func(yield func(processor.BatchResult) bool) {
+		for res := range results {
+			if input, ok := r.outputs.done(res.Item.OutputPath, res.IsSuccess()); ok {
+				watcher.Requeue(input)
+			}
+			if ctx.Err() != nil && errors.Is(res.Error, context.Canceled) {
+				continue
+			}
+			if !yield(res) {
+				return
+			}
+		}
+	}
+	return seq, streamErr
+}
+
+// item returns the item compressing or converting the file at path, or
+// false if the file is not to be processed.
+func (r watchRun) item(path string) (processor.BatchItem, bool) {
+	if r.convert {
+		return r.convertItem(path)
+	}
+	return r.compressItem(path)
+}
+
+// compressItem returns the item compressing the file at path into the
+// output directory, or false if the file is not to be processed.
+func (r watchRun) compressItem(path string) (processor.BatchItem, bool) {
+	format, err := detectFormat(path)
+	if err != nil || !format.CanEncode() {
+		return processor.BatchItem{}, false
+	}
+	outputPath, ok := r.outputPath(path, filepath.Ext(path))
+	if !ok {
+		return processor.BatchItem{}, false
+	}
+	return processor.BatchItem{InputPath: path, OutputPath: outputPath, Options: r.opts.CompressOptions}, true
+}
+
+// convertItem returns the item converting the file at path into the output
+// directory, or false if the file is not to be processed. Files already in
+// the target format are left out.
+func (r watchRun) convertItem(path string) (processor.BatchItem, bool) {
+	format, err := detectFormat(path)
+	if err != nil || format == r.opts.Format {
+		return processor.BatchItem{}, false
+	}
+	outputPath, ok := r.outputPath(path, r.opts.Format.Extension())
+	if !ok {
+		return processor.BatchItem{}, false
+	}
+	return processor.ConvertItem(path, outputPath, r.opts), true
+}
+
+// outputPath returns the output of the file at path, keeping its path
+// relative to the input directory and replacing its extension with ext.
+// It returns false for files written by the run itself.
+func (r watchRun) outputPath(path, ext string) (string, bool) {
+	if r.outputs.owns(path) {
+		return "", false
+	}
+	rel, err := filepath.Rel(r.inputDir, path)
+	if err != nil {
+		return "", false
+	}
+	outputPath := filepath.Join(r.outputDir, strings.TrimSuffix(rel, filepath.Ext(rel))+ext)
+	if !r.outputs.start(outputPath, path) {
+		return "", false
+	}
+	return outputPath, true
+}
+
+// ownOutputs records the files written by a watch run, so that the events
+// caused by writing them are not processed again, for example when the
+// output directory is the watched directory.
+type ownOutputs struct {
+	mu sync.Mutex
+	// watched is true when the outputs are written where the watcher sees
+	// them; otherwise no event follows a write and finished files are not kept.
+	watched bool
+	files   map[string]ownOutput
+}
+
+// ownOutput is the state of a file written by a watch run.
+type ownOutput struct {
+	// inFlight is true while the file is being written.
+	inFlight bool
+	// requeue is the input that changed while the file was being written,
+	// to be processed again once the write is done.
+	requeue string
+	size    int64
+	modTime time.Time
+}
+
+func newOwnOutputs(watched bool) *ownOutputs {
+	return &ownOutputs{watched: watched, files: make(map[string]ownOutput)}
+}
+
+// start marks path as being written from input. It returns false if path is
+// already being written by another item, in which case input is requeued
+// once that write is done.
+func (o *ownOutputs) start(path, input string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if f := o.files[path]; f.inFlight {
+		f.requeue = input
+		o.files[path] = f
+		return false
+	}
+	o.files[path] = ownOutput{inFlight: true}
+	return true
+}
+
+// done records the file written to path, or forgets it if the item failed
+// or its events are not watched. It returns the input to process again if
+// one changed during the write.
+func (o *ownOutputs) done(path string, ok bool) (string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	requeue := o.files[path].requeue
+	info, err := os.Stat(path)
+	if !ok || err != nil || !o.watched {
+		delete(o.files, path)
+	} else {
+		o.files[path] = ownOutput{size: info.Size(), modTime: info.ModTime()}
+	}
+	return requeue, requeue != ""
+}
+
+// owns reports whether path is being written by the run or still holds
+// what the run wrote to it. The record of a written file is dropped once
+// its event has been seen here, or once the file changed since.
+func (o *ownOutputs) owns(path string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f, ok := o.files[path]
+	if !ok {
+		return false
+	}
+	if f.inFlight {
+		return true
+	}
+	delete(o.files, path)
+	info, err := os.Stat(path)
+	return err == nil && info.Size() == f.size && info.ModTime().Equal(f.modTime)
+}
@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of a running command.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// startWatch runs the watch command with args until the returned stop
+// function is called, which returns the output and the command error.
+func startWatch(t *testing.T, args ...string) func() (string, error) {
+	t.Helper()
+	resetGlobals(t)
+
+	var buf syncBuffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetErr(&buf)
+	t.Cleanup(func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+	})
+	rootCmd.SetArgs(append([]string{"watch", "--debounce", "50ms"}, args...))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// Cobra keeps the context of a subcommand from an earlier execution, so
+	// it is set on the subcommand itself.
+	watchCmd.SetContext(ctx)
+	errCh := make(chan error, 1)
+	go func() { errCh <- rootCmd.ExecuteContext(ctx) }()
+
+	stop := func() (string, error) {
+		cancel()
+		err := <-errCh
+		return buf.String(), err
+	}
+	waitFor(t, func() bool { return strings.Contains(buf.String(), "監視中") }, stop)
+	return stop
+}
+
+// waitFor polls cond until it holds, failing the test after a timeout.
+func waitFor(t *testing.T, cond func() bool, stop func() (string, error)) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			out, err := stop()
+			t.Fatalf("timed out; output:\n%s\nerror: %v", out, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestE2E_監視_圧縮(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "out")
+	writeTestFile(t, inputDir, "existing.png", createTestPNG(t, 20, 20))
+
+	stop := startWatch(t, inputDir, "--to", outputDir, "-r")
+
+	writeTestFile(t, inputDir, "sub/new.png", createTestPNG(t, 40, 40))
+	writeTestFile(t, inputDir, "notes.txt", []byte("not an image"))
+	outPath := filepath.Join(outputDir, "sub", "new.png")
+	waitFor(t, func() bool {
+		_, err := os.Stat(outPath)
+		return err == nil
+	}, stop)
+
+	out, err := stop()
+	if err != nil {
+		t.Fatalf("watch error = %v\noutput:\n%s", err, out)
+	}
+	verifyImageFile(t, outPath, "png")
+	if _, err := os.Stat(filepath.Join(outputDir, "existing.png")); !os.IsNotExist(err) {
+		t.Errorf("既存ファイルが処理されています: %v", err)
+	}
+	if !strings.Contains(out, "監視を終了しました: 成功 1, 失敗 0") {
+		t.Errorf("出力に終了メッセージがありません:\n%s", out)
+	}
+}
+
+func TestE2E_監視_自身の出力を無視(t *testing.T) {
+	dir := t.TempDir()
+
+	stop := startWatch(t, dir, "--to", dir, "-f", "webp")
+
+	writeTestFile(t, dir, "photo.png", createTestPNG(t, 20, 20))
+	outPath := filepath.Join(dir, "photo.webp")
+	waitFor(t, func() bool {
+		_, err := os.Stat(outPath)
+		return err == nil
+	}, stop)
+	// Leave time for the events of the output to be handled.
+	time.Sleep(300 * time.Millisecond)
+
+	out, err := stop()
+	if err != nil {
+		t.Fatalf("watch error = %v\noutput:\n%s", err, out)
+	}
+	verifyImageFile(t, outPath, "webp")
+	if !strings.Contains(out, "監視を終了しました: 成功 1, 失敗 0") {
+		t.Errorf("出力ファイルが再処理されています:\n%s", out)
+	}
+}
+
+func TestE2E_監視_エラー(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "photo.png")
+	writeTestFile(t, dir, "photo.png", createTestPNG(t, 10, 10))
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "存在しないディレクトリ", args: []string{"watch", filepath.Join(dir, "missing")}, wantErr: "入力パスが存在しません"},
+		{name: "ファイル指定", args: []string{"watch", file}, wantErr: "監視するディレクトリを指定してください"},
+		{name: "不正なフォーマット", args: []string{"watch", dir, "-f", "bmp"}, wantErr: "不正なフォーマットです"},
+		{name: "品質範囲外", args: []string{"watch", dir, "-q", "101"}, wantErr: "品質は1〜100の範囲で指定してください"},
+		{name: "不正なデバウンス", args: []string{"watch", dir, "--debounce", "0s"}, wantErr: "--debounce は0より大きい値で指定してください"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executeCompress(t, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOwnOutputs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.png")
+	input := filepath.Join(dir, "in", "a.png")
+	o := newOwnOutputs(true)
+
+	if o.owns(path) {
+		t.Error("owns() = true for an unknown file")
+	}
+	if !o.start(path, input) {
+		t.Fatal("start() = false for a new file")
+	}
+	if o.start(path, input) {
+		t.Error("start() = true for a file being written")
+	}
+	if !o.owns(path) {
+		t.Error("owns() = false for a file being written")
+	}
+
+	// The input changed during the write is handed back to be requeued.
+	writeTestFile(t, dir, "a.png", []byte("output"))
+	if got, ok := o.done(path, true); !ok || got != input {
+		t.Errorf("done() = %q, %v, want %q, true", got, ok, input)
+	}
+	if !o.owns(path) {
+		t.Error("owns() = false for a file written by the run")
+	}
+	// The record is dropped once the event of the write has been seen.
+	if o.owns(path) || len(o.files) != 0 {
+		t.Errorf("owns() kept the record after its event: %v", o.files)
+	}
+
+	// A later change by someone else makes the file an input again.
+	o.start(path, input)
+	if _, ok := o.done(path, true); ok {
+		t.Error("done() asked to requeue an input that did not change")
+	}
+	writeTestFile(t, dir, "a.png", []byte("edited by a user"))
+	if o.owns(path) {
+		t.Error("owns() = true for a file changed after the run wrote it")
+	}
+
+	o.start(path, input)
+	o.done(path, false)
+	if o.owns(path) {
+		t.Error("owns() = true for a file whose item failed")
+	}
+}
+
+func TestOwnOutputs_監視外の出力(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.png")
+	o := newOwnOutputs(false)
+
+	o.start(path, filepath.Join(dir, "in.png"))
+	writeTestFile(t, dir, "a.png", []byte("output"))
+	o.done(path, true)
+	if len(o.files) != 0 {
+		t.Errorf("finished outputs are kept: %v", o.files)
+	}
+}
@@ -15,7 +15,7 @@ const maxFileSize = 50 * 1024 * 1024 // 50MB
 
 // CompressFormData はmultipart/form-dataのフォームデータを表す。
 type CompressFormData struct {
-	File    huma.FormFile `form:"file" contentType:"image/jpeg,image/png,image/webp" required:"true" doc:"圧縮する画像ファイル（JPEG/PNG/WebP）"`
+	File    huma.FormFile `form:"file" contentType:"image/jpeg,image/png,image/apng,image/webp,image/tiff,image/gif" required:"true" doc:"圧縮する画像ファイル（JPEG/PNG/APNG/WebP/TIFF/GIF）。マルチページTIFFは全ページ、アニメーションは全フレームを保持する"`
 	Quality int           `form:"quality" minimum:"0" maximum:"100" required:"false" example:"75" doc:"圧縮品質（1-100）。0または未指定の場合はlevelに基づくデフォルト値を使用"`
 	Level   string        `form:"level" enum:"low,medium,high," required:"false" example:"medium" doc:"圧縮レベル。low=圧縮優先(JPEG:60), medium=バランス(JPEG:75,デフォルト), high=品質優先(JPEG:90)。quality指定時はqualityが優先"`
 }
@@ -93,10 +93,20 @@ func detectFormatFromMIME(mimeType string) (processor.ImageFormat, error) {
 	switch mimeType {
 	case "image/jpeg":
 		return processor.FormatJPEG, nil
-	case "image/png":
+	case "image/png", "image/apng":
 		return processor.FormatPNG, nil
 	case "image/webp":
 		return processor.FormatWEBP, nil
+	case "image/heic", "image/heif":
+		return processor.FormatHEIC, nil
+	case "image/tiff":
+		return processor.FormatTIFF, nil
+	case "image/bmp":
+		return processor.FormatBMP, nil
+	case "image/svg+xml":
+		return processor.FormatSVG, nil
+	case "image/gif":
+		return processor.FormatGIF, nil
 	default:
 		return 0, fmt.Errorf("非対応のMIMEタイプ: %s", mimeType)
 	}
@@ -26,6 +26,8 @@ func newTestProcessors() map[processor.ImageFormat]processor.Processor {
 		processor.FormatJPEG: processor.NewJPEGProcessor(),
 		processor.FormatPNG:  processor.NewPNGProcessor(),
 		processor.FormatWEBP: processor.NewWEBPProcessor(),
+		processor.FormatTIFF: processor.NewTIFFProcessor(),
+		processor.FormatGIF:  processor.NewGIFProcessor(),
 	}
 }
 
@@ -206,7 +208,7 @@ func TestCompressWithLevel(t *testing.T) {
 
 func TestCompressUnsupportedFormat(t *testing.T) {
 	api := setupTestAPI(t)
-	body, ct := buildMultipartRequest(t, nil, "test.gif", "image/gif", []byte("GIF89a"))
+	body, ct := buildMultipartRequest(t, nil, "test.avif", "image/avif", []byte("\x00\x00\x00\x1cftypavif"))
 
 	resp := doMultipartRequest(t, api, body, ct)
 
@@ -266,7 +268,14 @@ func TestDetectFormatFromMIME(t *testing.T) {
 		{"image/jpeg", processor.FormatJPEG, false},
 		{"image/png", processor.FormatPNG, false},
 		{"image/webp", processor.FormatWEBP, false},
-		{"image/gif", 0, true},
+		{"image/heic", processor.FormatHEIC, false},
+		{"image/heif", processor.FormatHEIC, false},
+		{"image/tiff", processor.FormatTIFF, false},
+		{"image/bmp", processor.FormatBMP, false},
+		{"image/svg+xml", processor.FormatSVG, false},
+		{"image/gif", processor.FormatGIF, false},
+		{"image/apng", processor.FormatPNG, false},
+		{"image/avif", 0, true},
 		{"text/plain", 0, true},
 	}
 
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/FrontWorksDev/Loki/pkg/processor"
 	"github.com/danielgtaylor/huma/v2"
@@ -12,8 +13,13 @@ import (
 
 // ConvertFormData はフォーマット変換のmultipart/form-dataを表す。
 type ConvertFormData struct {
-	File    huma.FormFile `form:"file" contentType:"image/jpeg,image/png,image/webp" required:"true" doc:"変換する画像ファイル（JPEG/PNG/WebP）"`
-	Format  string        `form:"format" enum:"jpeg,png,webp" required:"true" example:"webp" doc:"出力フォーマット（jpeg/png/webp）"`
+	File    huma.FormFile `form:"file" contentType:"image/jpeg,image/png,image/apng,image/webp,image/tiff,image/gif,image/heic,image/heif,image/bmp,image/svg+xml" required:"true" doc:"変換する画像ファイル（JPEG/PNG/APNG/WebP/TIFF/GIF/HEIC/BMP/SVG）。HEIC/HEIF、BMP、SVGは入力のみ対応。外部リソースを参照するSVGは拒否する"`
+	Format  string        `form:"format" enum:"jpeg,png,webp,tiff,gif,auto" required:"true" example:"webp" doc:"出力フォーマット（jpeg/png/webp/tiff/gif/auto）。アニメーションはgif/png(APNG)/webpで保持される。autoはjpeg/webp/pngのうち最も小さいものを選び、試したフォーマットとサイズをX-Format-Candidatesで返す。どれも入力より大きいJPEG/PNG/WebP/GIFは元のまま返す"`
+	Width   int           `form:"width" minimum:"0" maximum:"16384" required:"false" example:"512" doc:"SVGの出力の幅（px）。ラスター画像には適用しない。heightのみ指定時は縦横比を維持。0または未指定の場合は元のサイズ"`
+	Height  int           `form:"height" minimum:"0" maximum:"16384" required:"false" example:"512" doc:"SVGの出力の高さ（px）。ラスター画像には適用しない。widthのみ指定時は縦横比を維持。0または未指定の場合は元のサイズ"`
+	DPI     float64       `form:"dpi" minimum:"0" maximum:"2400" required:"false" example:"96" doc:"SVGの描画解像度。width/height未指定時のみ使用。0または未指定の場合は96"`
+	Page    int           `form:"page" minimum:"1" required:"false" example:"1" doc:"マルチページTIFFの変換対象ページ、またはアニメーションのフレーム（1始まり）。未指定の場合は1ページ目。TIFFからTIFFへの変換で指定した場合はそのページだけを出力する"`
+	Poster  bool          `form:"poster" required:"false" doc:"trueの場合、アニメーションからpageで指定したフレームだけを静止画として出力する"`
 	Quality int           `form:"quality" minimum:"0" maximum:"100" required:"false" example:"75" doc:"出力品質（1-100）。0または未指定の場合はlevelに基づくデフォルト値を使用"`
 	Level   string        `form:"level" enum:"low,medium,high," required:"false" example:"medium" doc:"圧縮レベル。low=圧縮優先, medium=バランス(デフォルト), high=品質優先。quality指定時はqualityが優先"`
 }
@@ -50,14 +56,34 @@ func (h *ConvertHandler) Handle(ctx context.Context, input *ConvertInput) (*huma
 		return nil, huma.Error422UnprocessableEntity("出力フォーマットが指定されていません")
 	}
 
+	compressOpts := processor.CompressOptions{
+		Quality:     data.Quality,
+		Level:       parseCompressionLevel(data.Level),
+		MaxFileSize: maxFileSize,
+		Page:        max(data.Page-1, 0),
+		Poster:      data.Poster,
+		Width:       data.Width,
+		Height:      data.Height,
+		DPI:         data.DPI,
+	}
+
+	if data.Format == "auto" {
+		var buf bytes.Buffer
+		result, err := processor.Optimize(ctx, data.File, &buf, compressOpts)
+		if err != nil {
+			return nil, handleProcessorError(err)
+		}
+		return buildConvertResponse(&buf, result, inputFormat, result.Format), nil
+	}
+
 	outputFormat, err := parseImageFormat(data.Format)
 	if err != nil {
 		return nil, huma.Error400BadRequest("非対応の出力フォーマットです", err)
 	}
 
-	// 同一フォーマットの場合は圧縮にフォールバック
-	if inputFormat == outputFormat {
-		return h.handleCompress(ctx, *data, inputFormat)
+	opts := processor.ConvertOptions{
+		Format:          outputFormat,
+		CompressOptions: compressOpts,
 	}
 
 	proc, ok := h.processors[outputFormat]
@@ -65,44 +91,20 @@ func (h *ConvertHandler) Handle(ctx context.Context, input *ConvertInput) (*huma
 		return nil, huma.Error400BadRequest("非対応の出力フォーマットです")
 	}
 
-	opts := processor.ConvertOptions{
-		Format: outputFormat,
-		CompressOptions: processor.CompressOptions{
-			Quality:     data.Quality,
-			Level:       parseCompressionLevel(data.Level),
-			MaxFileSize: maxFileSize,
-		},
-	}
-
+	// 同一フォーマットの場合は圧縮にフォールバックする。
+	// ただしページを指定した場合は全ページを保持する圧縮ではなく、指定ページだけを変換する
 	var buf bytes.Buffer
-	result, err := proc.Convert(ctx, data.File, &buf, opts)
-	if err != nil {
-		return nil, handleProcessorError(err)
+	var result *processor.Result
+	if inputFormat == outputFormat && data.Page == 0 {
+		result, err = proc.Compress(ctx, data.File, &buf, opts.CompressOptions)
+	} else {
+		result, err = proc.Convert(ctx, data.File, &buf, opts)
 	}
-
-	return buildConvertResponse(&buf, result, inputFormat, outputFormat), nil
-}
-
-// handleCompress は同一フォーマット変換時の圧縮フォールバックを処理する。
-func (h *ConvertHandler) handleCompress(ctx context.Context, data ConvertFormData, format processor.ImageFormat) (*huma.StreamResponse, error) {
-	proc, ok := h.processors[format]
-	if !ok {
-		return nil, huma.Error400BadRequest("非対応の画像フォーマットです")
-	}
-
-	opts := processor.CompressOptions{
-		Quality:     data.Quality,
-		Level:       parseCompressionLevel(data.Level),
-		MaxFileSize: maxFileSize,
-	}
-
-	var buf bytes.Buffer
-	result, err := proc.Compress(ctx, data.File, &buf, opts)
 	if err != nil {
 		return nil, handleProcessorError(err)
 	}
 
-	return buildConvertResponse(&buf, result, format, format), nil
+	return buildConvertResponse(&buf, result, inputFormat, outputFormat), nil
 }
 
 // handleProcessorError はプロセッサエラーをHTTPエラーに変換する。
@@ -110,6 +112,12 @@ func handleProcessorError(err error) error {
 	if errors.Is(err, processor.ErrFileTooLarge) {
 		return huma.Error413RequestEntityTooLarge("ファイルサイズが上限を超えています", err)
 	}
+	if errors.Is(err, processor.ErrUnsafeSVG) {
+		return huma.Error400BadRequest("外部リソースを参照するSVGは変換できません", err)
+	}
+	if errors.Is(err, processor.ErrPageOutOfRange) {
+		return huma.Error400BadRequest("指定したページが存在しません", err)
+	}
 	if isDecodeError(err) {
 		return huma.Error400BadRequest("画像データが不正です", err)
 	}
@@ -117,6 +125,7 @@ func handleProcessorError(err error) error {
 }
 
 // buildConvertResponse は変換結果からStreamResponseを生成する。
+// 出力フォーマットを自動選択した場合は、試した候補をX-Format-Candidatesに設定する。
 func buildConvertResponse(buf *bytes.Buffer, result *processor.Result, inputFormat, outputFormat processor.ImageFormat) *huma.StreamResponse {
 	converted := buf.Bytes()
 	mimeType := outputFormat.MIMEType()
@@ -124,6 +133,7 @@ func buildConvertResponse(buf *bytes.Buffer, result *processor.Result, inputForm
 	convSize := fmt.Sprintf("%d", result.CompressedSize)
 	origFmt := inputFormat.String()
 	outFmt := outputFormat.String()
+	candidates := formatCandidates(result.Candidates)
 
 	return &huma.StreamResponse{
 		Body: func(ctx huma.Context) {
@@ -132,11 +142,31 @@ func buildConvertResponse(buf *bytes.Buffer, result *processor.Result, inputForm
 			ctx.SetHeader("X-Converted-Size", convSize)
 			ctx.SetHeader("X-Original-Format", origFmt)
 			ctx.SetHeader("X-Output-Format", outFmt)
+			if candidates != "" {
+				ctx.SetHeader("X-Format-Candidates", candidates)
+			}
 			_, _ = ctx.BodyWriter().Write(converted)
 		},
 	}
 }
 
+// formatCandidates は自動選択で試した候補を "jpeg=1234, webp=1000, png=5678" の形式で返す。
+// ロスレスWebPは "webp-lossless"、どの候補より小さく元のまま返した入力は "original" と表す。
+func formatCandidates(candidates []processor.Candidate) string {
+	parts := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		name := c.Format.String()
+		switch {
+		case c.Original:
+			name = "original"
+		case c.Lossless && c.Format == processor.FormatWEBP:
+			name += "-lossless"
+		}
+		parts = append(parts, fmt.Sprintf("%s=%d", name, c.Size))
+	}
+	return strings.Join(parts, ", ")
+}
+
 // parseImageFormat は文字列からImageFormatに変換する。
 func parseImageFormat(s string) (processor.ImageFormat, error) {
 	switch s {
@@ -146,6 +176,10 @@ func parseImageFormat(s string) (processor.ImageFormat, error) {
 		return processor.FormatPNG, nil
 	case "webp":
 		return processor.FormatWEBP, nil
+	case "tiff":
+		return processor.FormatTIFF, nil
+	case "gif":
+		return processor.FormatGIF, nil
 	default:
 		return 0, fmt.Errorf("非対応のフォーマット: %s", s)
 	}
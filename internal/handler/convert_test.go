@@ -3,13 +3,23 @@ package handler
 import (
 	"bytes"
 	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/FrontWorksDev/Loki/pkg/processor"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/humatest"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
 )
 
 func setupConvertTestAPI(t *testing.T) humatest.TestAPI {
@@ -81,6 +91,242 @@ func TestConvertWebPToPNG(t *testing.T) {
 	}
 }
 
+func TestConvertHEICToJPEG(t *testing.T) {
+	api := setupConvertTestAPI(t)
+	heicData, err := os.ReadFile(filepath.Join("..", "..", "pkg", "processor", "testdata", "sample.heic"))
+	if err != nil {
+		t.Fatalf("failed to read HEIC sample: %v", err)
+	}
+	body, ct := buildMultipartRequest(t, map[string]string{"format": "jpeg"}, "IMG_0001.heic", "image/heic", heicData)
+
+	resp := doConvertRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("expected Content-Type image/jpeg, got %s", resp.Header().Get("Content-Type"))
+	}
+	if resp.Header().Get("X-Original-Format") != "heic" {
+		t.Errorf("expected X-Original-Format heic, got %s", resp.Header().Get("X-Original-Format"))
+	}
+}
+
+func TestConvertTIFFPage(t *testing.T) {
+	tiffData, err := os.ReadFile(filepath.Join("..", "..", "pkg", "processor", "testdata", "multipage.tiff"))
+	if err != nil {
+		t.Fatalf("failed to read TIFF sample: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		page      string
+		wantCode  int
+		wantWidth int
+	}{
+		{name: "default first page", page: "", wantCode: http.StatusOK, wantWidth: 10},
+		{name: "third page", page: "3", wantCode: http.StatusOK, wantWidth: 30},
+		{name: "page out of range", page: "4", wantCode: http.StatusBadRequest},
+		// pageは1始まりのため0は指定できない
+		{name: "page zero", page: "0", wantCode: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := setupConvertTestAPI(t)
+			fields := map[string]string{"format": "png"}
+			if tt.page != "" {
+				fields["page"] = tt.page
+			}
+			body, ct := buildMultipartRequest(t, fields, "scan.tiff", "image/tiff", tiffData)
+
+			resp := doConvertRequest(t, api, body, ct)
+
+			if resp.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, resp.Code, resp.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			img, err := png.Decode(resp.Body)
+			if err != nil {
+				t.Fatalf("response is not a valid PNG: %v", err)
+			}
+			if img.Bounds().Dx() != tt.wantWidth {
+				t.Errorf("expected width %d, got %d", tt.wantWidth, img.Bounds().Dx())
+			}
+		})
+	}
+}
+
+func TestConvertTIFFToTIFFPage(t *testing.T) {
+	tiffData, err := os.ReadFile(filepath.Join("..", "..", "pkg", "processor", "testdata", "multipage.tiff"))
+	if err != nil {
+		t.Fatalf("failed to read TIFF sample: %v", err)
+	}
+	api := setupConvertTestAPI(t)
+	body, ct := buildMultipartRequest(t, map[string]string{"format": "tiff", "page": "3"}, "scan.tiff", "image/tiff", tiffData)
+
+	resp := doConvertRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	pages, err := processor.PageCount(bytes.NewReader(resp.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("PageCount() error = %v", err)
+	}
+	if pages != 1 {
+		t.Errorf("expected only the selected page, got %d pages", pages)
+	}
+	img, err := tiff.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("response is not a valid TIFF: %v", err)
+	}
+	if img.Bounds().Dx() != 30 {
+		t.Errorf("expected width 30 of the third page, got %d", img.Bounds().Dx())
+	}
+}
+
+func TestConvertBMPToTIFF(t *testing.T) {
+	api := setupConvertTestAPI(t)
+	var bmpData bytes.Buffer
+	if err := bmp.Encode(&bmpData, image.NewRGBA(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	body, ct := buildMultipartRequest(t, map[string]string{"format": "tiff"}, "scan.bmp", "image/bmp", bmpData.Bytes())
+
+	resp := doConvertRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp.Header().Get("Content-Type") != "image/tiff" {
+		t.Errorf("expected Content-Type image/tiff, got %s", resp.Header().Get("Content-Type"))
+	}
+	if resp.Header().Get("X-Original-Format") != "bmp" {
+		t.Errorf("expected X-Original-Format bmp, got %s", resp.Header().Get("X-Original-Format"))
+	}
+}
+
+// createTestAnimatedGIF creates a 3-frame animated GIF with black, gray and white frames.
+func createTestAnimatedGIF(t *testing.T) []byte {
+	t.Helper()
+	pal := color.Palette{color.Black, color.Gray{Y: 128}, color.White}
+	g := &gif.GIF{}
+	for i := range pal {
+		img := image.NewPaletted(image.Rect(0, 0, 8, 8), pal)
+		for p := range img.Pix {
+			img.Pix[p] = uint8(i)
+		}
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestConvertAnimatedGIF(t *testing.T) {
+	tests := []struct {
+		name       string
+		fields     map[string]string
+		wantType   string
+		wantFrames int
+	}{
+		{name: "animated WebP", fields: map[string]string{"format": "webp"}, wantType: "image/webp", wantFrames: 3},
+		{name: "APNG", fields: map[string]string{"format": "png"}, wantType: "image/png", wantFrames: 3},
+		{name: "poster frame", fields: map[string]string{"format": "png", "poster": "true", "page": "3"}, wantType: "image/png", wantFrames: 1},
+		{name: "same format compresses", fields: map[string]string{"format": "gif"}, wantType: "image/gif", wantFrames: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := setupConvertTestAPI(t)
+			body, ct := buildMultipartRequest(t, tt.fields, "anim.gif", "image/gif", createTestAnimatedGIF(t))
+
+			resp := doConvertRequest(t, api, body, ct)
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+			}
+			if got := resp.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("expected Content-Type %s, got %s", tt.wantType, got)
+			}
+			anim, err := processor.DecodeAnimation(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(anim.Frames) != tt.wantFrames {
+				t.Errorf("expected %d frames, got %d", tt.wantFrames, len(anim.Frames))
+			}
+		})
+	}
+}
+
+func TestConvertAnimationFrameOutOfRange(t *testing.T) {
+	api := setupConvertTestAPI(t)
+	body, ct := buildMultipartRequest(t, map[string]string{"format": "jpeg", "page": "4"}, "anim.gif", "image/gif", createTestAnimatedGIF(t))
+
+	resp := doConvertRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestConvertSVGToPNG(t *testing.T) {
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 20 10"><rect width="20" height="10" fill="#0f0"/></svg>`)
+
+	tests := []struct {
+		name       string
+		fields     map[string]string
+		wantWidth  int
+		wantHeight int
+	}{
+		{name: "intrinsic size", fields: map[string]string{"format": "png"}, wantWidth: 20, wantHeight: 10},
+		{name: "width", fields: map[string]string{"format": "png", "width": "512"}, wantWidth: 512, wantHeight: 256},
+		{name: "dpi", fields: map[string]string{"format": "png", "dpi": "192"}, wantWidth: 40, wantHeight: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := setupConvertTestAPI(t)
+			body, ct := buildMultipartRequest(t, tt.fields, "icon.svg", "image/svg+xml", svg)
+
+			resp := doConvertRequest(t, api, body, ct)
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+			}
+			if resp.Header().Get("X-Original-Format") != "svg" {
+				t.Errorf("expected X-Original-Format svg, got %s", resp.Header().Get("X-Original-Format"))
+			}
+			img, err := png.Decode(resp.Body)
+			if err != nil {
+				t.Fatalf("response is not a valid PNG: %v", err)
+			}
+			if got := img.Bounds().Size(); got.X != tt.wantWidth || got.Y != tt.wantHeight {
+				t.Errorf("expected %dx%d, got %dx%d", tt.wantWidth, tt.wantHeight, got.X, got.Y)
+			}
+		})
+	}
+}
+
+func TestConvertSVGWithExternalReference(t *testing.T) {
+	api := setupConvertTestAPI(t)
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><image href="http://169.254.169.254/latest" width="10" height="10"/></svg>`)
+	body, ct := buildMultipartRequest(t, map[string]string{"format": "png"}, "icon.svg", "image/svg+xml", svg)
+
+	resp := doConvertRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
 func TestConvertWithQuality(t *testing.T) {
 	api := setupConvertTestAPI(t)
 	pngData := createTestPNG(t, 100, 100)
@@ -120,6 +366,26 @@ func TestConvertSameFormatFallback(t *testing.T) {
 	}
 }
 
+func TestConvertRasterIgnoresSize(t *testing.T) {
+	// width/heightはSVGの描画サイズで、ラスター画像は元のサイズのまま出力される
+	api := setupConvertTestAPI(t)
+	jpegData := createTestJPEG(t, 100, 50, 95)
+	body, ct := buildMultipartRequest(t, map[string]string{"format": "jpeg", "width": "40"}, "test.jpg", "image/jpeg", jpegData)
+
+	resp := doConvertRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	img, err := jpeg.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("response is not a valid JPEG: %v", err)
+	}
+	if got := img.Bounds().Size(); got.X != 100 || got.Y != 50 {
+		t.Errorf("expected 100x50, got %dx%d", got.X, got.Y)
+	}
+}
+
 func TestConvertResponseHeaders(t *testing.T) {
 	api := setupConvertTestAPI(t)
 	jpegData := createTestJPEG(t, 100, 100, 95)
@@ -146,10 +412,67 @@ func TestConvertResponseHeaders(t *testing.T) {
 	}
 }
 
+func TestConvertAutoFormat(t *testing.T) {
+	api := setupConvertTestAPI(t)
+	jpegData := createTestJPEG(t, 100, 100, 95)
+	body, ct := buildMultipartRequest(t, map[string]string{"format": "auto", "quality": "80"}, "test.jpg", "image/jpeg", jpegData)
+
+	resp := doConvertRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	outFmt := resp.Header().Get("X-Output-Format")
+	if outFmt != "jpeg" && outFmt != "webp" {
+		t.Errorf("expected X-Output-Format jpeg or webp, got %s", outFmt)
+	}
+	if resp.Header().Get("Content-Type") != "image/"+outFmt {
+		t.Errorf("Content-Type %s does not match X-Output-Format %s", resp.Header().Get("Content-Type"), outFmt)
+	}
+	candidates := resp.Header().Get("X-Format-Candidates")
+	for _, want := range []string{"jpeg=", "webp=", "png="} {
+		if !strings.Contains(candidates, want) {
+			t.Errorf("X-Format-Candidates %q does not contain %q", candidates, want)
+		}
+	}
+	if !strings.Contains(candidates, outFmt+"="+resp.Header().Get("X-Converted-Size")) {
+		t.Errorf("X-Format-Candidates %q does not record the chosen %s output", candidates, outFmt)
+	}
+}
+
+func TestConvertAutoFormatLosslessSource(t *testing.T) {
+	api := setupConvertTestAPI(t)
+	pngData := createTestPNG(t, 64, 64)
+	body, ct := buildMultipartRequest(t, map[string]string{"format": "auto"}, "test.png", "image/png", pngData)
+
+	resp := doConvertRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if got := resp.Header().Get("X-Format-Candidates"); !strings.HasPrefix(got, "png=") || !strings.Contains(got, "webp-lossless=") || strings.Contains(got, "jpeg") {
+		t.Errorf("expected only lossless candidates, got %q", got)
+	}
+}
+
+func TestConvertFixedFormatHasNoCandidates(t *testing.T) {
+	api := setupConvertTestAPI(t)
+	body, ct := buildMultipartRequest(t, map[string]string{"format": "webp"}, "test.png", "image/png", createTestPNG(t, 10, 10))
+
+	resp := doConvertRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if got := resp.Header().Get("X-Format-Candidates"); got != "" {
+		t.Errorf("expected no X-Format-Candidates header, got %q", got)
+	}
+}
+
 func TestConvertUnsupportedOutputFormat(t *testing.T) {
 	api := setupConvertTestAPI(t)
 	jpegData := createTestJPEG(t, 100, 100, 95)
-	body, ct := buildMultipartRequest(t, map[string]string{"format": "gif"}, "test.jpg", "image/jpeg", jpegData)
+	body, ct := buildMultipartRequest(t, map[string]string{"format": "bmp"}, "test.jpg", "image/jpeg", jpegData)
 
 	resp := doConvertRequest(t, api, body, ct)
 
@@ -184,7 +507,7 @@ func TestConvertNoFormat(t *testing.T) {
 
 func TestConvertUnsupportedInputFormat(t *testing.T) {
 	api := setupConvertTestAPI(t)
-	body, ct := buildMultipartRequest(t, map[string]string{"format": "webp"}, "test.gif", "image/gif", []byte("GIF89a"))
+	body, ct := buildMultipartRequest(t, map[string]string{"format": "webp"}, "test.avif", "image/avif", []byte("\x00\x00\x00\x1cftypavif"))
 
 	resp := doConvertRequest(t, api, body, ct)
 
@@ -354,7 +677,8 @@ func TestParseImageFormat(t *testing.T) {
 		{"jpeg", processor.FormatJPEG, false},
 		{"png", processor.FormatPNG, false},
 		{"webp", processor.FormatWEBP, false},
-		{"gif", 0, true},
+		{"tiff", processor.FormatTIFF, false},
+		{"gif", processor.FormatGIF, false},
 		{"", 0, true},
 		{"bmp", 0, true},
 	}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// InfoFormData は画像情報取得のmultipart/form-dataを表す。
+type InfoFormData struct {
+	File huma.FormFile `form:"file" contentType:"image/jpeg,image/png,image/apng,image/webp,image/tiff,image/gif,image/heic,image/heif,image/bmp,image/svg+xml" required:"true" doc:"情報を取得する画像ファイル（JPEG/PNG/APNG/WebP/TIFF/GIF/HEIC/BMP/SVG）。形式はファイルの内容から判別する"`
+}
+
+// InfoInput は画像情報取得エンドポイントのリクエストを表す。
+type InfoInput struct {
+	RawBody huma.MultipartFormFiles[InfoFormData]
+}
+
+// InfoOutput は画像情報取得エンドポイントのレスポンスを表す。
+type InfoOutput struct {
+	Body *processor.ImageInfo
+}
+
+// InfoHandler は画像情報取得ハンドラーを表す。
+type InfoHandler struct{}
+
+// NewInfoHandler は新しいInfoHandlerを生成する。
+func NewInfoHandler() *InfoHandler {
+	return &InfoHandler{}
+}
+
+// Handle は画像情報取得リクエストを処理する。
+// 画像はヘッダーのみを解析し、画素データはデコードしない。
+func (h *InfoHandler) Handle(ctx context.Context, input *InfoInput) (*InfoOutput, error) {
+	data := input.RawBody.Data()
+
+	if !data.File.IsSet {
+		return nil, huma.Error422UnprocessableEntity("ファイルが指定されていません")
+	}
+
+	info, err := processor.Inspect(data.File)
+	if err != nil {
+		return nil, huma.Error400BadRequest("画像データが不正です", err)
+	}
+	return &InfoOutput{Body: info}, nil
+}
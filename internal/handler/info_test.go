@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FrontWorksDev/Loki/pkg/processor"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/humatest"
+)
+
+func setupInfoTestAPI(t *testing.T) humatest.TestAPI {
+	t.Helper()
+	_, api := humatest.New(t)
+	h := NewInfoHandler()
+	huma.Register(api, huma.Operation{
+		OperationID:  "inspect-image",
+		Method:       http.MethodPost,
+		Path:         "/api/v1/info",
+		MaxBodyBytes: 50 * 1024 * 1024,
+	}, h.Handle)
+	return api
+}
+
+func doInfoRequest(t *testing.T, api humatest.TestAPI, body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+	t.Helper()
+	return api.Do(http.MethodPost, "/api/v1/info",
+		"Content-Type: "+contentType,
+		body,
+	)
+}
+
+func TestInfoJPEG(t *testing.T) {
+	api := setupInfoTestAPI(t)
+	jpegData := createTestJPEG(t, 120, 80, 85)
+	body, ct := buildMultipartRequest(t, nil, "test.jpg", "image/jpeg", jpegData)
+
+	resp := doInfoRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var info processor.ImageInfo
+	if err := json.Unmarshal(resp.Body.Bytes(), &info); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if info.Format != "jpeg" || info.Width != 120 || info.Height != 80 || info.Size != int64(len(jpegData)) {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if info.JPEGQuality < 84 || info.JPEGQuality > 86 {
+		t.Errorf("expected estimated quality around 85, got %d", info.JPEGQuality)
+	}
+}
+
+func TestInfoDetectsFormatFromContent(t *testing.T) {
+	api := setupInfoTestAPI(t)
+	// PNGデータをJPEGとして送信しても内容から判別する
+	body, ct := buildMultipartRequest(t, nil, "test.jpg", "image/jpeg", createTestPNG(t, 10, 10))
+
+	resp := doInfoRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var info processor.ImageInfo
+	if err := json.Unmarshal(resp.Body.Bytes(), &info); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if info.Format != "png" {
+		t.Errorf("expected format png, got %s", info.Format)
+	}
+}
+
+func TestInfoNoFile(t *testing.T) {
+	api := setupInfoTestAPI(t)
+	body, ct := buildMultipartRequest(t, nil, "", "", nil)
+
+	resp := doInfoRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestInfoInvalidImageData(t *testing.T) {
+	api := setupInfoTestAPI(t)
+	body, ct := buildMultipartRequest(t, nil, "test.png", "image/png", []byte("not an image"))
+
+	resp := doInfoRequest(t, api, body, ct)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
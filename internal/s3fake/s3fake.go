@@ -0,0 +1,239 @@
+// Package s3fake provides an in-memory stand-in for an S3-compatible
+// service, like a local MinIO, for tests of the S3 storage backend.
+package s3fake
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server serves path-style GetObject, PutObject, HeadObject and
+// ListObjectsV2 requests from memory. GetObject honours a single
+// "bytes=first-last" Range.
+type Server struct {
+	*httptest.Server
+
+	// AccessKeyID, when set, is required in the credential of every request.
+	AccessKeyID string
+
+	// PageSize is the maximum number of keys per ListObjectsV2 page. 0 means 1000.
+	PageSize int
+
+	mu       sync.Mutex
+	objects  map[string]object // keyed by "bucket/key"
+	failing  map[string]int    // remaining 503 responses by "bucket/key"
+	requests []Request
+}
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	Bucket string
+	Key    string // empty for bucket requests such as ListObjectsV2
+	Range  string // the Range header, if any
+}
+
+type object struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewServer starts a Server. Callers must Close it.
+func NewServer() *Server {
+	s := &Server{objects: make(map[string]object), failing: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Put stores data as the object key of bucket.
+func (s *Server) Put(bucket, key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[bucket+"/"+key] = object{data: slices.Clone(data), modTime: time.Now()}
+}
+
+// Object returns the object key of bucket.
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[bucket+"/"+key]
+	return slices.Clone(o.data), ok
+}
+
+// Keys returns the keys of bucket in lexical order.
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.objects {
+		if key, ok := strings.CutPrefix(k, bucket+"/"); ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Requests returns the requests received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// Fail makes the next n requests for the object key of bucket fail with
+// 503 Slow Down.
+func (s *Server) Fail(bucket, key string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing[bucket+"/"+key] = n
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if s.AccessKeyID != "" && !strings.Contains(r.Header.Get("Authorization"), "Credential="+s.AccessKeyID+"/") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Bucket: bucket, Key: key, Range: r.Header.Get("Range")})
+	s.mu.Unlock()
+	if key == "" {
+		if r.Method != http.MethodGet || r.URL.Query().Get("list-type") != "2" {
+			writeError(w, http.StatusNotImplemented, "NotImplemented", "unsupported bucket request")
+			return
+		}
+		s.list(w, bucket, r.URL.Query().Get("prefix"), r.URL.Query().Get("continuation-token"))
+		return
+	}
+
+	name := bucket + "/" + key
+	s.mu.Lock()
+	if s.failing[name] > 0 {
+		s.failing[name]--
+		s.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, "SlowDown", "Please reduce your request rate.")
+		return
+	}
+	o, ok := s.objects[name]
+	s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		s.Put(bucket, key, data)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		data, status := o.data, http.StatusOK
+		if rng := r.Header.Get("Range"); rng != "" && r.Method == http.MethodGet {
+			first, last, ok := parseRange(rng, len(o.data))
+			if !ok {
+				writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+				return
+			}
+			data, status = o.data[first:last+1], http.StatusPartialContent
+			w.Header().Set("Content-Range", "bytes "+strconv.Itoa(first)+"-"+strconv.Itoa(last)+"/"+strconv.Itoa(len(o.data)))
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", o.modTime.UTC().Format(http.TimeFormat))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "unsupported object request")
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, bucket, prefix, token string) {
+	pageSize := s.PageSize
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+	var keys []string
+	for _, k := range s.Keys(bucket) {
+		if strings.HasPrefix(k, prefix) && k > token {
+			keys = append(keys, k)
+		}
+	}
+
+	type contents struct {
+		Key  string
+		Size int
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		Prefix                string
+		KeyCount              int
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []contents
+	}{Name: bucket, Prefix: prefix}
+	if len(keys) > pageSize {
+		keys = keys[:pageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, k := range keys {
+		data, _ := s.Object(bucket, k)
+		result.Contents = append(result.Contents, contents{Key: k, Size: len(data)})
+	}
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+// parseRange parses a Range header of the form "bytes=first-last" or
+// "bytes=first-" for an object of size bytes, clamping last to the end of
+// the object. ok is false when the range does not start within the object.
+func parseRange(header string, size int) (first, last int, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found {
+		return 0, 0, false
+	}
+	from, to, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false
+	}
+	first, err := strconv.Atoi(from)
+	if err != nil || first < 0 || first >= size {
+		return 0, 0, false
+	}
+	last = size - 1
+	if to != "" {
+		n, err := strconv.Atoi(to)
+		if err != nil || n < first {
+			return 0, 0, false
+		}
+		last = min(n, last)
+	}
+	return first, last, true
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+}
@@ -0,0 +1,184 @@
+package s3fake
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// do sends a request to srv and returns the status code and body.
+func do(t *testing.T, srv *Server, method, path string, header http.Header, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s %s error = %v", method, path, err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+func TestServer_オブジェクト(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	if code, _ := do(t, srv, http.MethodPut, "/images/in/a.jpg", nil, "hello"); code != http.StatusOK {
+		t.Fatalf("PUT status = %d, want 200", code)
+	}
+	if data, ok := srv.Object("images", "in/a.jpg"); !ok || string(data) != "hello" {
+		t.Errorf("Object() = %q, %v, want %q, true", data, ok, "hello")
+	}
+	if code, body := do(t, srv, http.MethodGet, "/images/in/a.jpg", nil, ""); code != http.StatusOK || body != "hello" {
+		t.Errorf("GET = %d %q, want 200 %q", code, body, "hello")
+	}
+	if code, body := do(t, srv, http.MethodHead, "/images/in/a.jpg", nil, ""); code != http.StatusOK || body != "" {
+		t.Errorf("HEAD = %d %q, want 200 with no body", code, body)
+	}
+	if code, body := do(t, srv, http.MethodGet, "/images/in/missing.jpg", nil, ""); code != http.StatusNotFound || !strings.Contains(body, "NoSuchKey") {
+		t.Errorf("GET missing = %d %q, want 404 NoSuchKey", code, body)
+	}
+	if code, _ := do(t, srv, http.MethodDelete, "/images/in/a.jpg", nil, ""); code != http.StatusNotImplemented {
+		t.Errorf("DELETE status = %d, want 501", code)
+	}
+}
+
+func TestServer_Range(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Put("images", "a.bin", []byte("0123456789"))
+
+	tests := []struct {
+		rng      string
+		wantCode int
+		wantBody string
+	}{
+		{"bytes=0-3", http.StatusPartialContent, "0123"},
+		{"bytes=5-", http.StatusPartialContent, "56789"},
+		{"bytes=8-100", http.StatusPartialContent, "89"},
+		{"bytes=10-20", http.StatusRequestedRangeNotSatisfiable, ""},
+		{"bytes=4-2", http.StatusRequestedRangeNotSatisfiable, ""},
+		{"items=0-1", http.StatusRequestedRangeNotSatisfiable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rng, func(t *testing.T) {
+			code, body := do(t, srv, http.MethodGet, "/images/a.bin", http.Header{"Range": {tt.rng}}, "")
+			if code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusPartialContent && body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestServer_ListObjectsV2(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.PageSize = 2
+	for _, key := range []string{"in/c.jpg", "in/a.jpg", "in/b.png", "out/d.jpg"} {
+		srv.Put("images", key, []byte(key))
+	}
+	srv.Put("other", "in/e.jpg", nil)
+
+	var keys []string
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("listing did not end")
+		}
+		path := "/images?list-type=2&prefix=in/"
+		if token != "" {
+			path += "&continuation-token=" + token
+		}
+		code, body := do(t, srv, http.MethodGet, path, nil, "")
+		if code != http.StatusOK {
+			t.Fatalf("list status = %d, want 200", code)
+		}
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err := xml.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatalf("xml.Unmarshal() error = %v", err)
+		}
+		if len(page.Contents) > srv.PageSize {
+			t.Errorf("page holds %d keys, want at most %d", len(page.Contents), srv.PageSize)
+		}
+		for _, c := range page.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !page.IsTruncated {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+
+	want := []string{"in/a.jpg", "in/b.png", "in/c.jpg"}
+	if !slices.Equal(keys, want) {
+		t.Errorf("listed keys = %v, want %v", keys, want)
+	}
+	if got := srv.Keys("images"); len(got) != 4 {
+		t.Errorf("Keys() = %v, want 4 keys", got)
+	}
+	if code, _ := do(t, srv, http.MethodGet, "/images", nil, ""); code != http.StatusNotImplemented {
+		t.Errorf("bucket GET without list-type status = %d, want 501", code)
+	}
+}
+
+func TestServer_FailとAccessKeyID(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AccessKeyID = "test-key"
+	srv.Put("images", "a.jpg", []byte("a"))
+	auth := http.Header{"Authorization": {"AWS4-HMAC-SHA256 Credential=test-key/20240101/us-east-1/s3/aws4_request"}}
+
+	if code, body := do(t, srv, http.MethodGet, "/images/a.jpg", nil, ""); code != http.StatusForbidden || !strings.Contains(body, "AccessDenied") {
+		t.Errorf("unsigned GET = %d %q, want 403 AccessDenied", code, body)
+	}
+
+	srv.Fail("images", "a.jpg", 2)
+	for i := range 2 {
+		if code, body := do(t, srv, http.MethodGet, "/images/a.jpg", auth, ""); code != http.StatusServiceUnavailable || !strings.Contains(body, "SlowDown") {
+			t.Errorf("GET %d = %d %q, want 503 SlowDown", i+1, code, body)
+		}
+	}
+	if code, body := do(t, srv, http.MethodGet, "/images/a.jpg", auth, ""); code != http.StatusOK || body != "a" {
+		t.Errorf("GET after failures = %d %q, want 200 %q", code, body, "a")
+	}
+}
+
+func TestServer_Requests(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Put("images", "a.jpg", []byte("abc"))
+
+	do(t, srv, http.MethodGet, "/images/a.jpg", http.Header{"Range": {"bytes=0-1"}}, "")
+	do(t, srv, http.MethodHead, "/images/a.jpg", nil, "")
+	do(t, srv, http.MethodGet, "/images?list-type=2&prefix=", nil, "")
+
+	want := []Request{
+		{Method: http.MethodGet, Bucket: "images", Key: "a.jpg", Range: "bytes=0-1"},
+		{Method: http.MethodHead, Bucket: "images", Key: "a.jpg"},
+		{Method: http.MethodGet, Bucket: "images"},
+	}
+	if got := srv.Requests(); !slices.Equal(got, want) {
+		t.Errorf("Requests() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,193 @@
+package processor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"time"
+)
+
+// maxAnimationPixels bounds the total number of canvas pixels held by a decoded
+// animation (width x height x frames) to avoid huge allocations.
+const maxAnimationPixels = 1 << 27
+
+// Frame is a single frame of an animated image.
+type Frame struct {
+	// Image is the fully composited canvas shown for this frame.
+	Image image.Image
+
+	// Delay is how long the frame is shown before the next one.
+	Delay time.Duration
+}
+
+// Animation is a decoded multi-frame image such as an animated GIF, APNG or
+// animated WebP. Every frame covers the whole canvas, so frames can be
+// re-encoded without the disposal and blending rules of the source format.
+type Animation struct {
+	// Frames holds the frames in display order.
+	Frames []Frame
+
+	// LoopCount is the number of times the animation is played; 0 means forever.
+	LoopCount int
+}
+
+// DecodeAnimation decodes every frame of an animated GIF, APNG or animated WebP.
+// Still images in any supported format are returned as a single frame.
+func DecodeAnimation(r io.Reader) (*Animation, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	anim, err := decodeAnimation(data, 0)
+	if err != nil || anim != nil {
+		return anim, err
+	}
+	img, err := decodeImage(data, CompressOptions{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Animation{Frames: []Frame{{Image: img}}}, nil
+}
+
+// decodeAnimation decodes data if it is a GIF, APNG or animated WebP.
+// Only the first limit frames are decoded when limit is positive.
+// It returns nil without error for any other input.
+func decodeAnimation(data []byte, limit int) (*Animation, error) {
+	switch {
+	case isGIF(data):
+		return decodeGIFAnimation(data, limit)
+	case isAPNG(data):
+		return decodeAPNG(data, limit)
+	case isAnimatedWebP(data):
+		return decodeAnimatedWebP(data, limit)
+	default:
+		return nil, nil
+	}
+}
+
+// frameCount returns the number of frames of a GIF, APNG or animated WebP as
+// recorded in its container headers, without decoding any image data. It
+// returns 0 for any other input. Malformed headers count as at least one
+// frame so that decoding reports the error.
+func frameCount(data []byte) int {
+	switch {
+	case isGIF(data):
+		return max(len(gifFrameEnds(data)), 1)
+	case isAPNG(data):
+		chunks, err := readPNGChunks(data)
+		if err != nil {
+			return 1
+		}
+		for _, c := range chunks {
+			if c.typ == "acTL" && len(c.data) == 8 {
+				return max(int(binary.BigEndian.Uint32(c.data[0:4])), 1)
+			}
+		}
+		return 1
+	case isAnimatedWebP(data):
+		body, _ := webpBody(data)
+		chunks, err := readRIFFChunks(body)
+		if err != nil {
+			return 1
+		}
+		n := 0
+		for _, c := range chunks {
+			if c.fourCC == "ANMF" {
+				n++
+			}
+		}
+		return max(n, 1)
+	default:
+		return 0
+	}
+}
+
+// decodeAnimated decodes inputData for encoders that can write animations.
+// Input whose container headers record more than one frame is returned as an
+// Animation, with the color-management stage applied to every frame. Still
+// input, and any input when opts.Poster is set, is returned as a single image
+// instead without decoding the remaining frames.
+// Stage durations and image sizes are added to st, which may be nil.
+func decodeAnimated(inputData []byte, opts CompressOptions, st *Stats) (*Animation, image.Image, error) {
+	if !opts.Poster && frameCount(inputData) > 1 {
+		start := time.Now()
+		anim, err := decodeAnimation(inputData, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(anim.Frames) > 1 {
+			st.addDecode(start)
+			for i := range anim.Frames {
+				img, err := finishImage(anim.Frames[i].Image, inputData, opts, st)
+				if err != nil {
+					return nil, nil, err
+				}
+				anim.Frames[i].Image = img
+			}
+			return anim, nil, nil
+		}
+	}
+	img, err := decodeImage(inputData, opts, st)
+	return nil, img, err
+}
+
+// selectFrame returns the frame of anim selected by page.
+func selectFrame(anim *Animation, page int) (image.Image, error) {
+	if page >= len(anim.Frames) {
+		return nil, fmt.Errorf("%w: frame %d of %d", ErrPageOutOfRange, page, len(anim.Frames))
+	}
+	return anim.Frames[page].Image, nil
+}
+
+// checkAnimationSize returns an error if an animation of the given canvas size
+// and frame count exceeds maxAnimationPixels.
+func checkAnimationSize(width, height, frames int) error {
+	if width <= 0 || height <= 0 {
+		return errors.New("invalid animation: empty canvas")
+	}
+	if int64(width)*int64(height)*int64(frames) > maxAnimationPixels {
+		return fmt.Errorf("invalid animation: %dx%d canvas with %d frames is too large", width, height, frames)
+	}
+	return nil
+}
+
+// snapshot returns a copy of canvas.
+func snapshot(canvas *image.RGBA) *image.RGBA {
+	c := image.NewRGBA(canvas.Rect)
+	copy(c.Pix, canvas.Pix)
+	return c
+}
+
+// clearRect makes the pixels of canvas inside r fully transparent.
+func clearRect(canvas *image.RGBA, r image.Rectangle) {
+	draw.Draw(canvas, r, image.Transparent, image.Point{}, draw.Src)
+}
+
+// toNRGBA returns img as a non-premultiplied image whose bounds start at (0, 0).
+func toNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+		return n
+	}
+	b := img.Bounds()
+	n := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(n, n.Rect, img, b.Min, draw.Src)
+	return n
+}
+
+// animationFrames converts the frames of anim to NRGBA images of equal size.
+func animationFrames(anim *Animation) ([]*image.NRGBA, error) {
+	if len(anim.Frames) == 0 {
+		return nil, errors.New("animation has no frames")
+	}
+	frames := make([]*image.NRGBA, len(anim.Frames))
+	for i, f := range anim.Frames {
+		frames[i] = toNRGBA(f.Image)
+		if frames[i].Rect != frames[0].Rect {
+			return nil, fmt.Errorf("frame %d size %v differs from canvas size %v", i, frames[i].Rect.Size(), frames[0].Rect.Size())
+		}
+	}
+	return frames, nil
+}
@@ -0,0 +1,452 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/chai2010/webp"
+)
+
+// testFrameColors are the colors of the frames created by createTestGIF.
+var testFrameColors = []color.RGBA{
+	{R: 255, A: 255},
+	{G: 255, A: 255},
+	{B: 255, A: 255},
+}
+
+// createTestGIF creates an animated GIF whose frame i is filled with
+// testFrameColors[i] and shown for (i+1)*100ms, playing twice.
+func createTestGIF(t *testing.T, width, height int) []byte {
+	t.Helper()
+	pal := color.Palette{testFrameColors[0], testFrameColors[1], testFrameColors[2]}
+	g := &gif.GIF{LoopCount: 1}
+	for i := range testFrameColors {
+		img := image.NewPaletted(image.Rect(0, 0, width, height), pal)
+		for p := range img.Pix {
+			img.Pix[p] = uint8(i)
+		}
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, (i+1)*10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("gif.EncodeAll() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+// assertTestAnimation checks that anim matches the animation created by createTestGIF.
+// tolerance is the allowed per-channel difference for lossy formats.
+func assertTestAnimation(t *testing.T, anim *Animation, tolerance uint32) {
+	t.Helper()
+	if len(anim.Frames) != len(testFrameColors) {
+		t.Fatalf("frames = %d, want %d", len(anim.Frames), len(testFrameColors))
+	}
+	if anim.LoopCount != 2 {
+		t.Errorf("LoopCount = %d, want 2", anim.LoopCount)
+	}
+	for i, f := range anim.Frames {
+		if want := time.Duration(i+1) * 100 * time.Millisecond; f.Delay != want {
+			t.Errorf("frame %d delay = %v, want %v", i, f.Delay, want)
+		}
+		r, g, b, a := f.Image.At(4, 4).RGBA()
+		want := testFrameColors[i]
+		if diff(r>>8, uint32(want.R)) > tolerance || diff(g>>8, uint32(want.G)) > tolerance ||
+			diff(b>>8, uint32(want.B)) > tolerance || a>>8 != 255 {
+			t.Errorf("frame %d color = (%d,%d,%d,%d), want %v", i, r>>8, g>>8, b>>8, a>>8, want)
+		}
+	}
+}
+
+func diff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestDecodeAnimation_GIF(t *testing.T) {
+	anim, err := DecodeAnimation(bytes.NewReader(createTestGIF(t, 16, 8)))
+	if err != nil {
+		t.Fatalf("DecodeAnimation() error = %v", err)
+	}
+	assertTestAnimation(t, anim, 0)
+}
+
+func TestDecodeAnimation_StillImage(t *testing.T) {
+	anim, err := DecodeAnimation(bytes.NewReader(createTestPNG(t, 6, 4)))
+	if err != nil {
+		t.Fatalf("DecodeAnimation() error = %v", err)
+	}
+	if len(anim.Frames) != 1 {
+		t.Fatalf("frames = %d, want 1", len(anim.Frames))
+	}
+	if got := anim.Frames[0].Image.Bounds().Size(); got != image.Pt(6, 4) {
+		t.Errorf("size = %v, want 6x4", got)
+	}
+}
+
+func TestFrameCount(t *testing.T) {
+	gifData := createTestGIF(t, 8, 8)
+	anim, err := decodeAnimation(gifData, 0)
+	if err != nil {
+		t.Fatalf("decodeAnimation() error = %v", err)
+	}
+	var apngData, webpData bytes.Buffer
+	if err := encodeAPNG(&apngData, anim, CompressionMedium); err != nil {
+		t.Fatalf("encodeAPNG() error = %v", err)
+	}
+	if err := encodeAnimatedWebP(&webpData, anim, &webp.Options{Lossless: true}); err != nil {
+		t.Fatalf("encodeAnimatedWebP() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{name: "GIF", data: gifData, want: 3},
+		{name: "APNG", data: apngData.Bytes(), want: 3},
+		{name: "animated WebP", data: webpData.Bytes(), want: 3},
+		{name: "still PNG", data: createTestPNG(t, 4, 4), want: 0},
+		{name: "still WebP", data: createTestWEBP(t, 4, 4, 80), want: 0},
+		{name: "truncated GIF", data: []byte("GIF89a\x10\x00"), want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := frameCount(tt.data); got != tt.want {
+				t.Errorf("frameCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeImage_DecodesUpToSelectedFrame(t *testing.T) {
+	// Cut the GIF inside its last frame: frames before it must still decode.
+	data := createTestGIF(t, 16, 8)
+	ends := gifFrameEnds(data)
+	if len(ends) != 3 {
+		t.Fatalf("gifFrameEnds() = %v, want 3 frames", ends)
+	}
+	data = data[:ends[1]+8]
+	if _, err := decodeAnimation(data, 0); err == nil {
+		t.Fatal("decodeAnimation() of a truncated GIF expected error")
+	}
+
+	for page := range 2 {
+		img, err := decodeImage(data, CompressOptions{Page: page}, nil)
+		if err != nil {
+			t.Fatalf("decodeImage(page %d) error = %v", page, err)
+		}
+		r, g, b, _ := img.At(4, 4).RGBA()
+		if want := testFrameColors[page]; uint8(r>>8) != want.R || uint8(g>>8) != want.G || uint8(b>>8) != want.B {
+			t.Errorf("page %d color = (%d,%d,%d), want %v", page, r>>8, g>>8, b>>8, want)
+		}
+	}
+
+	if _, err := decodeImage(createTestGIF(t, 16, 8), CompressOptions{Page: 3}, nil); !errors.Is(err, ErrPageOutOfRange) {
+		t.Errorf("decodeImage(page 3) error = %v, want ErrPageOutOfRange", err)
+	}
+}
+
+func TestDecodeGIFAnimation_Disposal(t *testing.T) {
+	pal := color.Palette{color.Transparent, color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}}
+	full := image.NewPaletted(image.Rect(0, 0, 4, 4), pal)
+	for i := range full.Pix {
+		full.Pix[i] = 1
+	}
+	corner := image.NewPaletted(image.Rect(0, 0, 2, 2), pal)
+	for i := range corner.Pix {
+		corner.Pix[i] = 2
+	}
+
+	tests := []struct {
+		name     string
+		disposal byte
+		// want is the color of pixel (3, 3) in the third frame.
+		want color.RGBA
+	}{
+		{name: "none keeps previous pixels", disposal: gif.DisposalNone, want: color.RGBA{R: 255, A: 255}},
+		{name: "background clears the frame", disposal: gif.DisposalBackground, want: color.RGBA{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &gif.GIF{
+				Image:    []*image.Paletted{full, corner, corner},
+				Delay:    []int{0, 0, 0},
+				Disposal: []byte{tt.disposal, gif.DisposalNone, gif.DisposalNone},
+				Config:   image.Config{ColorModel: pal, Width: 4, Height: 4},
+			}
+			var buf bytes.Buffer
+			if err := gif.EncodeAll(&buf, g); err != nil {
+				t.Fatal(err)
+			}
+			anim, err := decodeGIFAnimation(buf.Bytes(), 0)
+			if err != nil {
+				t.Fatalf("decodeGIFAnimation() error = %v", err)
+			}
+			if got := color.RGBAModel.Convert(anim.Frames[2].Image.At(3, 3)); got != tt.want {
+				t.Errorf("pixel = %v, want %v", got, tt.want)
+			}
+			if got := color.RGBAModel.Convert(anim.Frames[2].Image.At(0, 0)); got != (color.RGBA{B: 255, A: 255}) {
+				t.Errorf("corner pixel = %v, want blue", got)
+			}
+		})
+	}
+}
+
+func TestConvert_KeepsAnimation(t *testing.T) {
+	tests := []struct {
+		name      string
+		proc      Processor
+		format    ImageFormat
+		tolerance uint32
+	}{
+		{name: "GIF to APNG", proc: NewPNGProcessor(), format: FormatPNG},
+		{name: "GIF to animated WebP", proc: NewWEBPProcessor(), format: FormatWEBP, tolerance: 8},
+		{name: "GIF to GIF", proc: NewGIFProcessor(), format: FormatGIF},
+	}
+
+	input := createTestGIF(t, 16, 8)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			result, err := tt.proc.Convert(context.Background(), bytes.NewReader(input), &buf, DefaultConvertOptions(tt.format))
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+			if result.Format != tt.format {
+				t.Errorf("Format = %v, want %v", result.Format, tt.format)
+			}
+			if result.CompressedSize != int64(buf.Len()) {
+				t.Errorf("CompressedSize = %d, want %d", result.CompressedSize, buf.Len())
+			}
+			anim, err := DecodeAnimation(&buf)
+			if err != nil {
+				t.Fatalf("DecodeAnimation() error = %v", err)
+			}
+			assertTestAnimation(t, anim, tt.tolerance)
+		})
+	}
+}
+
+func TestCompress_KeepsAnimation(t *testing.T) {
+	gifData := createTestGIF(t, 16, 8)
+
+	var apng bytes.Buffer
+	if _, err := NewPNGProcessor().Convert(context.Background(), bytes.NewReader(gifData), &apng, DefaultConvertOptions(FormatPNG)); err != nil {
+		t.Fatal(err)
+	}
+	var awebp bytes.Buffer
+	if _, err := NewWEBPProcessor().Convert(context.Background(), bytes.NewReader(gifData), &awebp, DefaultConvertOptions(FormatWEBP)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		proc      Processor
+		input     []byte
+		tolerance uint32
+	}{
+		{name: "GIF", proc: NewGIFProcessor(), input: gifData},
+		{name: "APNG", proc: NewPNGProcessor(), input: apng.Bytes()},
+		{name: "animated WebP", proc: NewWEBPProcessor(), input: awebp.Bytes(), tolerance: 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := tt.proc.Compress(context.Background(), bytes.NewReader(tt.input), &buf, CompressOptions{Level: CompressionHigh}); err != nil {
+				t.Fatalf("Compress() error = %v", err)
+			}
+			anim, err := DecodeAnimation(&buf)
+			if err != nil {
+				t.Fatalf("DecodeAnimation() error = %v", err)
+			}
+			assertTestAnimation(t, anim, tt.tolerance)
+		})
+	}
+}
+
+func TestAPNG_DefaultImageIsFirstFrame(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewPNGProcessor().Convert(context.Background(), bytes.NewReader(createTestGIF(t, 16, 8)), &buf, DefaultConvertOptions(FormatPNG)); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("output is not a valid PNG: %v", err)
+	}
+	if got := color.RGBAModel.Convert(img.At(0, 0)); got != testFrameColors[0] {
+		t.Errorf("default image color = %v, want %v", got, testFrameColors[0])
+	}
+}
+
+func TestConvert_AnimationKeepsSize(t *testing.T) {
+	opts := DefaultConvertOptions(FormatPNG)
+	opts.Width = 8
+
+	var buf bytes.Buffer
+	if _, err := NewPNGProcessor().Convert(context.Background(), bytes.NewReader(createTestGIF(t, 16, 8)), &buf, opts); err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	anim, err := DecodeAnimation(&buf)
+	if err != nil {
+		t.Fatalf("DecodeAnimation() error = %v", err)
+	}
+	if len(anim.Frames) != 3 {
+		t.Fatalf("frames = %d, want 3", len(anim.Frames))
+	}
+	for i, f := range anim.Frames {
+		if got := f.Image.Bounds().Size(); got != image.Pt(16, 8) {
+			t.Errorf("frame %d size = %v, want 16x8", i, got)
+		}
+	}
+}
+
+func TestConvert_Poster(t *testing.T) {
+	input := createTestGIF(t, 16, 8)
+
+	tests := []struct {
+		name    string
+		proc    Processor
+		format  ImageFormat
+		poster  bool
+		page    int
+		decode  func(*bytes.Buffer) (image.Image, error)
+		wantErr error
+	}{
+		{name: "PNG poster of second frame", proc: NewPNGProcessor(), format: FormatPNG, poster: true, page: 1, decode: decodePNG},
+		{name: "JPEG always writes one frame", proc: NewJPEGProcessor(), format: FormatJPEG, page: 2, decode: decodeJPEG},
+		{name: "frame out of range", proc: NewPNGProcessor(), format: FormatPNG, poster: true, page: 3, wantErr: ErrPageOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultConvertOptions(tt.format)
+			opts.Poster = tt.poster
+			opts.Page = tt.page
+
+			var buf bytes.Buffer
+			_, err := tt.proc.Convert(context.Background(), bytes.NewReader(input), &buf, opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Convert() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+			if isAPNG(buf.Bytes()) {
+				t.Fatal("poster output is animated")
+			}
+			img, err := tt.decode(&buf)
+			if err != nil {
+				t.Fatalf("decode output: %v", err)
+			}
+			r, g, b, _ := img.At(4, 4).RGBA()
+			want := testFrameColors[tt.page]
+			if diff(r>>8, uint32(want.R)) > 8 || diff(g>>8, uint32(want.G)) > 8 || diff(b>>8, uint32(want.B)) > 8 {
+				t.Errorf("color = (%d,%d,%d), want %v", r>>8, g>>8, b>>8, want)
+			}
+		})
+	}
+}
+
+func decodePNG(buf *bytes.Buffer) (image.Image, error)  { return png.Decode(buf) }
+func decodeJPEG(buf *bytes.Buffer) (image.Image, error) { return jpeg.Decode(buf) }
+
+func TestGIFProcessor_ConvertStill(t *testing.T) {
+	// A gradient has more colors than a GIF palette can hold.
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := range 64 {
+		for x := range 64 {
+			src.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8((x + y) * 2), A: 255})
+		}
+	}
+	src.SetNRGBA(0, 0, color.NRGBA{})
+	var in bytes.Buffer
+	if err := png.Encode(&in, src); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, level := range []CompressionLevel{CompressionLow, CompressionMedium} {
+		t.Run(level.String(), func(t *testing.T) {
+			opts := DefaultConvertOptions(FormatGIF)
+			opts.Level = level
+
+			var buf bytes.Buffer
+			if _, err := NewGIFProcessor().Convert(context.Background(), bytes.NewReader(in.Bytes()), &buf, opts); err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+			img, err := gif.Decode(&buf)
+			if err != nil {
+				t.Fatalf("output is not a valid GIF: %v", err)
+			}
+			if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+				t.Errorf("transparent pixel alpha = %d, want 0", a)
+			}
+			r, g, _, _ := img.At(40, 20).RGBA()
+			if diff(r>>8, 160) > 24 || diff(g>>8, 80) > 24 {
+				t.Errorf("pixel (40,20) = (%d,%d), want about (160,80)", r>>8, g>>8)
+			}
+		})
+	}
+}
+
+func TestGIFProcessor_Convert_FormatMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := NewGIFProcessor().Convert(context.Background(), bytes.NewReader(createTestGIF(t, 4, 4)), &buf, DefaultConvertOptions(FormatPNG))
+	if err == nil {
+		t.Error("expected error for non-GIF target format")
+	}
+}
+
+func TestLoopCountConversion(t *testing.T) {
+	tests := []struct {
+		plays, gifLoop int
+	}{
+		{plays: 0, gifLoop: 0},
+		{plays: 1, gifLoop: -1},
+		{plays: 2, gifLoop: 1},
+		{plays: 5, gifLoop: 4},
+	}
+
+	for _, tt := range tests {
+		if got := gifLoopCount(tt.plays); got != tt.gifLoop {
+			t.Errorf("gifLoopCount(%d) = %d, want %d", tt.plays, got, tt.gifLoop)
+		}
+		if got := gifPlays(tt.gifLoop); got != tt.plays {
+			t.Errorf("gifPlays(%d) = %d, want %d", tt.gifLoop, got, tt.plays)
+		}
+	}
+}
+
+func TestDecodeAnimation_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "truncated GIF", data: []byte("GIF89a\x10\x00")},
+		{name: "APNG without frames", data: append([]byte(pngSignature), "\x00\x00\x00\x08acTL\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00"...)},
+		{name: "animated WebP without frames", data: riffFile([]byte("WEBPVP8X\x0a\x00\x00\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeAnimation(bytes.NewReader(tt.data)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
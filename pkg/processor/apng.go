@@ -0,0 +1,415 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"time"
+)
+
+// pngSignature is the 8-byte signature at the start of every PNG file.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// APNG frame disposal and blend operations (fcTL dispose_op/blend_op).
+const (
+	apngDisposeNone       = 0
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+
+	apngBlendSource = 0
+)
+
+// pngChunk is a raw PNG chunk without its length and CRC.
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readPNGChunks splits a PNG file into chunks, stopping after IEND.
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, errors.New("invalid png: missing signature")
+	}
+	var chunks []pngChunk
+	for off := len(pngSignature); off < len(data); {
+		if len(data)-off < 12 {
+			return nil, errors.New("invalid png: truncated chunk")
+		}
+		n := binary.BigEndian.Uint32(data[off : off+4])
+		if uint64(n) > uint64(len(data)-off-12) {
+			return nil, errors.New("invalid png: chunk length exceeds file size")
+		}
+		c := pngChunk{typ: string(data[off+4 : off+8]), data: data[off+8 : off+8+int(n)]}
+		chunks = append(chunks, c)
+		off += 12 + int(n)
+		if c.typ == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// isAPNG reports whether data is a PNG with an acTL chunk before its image data.
+func isAPNG(data []byte) bool {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return false
+	}
+	for off := len(pngSignature); len(data)-off >= 12; {
+		n := int(binary.BigEndian.Uint32(data[off : off+4]))
+		switch string(data[off+4 : off+8]) {
+		case "acTL":
+			return true
+		case "IDAT", "IEND":
+			return false
+		}
+		if n > len(data)-off-12 {
+			return false
+		}
+		off += 12 + n
+	}
+	return false
+}
+
+// apngFrameControl holds the fields of an fcTL chunk.
+type apngFrameControl struct {
+	rect      image.Rectangle
+	delay     time.Duration
+	disposeOp byte
+	blendOp   byte
+}
+
+// parseFrameControl parses the data of an fcTL chunk.
+func parseFrameControl(data []byte) (apngFrameControl, error) {
+	if len(data) != 26 {
+		return apngFrameControl{}, errors.New("invalid apng: bad fcTL length")
+	}
+	be := binary.BigEndian
+	w, h := int(be.Uint32(data[4:8])), int(be.Uint32(data[8:12]))
+	x, y := int(be.Uint32(data[12:16])), int(be.Uint32(data[16:20]))
+	num, den := be.Uint16(data[20:22]), be.Uint16(data[22:24])
+	if den == 0 {
+		den = 100
+	}
+	return apngFrameControl{
+		rect:      image.Rect(x, y, x+w, y+h),
+		delay:     time.Duration(num) * time.Second / time.Duration(den),
+		disposeOp: data[24],
+		blendOp:   data[25],
+	}, nil
+}
+
+// decodeAPNG decodes every frame of an APNG, compositing each frame onto the
+// canvas according to its dispose and blend operations. A default image that
+// is not part of the animation is skipped. When limit is positive only the
+// first limit frames are decoded.
+func decodeAPNG(data []byte, limit int) (*Animation, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].typ != "IHDR" || len(chunks[0].data) != 13 {
+		return nil, errors.New("invalid png: missing IHDR")
+	}
+	ihdr := chunks[0].data
+	canvasRect := image.Rect(0, 0, int(binary.BigEndian.Uint32(ihdr[0:4])), int(binary.BigEndian.Uint32(ihdr[4:8])))
+
+	type apngFrame struct {
+		control apngFrameControl
+		data    []byte
+	}
+	var (
+		anim     Animation
+		frames   []apngFrame
+		palette  []pngChunk
+		seenIDAT bool
+	)
+	for _, c := range chunks[1:] {
+		switch c.typ {
+		case "acTL":
+			if len(c.data) != 8 {
+				return nil, errors.New("invalid apng: bad acTL length")
+			}
+			anim.LoopCount = int(binary.BigEndian.Uint32(c.data[4:8]))
+		case "PLTE", "tRNS":
+			if !seenIDAT {
+				palette = append(palette, c)
+			}
+		case "fcTL":
+			control, err := parseFrameControl(c.data)
+			if err != nil {
+				return nil, err
+			}
+			if control.rect.Empty() || !control.rect.In(canvasRect) {
+				return nil, fmt.Errorf("invalid apng: frame %v outside canvas %v", control.rect, canvasRect)
+			}
+			frames = append(frames, apngFrame{control: control})
+		case "IDAT":
+			seenIDAT = true
+			// IDAT belongs to the animation only when an fcTL precedes it.
+			if len(frames) == 1 {
+				frames[0].data = append(frames[0].data, c.data...)
+			}
+		case "fdAT":
+			if len(frames) == 0 || len(c.data) < 4 {
+				return nil, errors.New("invalid apng: unexpected fdAT")
+			}
+			f := &frames[len(frames)-1]
+			f.data = append(f.data, c.data[4:]...)
+		}
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("invalid apng: no frames")
+	}
+	if limit > 0 && len(frames) > limit {
+		frames = frames[:limit]
+	}
+	if err := checkAnimationSize(canvasRect.Dx(), canvasRect.Dy(), len(frames)); err != nil {
+		return nil, err
+	}
+
+	canvas := image.NewRGBA(canvasRect)
+	for i, f := range frames {
+		img, err := decodeAPNGFrame(ihdr, f.control.rect.Size(), palette, f.data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid apng frame %d: %w", i, err)
+		}
+
+		dispose := f.control.disposeOp
+		if i == 0 && dispose == apngDisposePrevious {
+			dispose = apngDisposeBackground
+		}
+		var previous *image.RGBA
+		if dispose == apngDisposePrevious {
+			previous = snapshot(canvas)
+		}
+
+		op := draw.Over
+		if f.control.blendOp == apngBlendSource {
+			op = draw.Src
+		}
+		draw.Draw(canvas, f.control.rect, img, img.Bounds().Min, op)
+		anim.Frames = append(anim.Frames, Frame{Image: snapshot(canvas), Delay: f.control.delay})
+
+		switch dispose {
+		case apngDisposeBackground:
+			clearRect(canvas, f.control.rect)
+		case apngDisposePrevious:
+			canvas = previous
+		}
+	}
+	return &anim, nil
+}
+
+// decodeAPNGFrame decodes the compressed image data of one frame by wrapping it
+// in a standalone PNG that shares the header and palette of the animation.
+func decodeAPNGFrame(ihdr []byte, size image.Point, palette []pngChunk, data []byte) (image.Image, error) {
+	header := append([]byte{}, ihdr...)
+	binary.BigEndian.PutUint32(header[0:4], uint32(size.X))
+	binary.BigEndian.PutUint32(header[4:8], uint32(size.Y))
+
+	var buf bytes.Buffer
+	buf.WriteString(pngSignature)
+	cw := &pngChunkWriter{w: &buf}
+	cw.write("IHDR", header)
+	for _, c := range palette {
+		cw.write(c.typ, c.data)
+	}
+	cw.write("IDAT", data)
+	cw.write("IEND", nil)
+	return png.Decode(&buf)
+}
+
+// pngChunkWriter writes PNG chunks, keeping the first write error.
+type pngChunkWriter struct {
+	w   io.Writer
+	err error
+}
+
+// write writes a chunk with its length and CRC.
+func (cw *pngChunkWriter) write(typ string, data []byte) {
+	if cw.err != nil {
+		return
+	}
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+	for _, b := range [][]byte{header[:], data, footer[:]} {
+		if _, err := cw.w.Write(b); err != nil {
+			cw.err = err
+			return
+		}
+	}
+}
+
+// encodeAPNG writes anim as an 8-bit RGBA APNG. Every frame covers the whole
+// canvas and replaces the previous one, and the first frame doubles as the
+// default image shown by decoders without APNG support.
+func encodeAPNG(w io.Writer, anim *Animation, level CompressionLevel) error {
+	frames, err := animationFrames(anim)
+	if err != nil {
+		return err
+	}
+	be := binary.BigEndian
+	size := frames[0].Rect.Size()
+
+	if _, err := io.WriteString(w, pngSignature); err != nil {
+		return err
+	}
+	cw := &pngChunkWriter{w: w}
+
+	ihdr := make([]byte, 13)
+	be.PutUint32(ihdr[0:4], uint32(size.X))
+	be.PutUint32(ihdr[4:8], uint32(size.Y))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // truecolor with alpha
+	cw.write("IHDR", ihdr)
+
+	actl := make([]byte, 8)
+	be.PutUint32(actl[0:4], uint32(len(frames)))
+	be.PutUint32(actl[4:8], uint32(anim.LoopCount))
+	cw.write("acTL", actl)
+
+	var seq uint32
+	for i, frame := range frames {
+		fctl := make([]byte, 26)
+		be.PutUint32(fctl[0:4], seq)
+		be.PutUint32(fctl[4:8], uint32(size.X))
+		be.PutUint32(fctl[8:12], uint32(size.Y))
+		num, den := apngDelay(anim.Frames[i].Delay)
+		be.PutUint16(fctl[20:22], num)
+		be.PutUint16(fctl[22:24], den)
+		fctl[24] = apngDisposeNone
+		fctl[25] = apngBlendSource
+		cw.write("fcTL", fctl)
+		seq++
+
+		data, err := compressPNGRows(frame, level)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			cw.write("IDAT", data)
+			continue
+		}
+		fdat := make([]byte, 4, 4+len(data))
+		be.PutUint32(fdat, seq)
+		cw.write("fdAT", append(fdat, data...))
+		seq++
+	}
+	cw.write("IEND", nil)
+	return cw.err
+}
+
+// apngDelay converts a frame delay to an fcTL delay fraction, using
+// milliseconds when they fit and hundredths of a second otherwise.
+func apngDelay(d time.Duration) (num, den uint16) {
+	if ms := d.Milliseconds(); ms <= 0xffff {
+		return uint16(max(ms, 0)), 1000
+	}
+	return uint16(min(d/(10*time.Millisecond), 0xffff)), 100
+}
+
+// zlibLevel converts CompressionLevel to a zlib compression level.
+func zlibLevel(level CompressionLevel) int {
+	switch level {
+	case CompressionLow:
+		return zlib.BestSpeed
+	case CompressionHigh:
+		return zlib.BestCompression
+	default:
+		return zlib.DefaultCompression
+	}
+}
+
+// compressPNGRows filters and compresses the rows of img as 8-bit RGBA PNG
+// image data. Each row uses the filter with the smallest sum of absolute
+// differences, the heuristic recommended by the PNG specification.
+func compressPNGRows(img *image.NRGBA, level CompressionLevel) ([]byte, error) {
+	const bpp = 4
+	var buf bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&buf, zlibLevel(level))
+	if err != nil {
+		return nil, err
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	rowLen := w * bpp
+	prev := make([]byte, rowLen)
+	var filtered [5][]byte
+	for f := range filtered {
+		filtered[f] = make([]byte, 1+rowLen)
+		filtered[f][0] = byte(f)
+	}
+	for y := range h {
+		row := img.Pix[y*img.Stride : y*img.Stride+rowLen]
+		best, bestSum := 0, -1
+		for f := range filtered {
+			out := filtered[f][1:]
+			sum := 0
+			for i := range rowLen {
+				var left, upLeft byte
+				if i >= bpp {
+					left, upLeft = row[i-bpp], prev[i-bpp]
+				}
+				up := prev[i]
+				var pred byte
+				switch f {
+				case 1:
+					pred = left
+				case 2:
+					pred = up
+				case 3:
+					pred = byte((int(left) + int(up)) / 2)
+				case 4:
+					pred = paeth(left, up, upLeft)
+				}
+				out[i] = row[i] - pred
+				sum += absInt(int(int8(out[i])))
+			}
+			if bestSum < 0 || sum < bestSum {
+				best, bestSum = f, sum
+			}
+		}
+		if _, err := zw.Write(filtered[best]); err != nil {
+			return nil, err
+		}
+		prev = row
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// paeth returns the Paeth predictor of a (left), b (up) and c (upper left).
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+// absInt returns the absolute value of x.
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
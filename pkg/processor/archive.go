@@ -0,0 +1,624 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"strings"
+)
+
+// ArchiveFormat is the container format of an Archive.
+type ArchiveFormat int
+
+const (
+	// ArchiveZIP is a ZIP archive.
+	ArchiveZIP ArchiveFormat = iota
+	// ArchiveTAR is an uncompressed TAR archive.
+	ArchiveTAR
+	// ArchiveTarGz is a gzip-compressed TAR archive.
+	ArchiveTarGz
+)
+
+// String returns the usual file extension of the format without the leading dot.
+func (f ArchiveFormat) String() string {
+	switch f {
+	case ArchiveZIP:
+		return "zip"
+	case ArchiveTAR:
+		return "tar"
+	case ArchiveTarGz:
+		return "tar.gz"
+	default:
+		return "unknown"
+	}
+}
+
+// DetectArchiveFormat returns the archive format of name from its extension:
+// ".zip", ".tar", ".tar.gz" or ".tgz", ignoring case.
+func DetectArchiveFormat(name string) (ArchiveFormat, bool) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveZIP, true
+	case strings.HasSuffix(lower, ".tar"):
+		return ArchiveTAR, true
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveTarGz, true
+	default:
+		return -1, false
+	}
+}
+
+// Default limits of CompressArchive, see WithArchiveLimits and
+// WithArchiveMaxEntrySize.
+const (
+	DefaultArchiveMaxEntries         = 100_000
+	DefaultArchiveMaxTotalSize int64 = 16 << 30
+	DefaultArchiveMaxEntrySize int64 = 256 << 20
+)
+
+// archiveBufferSize is the size up to which an entry other than an image is
+// held in memory while earlier images are still being compressed. Larger
+// entries wait for them and are then streamed.
+const archiveBufferSize = 1 << 20
+
+// ErrArchiveTooLarge is returned by CompressArchive when an archive holds
+// more entries or more uncompressed data than WithArchiveLimits allows.
+var ErrArchiveTooLarge = errors.New("archive exceeds the entry or size limit")
+
+// ArchiveOption is a functional option for CompressArchive.
+type ArchiveOption func(*archiveConfig)
+
+type archiveConfig struct {
+	filter       ScanFilter
+	maxEntries   int
+	maxTotalSize int64
+	maxEntrySize int64
+}
+
+// WithArchiveFilter selects the image entries to compress by name, like
+// WithFilter selects files. IgnoreFiles is not applied: an ignore file inside
+// an archive comes from whoever made the archive, who must not decide what
+// is scanned. Symlinks does not apply either.
+func WithArchiveFilter(f ScanFilter) ArchiveOption {
+	return func(cfg *archiveConfig) {
+		cfg.filter = f
+		cfg.filter.IgnoreFiles = nil
+	}
+}
+
+// WithArchiveLimits makes CompressArchive fail with ErrArchiveTooLarge once
+// the archive holds more than maxEntries entries, or more than maxTotalSize
+// bytes of entry data have been decompressed. A value of 0 or less keeps
+// the default, DefaultArchiveMaxEntries or DefaultArchiveMaxTotalSize.
+func WithArchiveLimits(maxEntries int, maxTotalSize int64) ArchiveOption {
+	return func(cfg *archiveConfig) {
+		if maxEntries > 0 {
+			cfg.maxEntries = maxEntries
+		}
+		if maxTotalSize > 0 {
+			cfg.maxTotalSize = maxTotalSize
+		}
+	}
+}
+
+// WithArchiveMaxEntrySize sets the size up to which CompressArchive reads an
+// image entry when opts.MaxFileSize is 0. A value of 0 or less keeps the
+// default, DefaultArchiveMaxEntrySize.
+func WithArchiveMaxEntrySize(size int64) ArchiveOption {
+	return func(cfg *archiveConfig) {
+		if size > 0 {
+			cfg.maxEntrySize = size
+		}
+	}
+}
+
+// CompressArchive reads the archive in r entry by entry, compresses its
+// images with opts on the workers of bp and writes an archive in the same
+// format to w, with the entries in the same order. Other entries, and images
+// that fail, are aborted or are kept by WithNeverGrow, are copied unchanged;
+// ZIP entries are then copied without being decompressed. Only the images
+// being compressed and the small entries queued behind them are held in memory.
+//
+// Images are regular entries of a format that can be compressed whose name
+// is a clean relative path (not e.g. "../a.jpg" or "/a.jpg"), except later
+// duplicates of a name. Each is read up to opts.MaxFileSize, or up to the
+// size set by WithArchiveMaxEntrySize when it is 0; a larger image fails
+// with ErrFileTooLarge and is copied unchanged. A ZIP archive is read
+// at random: r is used in place when it is an *os.File or an io.ReaderAt
+// with a Size method such as *bytes.Reader, and read into memory otherwise.
+//
+// The results cover every image, in archive order. Progress reports a Total
+// for ZIP archives only. WithStorage, WithJournal and WithOutputSink do not
+// apply, since the entries are processed in memory.
+func (bp *DefaultBatchProcessor) CompressArchive(ctx context.Context, r io.Reader, w io.Writer, format ArchiveFormat, opts CompressOptions, archiveOpts ...ArchiveOption) ([]BatchResult, error) {
+	cfg := archiveConfig{
+		maxEntries:   DefaultArchiveMaxEntries,
+		maxTotalSize: DefaultArchiveMaxTotalSize,
+		maxEntrySize: DefaultArchiveMaxEntrySize,
+	}
+	for _, opt := range archiveOpts {
+		opt(&cfg)
+	}
+	if opts.MaxFileSize == 0 {
+		opts.MaxFileSize = cfg.maxEntrySize
+	}
+	c, err := newArchiveCompressor(ctx, bp, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.cancel(nil)
+
+	switch format {
+	case ArchiveZIP:
+		err = c.compressZIP(r, w)
+	case ArchiveTAR:
+		err = c.compressTAR(r, w)
+	case ArchiveTarGz:
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(r); err == nil {
+			gw := gzip.NewWriter(w)
+			if err = c.compressTAR(gz, gw); err == nil {
+				err = gw.Close()
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %d", format)
+	}
+	if err != nil {
+		c.discard()
+		return c.results, fmt.Errorf("failed to compress %s archive: %w", format, err)
+	}
+	return c.results, nil
+}
+
+// archiveCompressor runs CompressArchive. Entries are read and written on the
+// calling goroutine; images are compressed on goroutines of their own, at
+// most as many at a time as bp has workers.
+type archiveCompressor struct {
+	parent context.Context // cancelled by the caller
+	ctx    context.Context // also cancelled by the failure policy
+	cancel context.CancelCauseFunc
+
+	bp       *DefaultBatchProcessor
+	opts     CompressOptions
+	files    *MemoryStorage // images in flight, compressed in place
+	filter   *walker
+	sem      *memorySemaphore
+	progress *progressTracker
+	workers  chan struct{}
+	window   int
+
+	maxEntries int
+	maxTotal   int64
+	entries    int
+	left       int64 // uncompressed bytes left before maxTotal is exceeded
+	seen       map[string]bool
+
+	pending []archiveSlot
+	results []BatchResult
+}
+
+// archiveSlot is an entry waiting to be written in archive order. done
+// delivers the result of an image and is nil for other entries.
+type archiveSlot struct {
+	name  string
+	done  chan BatchResult
+	write func(res BatchResult) error
+}
+
+func newArchiveCompressor(ctx context.Context, bp *DefaultBatchProcessor, cfg archiveConfig, opts CompressOptions) (*archiveCompressor, error) {
+	filter, err := newWalker(cfg.filter)
+	if err != nil {
+		return nil, err
+	}
+	files := NewMemoryStorage()
+	abp := *bp
+	abp.storage, abp.journalPath, abp.sink = files, "", nil
+	workers := max(bp.maxWorkers, 1)
+
+	c := &archiveCompressor{
+		parent:     ctx,
+		bp:         &abp,
+		opts:       opts,
+		files:      files,
+		filter:     filter,
+		sem:        newMemorySemaphore(bp.memoryBudget),
+		workers:    make(chan struct{}, workers),
+		window:     2 * workers,
+		maxEntries: cfg.maxEntries,
+		maxTotal:   cfg.maxTotalSize,
+		left:       cfg.maxTotalSize,
+		seen:       make(map[string]bool),
+	}
+	c.ctx, c.cancel = context.WithCancelCause(ctx)
+	return c, nil
+}
+
+func (c *archiveCompressor) compressZIP(r io.Reader, w io.Writer) error {
+	ra, size, err := archiveReaderAt(r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return err
+	}
+	if len(zr.File) > c.maxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveTooLarge, c.maxEntries)
+	}
+	seen := make(map[string]bool)
+	images := 0
+	for _, f := range zr.File {
+		if c.isImage(f.Name, f.Mode().IsRegular(), seen) {
+			images++
+		}
+	}
+	c.progress = newProgressTracker(images)
+
+	zw := zip.NewWriter(w)
+	for _, f := range zr.File {
+		if err := c.parent.Err(); err != nil {
+			return err
+		}
+		copyRaw := func(BatchResult) error { return zw.Copy(f) }
+		if !c.isImage(f.Name, f.Mode().IsRegular(), c.seen) {
+			if err := c.push(archiveSlot{name: f.Name, write: copyRaw}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		data, err := c.readZIPEntry(f)
+		if errors.Is(err, ErrArchiveTooLarge) {
+			return err
+		}
+		if err != nil {
+			err = c.push(c.failed(f.Name, err, copyRaw))
+		} else {
+			err = c.submit(f.Name, data, func(res BatchResult) error {
+				out, ok := c.output(res)
+				if !ok {
+					return zw.Copy(f)
+				}
+				hdr := f.FileHeader
+				// Sizes and checksums are recomputed, and the writer adds its
+				// own ZIP64 and timestamp extra fields.
+				hdr.CRC32, hdr.CompressedSize, hdr.UncompressedSize = 0, 0, 0
+				hdr.CompressedSize64, hdr.UncompressedSize64 = 0, 0
+				hdr.Extra = zipExtra(hdr.Extra, !hdr.Modified.IsZero())
+				fw, err := zw.CreateHeader(&hdr)
+				if err != nil {
+					return fmt.Errorf("%s: %w", hdr.Name, err)
+				}
+				if _, err := fw.Write(out); err != nil {
+					return fmt.Errorf("%s: %w", hdr.Name, err)
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := c.flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// readZIPEntry decompresses the image entry f up to the file size limit.
+func (c *archiveCompressor) readZIPEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+	return readEntry(c.budget(rc), c.opts.MaxFileSize)
+}
+
+func (c *archiveCompressor) compressTAR(r io.Reader, w io.Writer) error {
+	c.progress = newProgressTracker(0)
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		if err := c.parent.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.next(); err != nil {
+			return err
+		}
+		body := c.budget(tr)
+
+		if !c.isImage(hdr.Name, hdr.Typeflag == tar.TypeReg, c.seen) {
+			if hdr.Size > archiveBufferSize {
+				if err := c.flush(); err != nil {
+					return err
+				}
+				if err := writeTAREntry(tw, hdr, nil, body); err != nil {
+					return err
+				}
+				continue
+			}
+			data, err := io.ReadAll(body)
+			if err != nil {
+				return fmt.Errorf("%s: %w", hdr.Name, err)
+			}
+			err = c.push(archiveSlot{name: hdr.Name, write: func(BatchResult) error {
+				return writeTAREntry(tw, hdr, data, nil)
+			}})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		data, err := readEntry(body, c.opts.MaxFileSize)
+		switch {
+		case errors.Is(err, ErrFileTooLarge):
+			// Queue the failure, then stream the entry behind the images before it.
+			if err := c.push(c.failed(hdr.Name, err, func(BatchResult) error { return nil })); err != nil {
+				return err
+			}
+			if err := c.flush(); err != nil {
+				return err
+			}
+			err = writeTAREntry(tw, hdr, data, body)
+		case err != nil:
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		default:
+			err = c.submit(hdr.Name, data, func(res BatchResult) error {
+				if out, ok := c.output(res); ok {
+					return writeTAREntry(tw, hdr, out, nil)
+				}
+				return writeTAREntry(tw, hdr, data, nil)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := c.flush(); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// writeTAREntry writes hdr followed by data and then the rest of rest, if
+// non-nil, with the size set to the bytes written.
+func writeTAREntry(tw *tar.Writer, hdr *tar.Header, data []byte, rest io.Reader) error {
+	h := *hdr
+	if rest == nil {
+		h.Size = int64(len(data))
+	}
+	if err := tw.WriteHeader(&h); err != nil {
+		return fmt.Errorf("%s: %w", h.Name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("%s: %w", h.Name, err)
+	}
+	if rest != nil {
+		if _, err := io.Copy(tw, rest); err != nil {
+			return fmt.Errorf("%s: %w", h.Name, err)
+		}
+	}
+	return nil
+}
+
+// isImage reports whether the entry name is an image to compress and marks
+// it in seen: a regular file with a clean relative name not in seen yet, of
+// a format that can be compressed and passing the filter.
+func (c *archiveCompressor) isImage(name string, regular bool, seen map[string]bool) bool {
+	if !regular || memoryKey(name) != name || seen[name] {
+		return false
+	}
+	seen[name] = true
+	format, err := detectFormatFromPath(name)
+	if err != nil || !format.CanEncode() {
+		return false
+	}
+	ok, _ := c.filter.allows(name, nil)
+	return ok
+}
+
+// next counts an entry against the entry limit.
+func (c *archiveCompressor) next() error {
+	c.entries++
+	if c.entries > c.maxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveTooLarge, c.maxEntries)
+	}
+	return nil
+}
+
+// budget returns r counting what it reads against the total size limit.
+func (c *archiveCompressor) budget(r io.Reader) io.Reader {
+	return &budgetReader{r: r, c: c}
+}
+
+type budgetReader struct {
+	r io.Reader
+	c *archiveCompressor
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.c.left -= int64(n)
+	if b.c.left < 0 {
+		return n, fmt.Errorf("%w: more than %d bytes uncompressed", ErrArchiveTooLarge, b.c.maxTotal)
+	}
+	return n, err
+}
+
+// readEntry reads r up to limit bytes. A longer entry returns the first
+// limit+1 bytes with ErrFileTooLarge. A limit of 0 or less reads everything.
+func readEntry(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 || limit == math.MaxInt64 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err == nil && int64(len(data)) > limit {
+		err = ErrFileTooLarge
+	}
+	return data, err
+}
+
+// submit compresses the image data of the entry name on a worker and queues
+// write to run with its result.
+func (c *archiveCompressor) submit(name string, data []byte, write func(BatchResult) error) error {
+	c.files.WriteFile(name, data)
+	done := make(chan BatchResult, 1)
+	go func() {
+		c.workers <- struct{}{}
+		res := c.bp.runItem(c.ctx, nil, c.sem, BatchItem{InputPath: name, OutputPath: name, Options: c.opts})
+		<-c.workers
+		c.finish(res)
+		done <- res
+	}()
+	return c.push(archiveSlot{name: name, done: done, write: write})
+}
+
+// failed returns the slot of an image that failed with err before it could
+// be compressed; write copies it unchanged.
+func (c *archiveCompressor) failed(name string, err error, write func(BatchResult) error) archiveSlot {
+	res := BatchResult{Item: BatchItem{InputPath: name, OutputPath: name, Options: c.opts}, Error: err}
+	if errors.Is(context.Cause(c.ctx), ErrBatchAborted) {
+		res.Error, res.Aborted = ErrBatchAborted, true
+	}
+	c.finish(res)
+	done := make(chan BatchResult, 1)
+	done <- res
+	return archiveSlot{name: name, done: done, write: write}
+}
+
+// finish accounts for res and trips the failure policy if needed.
+func (c *archiveCompressor) finish(res BatchResult) {
+	if c.bp.exceedsFailureBudget(c.progress.finish(res.outcome())) {
+		c.cancel(ErrBatchAborted)
+	}
+}
+
+// output returns the compressed data of an image, or false if the original
+// is to be copied unchanged.
+func (c *archiveCompressor) output(res BatchResult) ([]byte, bool) {
+	if !res.IsSuccess() || res.KeptOriginal {
+		return nil, false
+	}
+	data, err := c.files.ReadFile(res.Item.OutputPath)
+	return data, err == nil
+}
+
+// push queues s, writing the oldest entries while too many are queued.
+func (c *archiveCompressor) push(s archiveSlot) error {
+	c.pending = append(c.pending, s)
+	for len(c.pending) > c.window {
+		if err := c.writeNext(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush writes every queued entry.
+func (c *archiveCompressor) flush() error {
+	for len(c.pending) > 0 {
+		if err := c.writeNext(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNext waits for the oldest queued entry and writes it.
+func (c *archiveCompressor) writeNext() error {
+	s := c.pending[0]
+	c.pending = c.pending[1:]
+	if s.done == nil {
+		return s.write(BatchResult{})
+	}
+	res := <-s.done
+	defer c.files.remove(s.name)
+	c.results = append(c.results, res)
+	if c.bp.progressCallback != nil {
+		c.bp.progressCallback(c.progress.snapshot(s.name))
+	}
+	return s.write(res)
+}
+
+// discard cancels the images in flight and waits for them without writing.
+func (c *archiveCompressor) discard() {
+	c.cancel(nil)
+	for _, s := range c.pending {
+		if s.done != nil {
+			<-s.done
+		}
+	}
+	c.pending = nil
+}
+
+// archiveReaderAt returns r as an io.ReaderAt with its size, reading it into
+// memory unless it supports random access.
+func archiveReaderAt(r io.Reader) (io.ReaderAt, int64, error) {
+	switch ra := r.(type) {
+	case interface {
+		io.ReaderAt
+		Size() int64
+	}:
+		return ra, ra.Size(), nil
+	case interface {
+		io.ReaderAt
+		Stat() (fs.FileInfo, error)
+	}:
+		info, err := ra.Stat()
+		if err != nil {
+			return nil, 0, err
+		}
+		return ra, info.Size(), nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
+
+// ZIP extra field IDs that zip.Writer writes itself.
+const (
+	zip64ExtraID   = 0x0001
+	extTimeExtraID = 0x5455
+)
+
+// zipExtra returns the extra fields of a rewritten ZIP entry: those of extra
+// except the ZIP64 sizes, which describe the old data, and, when the writer
+// adds its own from Modified, the extended timestamp.
+func zipExtra(extra []byte, modified bool) []byte {
+	var out []byte
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < 4+size {
+			break
+		}
+		field := extra[:4+size]
+		extra = extra[4+size:]
+		if id == zip64ExtraID || (id == extTimeExtraID && modified) {
+			continue
+		}
+		out = append(out, field...)
+	}
+	return out
+}
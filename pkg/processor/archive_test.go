@@ -0,0 +1,374 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+// archiveFile is an entry of a test archive; a name ending in "/" is a directory.
+type archiveFile struct {
+	name string
+	data []byte
+}
+
+func createTestZIP(t *testing.T, files []archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func createTestTAR(t *testing.T, files []archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0o640, Size: int64(len(f.data)), Typeflag: tar.TypeReg}
+		if f.name[len(f.name)-1] == '/' {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0o755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readTestArchive returns the entries of an archive in order.
+func readTestArchive(t *testing.T, data []byte, format ArchiveFormat) []archiveFile {
+	t.Helper()
+	var files []archiveFile
+	switch format {
+	case ArchiveZIP:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(rc)
+			_ = rc.Close()
+			files = append(files, archiveFile{f.Name, body})
+		}
+	default:
+		r := io.Reader(bytes.NewReader(data))
+		if format == ArchiveTarGz {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = gz
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(tr)
+			files = append(files, archiveFile{hdr.Name, body})
+		}
+	}
+	return files
+}
+
+func TestDetectArchiveFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   ArchiveFormat
+		wantOK bool
+	}{
+		{name: "photos.zip", want: ArchiveZIP, wantOK: true},
+		{name: "PHOTOS.ZIP", want: ArchiveZIP, wantOK: true},
+		{name: "photos.tar", want: ArchiveTAR, wantOK: true},
+		{name: "photos.tar.gz", want: ArchiveTarGz, wantOK: true},
+		{name: "photos.tgz", want: ArchiveTarGz, wantOK: true},
+		{name: "photo.jpg", wantOK: false},
+		{name: "photos.gz", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := DetectArchiveFormat(tt.name)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("DetectArchiveFormat(%q) = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDefaultBatchProcessor_CompressArchive(t *testing.T) {
+	photo := createTestJPEG(t, 64, 64, 100)
+	files := []archiveFile{
+		{name: "photos/", data: nil},
+		{name: "photos/a.jpg", data: photo},
+		{name: "photos/readme.txt", data: []byte("keep me")},
+		{name: "photos/broken.jpg", data: []byte("not an image")},
+		{name: "b.png", data: createTestPNG(t, 16, 16)},
+		{name: "../evil.jpg", data: photo},
+	}
+
+	tests := []struct {
+		name   string
+		format ArchiveFormat
+		input  func(*testing.T, []archiveFile) []byte
+	}{
+		{name: "zip", format: ArchiveZIP, input: createTestZIP},
+		{name: "tar", format: ArchiveTAR, input: createTestTAR},
+		{
+			name:   "tar.gz",
+			format: ArchiveTarGz,
+			input: func(t *testing.T, files []archiveFile) []byte {
+				var buf bytes.Buffer
+				gz := gzip.NewWriter(&buf)
+				_, _ = gz.Write(createTestTAR(t, files))
+				_ = gz.Close()
+				return buf.Bytes()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			results, err := NewDefaultBatchProcessor(WithMaxWorkers(2)).CompressArchive(context.Background(), bytes.NewReader(tt.input(t, files)), &out, tt.format, DefaultCompressOptions())
+			if err != nil {
+				t.Fatalf("CompressArchive() error = %v", err)
+			}
+
+			var processed []string
+			for _, r := range results {
+				processed = append(processed, r.Item.InputPath)
+				if r.IsSuccess() == (r.Item.InputPath == "photos/broken.jpg") {
+					t.Errorf("%s: IsSuccess() = %v, error = %v", r.Item.InputPath, r.IsSuccess(), r.Error)
+				}
+			}
+			slices.Sort(processed)
+			if want := []string{"b.png", "photos/a.jpg", "photos/broken.jpg"}; !slices.Equal(processed, want) {
+				t.Errorf("processed %v, want %v", processed, want)
+			}
+
+			got := readTestArchive(t, out.Bytes(), tt.format)
+			if len(got) != len(files) {
+				t.Fatalf("output has %d entries, want %d", len(got), len(files))
+			}
+			for i, f := range got {
+				if f.name != files[i].name {
+					t.Errorf("entry %d = %s, want %s", i, f.name, files[i].name)
+				}
+				switch f.name {
+				case "photos/a.jpg":
+					if len(f.data) >= len(photo) {
+						t.Errorf("photos/a.jpg was not compressed: %d >= %d bytes", len(f.data), len(photo))
+					}
+				case "photos/readme.txt", "photos/broken.jpg", "../evil.jpg":
+					if !bytes.Equal(f.data, files[i].data) {
+						t.Errorf("%s was modified", f.name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultBatchProcessor_CompressArchive_破損アーカイブ(t *testing.T) {
+	for _, format := range []ArchiveFormat{ArchiveZIP, ArchiveTAR, ArchiveTarGz} {
+		_, err := NewDefaultBatchProcessor().CompressArchive(context.Background(), bytes.NewReader(bytes.Repeat([]byte("not an archive"), 64)), io.Discard, format, DefaultCompressOptions())
+		if err == nil {
+			t.Errorf("CompressArchive(%s) error = nil, want error", format)
+		}
+	}
+}
+
+func TestDefaultBatchProcessor_CompressArchive_ファイルサイズ上限(t *testing.T) {
+	large := createTestJPEG(t, 64, 64, 100)
+	small := createTestJPEG(t, 8, 8, 100)
+	files := []archiveFile{
+		{name: "large.jpg", data: large},
+		{name: "small.jpg", data: small},
+	}
+	limited := DefaultCompressOptions()
+	limited.MaxFileSize = int64(len(small))
+
+	tests := []struct {
+		name        string
+		opts        CompressOptions
+		archiveOpts []ArchiveOption
+	}{
+		{name: "max file size", opts: limited, archiveOpts: []ArchiveOption{WithArchiveMaxEntrySize(int64(len(large)))}},
+		{name: "max entry size", opts: DefaultCompressOptions(), archiveOpts: []ArchiveOption{WithArchiveMaxEntrySize(int64(len(small)))}},
+	}
+	for _, tt := range tests {
+		for _, format := range []ArchiveFormat{ArchiveZIP, ArchiveTAR} {
+			t.Run(tt.name+"/"+format.String(), func(t *testing.T) {
+				input := createTestZIP(t, files)
+				if format == ArchiveTAR {
+					input = createTestTAR(t, files)
+				}
+				var out bytes.Buffer
+				results, err := NewDefaultBatchProcessor().CompressArchive(context.Background(), bytes.NewReader(input), &out, format, tt.opts, tt.archiveOpts...)
+				if err != nil {
+					t.Fatalf("CompressArchive() error = %v", err)
+				}
+				if len(results) != 2 {
+					t.Fatalf("got %d results, want 2", len(results))
+				}
+				if !errors.Is(results[0].Error, ErrFileTooLarge) {
+					t.Errorf("large.jpg error = %v, want ErrFileTooLarge", results[0].Error)
+				}
+				if !results[1].IsSuccess() {
+					t.Errorf("small.jpg error = %v", results[1].Error)
+				}
+				got := readTestArchive(t, out.Bytes(), format)
+				if len(got) != 2 || !bytes.Equal(got[0].data, large) {
+					t.Errorf("large.jpg was not copied unchanged")
+				}
+			})
+		}
+	}
+}
+
+func TestDefaultBatchProcessor_CompressArchive_上限超過(t *testing.T) {
+	files := []archiveFile{
+		{name: "a.txt", data: bytes.Repeat([]byte("a"), 100)},
+		{name: "b.txt", data: bytes.Repeat([]byte("b"), 100)},
+		{name: "c.txt", data: bytes.Repeat([]byte("c"), 100)},
+	}
+	tests := []struct {
+		name       string
+		format     ArchiveFormat
+		maxEntries int
+		maxTotal   int64
+	}{
+		{name: "zip entries", format: ArchiveZIP, maxEntries: 2},
+		{name: "tar entries", format: ArchiveTAR, maxEntries: 2},
+		{name: "tar total size", format: ArchiveTAR, maxTotal: 250},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := createTestZIP(t, files)
+			if tt.format == ArchiveTAR {
+				input = createTestTAR(t, files)
+			}
+			_, err := NewDefaultBatchProcessor().CompressArchive(context.Background(), bytes.NewReader(input), io.Discard, tt.format, DefaultCompressOptions(), WithArchiveLimits(tt.maxEntries, tt.maxTotal))
+			if !errors.Is(err, ErrArchiveTooLarge) {
+				t.Errorf("CompressArchive() error = %v, want ErrArchiveTooLarge", err)
+			}
+		})
+	}
+
+	t.Run("zip total size", func(t *testing.T) {
+		photo := createTestJPEG(t, 64, 64, 100)
+		input := createTestZIP(t, []archiveFile{{name: "a.jpg", data: photo}})
+		_, err := NewDefaultBatchProcessor().CompressArchive(context.Background(), bytes.NewReader(input), io.Discard, ArchiveZIP, DefaultCompressOptions(), WithArchiveLimits(0, int64(len(photo)/2)))
+		if !errors.Is(err, ErrArchiveTooLarge) {
+			t.Errorf("CompressArchive() error = %v, want ErrArchiveTooLarge", err)
+		}
+	})
+}
+
+func TestDefaultBatchProcessor_CompressArchive_アーカイブ内の除外ファイルは無視(t *testing.T) {
+	photo := createTestJPEG(t, 32, 32, 100)
+	input := createTestTAR(t, []archiveFile{
+		{name: ".lokiignore", data: []byte("*.jpg\n")},
+		{name: "a.jpg", data: photo},
+		{name: "skip/b.jpg", data: photo},
+	})
+	filter := ScanFilter{IgnoreFiles: []string{".lokiignore"}, Exclude: []string{"skip/"}}
+	results, err := NewDefaultBatchProcessor().CompressArchive(context.Background(), bytes.NewReader(input), io.Discard, ArchiveTAR, DefaultCompressOptions(), WithArchiveFilter(filter))
+	if err != nil {
+		t.Fatalf("CompressArchive() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Item.InputPath != "a.jpg" {
+		t.Errorf("results = %+v, want a.jpg only", results)
+	}
+}
+
+func TestDefaultBatchProcessor_CompressArchive_ZIPの拡張フィールド(t *testing.T) {
+	// A Unix UID/GID field (0x7875) must survive the rewrite.
+	unix := []byte{0x75, 0x78, 0x0b, 0x00, 0x01, 0x04, 0xe8, 0x03, 0x00, 0x00, 0x04, 0xe8, 0x03, 0x00, 0x00}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"a.jpg", "notes.txt"} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Extra: unix, Comment: "c"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := []byte("notes")
+		if name == "a.jpg" {
+			data = createTestJPEG(t, 64, 64, 100)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	results, err := NewDefaultBatchProcessor().CompressArchive(context.Background(), bytes.NewReader(buf.Bytes()), &out, ArchiveZIP, DefaultCompressOptions())
+	if err != nil || len(results) != 1 || !results[0].IsSuccess() || results[0].KeptOriginal {
+		t.Fatalf("CompressArchive() = %+v, %v", results, err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if !bytes.Contains(f.Extra, unix) {
+			t.Errorf("%s: extra = %x, want it to keep %x", f.Name, f.Extra, unix)
+		}
+		if f.Comment != "c" {
+			t.Errorf("%s: comment = %q, want %q", f.Name, f.Comment, "c")
+		}
+	}
+}
+
+func TestZipExtra(t *testing.T) {
+	field := func(id uint16, data ...byte) []byte {
+		return append([]byte{byte(id), byte(id >> 8), byte(len(data)), 0}, data...)
+	}
+	unix := field(0x7875, 1, 2)
+	zip64 := field(zip64ExtraID, 1, 2, 3, 4, 5, 6, 7, 8)
+	ts := field(extTimeExtraID, 1, 0, 0, 0, 0)
+	extra := slices.Concat(zip64, unix, ts)
+
+	if got := zipExtra(extra, false); !bytes.Equal(got, slices.Concat(unix, ts)) {
+		t.Errorf("zipExtra(modified=false) = %x", got)
+	}
+	if got := zipExtra(extra, true); !bytes.Equal(got, unix) {
+		t.Errorf("zipExtra(modified=true) = %x", got)
+	}
+}
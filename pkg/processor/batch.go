@@ -1,26 +1,55 @@
 package processor
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
-	"io/fs"
+	"hash"
+	"io"
+	"iter"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
-	"sync"
+	"time"
 )
 
 // Progress represents the progress of batch processing.
 type Progress struct {
-	// Total is the total number of items to process.
+	// Total is the total number of items to process. It is 0 for streams,
+	// whose length is unknown; ETA is then not estimated.
 	Total int
 	// Completed is the number of items that have been processed successfully.
 	Completed int
-	// Failed is the number of items that have failed.
+	// Failed is the number of items that have failed, not counting aborted items.
 	Failed int
+	// Skipped is the number of completed items that were skipped because the
+	// journal showed them as done by a previous run. They are included in Completed.
+	Skipped int
+	// Aborted is the number of items that were cancelled or never started
+	// because the failure policy stopped the batch. They are not included in Failed.
+	Aborted int
 	// Current is the path of the item currently being processed.
 	Current string
+	// Elapsed is the time since the batch started.
+	Elapsed time.Duration
+	// FilesPerSecond is the number of finished items per second of Elapsed.
+	FilesPerSecond float64
+	// BytesPerSecond is the input size of the processed items per second of
+	// Elapsed. Skipped items are not counted.
+	BytesPerSecond float64
+	// ETA estimates the time until every item is finished from the average
+	// time per processed item, leaving out skipped items.
+	ETA time.Duration
+}
+
+// Finished returns the number of items that have finished, whether they
+// completed, failed or were aborted.
+func (p Progress) Finished() int {
+	return p.Completed + p.Failed + p.Aborted
 }
 
 // BatchProcessorOption is a functional option for DefaultBatchProcessor.
@@ -28,19 +57,26 @@ type BatchProcessorOption func(*DefaultBatchProcessor)
 
 // DefaultBatchProcessor implements the BatchProcessor interface with parallel processing.
 type DefaultBatchProcessor struct {
-	jpegProc         Processor
-	pngProc          Processor
-	webpProc         Processor
-	maxWorkers       int
-	progressCallback func(Progress)
+	maxWorkers        int
+	progressCallback  func(Progress)
+	journalPath       string
+	resume            bool
+	hashInputs        bool
+	backupSuffix      string
+	backupRoot        string
+	backupDir         string
+	neverGrow         bool
+	sink              OutputSink
+	memoryBudget      int64
+	maxFailures       int
+	maxFailurePercent float64
+	retry             RetryPolicy
+	storage           Storage
 }
 
 // NewDefaultBatchProcessor creates a new DefaultBatchProcessor with the given options.
 func NewDefaultBatchProcessor(opts ...BatchProcessorOption) *DefaultBatchProcessor {
 	bp := &DefaultBatchProcessor{
-		jpegProc:   NewJPEGProcessor(),
-		pngProc:    NewPNGProcessor(),
-		webpProc:   NewWEBPProcessor(),
 		maxWorkers: runtime.NumCPU(),
 	}
 	for _, opt := range opts {
@@ -49,6 +85,7 @@ func NewDefaultBatchProcessor(opts ...BatchProcessorOption) *DefaultBatchProcess
 	if bp.maxWorkers < 1 {
 		bp.maxWorkers = 1
 	}
+	bp.storage = storageOrLocal(bp.storage)
 	return bp
 }
 
@@ -59,125 +96,193 @@ func WithMaxWorkers(n int) BatchProcessorOption {
 	}
 }
 
-// WithProgressCallback sets a callback function that is called on progress updates.
+// WithProgressCallback sets a callback function that is called on progress
+// updates, once per finished item. Calls are made from a single goroutine,
+// never concurrently, and their counts never decrease.
 func WithProgressCallback(cb func(Progress)) BatchProcessorOption {
 	return func(bp *DefaultBatchProcessor) {
 		bp.progressCallback = cb
 	}
 }
 
+// WithJournal records every successfully processed item in a JSON Lines
+// journal at path, together with the SHA-256 of its input and of its
+// options. The input is hashed as it is read for processing. An entry is only
+// written once the output file has been closed, so items that fail or are
+// cancelled are never recorded. Without WithResume the journal is truncated
+// at the start of each batch.
+func WithJournal(path string) BatchProcessorOption {
+	return func(bp *DefaultBatchProcessor) {
+		bp.journalPath = path
+	}
+}
+
+// WithResume makes a batch continue from the journal set by WithJournal:
+// items whose input and options are unchanged and whose output still exists
+// are skipped and reported with their journaled result.
+func WithResume() BatchProcessorOption {
+	return func(bp *DefaultBatchProcessor) {
+		bp.resume = true
+	}
+}
+
+// WithInputHashes reports the SHA-256 of every processed input in
+// BatchResult.InputHash, for recording in a Manifest. The input is hashed as
+// it is read for processing, so the hash matches the contents that were
+// actually processed. WithJournal implies it.
+func WithInputHashes() BatchProcessorOption {
+	return func(bp *DefaultBatchProcessor) {
+		bp.hashInputs = true
+	}
+}
+
+// openJournal opens the journal configured by WithJournal, or returns nil if none is set.
+func (bp *DefaultBatchProcessor) openJournal() (*journal, error) {
+	if bp.journalPath == "" {
+		return nil, nil
+	}
+	j, err := openJournal(bp.journalPath, bp.resume)
+	if err != nil {
+		return nil, err
+	}
+	j.storage = bp.storage
+	return j, nil
+}
+
 // ProcessBatch processes multiple images in batch with parallel workers.
+// Each item is compressed or, when built by ConvertItem or OptimizeItem,
+// converted. An item whose OutputPath is its InputPath is compressed in
+// place: the original is replaced atomically, keeping its permissions and
+// modification time.
+// With WithFailFast, WithMaxFailures or WithMaxFailurePercent, the batch stops
+// once too many items have failed: items in flight are cancelled and every
+// item not finished is reported as Aborted. Results still cover all items.
 func (bp *DefaultBatchProcessor) ProcessBatch(ctx context.Context, items []BatchItem) ([]BatchResult, error) {
 	if len(items) == 0 {
 		return []BatchResult{}, nil
 	}
 
-	results := make([]BatchResult, len(items))
-	itemCh := make(chan int, len(items))
-
-	var mu sync.Mutex
-	progress := Progress{Total: len(items)}
-
-	// Send item indices to the channel.
-	for i := range items {
-		itemCh <- i
-	}
-	close(itemCh)
-
-	// Determine worker count.
-	workers := min(bp.maxWorkers, len(items))
-
-	var wg sync.WaitGroup
-	for range workers {
-		wg.Go(func() {
-			for idx := range itemCh {
-				var result BatchResult
-
-				select {
-				case <-ctx.Done():
-					// Context cancelled: mark item as failed but continue draining.
-					result = BatchResult{
-						Item:  items[idx],
-						Error: ctx.Err(),
-					}
-				default:
-					result = bp.processItem(ctx, items[idx])
-				}
-
-				results[idx] = result
-
-				mu.Lock()
-				if result.Error != nil {
-					progress.Failed++
-				} else {
-					progress.Completed++
-				}
-				p := Progress{
-					Total:     progress.Total,
-					Completed: progress.Completed,
-					Failed:    progress.Failed,
-					Current:   items[idx].InputPath,
-				}
-				cb := bp.progressCallback
-				mu.Unlock()
-
-				if cb != nil {
-					cb(p)
-				}
-			}
-		})
+	j, err := bp.openJournal()
+	if err != nil {
+		return nil, err
 	}
 
-	wg.Wait()
+	results := make([]BatchResult, len(items))
+	streamBatch(ctx, bp, j, len(items), slices.Values(items), func(idx int, r BatchResult) bool {
+		results[idx] = r
+		return true
+	})
 
+	if err := j.close(); err != nil {
+		return results, err
+	}
 	return results, nil
 }
 
-// processItem processes a single batch item.
-func (bp *DefaultBatchProcessor) processItem(ctx context.Context, item BatchItem) BatchResult {
-	format, err := detectFormatFromPath(item.InputPath)
-	if err != nil {
-		return BatchResult{Item: item, Error: err}
+// runItem compresses, converts or optimizes item. Once ctx is done, remaining items fail with the
+// context error without being read; items cancelled by the failure policy
+// are marked Aborted.
+func (bp *DefaultBatchProcessor) runItem(ctx context.Context, j *journal, sem *memorySemaphore, item BatchItem) BatchResult {
+	r := bp.runPipeline(ctx, j, sem, item.InputPath, item.OutputPath, bp.neverGrow && !item.Convert && !item.Optimize, item.Pipeline)
+	return BatchResult{Item: item, Result: r.res, InputHash: r.inputHash, Error: r.err, Skipped: r.skipped, KeptOriginal: r.kept, Aborted: r.aborted, Attempts: r.attempts, Duration: r.duration}
+}
+
+// itemRun is the outcome of running a batch item.
+type itemRun struct {
+	res       *Result
+	inputHash string
+	err       error
+	skipped   bool
+	kept      bool
+	aborted   bool
+	attempts  int
+	duration  time.Duration
+}
+
+// runPipeline runs the pipeline of an item from input to output through the
+// journal, the memory budget and the retry policy.
+func (bp *DefaultBatchProcessor) runPipeline(ctx context.Context, j *journal, sem *memorySemaphore, input, output string, neverGrow bool, pipeline func() (Pipeline, error)) itemRun {
+	if ctx.Err() != nil {
+		err := abortError(ctx, ctx.Err())
+		return itemRun{err: err, aborted: err == ErrBatchAborted}
 	}
+	var r itemRun
+	start := time.Now()
+	pl, err := pipeline()
+	if err != nil {
+		return itemRun{err: err, duration: time.Since(start)}
+	}
+	var h hash.Hash
+	if j != nil || bp.hashInputs {
+		h = sha256.New()
+	}
+	res, inputHash, skipped, err := j.run(ctx, input, output, pl, func() (*Result, string, error) {
+		res, err := admit(ctx, sem, bp.storage, input, pl, func() (*Result, error) {
+			return bp.retry.do(ctx, &r.attempts, func() (*Result, error) {
+				res, kept, err := bp.processPipeline(ctx, input, output, pl, neverGrow, h)
+				r.kept = kept
+				return res, err
+			})
+		})
+		if err != nil || h == nil {
+			return res, "", err
+		}
+		inputHash, err := processedHash(ctx, bp.storage, input, pl.outputPath(output, res.Format), h)
+		return res, inputHash, err
+	})
+	r.err = abortError(ctx, err)
+	r.res, r.inputHash, r.skipped, r.aborted, r.duration = res, inputHash, skipped, r.err == ErrBatchAborted, time.Since(start)
+	return r
+}
 
-	inFile, err := os.Open(item.InputPath)
+// processPipeline runs pl on the file at input and writes the result to output.
+// When h is non-nil it is reset and receives the input as it is read.
+func (bp *DefaultBatchProcessor) processPipeline(ctx context.Context, input, output string, pl Pipeline, neverGrow bool, h hash.Hash) (*Result, bool, error) {
+	inFile, err := bp.storage.Open(ctx, input)
 	if err != nil {
-		return BatchResult{Item: item, Error: fmt.Errorf("failed to open input file: %w", err)}
+		return nil, false, fmt.Errorf("failed to open input file: %w", err)
 	}
 	defer func() { _ = inFile.Close() }()
 
-	// Ensure output directory exists.
-	outDir := filepath.Dir(item.OutputPath)
-	if err := os.MkdirAll(outDir, 0o755); err != nil {
-		return BatchResult{Item: item, Error: fmt.Errorf("failed to create output directory: %w", err)}
+	var r io.Reader = inFile
+	if h != nil {
+		h.Reset()
+		r = io.TeeReader(inFile, h)
+	}
+	var original *bytes.Buffer
+	if neverGrow && bp.sink == nil && !isLocal(bp.storage) {
+		// Keep the input so that keeping the original does not fetch it again.
+		original = new(bytes.Buffer)
+		r = io.TeeReader(r, original)
+	}
+	if pl.Optimize {
+		return bp.optimizeOutput(ctx, input, output, pl, r)
 	}
+	return bp.output(ctx, input, output, neverGrow, original, func(w io.Writer) (*Result, error) {
+		return pl.Run(ctx, r, w)
+	})
+}
 
-	outFile, err := os.Create(item.OutputPath)
+// optimizeOutput runs the optimize pipeline pl on r and writes the result to
+// output with the extension of the chosen format. The output path depends on
+// the choice, so the image is kept in memory until it is made. kept reports
+// whether the input was smaller than every encoding and written unchanged.
+func (bp *DefaultBatchProcessor) optimizeOutput(ctx context.Context, input, output string, pl Pipeline, r io.Reader) (*Result, bool, error) {
+	var buf bytes.Buffer
+	res, err := pl.Run(ctx, r, &buf)
 	if err != nil {
-		return BatchResult{Item: item, Error: fmt.Errorf("failed to create output file: %w", err)}
-	}
-	defer func() { _ = outFile.Close() }()
-
-	var proc Processor
-	switch format {
-	case FormatJPEG:
-		proc = bp.jpegProc
-	case FormatPNG:
-		proc = bp.pngProc
-	case FormatWEBP:
-		proc = bp.webpProc
-	default:
-		return BatchResult{Item: item, Error: fmt.Errorf("unsupported format: %s", format)}
+		return nil, false, err
 	}
-
-	result, err := proc.Compress(ctx, inFile, outFile, item.Options)
+	res, _, err = bp.output(ctx, input, OptimizedPath(output, res.Format), false, nil, func(w io.Writer) (*Result, error) {
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to write output: %w", err)
+		}
+		return res, nil
+	})
 	if err != nil {
-		_ = outFile.Close()
-		_ = os.Remove(item.OutputPath)
-		return BatchResult{Item: item, Error: err}
+		return nil, false, err
 	}
-
-	return BatchResult{Item: item, Result: result}
+	return res, keptOriginal(res), nil
 }
 
 // detectFormatFromPath detects the image format from the file extension.
@@ -186,149 +291,96 @@ func detectFormatFromPath(path string) (ImageFormat, error) {
 	switch ext {
 	case ".jpg", ".jpeg":
 		return FormatJPEG, nil
-	case ".png":
+	case ".png", ".apng":
 		return FormatPNG, nil
 	case ".webp":
 		return FormatWEBP, nil
+	case ".heic", ".heif":
+		return FormatHEIC, nil
+	case ".tif", ".tiff":
+		return FormatTIFF, nil
+	case ".bmp":
+		return FormatBMP, nil
+	case ".svg":
+		return FormatSVG, nil
+	case ".gif":
+		return FormatGIF, nil
 	default:
 		return -1, fmt.Errorf("unsupported image format: %s", ext)
 	}
 }
 
-// ProcessBatchConvert processes multiple images in batch format conversion with parallel workers.
-func (bp *DefaultBatchProcessor) ProcessBatchConvert(ctx context.Context, items []BatchConvertItem) ([]BatchConvertResult, error) {
-	if len(items) == 0 {
-		return []BatchConvertResult{}, nil
-	}
-
-	results := make([]BatchConvertResult, len(items))
-	itemCh := make(chan int, len(items))
-
-	var mu sync.Mutex
-	progress := Progress{Total: len(items)}
-
-	// Send item indices to the channel.
-	for i := range items {
-		itemCh <- i
-	}
-	close(itemCh)
-
-	// Determine worker count.
-	workers := min(bp.maxWorkers, len(items))
-
-	var wg sync.WaitGroup
-	for range workers {
-		wg.Go(func() {
-			for idx := range itemCh {
-				var result BatchConvertResult
-
-				select {
-				case <-ctx.Done():
-					result = BatchConvertResult{
-						Item:  items[idx],
-						Error: ctx.Err(),
-					}
-				default:
-					result = bp.processConvertItem(ctx, items[idx])
-				}
-
-				results[idx] = result
-
-				mu.Lock()
-				if result.Error != nil {
-					progress.Failed++
-				} else {
-					progress.Completed++
-				}
-				p := Progress{
-					Total:     progress.Total,
-					Completed: progress.Completed,
-					Failed:    progress.Failed,
-					Current:   items[idx].InputPath,
-				}
-				cb := bp.progressCallback
-				mu.Unlock()
-
-				if cb != nil {
-					cb(p)
-				}
-			}
-		})
-	}
-
-	wg.Wait()
+// ScanDirectoryForConvertOption is a functional option for ScanDirectoryForConvert.
+type ScanDirectoryForConvertOption func(*scanConvertConfig)
 
-	return results, nil
+type scanConvertConfig struct {
+	opts     ConvertOptions
+	allPages bool
+	manifest *Manifest
+	filter   ScanFilter
+	template *OutputTemplate
+	storage  Storage
+	ctx      context.Context
 }
 
-// processConvertItem processes a single batch convert item.
-func (bp *DefaultBatchProcessor) processConvertItem(ctx context.Context, item BatchConvertItem) BatchConvertResult {
-	inFile, err := os.Open(item.InputPath)
-	if err != nil {
-		return BatchConvertResult{Item: item, Error: fmt.Errorf("failed to open input file: %w", err)}
+// WithConvertOptions sets the conversion options for scanned items.
+func WithConvertOptions(opts ConvertOptions) ScanDirectoryForConvertOption {
+	return func(cfg *scanConvertConfig) {
+		cfg.opts = opts
 	}
-	defer func() { _ = inFile.Close() }()
+}
 
-	// Ensure output directory exists.
-	outDir := filepath.Dir(item.OutputPath)
-	if err := os.MkdirAll(outDir, 0o755); err != nil {
-		return BatchConvertResult{Item: item, Error: fmt.Errorf("failed to create output directory: %w", err)}
+// WithAllPages expands multi-page inputs (e.g. TIFF) into one item per page.
+// Page items are written as "{name}_p{n}{ext}" with n starting at 1.
+// Without this option only the page set in the conversion options is converted.
+func WithAllPages() ScanDirectoryForConvertOption {
+	return func(cfg *scanConvertConfig) {
+		cfg.allPages = true
 	}
+}
 
-	outFile, err := os.Create(item.OutputPath)
-	if err != nil {
-		return BatchConvertResult{Item: item, Error: fmt.Errorf("failed to create output file: %w", err)}
-	}
-
-	// Select processor based on output format.
-	var proc Processor
-	switch item.Options.Format {
-	case FormatJPEG:
-		proc = bp.jpegProc
-	case FormatPNG:
-		proc = bp.pngProc
-	case FormatWEBP:
-		proc = bp.webpProc
-	default:
-		_ = outFile.Close()
-		return BatchConvertResult{Item: item, Error: fmt.Errorf("unsupported output format: %s", item.Options.Format)}
+// WithConvertManifest leaves out items that are unchanged according to m:
+// the output exists and the input contents and conversion options are the
+// same as when the manifest last recorded it. The number of items left out
+// is available from m.Skipped.
+func WithConvertManifest(m *Manifest) ScanDirectoryForConvertOption {
+	return func(cfg *scanConvertConfig) {
+		cfg.manifest = m
 	}
+}
 
-	result, err := proc.Convert(ctx, inFile, outFile, item.Options)
+// ScanDirectoryForConvert scans a directory for supported image files and returns conversion items built by ConvertItem.
+// Files that are already in the target format are skipped. Use WithConvertFilter to
+// select which files and directories are visited, and WithConvertOutputTemplate to
+// name the outputs.
+func ScanDirectoryForConvert(inputDir, outputDir string, targetFormat ImageFormat, opts ...ScanDirectoryForConvertOption) ([]BatchItem, error) {
+	var items []BatchItem
+	err := newScanConvertConfig(targetFormat, opts).scan(inputDir, outputDir, targetFormat, func(item BatchItem) bool {
+		items = append(items, item)
+		return true
+	})
 	if err != nil {
-		_ = outFile.Close()
-		_ = os.Remove(item.OutputPath)
-		return BatchConvertResult{Item: item, Error: err}
-	}
-
-	// Explicitly close to catch buffered write/flush errors (e.g., disk full).
-	if err := outFile.Close(); err != nil {
-		_ = os.Remove(item.OutputPath)
-		return BatchConvertResult{Item: item, Error: fmt.Errorf("failed to close output file: %w", err)}
+		return nil, err
 	}
-
-	return BatchConvertResult{Item: item, Result: result}
-}
-
-// ScanDirectoryForConvertOption is a functional option for ScanDirectoryForConvert.
-type ScanDirectoryForConvertOption func(*scanConvertConfig)
-
-type scanConvertConfig struct {
-	opts ConvertOptions
+	return items, nil
 }
 
-// WithConvertOptions sets the conversion options for scanned items.
-func WithConvertOptions(opts ConvertOptions) ScanDirectoryForConvertOption {
-	return func(cfg *scanConvertConfig) {
-		cfg.opts = opts
+// ScanDirectoryForConvertSeq is like ScanDirectoryForConvert but yields each
+// item as soon as its file is visited. The returned function reports the
+// error that ended the scan, if any, once iteration has finished.
+func ScanDirectoryForConvertSeq(inputDir, outputDir string, targetFormat ImageFormat, opts ...ScanDirectoryForConvertOption) (iter.Seq[BatchItem], func() error) {
+	cfg := newScanConvertConfig(targetFormat, opts)
+	var err error
+	seq := func(yield func(BatchItem) bool) {
+		err = cfg.scan(inputDir, outputDir, targetFormat, yield)
 	}
+	return seq, func() error { return err }
 }
 
-// ScanDirectoryForConvert scans a directory for supported image files and returns BatchConvertItems.
-// Files that are already in the target format are skipped.
-func ScanDirectoryForConvert(inputDir, outputDir string, targetFormat ImageFormat, opts ...ScanDirectoryForConvertOption) ([]BatchConvertItem, error) {
+func newScanConvertConfig(targetFormat ImageFormat, opts []ScanDirectoryForConvertOption) *scanConvertConfig {
 	cfg := &scanConvertConfig{
 		opts: DefaultConvertOptions(targetFormat),
+		ctx:  context.Background(),
 	}
 	for _, opt := range opts {
 		opt(cfg)
@@ -336,24 +388,14 @@ func ScanDirectoryForConvert(inputDir, outputDir string, targetFormat ImageForma
 	// Ensure the effective conversion format matches the targetFormat used for output paths.
 	// This prevents mismatches where WithConvertOptions sets a different Format.
 	cfg.opts.Format = targetFormat
+	return cfg
+}
 
-	info, err := os.Stat(inputDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to access input directory: %w", err)
-	}
-	if !info.IsDir() {
-		return nil, fmt.Errorf("input path is not a directory: %s", inputDir)
-	}
-
-	var items []BatchConvertItem
-	err = filepath.WalkDir(inputDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-
+// scan walks inputDir and passes every item to yield until it returns false.
+func (cfg *scanConvertConfig) scan(inputDir, outputDir string, targetFormat ImageFormat, yield func(BatchItem) bool) error {
+	s := storageOrLocal(cfg.storage)
+	outputs := make(templateOutputs)
+	err := walkInput(cfg.ctx, s, inputDir, cfg.filter, func(path string) error {
 		srcFormat, fmtErr := detectFormatFromPath(path)
 		if fmtErr != nil {
 			return nil // Skip unsupported files.
@@ -364,36 +406,93 @@ func ScanDirectoryForConvert(inputDir, outputDir string, targetFormat ImageForma
 			return nil
 		}
 
-		relPath, err := filepath.Rel(inputDir, path)
-		if err != nil {
-			return err
-		}
-
-		// Change extension to target format.
-		ext := filepath.Ext(relPath)
-		relPathNoExt := strings.TrimSuffix(relPath, ext)
-		outPath := filepath.Join(outputDir, relPathNoExt+targetFormat.Extension())
+		var outPath string
+		var err error
+		if cfg.template != nil {
+			outPath, err = outputs.templatePath(cfg.ctx, s, cfg.template, inputDir, outputDir, path, targetFormat, cfg.opts.CompressOptions)
+			if err != nil {
+				return err
+			}
+		} else {
+			var relPath string
+			if relPath, err = filepath.Rel(inputDir, path); err != nil {
+				return err
+			}
 
-		items = append(items, BatchConvertItem{
-			InputPath:  path,
-			OutputPath: outPath,
-			Options:    cfg.opts,
-		})
+			// Change extension to target format.
+			ext := filepath.Ext(relPath)
+			relPathNoExt := strings.TrimSuffix(relPath, ext)
+			outPath = filepath.Join(outputDir, relPathNoExt+targetFormat.Extension())
+		}
 
+		items := []BatchItem{ConvertItem(path, outPath, cfg.opts)}
+		if cfg.allPages && srcFormat == FormatTIFF {
+			pages, err := filePageCount(cfg.ctx, s, path)
+			if err != nil {
+				return err
+			}
+			items = PageItems(path, outPath, pages, cfg.opts)
+		}
+		for _, item := range items {
+			if cfg.manifest.skip(item.InputPath, item.OutputPath, ConvertPipeline(item.ConvertOptions())) {
+				continue
+			}
+			if !yield(item) {
+				return errStopScan
+			}
+		}
 		return nil
 	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		return fmt.Errorf("failed to scan directory: %w", err)
+	}
+	return nil
+}
+
+// PageItems returns one conversion item per page of a multi-page input.
+// A single page keeps outputPath unchanged; otherwise page n (starting at 1)
+// is written to outputPath with "_p{n}" inserted before the extension.
+func PageItems(inputPath, outputPath string, pages int, opts ConvertOptions) []BatchItem {
+	if pages <= 1 {
+		return []BatchItem{ConvertItem(inputPath, outputPath, opts)}
+	}
+	ext := filepath.Ext(outputPath)
+	base := strings.TrimSuffix(outputPath, ext)
+	items := make([]BatchItem, 0, pages)
+	for page := range pages {
+		pageOpts := opts
+		pageOpts.Page = page
+		items = append(items, ConvertItem(inputPath, fmt.Sprintf("%s_p%d%s", base, page+1, ext), pageOpts))
+	}
+	return items
+}
+
+// filePageCount returns the number of pages in the image file at path in s.
+func filePageCount(ctx context.Context, s Storage, path string) (int, error) {
+	f, err := s.Open(ctx, path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to scan directory: %w", err)
+		return 0, fmt.Errorf("failed to open input file: %w", err)
 	}
+	defer func() { _ = f.Close() }()
 
-	return items, nil
+	pages, err := PageCount(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read pages of %s: %w", path, err)
+	}
+	return pages, nil
 }
 
 // ScanDirectoryOption is a functional option for ScanDirectory.
 type ScanDirectoryOption func(*scanConfig)
 
 type scanConfig struct {
-	opts CompressOptions
+	opts     CompressOptions
+	manifest *Manifest
+	filter   ScanFilter
+	template *OutputTemplate
+	storage  Storage
+	ctx      context.Context
+	optimize bool
 }
 
 // WithCompressOptions sets the compression options for scanned items.
@@ -403,55 +502,170 @@ func WithCompressOptions(opts CompressOptions) ScanDirectoryOption {
 	}
 }
 
+// WithManifest leaves out items that are unchanged according to m: the output
+// exists and the input contents and compression options are the same as when
+// the manifest last recorded it. The number of items left out is available
+// from m.Skipped.
+func WithManifest(m *Manifest) ScanDirectoryOption {
+	return func(cfg *scanConfig) {
+		cfg.manifest = m
+	}
+}
+
+// WithOptimize makes ScanDirectory return optimize items built by
+// OptimizeItem, whose outputs mirror the input paths without their
+// extensions. Decode-only formats are then included. Two inputs that differ
+// only in their extension, such as a.jpg and a.png, would be written to the
+// same base and end the scan with an error; as with WithOutputTemplate, a
+// scan keeps a small digest of every base to detect this. It cannot be
+// combined with WithOutputTemplate.
+func WithOptimize() ScanDirectoryOption {
+	return func(cfg *scanConfig) {
+		cfg.optimize = true
+	}
+}
+
 // ScanDirectory scans a directory for supported image files and returns BatchItems.
+// Decode-only formats (e.g. HEIC, BMP, SVG) are skipped since they cannot be re-encoded.
+// Use WithFilter to select which files and directories are visited,
+// WithOutputTemplate to name the outputs, and WithOptimize to write each
+// image in its smallest format.
 func ScanDirectory(inputDir, outputDir string, opts ...ScanDirectoryOption) ([]BatchItem, error) {
+	var items []BatchItem
+	err := newScanConfig(opts).scan(inputDir, outputDir, func(item BatchItem) bool {
+		items = append(items, item)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ScanDirectorySeq is like ScanDirectory but yields each item as soon as its
+// file is visited, so a batch can start before the whole tree is scanned.
+// The returned function reports the error that ended the scan, if any, once
+// iteration has finished.
+func ScanDirectorySeq(inputDir, outputDir string, opts ...ScanDirectoryOption) (iter.Seq[BatchItem], func() error) {
+	cfg := newScanConfig(opts)
+	var err error
+	seq := func(yield func(BatchItem) bool) {
+		err = cfg.scan(inputDir, outputDir, yield)
+	}
+	return seq, func() error { return err }
+}
+
+func newScanConfig(opts []ScanDirectoryOption) *scanConfig {
 	cfg := &scanConfig{
 		opts: DefaultCompressOptions(),
+		ctx:  context.Background(),
 	}
 	for _, opt := range opts {
 		opt(cfg)
 	}
+	return cfg
+}
 
-	info, err := os.Stat(inputDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to access input directory: %w", err)
-	}
-	if !info.IsDir() {
-		return nil, fmt.Errorf("input path is not a directory: %s", inputDir)
+// scan walks inputDir and passes every item to yield until it returns false.
+func (cfg *scanConfig) scan(inputDir, outputDir string, yield func(BatchItem) bool) error {
+	if cfg.optimize && cfg.template != nil {
+		return errors.New("output templates cannot be used with WithOptimize")
 	}
+	s := storageOrLocal(cfg.storage)
+	outputs := make(templateOutputs)
+	err := walkInput(cfg.ctx, s, inputDir, cfg.filter, func(path string) error {
+		format, fmtErr := detectFormatFromPath(path)
+		if fmtErr != nil {
+			return nil // Skip unsupported files.
+		}
 
-	var items []BatchItem
-	err = filepath.WalkDir(inputDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
+		if cfg.optimize {
+			return cfg.optimizeItem(outputs, inputDir, outputDir, path, yield)
 		}
-		if d.IsDir() {
+
+		// Decode-only formats cannot be compressed in place; use ScanDirectoryForConvert.
+		if !format.CanEncode() {
 			return nil
 		}
 
-		_, fmtErr := detectFormatFromPath(path)
-		if fmtErr != nil {
-			return nil // Skip unsupported files.
+		var outPath string
+		var err error
+		if cfg.template != nil {
+			outPath, err = outputs.templatePath(cfg.ctx, s, cfg.template, inputDir, outputDir, path, format, cfg.opts)
+			if err != nil {
+				return err
+			}
+		} else {
+			var relPath string
+			if relPath, err = filepath.Rel(inputDir, path); err != nil {
+				return err
+			}
+			outPath = filepath.Join(outputDir, relPath)
 		}
-
-		relPath, err := filepath.Rel(inputDir, path)
-		if err != nil {
-			return err
+		if cfg.manifest.skip(path, outPath, CompressPipeline(format, cfg.opts)) {
+			return nil
 		}
 
-		outPath := filepath.Join(outputDir, relPath)
-
-		items = append(items, BatchItem{
+		if !yield(BatchItem{
 			InputPath:  path,
 			OutputPath: outPath,
 			Options:    cfg.opts,
-		})
-
+		}) {
+			return errStopScan
+		}
 		return nil
 	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		return fmt.Errorf("failed to scan directory: %w", err)
+	}
+	return nil
+}
+
+// optimizeItem passes the optimize item of the input at path under inputDir
+// to yield unless the manifest shows it unchanged. outputs records the output
+// bases seen so far.
+func (cfg *scanConfig) optimizeItem(outputs templateOutputs, inputDir, outputDir, path string, yield func(BatchItem) bool) error {
+	relPath, err := filepath.Rel(inputDir, path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to scan directory: %w", err)
+		return err
+	}
+	base := filepath.Join(outputDir, strings.TrimSuffix(relPath, filepath.Ext(relPath)))
+	if !outputs.add(base) {
+		return fmt.Errorf("optimize maps both %s and an earlier input to %s", path, base)
 	}
+	if cfg.manifest.skip(path, base, OptimizePipeline(cfg.opts)) {
+		return nil
+	}
+	if !yield(OptimizeItem(path, base, cfg.opts)) {
+		return errStopScan
+	}
+	return nil
+}
 
-	return items, nil
+// errStopScan ends a walk early once the consumer of a scan stops iterating.
+var errStopScan = errors.New("scan stopped")
+
+// walkInput calls fn for every file under inputDir in s that passes f. A
+// local inputDir must be an existing directory; other storages have no
+// directories, so an empty prefix just yields nothing.
+func walkInput(ctx context.Context, s Storage, inputDir string, f ScanFilter, fn func(path string) error) error {
+	if !isLocal(s) {
+		return walkStorage(ctx, s, inputDir, f, fn)
+	}
+	if err := checkInputDir(inputDir); err != nil {
+		return err
+	}
+	return walkFiles(inputDir, f, fn)
+}
+
+// checkInputDir returns an error unless inputDir is an existing directory.
+func checkInputDir(inputDir string) error {
+	info, err := os.Stat(inputDir)
+	if err != nil {
+		return fmt.Errorf("failed to access input directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("input path is not a directory: %s", inputDir)
+	}
+	return nil
 }
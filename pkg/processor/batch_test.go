@@ -57,15 +57,6 @@ func TestNewDefaultBatchProcessor(t *testing.T) {
 			if bp == nil {
 				t.Fatal("NewDefaultBatchProcessor() returned nil")
 			}
-			if bp.jpegProc == nil {
-				t.Error("jpegProc is nil")
-			}
-			if bp.pngProc == nil {
-				t.Error("pngProc is nil")
-			}
-			if bp.webpProc == nil {
-				t.Error("webpProc is nil")
-			}
 			if bp.maxWorkers != tt.wantMaxWorkers {
 				t.Errorf("maxWorkers = %d, want %d", bp.maxWorkers, tt.wantMaxWorkers)
 			}
@@ -409,6 +400,15 @@ func TestDefaultBatchProcessor_ProcessBatch_進捗通知(t *testing.T) {
 	if last.Failed != 0 {
 		t.Errorf("Failed = %d, want 0", last.Failed)
 	}
+	if last.Elapsed <= 0 || last.FilesPerSecond <= 0 || last.BytesPerSecond <= 0 {
+		t.Errorf("throughput = %v, %v files/s, %v B/s, want positive", last.Elapsed, last.FilesPerSecond, last.BytesPerSecond)
+	}
+	if last.ETA != 0 {
+		t.Errorf("ETA = %v, want 0 after the last item", last.ETA)
+	}
+	if first := progressUpdates[0]; first.ETA <= 0 {
+		t.Errorf("first ETA = %v, want positive while items remain", first.ETA)
+	}
 }
 
 func TestDefaultBatchProcessor_ProcessBatch_進捗通知_失敗含む(t *testing.T) {
@@ -470,10 +470,17 @@ func TestDetectFormatFromPath(t *testing.T) {
 		{name: ".JPEG大文字", path: "PHOTO.JPEG", wantFormat: FormatJPEG},
 		{name: ".PNG大文字", path: "ICON.PNG", wantFormat: FormatPNG},
 		{name: "パス付き", path: "/path/to/photo.jpg", wantFormat: FormatJPEG},
-		{name: "未対応拡張子_bmp", path: "file.bmp", wantErr: true},
-		{name: "未対応拡張子_gif", path: "file.gif", wantErr: true},
+		{name: ".bmp拡張子", path: "file.bmp", wantFormat: FormatBMP},
+		{name: ".svg拡張子", path: "logo.svg", wantFormat: FormatSVG},
+		{name: ".tif拡張子", path: "scan.tif", wantFormat: FormatTIFF},
+		{name: ".TIFF大文字", path: "SCAN.TIFF", wantFormat: FormatTIFF},
+		{name: ".gif拡張子", path: "anim.gif", wantFormat: FormatGIF},
+		{name: ".apng拡張子", path: "anim.apng", wantFormat: FormatPNG},
+		{name: "未対応拡張子_avif", path: "file.avif", wantErr: true},
 		{name: ".webp拡張子", path: "file.webp", wantFormat: FormatWEBP},
 		{name: ".WEBP大文字", path: "FILE.WEBP", wantFormat: FormatWEBP},
+		{name: ".heic拡張子", path: "IMG_0001.heic", wantFormat: FormatHEIC},
+		{name: ".HEIF大文字", path: "IMG_0001.HEIF", wantFormat: FormatHEIC},
 		{name: "拡張子なし", path: "noext", wantErr: true},
 		{name: "空文字", path: "", wantErr: true},
 	}
@@ -617,18 +624,18 @@ func TestScanDirectory_大文字拡張子(t *testing.T) {
 
 // --- BatchConvert Tests ---
 
-func TestDefaultBatchProcessor_ProcessBatchConvert_空バッチ(t *testing.T) {
+func TestDefaultBatchProcessor_ProcessBatch_変換_空バッチ(t *testing.T) {
 	bp := NewDefaultBatchProcessor()
-	results, err := bp.ProcessBatchConvert(context.Background(), []BatchConvertItem{})
+	results, err := bp.ProcessBatch(context.Background(), []BatchItem{})
 	if err != nil {
-		t.Fatalf("ProcessBatchConvert() error = %v", err)
+		t.Fatalf("ProcessBatch() error = %v", err)
 	}
 	if len(results) != 0 {
-		t.Errorf("ProcessBatchConvert() returned %d results, want 0", len(results))
+		t.Errorf("ProcessBatch() returned %d results, want 0", len(results))
 	}
 }
 
-func TestDefaultBatchProcessor_ProcessBatchConvert_単一ファイル(t *testing.T) {
+func TestDefaultBatchProcessor_ProcessBatch_変換_単一ファイル(t *testing.T) {
 	inputDir := t.TempDir()
 	outputDir := t.TempDir()
 
@@ -637,20 +644,16 @@ func TestDefaultBatchProcessor_ProcessBatchConvert_単一ファイル(t *testing
 	outputPath := filepath.Join(outputDir, "test.jpg")
 
 	bp := NewDefaultBatchProcessor(WithMaxWorkers(1))
-	items := []BatchConvertItem{
-		{
-			InputPath:  inputPath,
-			OutputPath: outputPath,
-			Options:    DefaultConvertOptions(FormatJPEG),
-		},
+	items := []BatchItem{
+		ConvertItem(inputPath, outputPath, DefaultConvertOptions(FormatJPEG)),
 	}
 
-	results, err := bp.ProcessBatchConvert(context.Background(), items)
+	results, err := bp.ProcessBatch(context.Background(), items)
 	if err != nil {
-		t.Fatalf("ProcessBatchConvert() error = %v", err)
+		t.Fatalf("ProcessBatch() error = %v", err)
 	}
 	if len(results) != 1 {
-		t.Fatalf("ProcessBatchConvert() returned %d results, want 1", len(results))
+		t.Fatalf("ProcessBatch() returned %d results, want 1", len(results))
 	}
 	if !results[0].IsSuccess() {
 		t.Fatalf("result is not success: %v", results[0].Error)
@@ -668,7 +671,7 @@ func TestDefaultBatchProcessor_ProcessBatchConvert_単一ファイル(t *testing
 	}
 }
 
-func TestDefaultBatchProcessor_ProcessBatchConvert_複数ファイル(t *testing.T) {
+func TestDefaultBatchProcessor_ProcessBatch_変換_複数ファイル(t *testing.T) {
 	inputDir := t.TempDir()
 	outputDir := t.TempDir()
 
@@ -678,26 +681,18 @@ func TestDefaultBatchProcessor_ProcessBatchConvert_複数ファイル(t *testing
 	inputJPEG := writeTestFile(t, inputDir, "photo.jpg", jpegData)
 	inputPNG := writeTestFile(t, inputDir, "icon.png", pngData)
 
-	items := []BatchConvertItem{
-		{
-			InputPath:  inputJPEG,
-			OutputPath: filepath.Join(outputDir, "photo.webp"),
-			Options:    DefaultConvertOptions(FormatWEBP),
-		},
-		{
-			InputPath:  inputPNG,
-			OutputPath: filepath.Join(outputDir, "icon.webp"),
-			Options:    DefaultConvertOptions(FormatWEBP),
-		},
+	items := []BatchItem{
+		ConvertItem(inputJPEG, filepath.Join(outputDir, "photo.webp"), DefaultConvertOptions(FormatWEBP)),
+		ConvertItem(inputPNG, filepath.Join(outputDir, "icon.webp"), DefaultConvertOptions(FormatWEBP)),
 	}
 
 	bp := NewDefaultBatchProcessor(WithMaxWorkers(2))
-	results, err := bp.ProcessBatchConvert(context.Background(), items)
+	results, err := bp.ProcessBatch(context.Background(), items)
 	if err != nil {
-		t.Fatalf("ProcessBatchConvert() error = %v", err)
+		t.Fatalf("ProcessBatch() error = %v", err)
 	}
 	if len(results) != 2 {
-		t.Fatalf("ProcessBatchConvert() returned %d results, want 2", len(results))
+		t.Fatalf("ProcessBatch() returned %d results, want 2", len(results))
 	}
 
 	for i, r := range results {
@@ -707,28 +702,51 @@ func TestDefaultBatchProcessor_ProcessBatchConvert_複数ファイル(t *testing
 	}
 }
 
-func TestDefaultBatchProcessor_ProcessBatchConvert_コンテキストキャンセル(t *testing.T) {
+func TestDefaultBatchProcessor_ProcessBatch_圧縮と変換の混在(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	inputPNG := writeTestFile(t, inputDir, "icon.png", createTestPNG(t, 50, 50))
+	items := []BatchItem{
+		{InputPath: inputPNG, OutputPath: filepath.Join(outputDir, "icon.png"), Options: DefaultCompressOptions()},
+		ConvertItem(inputPNG, filepath.Join(outputDir, "icon.jpg"), DefaultConvertOptions(FormatJPEG)),
+	}
+
+	results, err := NewDefaultBatchProcessor(WithNeverGrow()).ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	for i, want := range []ImageFormat{FormatPNG, FormatJPEG} {
+		if !results[i].IsSuccess() {
+			t.Fatalf("result[%d] is not success: %v", i, results[i].Error)
+		}
+		if results[i].Result.Format != want {
+			t.Errorf("result[%d].Format = %v, want %v", i, results[i].Result.Format, want)
+		}
+	}
+	if results[1].KeptOriginal {
+		t.Error("conversion item should never keep the original")
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_変換_コンテキストキャンセル(t *testing.T) {
 	inputDir := t.TempDir()
 	pngData := createTestPNG(t, 100, 100)
 
-	var items []BatchConvertItem
+	var items []BatchItem
 	for i := range 10 {
 		name := "img" + string(rune('0'+i)) + ".png"
 		writeTestFile(t, inputDir, name, pngData)
-		items = append(items, BatchConvertItem{
-			InputPath:  filepath.Join(inputDir, name),
-			OutputPath: filepath.Join(t.TempDir(), "img"+string(rune('0'+i))+".jpg"),
-			Options:    DefaultConvertOptions(FormatJPEG),
-		})
+		items = append(items, ConvertItem(filepath.Join(inputDir, name), filepath.Join(t.TempDir(), "img"+string(rune('0'+i))+".jpg"), DefaultConvertOptions(FormatJPEG)))
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately.
 
 	bp := NewDefaultBatchProcessor(WithMaxWorkers(1))
-	results, err := bp.ProcessBatchConvert(ctx, items)
+	results, err := bp.ProcessBatch(ctx, items)
 	if err != nil {
-		t.Fatalf("ProcessBatchConvert() error = %v", err)
+		t.Fatalf("ProcessBatch() error = %v", err)
 	}
 
 	for i, r := range results {
@@ -738,7 +756,7 @@ func TestDefaultBatchProcessor_ProcessBatchConvert_コンテキストキャン
 	}
 }
 
-func TestDefaultBatchProcessor_ProcessBatchConvert_進捗通知(t *testing.T) {
+func TestDefaultBatchProcessor_ProcessBatch_変換_進捗通知(t *testing.T) {
 	inputDir := t.TempDir()
 	outputDir := t.TempDir()
 
@@ -758,14 +776,14 @@ func TestDefaultBatchProcessor_ProcessBatchConvert_進捗通知(t *testing.T) {
 		}),
 	)
 
-	items := []BatchConvertItem{
-		{InputPath: input1, OutputPath: filepath.Join(outputDir, "a.png"), Options: DefaultConvertOptions(FormatPNG)},
-		{InputPath: input2, OutputPath: filepath.Join(outputDir, "b.png"), Options: DefaultConvertOptions(FormatPNG)},
+	items := []BatchItem{
+		ConvertItem(input1, filepath.Join(outputDir, "a.png"), DefaultConvertOptions(FormatPNG)),
+		ConvertItem(input2, filepath.Join(outputDir, "b.png"), DefaultConvertOptions(FormatPNG)),
 	}
 
-	results, err := bp.ProcessBatchConvert(context.Background(), items)
+	results, err := bp.ProcessBatch(context.Background(), items)
 	if err != nil {
-		t.Fatalf("ProcessBatchConvert() error = %v", err)
+		t.Fatalf("ProcessBatch() error = %v", err)
 	}
 
 	for i, r := range results {
@@ -790,51 +808,43 @@ func TestDefaultBatchProcessor_ProcessBatchConvert_進捗通知(t *testing.T) {
 	}
 }
 
-func TestDefaultBatchProcessor_ProcessBatchConvert_存在しないファイル(t *testing.T) {
+func TestDefaultBatchProcessor_ProcessBatch_変換_存在しないファイル(t *testing.T) {
 	bp := NewDefaultBatchProcessor(WithMaxWorkers(1))
-	items := []BatchConvertItem{
-		{
-			InputPath:  "/nonexistent/file.jpg",
-			OutputPath: filepath.Join(t.TempDir(), "out.png"),
-			Options:    DefaultConvertOptions(FormatPNG),
-		},
+	items := []BatchItem{
+		ConvertItem("/nonexistent/file.jpg", filepath.Join(t.TempDir(), "out.png"), DefaultConvertOptions(FormatPNG)),
 	}
 
-	results, err := bp.ProcessBatchConvert(context.Background(), items)
+	results, err := bp.ProcessBatch(context.Background(), items)
 	if err != nil {
-		t.Fatalf("ProcessBatchConvert() error = %v", err)
+		t.Fatalf("ProcessBatch() error = %v", err)
 	}
 	if len(results) != 1 {
-		t.Fatalf("ProcessBatchConvert() returned %d results, want 1", len(results))
+		t.Fatalf("ProcessBatch() returned %d results, want 1", len(results))
 	}
 	if results[0].IsSuccess() {
 		t.Error("result should be failure for nonexistent file")
 	}
 }
 
-func TestDefaultBatchProcessor_ProcessBatchConvert_破損画像(t *testing.T) {
+func TestDefaultBatchProcessor_ProcessBatch_変換_破損画像(t *testing.T) {
 	inputDir := t.TempDir()
 	inputPath := writeTestFile(t, inputDir, "corrupt.jpg", []byte("not a valid jpeg"))
 
 	bp := NewDefaultBatchProcessor(WithMaxWorkers(1))
-	items := []BatchConvertItem{
-		{
-			InputPath:  inputPath,
-			OutputPath: filepath.Join(t.TempDir(), "corrupt.png"),
-			Options:    DefaultConvertOptions(FormatPNG),
-		},
+	items := []BatchItem{
+		ConvertItem(inputPath, filepath.Join(t.TempDir(), "corrupt.png"), DefaultConvertOptions(FormatPNG)),
 	}
 
-	results, err := bp.ProcessBatchConvert(context.Background(), items)
+	results, err := bp.ProcessBatch(context.Background(), items)
 	if err != nil {
-		t.Fatalf("ProcessBatchConvert() error = %v", err)
+		t.Fatalf("ProcessBatch() error = %v", err)
 	}
 	if results[0].IsSuccess() {
 		t.Error("result should be failure for corrupt image")
 	}
 }
 
-func TestDefaultBatchProcessor_ProcessBatchConvert_全フォーマットプロセッサ選択(t *testing.T) {
+func TestDefaultBatchProcessor_ProcessBatch_変換_全フォーマットプロセッサ選択(t *testing.T) {
 	inputDir := t.TempDir()
 	outputDir := t.TempDir()
 
@@ -845,28 +855,16 @@ func TestDefaultBatchProcessor_ProcessBatchConvert_全フォーマットプロ
 	inputJPEG := writeTestFile(t, inputDir, "test.jpg", jpegData)
 
 	// Test all three output format processor selections.
-	items := []BatchConvertItem{
-		{
-			InputPath:  inputPNG,
-			OutputPath: filepath.Join(outputDir, "out.jpg"),
-			Options:    DefaultConvertOptions(FormatJPEG),
-		},
-		{
-			InputPath:  inputJPEG,
-			OutputPath: filepath.Join(outputDir, "out.png"),
-			Options:    DefaultConvertOptions(FormatPNG),
-		},
-		{
-			InputPath:  inputPNG,
-			OutputPath: filepath.Join(outputDir, "out.webp"),
-			Options:    DefaultConvertOptions(FormatWEBP),
-		},
+	items := []BatchItem{
+		ConvertItem(inputPNG, filepath.Join(outputDir, "out.jpg"), DefaultConvertOptions(FormatJPEG)),
+		ConvertItem(inputJPEG, filepath.Join(outputDir, "out.png"), DefaultConvertOptions(FormatPNG)),
+		ConvertItem(inputPNG, filepath.Join(outputDir, "out.webp"), DefaultConvertOptions(FormatWEBP)),
 	}
 
 	bp := NewDefaultBatchProcessor(WithMaxWorkers(1))
-	results, err := bp.ProcessBatchConvert(context.Background(), items)
+	results, err := bp.ProcessBatch(context.Background(), items)
 	if err != nil {
-		t.Fatalf("ProcessBatchConvert() error = %v", err)
+		t.Fatalf("ProcessBatch() error = %v", err)
 	}
 
 	for i, r := range results {
@@ -0,0 +1,470 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// ErrUnsupportedColorProfile is returned when ConvertToSRGB is set and the embedded
+// RGB ICC profile cannot be interpreted (e.g. LUT-based or malformed profiles).
+var ErrUnsupportedColorProfile = errors.New("unsupported ICC color profile")
+
+// d50ToLinearSRGB converts PCS XYZ (D50) to linear sRGB using Bradford adaptation.
+var d50ToLinearSRGB = [3][3]float64{
+	{3.1338561, -1.6168667, -0.4906146},
+	{-0.9787684, 1.9161415, 0.0334540},
+	{0.0719453, -0.2289914, 1.4052427},
+}
+
+// bayer8x8 is the ordered dithering threshold matrix used for 16-bit to 8-bit reduction.
+var bayer8x8 = [8][8]float64{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// applyColorManagement runs the optional color-management stage on a decoded image.
+// data is the encoded source and is used to locate an embedded ICC profile.
+// Images without an embedded profile are assumed to already be sRGB. Profiles
+// for other color spaces than RGB, such as GRAY and CMYK, describe how the
+// decoder's input was interpreted rather than the decoded RGB pixels, so the
+// image is passed through unchanged.
+func applyColorManagement(img image.Image, data []byte, opts CompressOptions) (image.Image, error) {
+	highDepth := is16Bit(img)
+
+	if opts.ConvertToSRGB {
+		if raw := extractICCProfile(data); raw != nil && iccColorSpace(raw) == "RGB " {
+			profile, err := parseICCProfile(raw)
+			if err != nil {
+				return nil, err
+			}
+			converted := profile.toSRGB(img)
+			if highDepth {
+				img = converted
+			} else {
+				img = roundTo8Bit(converted)
+			}
+		}
+	}
+
+	if opts.DitherTo8Bit && is16Bit(img) {
+		img = ditherTo8Bit(img)
+	}
+
+	return img, nil
+}
+
+// is16Bit reports whether img stores more than 8 bits per channel.
+func is16Bit(img image.Image) bool {
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		return true
+	default:
+		return false
+	}
+}
+
+// toneCurve maps an encoded channel value in [0, 1] to linear light.
+type toneCurve func(v float64) float64
+
+// iccProfile holds the matrix/TRC part of an RGB display profile.
+type iccProfile struct {
+	// matrix maps linear device RGB to PCS XYZ (D50). Columns are rXYZ, gXYZ, bXYZ.
+	matrix [3][3]float64
+	// trc holds the red, green and blue tone reproduction curves.
+	trc [3]toneCurve
+}
+
+// iccColorSpace returns the data color space signature of an ICC profile,
+// such as "RGB ", "GRAY" or "CMYK", or "" if the header is truncated.
+func iccColorSpace(b []byte) string {
+	if len(b) < 20 {
+		return ""
+	}
+	return string(b[16:20])
+}
+
+// parseICCProfile parses a matrix/TRC based RGB ICC profile.
+func parseICCProfile(b []byte) (*iccProfile, error) {
+	if len(b) < 132 {
+		return nil, fmt.Errorf("%w: profile too short", ErrUnsupportedColorProfile)
+	}
+	if string(b[16:20]) != "RGB " {
+		return nil, fmt.Errorf("%w: color space %q", ErrUnsupportedColorProfile, string(b[16:20]))
+	}
+
+	tags := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint32(b[128:132]))
+	for i := range count {
+		off := 132 + i*12
+		if off+12 > len(b) {
+			return nil, fmt.Errorf("%w: truncated tag table", ErrUnsupportedColorProfile)
+		}
+		sig := string(b[off : off+4])
+		start := int(binary.BigEndian.Uint32(b[off+4 : off+8]))
+		size := int(binary.BigEndian.Uint32(b[off+8 : off+12]))
+		if start < 0 || size < 0 || start+size > len(b) {
+			return nil, fmt.Errorf("%w: tag %q out of range", ErrUnsupportedColorProfile, sig)
+		}
+		tags[sig] = b[start : start+size]
+	}
+
+	p := &iccProfile{}
+	for i, name := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, err := parseXYZTag(tags[name])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrUnsupportedColorProfile, name, err)
+		}
+		for row := range 3 {
+			p.matrix[row][i] = xyz[row]
+		}
+	}
+	for i, name := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, err := parseCurveTag(tags[name])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrUnsupportedColorProfile, name, err)
+		}
+		p.trc[i] = curve
+	}
+	return p, nil
+}
+
+// s15Fixed16 decodes an ICC s15Fixed16Number.
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func parseXYZTag(b []byte) ([3]float64, error) {
+	if len(b) < 20 || string(b[0:4]) != "XYZ " {
+		return [3]float64{}, errors.New("missing or invalid XYZ tag")
+	}
+	return [3]float64{s15Fixed16(b[8:12]), s15Fixed16(b[12:16]), s15Fixed16(b[16:20])}, nil
+}
+
+func parseCurveTag(b []byte) (toneCurve, error) {
+	if len(b) < 12 {
+		return nil, errors.New("missing or invalid curve tag")
+	}
+	switch string(b[0:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(b[8:12]))
+		if len(b) < 12+n*2 {
+			return nil, errors.New("truncated curv tag")
+		}
+		switch n {
+		case 0:
+			return func(v float64) float64 { return v }, nil
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(b[12:14])) / 256
+			return func(v float64) float64 { return math.Pow(v, gamma) }, nil
+		default:
+			table := make([]float64, n)
+			for i := range n {
+				table[i] = float64(binary.BigEndian.Uint16(b[12+i*2:])) / 65535
+			}
+			return func(v float64) float64 {
+				pos := v * float64(n-1)
+				i := int(pos)
+				if i >= n-1 {
+					return table[n-1]
+				}
+				frac := pos - float64(i)
+				return table[i]*(1-frac) + table[i+1]*frac
+			}, nil
+		}
+	case "para":
+		funcType := binary.BigEndian.Uint16(b[8:10])
+		nparams := [...]int{1, 3, 4, 5, 7}
+		if int(funcType) >= len(nparams) || len(b) < 12+nparams[funcType]*4 {
+			return nil, errors.New("invalid para tag")
+		}
+		var g [7]float64
+		for i := range nparams[funcType] {
+			g[i] = s15Fixed16(b[12+i*4:])
+		}
+		gamma, a, bb, c, d, e, f := g[0], g[1], g[2], g[3], g[4], g[5], g[6]
+		if (funcType == 1 || funcType == 2) && a == 0 {
+			// The curve starts at -b/a.
+			return nil, errors.New("invalid para tag: a is zero")
+		}
+		switch funcType {
+		case 0:
+			return func(v float64) float64 { return math.Pow(v, gamma) }, nil
+		case 1:
+			return func(v float64) float64 {
+				if v >= -bb/a {
+					return math.Pow(a*v+bb, gamma)
+				}
+				return 0
+			}, nil
+		case 2:
+			return func(v float64) float64 {
+				if v >= -bb/a {
+					return math.Pow(a*v+bb, gamma) + c
+				}
+				return c
+			}, nil
+		case 3:
+			return func(v float64) float64 {
+				if v >= d {
+					return math.Pow(a*v+bb, gamma)
+				}
+				return c * v
+			}, nil
+		default:
+			return func(v float64) float64 {
+				if v >= d {
+					return math.Pow(a*v+bb, gamma) + e
+				}
+				return c*v + f
+			}, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported curve type %q", string(b[0:4]))
+	}
+}
+
+// toSRGB converts img from the profile's color space to sRGB.
+// The result keeps 16 bits per channel so callers can decide how to reduce depth.
+func (p *iccProfile) toSRGB(img image.Image) *image.NRGBA64 {
+	// Pre-compute per-channel linearization tables over the full 16-bit range.
+	var luts [3][]float32
+	for c := range 3 {
+		lut := make([]float32, 65536)
+		for v := range lut {
+			l := p.trc[c](float64(v) / 65535)
+			if math.IsNaN(l) || math.IsInf(l, 0) {
+				// Out-of-domain curve parameters must not poison the image.
+				l = 0
+			}
+			lut[v] = float32(l)
+		}
+		luts[c] = lut
+	}
+
+	var m [3][3]float64
+	for i := range 3 {
+		for j := range 3 {
+			for k := range 3 {
+				m[i][j] += d50ToLinearSRGB[i][k] * p.matrix[k][j]
+			}
+		}
+	}
+
+	encode := newSRGBEncoder()
+	bounds := img.Bounds()
+	dst := image.NewNRGBA64(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			r := float64(luts[0][c.R])
+			g := float64(luts[1][c.G])
+			b := float64(luts[2][c.B])
+			dst.SetNRGBA64(x, y, color.NRGBA64{
+				R: encode(m[0][0]*r + m[0][1]*g + m[0][2]*b),
+				G: encode(m[1][0]*r + m[1][1]*g + m[1][2]*b),
+				B: encode(m[2][0]*r + m[2][1]*g + m[2][2]*b),
+				A: c.A,
+			})
+		}
+	}
+	return dst
+}
+
+// newSRGBEncoder returns a function that applies the sRGB transfer function to a
+// linear value and quantizes it to 16 bits. Out-of-gamut values are clipped.
+func newSRGBEncoder() func(float64) uint16 {
+	const size = 4096
+	table := make([]float64, size+1)
+	for i := range table {
+		l := float64(i) / size
+		if l <= 0.0031308 {
+			table[i] = 12.92 * l
+		} else {
+			table[i] = 1.055*math.Pow(l, 1/2.4) - 0.055
+		}
+	}
+	return func(l float64) uint16 {
+		if l <= 0 {
+			return 0
+		}
+		if l >= 1 {
+			return 65535
+		}
+		pos := l * size
+		i := int(pos)
+		frac := pos - float64(i)
+		v := table[i]*(1-frac) + table[i+1]*frac
+		return uint16(math.Round(v * 65535))
+	}
+}
+
+// roundTo8Bit reduces img to 8 bits per channel by rounding.
+func roundTo8Bit(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: round16To8(c.R),
+				G: round16To8(c.G),
+				B: round16To8(c.B),
+				A: round16To8(c.A),
+			})
+		}
+	}
+	return dst
+}
+
+// ditherTo8Bit reduces img to 8 bits per channel using ordered (Bayer) dithering
+// on the color channels. Alpha is rounded to avoid noisy edges.
+func ditherTo8Bit(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			t := (bayer8x8[y&7][x&7] + 0.5) / 64
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: dither16To8(c.R, t),
+				G: dither16To8(c.G, t),
+				B: dither16To8(c.B, t),
+				A: round16To8(c.A),
+			})
+		}
+	}
+	return dst
+}
+
+func round16To8(v uint16) uint8 {
+	return uint8((uint32(v)*255 + 32767) / 65535)
+}
+
+func dither16To8(v uint16, threshold float64) uint8 {
+	out := math.Floor(float64(v)*255/65535 + threshold)
+	if out > 255 {
+		return 255
+	}
+	return uint8(out)
+}
+
+// extractICCProfile returns the ICC profile embedded in JPEG, PNG or WebP data,
+// or nil if the data carries no profile.
+func extractICCProfile(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		return extractJPEGICCProfile(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return extractPNGICCProfile(data)
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return extractWebPICCProfile(data)
+	case isTIFF(data):
+		return extractTIFFICCProfile(data)
+	default:
+		return nil
+	}
+}
+
+// extractJPEGICCProfile reassembles the ICC_PROFILE APP2 segments of a JPEG stream.
+func extractJPEGICCProfile(data []byte) []byte {
+	const iccMarker = "ICC_PROFILE\x00"
+	chunks := make(map[int][]byte)
+	total := 0
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			break
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break // Start of scan / end of image: no more metadata segments.
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE2 && len(segment) > len(iccMarker)+2 && string(segment[:len(iccMarker)]) == iccMarker {
+			seq := int(segment[len(iccMarker)])
+			total = int(segment[len(iccMarker)+1])
+			chunks[seq] = segment[len(iccMarker)+2:]
+		}
+		pos += 2 + length
+	}
+	if total == 0 || len(chunks) != total {
+		return nil
+	}
+	var profile []byte
+	for seq := 1; seq <= total; seq++ {
+		chunk, ok := chunks[seq]
+		if !ok {
+			return nil
+		}
+		profile = append(profile, chunk...)
+	}
+	return profile
+}
+
+// extractPNGICCProfile inflates the iCCP chunk of a PNG stream.
+func extractPNGICCProfile(data []byte) []byte {
+	pos := 8
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		typ := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) {
+			return nil
+		}
+		if typ == "IDAT" {
+			return nil // iCCP must precede the image data.
+		}
+		if typ == "iCCP" {
+			chunk := data[pos+8 : pos+8+length]
+			nul := bytes.IndexByte(chunk, 0)
+			if nul < 0 || nul+2 > len(chunk) {
+				return nil
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(chunk[nul+2:]))
+			if err != nil {
+				return nil
+			}
+			defer func() { _ = zr.Close() }()
+			profile, err := io.ReadAll(zr)
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+		pos += 12 + length
+	}
+	return nil
+}
+
+// extractWebPICCProfile returns the ICCP chunk of an extended-format WebP file.
+func extractWebPICCProfile(data []byte) []byte {
+	pos := 12
+	for pos+8 <= len(data) {
+		fourcc := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		if size < 0 || pos+8+size > len(data) {
+			return nil
+		}
+		if fourcc == "ICCP" {
+			return data[pos+8 : pos+8+size]
+		}
+		pos += 8 + size + size&1
+	}
+	return nil
+}
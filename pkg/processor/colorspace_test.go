@@ -0,0 +1,362 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// sRGBColorantsD50 are the D50-adapted sRGB primaries (columns rXYZ, gXYZ, bXYZ).
+var sRGBColorantsD50 = [3][3]float64{
+	{0.4360747, 0.2225045, 0.0139322},
+	{0.3850649, 0.7168786, 0.0971045},
+	{0.1430804, 0.0606169, 0.7141733},
+}
+
+// buildTestICCProfile builds a minimal matrix/TRC RGB ICC profile with the
+// given colorants and a pure gamma curve shared by all channels.
+func buildTestICCProfile(t *testing.T, colorants [3][3]float64, gamma float64) []byte {
+	t.Helper()
+
+	fixed := func(v float64) []byte {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(int32(v*65536)))
+		return b
+	}
+
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	var tags []tag
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		data := append([]byte("XYZ \x00\x00\x00\x00"), fixed(colorants[i][0])...)
+		data = append(data, fixed(colorants[i][1])...)
+		data = append(data, fixed(colorants[i][2])...)
+		tags = append(tags, tag{sig, data})
+	}
+	curve := []byte("curv\x00\x00\x00\x00\x00\x00\x00\x01")
+	curve = binary.BigEndian.AppendUint16(curve, uint16(gamma*256))
+	curve = append(curve, 0, 0) // Pad to 4-byte boundary.
+	for _, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		tags = append(tags, tag{sig, curve})
+	}
+
+	header := make([]byte, 128)
+	copy(header[12:16], "mntr")
+	copy(header[16:20], "RGB ")
+	copy(header[20:24], "XYZ ")
+	copy(header[36:40], "acsp")
+
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	offset := 128 + 4 + len(tags)*12
+	var body []byte
+	for _, tg := range tags {
+		table = append(table, tg.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset+len(body)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(tg.data)))
+		body = append(body, tg.data...)
+	}
+
+	profile := append(header, table...)
+	profile = append(profile, body...)
+	binary.BigEndian.PutUint32(profile[0:4], uint32(len(profile)))
+	return profile
+}
+
+// embedICCInPNG inserts an iCCP chunk right after the IHDR chunk of pngData.
+func embedICCInPNG(t *testing.T, pngData, profile []byte) []byte {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(profile); err != nil {
+		t.Fatalf("failed to compress profile: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to compress profile: %v", err)
+	}
+
+	chunkData := append([]byte("test\x00\x00"), compressed.Bytes()...)
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(chunkData)))
+	chunk = append(chunk, "iCCP"...)
+	chunk = append(chunk, chunkData...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	// Signature (8) + IHDR chunk (4 length + 4 type + 13 data + 4 CRC).
+	const ihdrEnd = 8 + 25
+	out := append([]byte{}, pngData[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, pngData[ihdrEnd:]...)
+}
+
+// embedICCInJPEG inserts an ICC_PROFILE APP2 segment right after the SOI marker.
+func embedICCInJPEG(t *testing.T, jpegData, profile []byte) []byte {
+	t.Helper()
+
+	payload := append([]byte("ICC_PROFILE\x00\x01\x01"), profile...)
+	segment := []byte{0xFF, 0xE2}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(out, segment...)
+	return append(out, jpegData[2:]...)
+}
+
+// createUniformPNG creates a PNG filled with a single 8-bit gray level.
+func createUniformPNG(t *testing.T, width, height int, gray uint8) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetNRGBA(x, y, color.NRGBA{R: gray, G: gray, B: gray, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to create test PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseICCProfile(t *testing.T) {
+	profile := buildTestICCProfile(t, sRGBColorantsD50, 2.2)
+
+	p, err := parseICCProfile(profile)
+	if err != nil {
+		t.Fatalf("parseICCProfile() error = %v", err)
+	}
+	if got := p.matrix[0][0]; got < 0.436 || got > 0.4362 {
+		t.Errorf("matrix[0][0] = %v, want ~0.4361", got)
+	}
+	if got := p.trc[0](0.5); got < 0.21 || got > 0.22 {
+		t.Errorf("trc(0.5) = %v, want ~0.2176 for gamma 2.2", got)
+	}
+}
+
+func TestParseICCProfile_Unsupported(t *testing.T) {
+	profile := buildTestICCProfile(t, sRGBColorantsD50, 2.2)
+	copy(profile[16:20], "CMYK")
+
+	if _, err := parseICCProfile(profile); !errors.Is(err, ErrUnsupportedColorProfile) {
+		t.Errorf("parseICCProfile() error = %v, want ErrUnsupportedColorProfile", err)
+	}
+	if _, err := parseICCProfile([]byte("short")); !errors.Is(err, ErrUnsupportedColorProfile) {
+		t.Errorf("parseICCProfile(short) error = %v, want ErrUnsupportedColorProfile", err)
+	}
+}
+
+func TestExtractICCProfile(t *testing.T) {
+	profile := buildTestICCProfile(t, sRGBColorantsD50, 1.0)
+
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"PNG with iCCP", embedICCInPNG(t, createTestPNG(t, 4, 4), profile), true},
+		{"JPEG with APP2", embedICCInJPEG(t, createTestJPEG(t, 4, 4, 90), profile), true},
+		{"PNG without profile", createTestPNG(t, 4, 4), false},
+		{"JPEG without profile", createTestJPEG(t, 4, 4, 90), false},
+		{"Unknown data", []byte("not an image"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractICCProfile(tt.data)
+			if tt.want && !bytes.Equal(got, profile) {
+				t.Errorf("extractICCProfile() returned %d bytes, want %d", len(got), len(profile))
+			}
+			if !tt.want && got != nil {
+				t.Errorf("extractICCProfile() = %d bytes, want nil", len(got))
+			}
+		})
+	}
+}
+
+func TestApplyColorManagement_ConvertToSRGB(t *testing.T) {
+	// A linear-gamma profile with sRGB primaries: mid gray 128 is linear 0.502,
+	// which the sRGB transfer function encodes to ~188.
+	profile := buildTestICCProfile(t, sRGBColorantsD50, 1.0)
+	data := embedICCInPNG(t, createUniformPNG(t, 4, 4, 128), profile)
+
+	proc := NewPNGProcessor()
+	var buf bytes.Buffer
+	opts := DefaultCompressOptions()
+	opts.ConvertToSRGB = true
+	if _, err := proc.Compress(context.Background(), bytes.NewReader(data), &buf, opts); err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+	r, g, b, _ := img.At(1, 1).RGBA()
+	for _, v := range []uint32{r >> 8, g >> 8, b >> 8} {
+		if v < 186 || v > 190 {
+			t.Errorf("channel = %d, want ~188", v)
+		}
+	}
+}
+
+func TestApplyColorManagement_Disabled(t *testing.T) {
+	profile := buildTestICCProfile(t, sRGBColorantsD50, 1.0)
+	data := embedICCInPNG(t, createUniformPNG(t, 4, 4, 128), profile)
+
+	img, err := decodeImage(data, DefaultCompressOptions(), nil)
+	if err != nil {
+		t.Fatalf("decodeImage() error = %v", err)
+	}
+	r, _, _, _ := img.At(0, 0).RGBA()
+	if r>>8 != 128 {
+		t.Errorf("channel = %d, want 128 when ConvertToSRGB is false", r>>8)
+	}
+}
+
+func TestApplyColorManagement_UnsupportedProfile(t *testing.T) {
+	profile := buildTestICCProfile(t, sRGBColorantsD50, 1.0)
+	// An RGB profile whose TRC is a LUT-based type the parser does not know.
+	profile = bytes.Replace(profile, []byte("curv"), []byte("mAB "), 1)
+	data := embedICCInJPEG(t, createTestJPEG(t, 4, 4, 90), profile)
+
+	proc := NewJPEGProcessor()
+	var buf bytes.Buffer
+	opts := DefaultCompressOptions()
+	opts.ConvertToSRGB = true
+	_, err := proc.Compress(context.Background(), bytes.NewReader(data), &buf, opts)
+	if !errors.Is(err, ErrUnsupportedColorProfile) {
+		t.Errorf("Compress() error = %v, want ErrUnsupportedColorProfile", err)
+	}
+}
+
+func TestApplyColorManagement_NonRGBProfilePassesThrough(t *testing.T) {
+	for _, space := range []string{"GRAY", "CMYK"} {
+		t.Run(space, func(t *testing.T) {
+			profile := buildTestICCProfile(t, sRGBColorantsD50, 2.2)
+			copy(profile[16:20], space)
+			data := embedICCInPNG(t, createUniformPNG(t, 4, 4, 100), profile)
+
+			img, _, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("image.Decode() error = %v", err)
+			}
+			got, err := applyColorManagement(img, data, CompressOptions{ConvertToSRGB: true})
+			if err != nil {
+				t.Fatalf("applyColorManagement() error = %v", err)
+			}
+			if got != img {
+				t.Error("image with a non-RGB profile was converted")
+			}
+		})
+	}
+}
+
+func TestParseCurveTag_ParaZeroA(t *testing.T) {
+	for _, funcType := range []uint16{1, 2} {
+		tag := []byte("para\x00\x00\x00\x00")
+		tag = binary.BigEndian.AppendUint16(tag, funcType)
+		tag = append(tag, 0, 0)
+		// gamma 2.2, a 0, b 0.5, c 0.
+		for _, v := range []float64{2.2, 0, 0.5, 0} {
+			tag = binary.BigEndian.AppendUint32(tag, uint32(int32(v*65536)))
+		}
+		if _, err := parseCurveTag(tag); err == nil {
+			t.Errorf("parseCurveTag(type %d, a=0) error = nil, want error", funcType)
+		}
+	}
+}
+
+func TestApplyColorManagement_DitherTo8Bit(t *testing.T) {
+	// A 16-bit image halfway between 8-bit levels 128 and 129.
+	src := image.NewNRGBA64(image.Rect(0, 0, 16, 16))
+	for y := range 16 {
+		for x := range 16 {
+			src.SetNRGBA64(x, y, color.NRGBA64{R: 128*257 + 128, G: 128*257 + 128, B: 128*257 + 128, A: 0xFFFF})
+		}
+	}
+	var in bytes.Buffer
+	if err := png.Encode(&in, src); err != nil {
+		t.Fatalf("failed to encode 16-bit PNG: %v", err)
+	}
+
+	proc := NewPNGProcessor()
+	var out bytes.Buffer
+	opts := DefaultCompressOptions()
+	opts.DitherTo8Bit = true
+	if _, err := proc.Compress(context.Background(), &in, &out, opts); err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+
+	img, err := png.Decode(&out)
+	if err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+	if is16Bit(img) {
+		t.Fatalf("output image type = %T, want 8-bit", img)
+	}
+
+	var low, high int
+	for y := range 16 {
+		for x := range 16 {
+			r, _, _, _ := img.At(x, y).RGBA()
+			switch r >> 8 {
+			case 128:
+				low++
+			case 129:
+				high++
+			default:
+				t.Fatalf("unexpected channel value %d", r>>8)
+			}
+		}
+	}
+	if low == 0 || high == 0 {
+		t.Errorf("dithering produced low=%d high=%d, want a mix of both levels", low, high)
+	}
+}
+
+func TestApplyColorManagement_16BitKeptWithoutDither(t *testing.T) {
+	src := image.NewNRGBA64(image.Rect(0, 0, 4, 4))
+	var in bytes.Buffer
+	if err := png.Encode(&in, src); err != nil {
+		t.Fatalf("failed to encode 16-bit PNG: %v", err)
+	}
+
+	img, err := decodeImage(in.Bytes(), DefaultCompressOptions(), nil)
+	if err != nil {
+		t.Fatalf("decodeImage() error = %v", err)
+	}
+	if !is16Bit(img) {
+		t.Errorf("decoded image type = %T, want 16-bit", img)
+	}
+}
+
+func TestDecodeImage_JPEGWithProfileToSRGB(t *testing.T) {
+	profile := buildTestICCProfile(t, sRGBColorantsD50, 2.2)
+	data := embedICCInJPEG(t, createTestJPEG(t, 8, 8, 95), profile)
+
+	opts := DefaultCompressOptions()
+	opts.ConvertToSRGB = true
+	img, err := decodeImage(data, opts, nil)
+	if err != nil {
+		t.Fatalf("decodeImage() error = %v", err)
+	}
+	if _, ok := img.(*image.NRGBA); !ok {
+		t.Errorf("decoded image type = %T, want *image.NRGBA for 8-bit source", img)
+	}
+
+	// The result must still be encodable as JPEG.
+	if err := jpeg.Encode(&bytes.Buffer{}, img, nil); err != nil {
+		t.Errorf("jpeg.Encode() error = %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+)
+
+// ErrDimensionMismatch is returned by Compare when the two images differ in size.
+var ErrDimensionMismatch = errors.New("images have different dimensions")
+
+// ssimWindow and ssimStride are the size and step of the square windows
+// SSIM is averaged over.
+const (
+	ssimWindow = 8
+	ssimStride = 4
+)
+
+// SSIM stabilizing constants for 8-bit samples: (0.01*255)^2 and (0.03*255)^2.
+const (
+	ssimC1 = 6.5025
+	ssimC2 = 58.5225
+)
+
+// heatmapStops is the color ramp of Comparison.Heatmap, from no difference
+// to the largest difference.
+var heatmapStops = []color.NRGBA{
+	{0, 0, 0, 255},
+	{0, 0, 255, 255},
+	{0, 255, 0, 255},
+	{255, 255, 0, 255},
+	{255, 0, 0, 255},
+}
+
+// Comparison holds the visual difference between a reference image and a
+// processed one. The metrics are computed on the 8-bit red, green and blue
+// channels premultiplied by alpha, that is the image composited over black,
+// so that the color of fully transparent pixels does not count. Changes of
+// alpha itself are measured by MaxAlphaError.
+type Comparison struct {
+	Width  int
+	Height int
+	// PSNR is the peak signal-to-noise ratio in dB, +Inf for identical images.
+	PSNR float64
+	// SSIM is the mean structural similarity of the luma, from -1 to 1
+	// where 1 means identical.
+	SSIM float64
+	// MaxError is the largest absolute difference of a premultiplied color
+	// channel, 0-255.
+	MaxError int
+	// MaxAlphaError is the largest absolute difference of alpha, 0-255.
+	MaxAlphaError int
+
+	ref, img *image.NRGBA
+}
+
+// Identical reports whether the images have the same pixels, including
+// alpha. Colors hidden by full transparency are not compared.
+func (c *Comparison) Identical() bool {
+	return c.MaxError == 0 && c.MaxAlphaError == 0
+}
+
+// Compare decodes a reference image and a processed one and measures their
+// difference. Multi-page and animated images are compared on their first
+// page or frame.
+func Compare(ref, img io.Reader) (*Comparison, error) {
+	a, err := decodeForCompare(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode reference image: %w", err)
+	}
+	b, err := decodeForCompare(img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return CompareImages(a, b)
+}
+
+// CompareImages measures the difference between two decoded images of the
+// same size.
+func CompareImages(ref, img image.Image) (*Comparison, error) {
+	if ref.Bounds().Size() != img.Bounds().Size() {
+		return nil, fmt.Errorf("%w: %v and %v", ErrDimensionMismatch, ref.Bounds().Size(), img.Bounds().Size())
+	}
+	c := &Comparison{ref: packedNRGBA(ref), img: packedNRGBA(img)}
+	size := ref.Bounds().Size()
+	c.Width, c.Height = size.X, size.Y
+
+	var sum float64
+	for i := 0; i < len(c.ref.Pix); i += 4 {
+		for ch := range 3 {
+			d := premultiplied(c.ref.Pix, i, ch) - premultiplied(c.img.Pix, i, ch)
+			if d < 0 {
+				d = -d
+			}
+			c.MaxError = max(c.MaxError, d)
+			sum += float64(d * d)
+		}
+		d := int(c.ref.Pix[i+3]) - int(c.img.Pix[i+3])
+		c.MaxAlphaError = max(c.MaxAlphaError, d, -d)
+	}
+	if mse := sum / float64(max(len(c.ref.Pix)/4*3, 1)); mse == 0 {
+		c.PSNR = math.Inf(1)
+	} else {
+		c.PSNR = 10 * math.Log10(255*255/mse)
+	}
+	c.SSIM = ssim(luma(c.ref), luma(c.img), c.Width, c.Height)
+	return c, nil
+}
+
+// Heatmap returns an image of the per-pixel difference, the largest channel
+// difference of each pixel, alpha included, colored from black through
+// blue, green and yellow to red. The ramp is scaled to the larger of
+// MaxError and MaxAlphaError so that small differences stay visible;
+// identical images give a black image.
+func (c *Comparison) Heatmap() image.Image {
+	out := image.NewNRGBA(image.Rect(0, 0, c.Width, c.Height))
+	scale := max(c.MaxError, c.MaxAlphaError)
+	if scale == 0 {
+		draw.Draw(out, out.Bounds(), image.NewUniform(heatmapStops[0]), image.Point{}, draw.Src)
+		return out
+	}
+	for i := 0; i < len(c.ref.Pix); i += 4 {
+		a := int(c.ref.Pix[i+3]) - int(c.img.Pix[i+3])
+		d := max(a, -a)
+		for ch := range 3 {
+			v := premultiplied(c.ref.Pix, i, ch) - premultiplied(c.img.Pix, i, ch)
+			d = max(d, v, -v)
+		}
+		col := heatmapColor(float64(d) / float64(scale))
+		out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = col.R, col.G, col.B, col.A
+	}
+	return out
+}
+
+// heatmapColor interpolates heatmapStops at t in [0, 1].
+func heatmapColor(t float64) color.NRGBA {
+	pos := t * float64(len(heatmapStops)-1)
+	i := min(int(pos), len(heatmapStops)-2)
+	f := pos - float64(i)
+	a, b := heatmapStops[i], heatmapStops[i+1]
+	lerp := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + (float64(y)-float64(x))*f))
+	}
+	return color.NRGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), 255}
+}
+
+// decodeForCompare decodes the first page or frame of the image read from r.
+func decodeForCompare(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeImage(data, CompressOptions{}, nil)
+}
+
+// packedNRGBA is like toNRGBA but also copies images whose rows have
+// padding, so that pixel i starts at Pix[4*i].
+func packedNRGBA(img image.Image) *image.NRGBA {
+	n := toNRGBA(img)
+	if n.Stride == 4*n.Rect.Dx() {
+		return n
+	}
+	out := image.NewNRGBA(n.Rect)
+	draw.Draw(out, out.Rect, n, image.Point{}, draw.Src)
+	return out
+}
+
+// premultiplied returns channel ch of the pixel at Pix[i] multiplied by its
+// alpha, rounded to 8 bits.
+func premultiplied(pix []uint8, i, ch int) int {
+	return (int(pix[i+ch])*int(pix[i+3]) + 127) / 255
+}
+
+// luma returns the BT.601 luma of every pixel of img, premultiplied by alpha.
+func luma(img *image.NRGBA) []float64 {
+	y := make([]float64, len(img.Pix)/4)
+	for i := range y {
+		r := premultiplied(img.Pix, i*4, 0)
+		g := premultiplied(img.Pix, i*4, 1)
+		b := premultiplied(img.Pix, i*4, 2)
+		y[i] = 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+	}
+	return y
+}
+
+// ssim returns the mean SSIM of two luma planes over square windows. Images
+// smaller than a window are compared as a single window.
+func ssim(a, b []float64, width, height int) float64 {
+	win := min(ssimWindow, width, height)
+	if win == 0 {
+		return 1
+	}
+	var total float64
+	var count int
+	for _, y0 := range windowStarts(height, win) {
+		for _, x0 := range windowStarts(width, win) {
+			total += ssimWindowAt(a, b, width, x0, y0, win)
+			count++
+		}
+	}
+	return total / float64(count)
+}
+
+// windowStarts returns the offsets of the windows of size win along a side
+// of size pixels, every ssimStride pixels plus a last window aligned to the
+// end so that the final pixels are covered.
+func windowStarts(size, win int) []int {
+	var starts []int
+	for i := 0; i+win <= size; i += ssimStride {
+		starts = append(starts, i)
+	}
+	if last := size - win; starts[len(starts)-1] != last {
+		starts = append(starts, last)
+	}
+	return starts
+}
+
+// ssimWindowAt returns the SSIM of the win x win window at (x0, y0).
+func ssimWindowAt(a, b []float64, width, x0, y0, win int) float64 {
+	var sumA, sumB, sumAA, sumBB, sumAB float64
+	for y := y0; y < y0+win; y++ {
+		for x := x0; x < x0+win; x++ {
+			va, vb := a[y*width+x], b[y*width+x]
+			sumA += va
+			sumB += vb
+			sumAA += va * va
+			sumBB += vb * vb
+			sumAB += va * vb
+		}
+	}
+	n := float64(win * win)
+	muA, muB := sumA/n, sumB/n
+	varA := sumAA/n - muA*muA
+	varB := sumBB/n - muB*muB
+	cov := sumAB/n - muA*muB
+	return ((2*muA*muB + ssimC1) * (2*cov + ssimC2)) /
+		((muA*muA + muB*muB + ssimC1) * (varA + varB + ssimC2))
+}
@@ -0,0 +1,147 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestCompareImages_同一画像(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+
+	c, err := CompareImages(img, img)
+	if err != nil {
+		t.Fatalf("CompareImages() error = %v", err)
+	}
+	if !math.IsInf(c.PSNR, 1) || c.SSIM != 1 || c.MaxError != 0 || !c.Identical() {
+		t.Errorf("CompareImages() = PSNR %v, SSIM %v, MaxError %d, want identical", c.PSNR, c.SSIM, c.MaxError)
+	}
+	if c.Width != 16 || c.Height != 16 {
+		t.Errorf("size = %dx%d, want 16x16", c.Width, c.Height)
+	}
+}
+
+func TestCompareImages_1画素の差(t *testing.T) {
+	ref := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(ref, ref.Rect, image.NewUniform(color.NRGBA{128, 128, 128, 255}), image.Point{}, draw.Src)
+	img := image.NewNRGBA(ref.Rect)
+	copy(img.Pix, ref.Pix)
+	img.SetNRGBA(3, 4, color.NRGBA{R: 138, G: 128, B: 128, A: 255})
+
+	c, err := CompareImages(ref, img)
+	if err != nil {
+		t.Fatalf("CompareImages() error = %v", err)
+	}
+	if c.MaxError != 10 {
+		t.Errorf("MaxError = %d, want 10", c.MaxError)
+	}
+	// One channel of 300 differs by 10.
+	wantPSNR := 10 * math.Log10(255*255/(100.0/300))
+	if math.Abs(c.PSNR-wantPSNR) > 1e-9 {
+		t.Errorf("PSNR = %v, want %v", c.PSNR, wantPSNR)
+	}
+	if c.SSIM >= 1 || c.SSIM < 0.9 {
+		t.Errorf("SSIM = %v, want slightly below 1", c.SSIM)
+	}
+
+	heat := c.Heatmap()
+	if got := color.NRGBAModel.Convert(heat.At(3, 4)); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("Heatmap() at the changed pixel = %v, want red", got)
+	}
+	if got := color.NRGBAModel.Convert(heat.At(0, 0)); got != (color.NRGBA{0, 0, 0, 255}) {
+		t.Errorf("Heatmap() at an unchanged pixel = %v, want black", got)
+	}
+}
+
+func TestCompareImages_端の画素の差(t *testing.T) {
+	// The side is not a multiple of the window stride, so the last pixels are
+	// only covered by the windows aligned to the edges.
+	ref := image.NewNRGBA(image.Rect(0, 0, 19, 19))
+	draw.Draw(ref, ref.Rect, image.NewUniform(color.NRGBA{128, 128, 128, 255}), image.Point{}, draw.Src)
+	img := image.NewNRGBA(ref.Rect)
+	copy(img.Pix, ref.Pix)
+	img.SetNRGBA(18, 18, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+
+	c, err := CompareImages(ref, img)
+	if err != nil {
+		t.Fatalf("CompareImages() error = %v", err)
+	}
+	if c.SSIM >= 1 {
+		t.Errorf("SSIM = %v, want below 1 for a change in the last pixel", c.SSIM)
+	}
+}
+
+func TestCompareImages_アルファ(t *testing.T) {
+	ref := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(ref, ref.Rect, image.NewUniform(color.NRGBA{200, 100, 50, 255}), image.Point{}, draw.Src)
+	ref.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 0})
+
+	// The color under a fully transparent pixel does not count.
+	hidden := image.NewNRGBA(ref.Rect)
+	copy(hidden.Pix, ref.Pix)
+	hidden.SetNRGBA(0, 0, color.NRGBA{0, 0, 255, 0})
+	c, err := CompareImages(ref, hidden)
+	if err != nil {
+		t.Fatalf("CompareImages() error = %v", err)
+	}
+	if !c.Identical() || !math.IsInf(c.PSNR, 1) {
+		t.Errorf("hidden color change: MaxError %d, MaxAlphaError %d, PSNR %v, want identical", c.MaxError, c.MaxAlphaError, c.PSNR)
+	}
+
+	// A change of alpha alone makes the images differ.
+	faded := image.NewNRGBA(ref.Rect)
+	copy(faded.Pix, ref.Pix)
+	faded.SetNRGBA(5, 5, color.NRGBA{200, 100, 50, 128})
+	c, err = CompareImages(ref, faded)
+	if err != nil {
+		t.Fatalf("CompareImages() error = %v", err)
+	}
+	if c.Identical() || c.MaxAlphaError != 127 {
+		t.Errorf("alpha change: Identical() = %v, MaxAlphaError = %d, want false, 127", c.Identical(), c.MaxAlphaError)
+	}
+	if c.MaxError == 0 || math.IsInf(c.PSNR, 1) {
+		t.Errorf("alpha change: MaxError %d, PSNR %v, want a visible difference", c.MaxError, c.PSNR)
+	}
+	if got := color.NRGBAModel.Convert(c.Heatmap().At(5, 5)); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("Heatmap() at the faded pixel = %v, want red", got)
+	}
+}
+
+func TestCompare_JPEG(t *testing.T) {
+	png := createTestPNG(t, 64, 64)
+	low := createTestJPEG(t, 64, 64, 20)
+	high := createTestJPEG(t, 64, 64, 95)
+
+	cLow, err := Compare(bytes.NewReader(png), bytes.NewReader(low))
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	cHigh, err := Compare(bytes.NewReader(png), bytes.NewReader(high))
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	if cHigh.PSNR <= cLow.PSNR || cHigh.SSIM <= cLow.SSIM || cHigh.MaxError > cLow.MaxError {
+		t.Errorf("quality 95 (PSNR %.2f, SSIM %.4f, max %d) is not closer than quality 20 (PSNR %.2f, SSIM %.4f, max %d)",
+			cHigh.PSNR, cHigh.SSIM, cHigh.MaxError, cLow.PSNR, cLow.SSIM, cLow.MaxError)
+	}
+	if cHigh.PSNR < 30 || cHigh.SSIM < 0.9 {
+		t.Errorf("quality 95: PSNR %.2f, SSIM %.4f, want close to the original", cHigh.PSNR, cHigh.SSIM)
+	}
+}
+
+func TestCompare_エラー(t *testing.T) {
+	_, err := Compare(bytes.NewReader(createTestPNG(t, 10, 10)), bytes.NewReader(createTestPNG(t, 10, 12)))
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Compare() error = %v, want ErrDimensionMismatch", err)
+	}
+	if _, err := Compare(bytes.NewReader([]byte("broken")), bytes.NewReader(createTestPNG(t, 10, 10))); err == nil {
+		t.Error("Compare() error = nil for an invalid reference image")
+	}
+}
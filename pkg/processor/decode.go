@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"time"
+
+	// Register BMP and TIFF decoders for Convert function
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+)
+
+// decodeImage decodes the page or animation frame of inputData selected by
+// opts.Page using the registered image decoders and applies the optional
+// color-management stage configured in opts. Animations are decoded only up
+// to the selected frame. SVG input is rasterized at the size requested by
+// opts.Width/opts.Height/opts.DPI.
+// Stage durations and image sizes are added to st, which may be nil.
+func decodeImage(inputData []byte, opts CompressOptions, st *Stats) (image.Image, error) {
+	start := time.Now()
+	if frames := frameCount(inputData); frames > 0 {
+		if opts.Page >= frames {
+			return nil, fmt.Errorf("%w: frame %d of %d", ErrPageOutOfRange, opts.Page, frames)
+		}
+		anim, err := decodeAnimation(inputData, opts.Page+1)
+		if err != nil {
+			return nil, err
+		}
+		img, err := selectFrame(anim, opts.Page)
+		if err != nil {
+			return nil, err
+		}
+		st.addDecode(start)
+		return finishImage(img, inputData, opts, st)
+	}
+
+	inputData, err := selectPage(inputData, opts.Page)
+	if err != nil {
+		return nil, err
+	}
+	if isSVG(inputData) {
+		img, err := decodeSVG(inputData, opts)
+		if err != nil {
+			return nil, err
+		}
+		st.addDecode(start)
+		st.recordInput(img)
+		st.recordOutput(img)
+		return img, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(inputData))
+	if err != nil {
+		return nil, err
+	}
+	st.addDecode(start)
+	return finishImage(img, inputData, opts, st)
+}
+
+// decodedSize returns the size of the image decodeImage returns for inputData
+// and opts, read from the headers without decoding any pixels: the canvas of
+// an animation, the selected page of a TIFF or the render size of an SVG.
+func decodedSize(inputData []byte, opts CompressOptions) (image.Point, error) {
+	if frames := frameCount(inputData); frames > 0 {
+		if opts.Page >= frames {
+			return image.Point{}, fmt.Errorf("%w: frame %d of %d", ErrPageOutOfRange, opts.Page, frames)
+		}
+	} else {
+		var err error
+		if inputData, err = selectPage(inputData, opts.Page); err != nil {
+			return image.Point{}, err
+		}
+	}
+	if isSVG(inputData) {
+		size, err := inspectSVG(inputData)
+		if err != nil {
+			return image.Point{}, err
+		}
+		w, h := svgTargetSize(size, opts.Width, opts.Height, opts.DPI)
+		return image.Pt(w, h), nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(inputData))
+	if err != nil {
+		return image.Point{}, err
+	}
+	return image.Pt(cfg.Width, cfg.Height), nil
+}
+
+// finishImage applies the color-management stage configured in opts to an
+// image decoded from inputData, adding the transform time to st.
+func finishImage(img image.Image, inputData []byte, opts CompressOptions, st *Stats) (image.Image, error) {
+	st.recordInput(img)
+	start := time.Now()
+	img, err := applyColorManagement(img, inputData, opts)
+	if err != nil {
+		return nil, err
+	}
+	st.addTransform(start)
+	st.recordOutput(img)
+	return img, nil
+}
+
+// DetectFormat returns the format of the image in data from its signature,
+// for input without a file name such as standard input.
+func DetectFormat(data []byte) (ImageFormat, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return FormatJPEG, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG, nil
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FormatGIF, nil
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return FormatWEBP, nil
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return FormatTIFF, nil
+	case bytes.HasPrefix(data, []byte("BM")):
+		return FormatBMP, nil
+	case isHEIF(data):
+		return FormatHEIC, nil
+	case isSVG(data):
+		return FormatSVG, nil
+	default:
+		return -1, fmt.Errorf("unrecognized image format")
+	}
+}
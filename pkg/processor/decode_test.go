@@ -0,0 +1,39 @@
+package processor
+
+import "testing"
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    ImageFormat
+		wantErr bool
+	}{
+		{name: "jpeg", data: createTestJPEG(t, 8, 8, 90), want: FormatJPEG},
+		{name: "png", data: createTestPNG(t, 8, 8), want: FormatPNG},
+		{name: "gif", data: createTestGIF(t, 8, 8), want: FormatGIF},
+		{name: "webp", data: createTestWEBP(t, 8, 8, 80), want: FormatWEBP},
+		{name: "tiff", data: createTestTIFFPages(t, 1), want: FormatTIFF},
+		{name: "bmp", data: []byte("BM\x00\x00"), want: FormatBMP},
+		{name: "heif generic brand", data: []byte("\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00"), want: FormatHEIC},
+		{name: "avif", data: []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1"), wantErr: true},
+		{name: "avif generic brand", data: []byte("\x00\x00\x00\x1cftypmif1\x00\x00\x00\x00mif1avif"), wantErr: true},
+		{name: "avif sequence", data: []byte("\x00\x00\x00\x1cftypmsf1\x00\x00\x00\x00msf1avis"), wantErr: true},
+		{name: "svg", data: []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"/>`), want: FormatSVG},
+		{name: "mp4", data: []byte("\x00\x00\x00\x18ftypisom\x00\x00\x00\x00"), wantErr: true},
+		{name: "text", data: []byte("not an image"), wantErr: true},
+		{name: "empty", data: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectFormat(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DetectFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("DetectFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
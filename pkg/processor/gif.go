@@ -0,0 +1,445 @@
+package processor
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"slices"
+	"time"
+)
+
+// maxGIFColors is the number of opaque palette entries written to GIF output.
+// The last entry of the 256-color table is reserved for transparency.
+const maxGIFColors = 255
+
+// GIFProcessor implements the Processor interface for GIF images,
+// including animated GIFs.
+type GIFProcessor struct{}
+
+// NewGIFProcessor creates a new GIFProcessor.
+func NewGIFProcessor() *GIFProcessor {
+	return &GIFProcessor{}
+}
+
+// Compress re-encodes a GIF image, keeping every frame of an animation.
+// Colors are reduced to a shared 255-color palette; Medium and High use
+// Floyd-Steinberg dithering, Low maps each pixel to the nearest color.
+func (p *GIFProcessor) Compress(ctx context.Context, r io.Reader, w io.Writer, opts CompressOptions) (*Result, error) {
+	return runAs(ctx, "GIFProcessor", FormatGIF, r, w, CompressPipeline(FormatGIF, opts))
+}
+
+// Convert converts an image to GIF format. Animated GIF, APNG and WebP input
+// is written as an animated GIF unless opts.Poster is set.
+func (p *GIFProcessor) Convert(ctx context.Context, r io.Reader, w io.Writer, opts ConvertOptions) (*Result, error) {
+	return runAs(ctx, "GIFProcessor", FormatGIF, r, w, ConvertPipeline(opts))
+}
+
+// SupportedFormats returns the formats supported by this processor.
+func (p *GIFProcessor) SupportedFormats() []ImageFormat {
+	return []ImageFormat{FormatGIF}
+}
+
+// isGIF reports whether data starts with a GIF signature.
+func isGIF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+}
+
+// decodeGIFAnimation decodes every frame of a GIF, compositing each frame onto
+// the logical screen according to its disposal method. When limit is positive
+// the data is cut after the first limit frames so that the rest is never
+// decompressed.
+func decodeGIFAnimation(data []byte, limit int) (*Animation, error) {
+	if limit > 0 {
+		if ends := gifFrameEnds(data); len(ends) >= limit {
+			data = append(data[:ends[limit-1]:ends[limit-1]], gifTrailer)
+		}
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	for _, frame := range g.Image {
+		bounds = bounds.Union(frame.Bounds())
+	}
+	if err := checkAnimationSize(bounds.Dx(), bounds.Dy(), len(g.Image)); err != nil {
+		return nil, err
+	}
+
+	anim := &Animation{LoopCount: gifPlays(g.LoopCount)}
+	canvas := image.NewRGBA(bounds)
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = snapshot(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		anim.Frames = append(anim.Frames, Frame{
+			Image: snapshot(canvas),
+			Delay: time.Duration(g.Delay[i]) * 10 * time.Millisecond,
+		})
+
+		switch disposal {
+		case gif.DisposalBackground:
+			clearRect(canvas, frame.Bounds())
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return anim, nil
+}
+
+// GIF block introducers.
+const (
+	gifExtension       = 0x21
+	gifImageDescriptor = 0x2C
+	gifTrailer         = 0x3B
+)
+
+// gifFrameEnds returns the offset just past the image data of every frame of
+// the GIF in data, walking its block structure without decompressing any
+// image data. Walking stops at the trailer or at the first malformed block.
+func gifFrameEnds(data []byte) []int {
+	if len(data) < 13 {
+		return nil
+	}
+	off := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		off += 3 << (flags&0x07 + 1)
+	}
+	var ends []int
+	for off < len(data) {
+		switch data[off] {
+		case gifExtension:
+			off = skipGIFSubBlocks(data, off+2)
+		case gifImageDescriptor:
+			if off+11 > len(data) {
+				return ends
+			}
+			flags := data[off+9]
+			off += 10
+			if flags&0x80 != 0 {
+				off += 3 << (flags&0x07 + 1)
+			}
+			// Skip the LZW minimum code size and the image data.
+			off = skipGIFSubBlocks(data, off+1)
+			ends = append(ends, min(off, len(data)))
+		default:
+			return ends
+		}
+	}
+	return ends
+}
+
+// gifPlays converts gif.GIF.LoopCount, which counts restarts (0 loops forever,
+// -1 plays once), to the number of plays used by Animation.LoopCount.
+func gifPlays(loopCount int) int {
+	switch {
+	case loopCount == 0:
+		return 0
+	case loopCount < 0:
+		return 1
+	default:
+		return loopCount + 1
+	}
+}
+
+// gifLoopCount converts Animation.LoopCount to gif.GIF.LoopCount.
+func gifLoopCount(plays int) int {
+	switch plays {
+	case 0:
+		return 0
+	case 1:
+		return -1
+	default:
+		return plays - 1
+	}
+}
+
+// gifDelay converts a frame delay to hundredths of a second.
+func gifDelay(d time.Duration) int {
+	return int((d + 5*time.Millisecond) / (10 * time.Millisecond))
+}
+
+// encodeGIF writes anim as a GIF with a single global palette. Frames are
+// written over the whole canvas and restored to the transparent background
+// when any of them contains transparent pixels.
+func encodeGIF(w io.Writer, anim *Animation, level CompressionLevel) error {
+	frames, err := animationFrames(anim)
+	if err != nil {
+		return err
+	}
+	q := newGIFQuantizer(frames)
+	size := frames[0].Rect.Size()
+
+	g := &gif.GIF{
+		LoopCount:       gifLoopCount(anim.LoopCount),
+		Config:          image.Config{ColorModel: q.palette, Width: size.X, Height: size.Y},
+		BackgroundIndex: q.transparent,
+	}
+	transparent := false
+	for i, frame := range frames {
+		img, hasTransparent := q.quantize(frame, level != CompressionLow)
+		transparent = transparent || hasTransparent
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, gifDelay(anim.Frames[i].Delay))
+	}
+	disposal := byte(gif.DisposalNone)
+	if transparent {
+		disposal = gif.DisposalBackground
+	}
+	g.Disposal = slices.Repeat([]byte{disposal}, len(frames))
+	return gif.EncodeAll(w, g)
+}
+
+// gifQuantizer maps NRGBA pixels to a palette of at most maxGIFColors opaque
+// colors followed by a transparent entry.
+type gifQuantizer struct {
+	palette     color.Palette
+	transparent uint8
+	// exact maps 0xRRGGBB colors to their palette index when the palette
+	// holds every opaque color of the input.
+	exact map[uint32]uint8
+	// lut caches the nearest palette index of each 5-bit-per-channel color, or -1.
+	lut []int16
+}
+
+// colorBucket accumulates the opaque pixels that share a 5-bit-per-channel color.
+type colorBucket struct {
+	count            int
+	r, g, b          int
+	sumR, sumG, sumB int
+}
+
+// newGIFQuantizer builds a palette for frames. When frames use at most
+// maxGIFColors opaque colors the palette holds them exactly; otherwise it is
+// reduced with median cut over a 5-bit-per-channel histogram.
+func newGIFQuantizer(frames []*image.NRGBA) *gifQuantizer {
+	exact := make(map[uint32]uint8)
+	buckets := make([]colorBucket, 1<<15)
+	for _, frame := range frames {
+		for i := 0; i+3 < len(frame.Pix); i += 4 {
+			px := frame.Pix[i : i+4 : i+4]
+			if px[3] < 128 {
+				continue
+			}
+			bucket := &buckets[bucketIndex(px[0], px[1], px[2])]
+			bucket.count++
+			bucket.sumR += int(px[0])
+			bucket.sumG += int(px[1])
+			bucket.sumB += int(px[2])
+			if exact != nil {
+				exact[packRGB(px[0], px[1], px[2])] = 0
+				if len(exact) > maxGIFColors {
+					exact = nil
+				}
+			}
+		}
+	}
+
+	q := &gifQuantizer{lut: slices.Repeat([]int16{-1}, 1<<15)}
+	if exact != nil {
+		colors := make([]uint32, 0, len(exact))
+		for c := range exact {
+			colors = append(colors, c)
+		}
+		slices.Sort(colors)
+		for i, c := range colors {
+			exact[c] = uint8(i)
+			q.palette = append(q.palette, color.NRGBA{R: uint8(c >> 16), G: uint8(c >> 8), B: uint8(c), A: 255})
+		}
+		q.exact = exact
+	} else {
+		q.palette = medianCut(buckets, maxGIFColors)
+	}
+	q.transparent = uint8(len(q.palette))
+	q.palette = append(q.palette, color.NRGBA{})
+	return q
+}
+
+// bucketIndex returns the histogram bucket of a color.
+func bucketIndex(r, g, b uint8) int {
+	return int(r>>3)<<10 | int(g>>3)<<5 | int(b>>3)
+}
+
+// packRGB packs a color into 0xRRGGBB.
+func packRGB(r, g, b uint8) uint32 {
+	return uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+}
+
+// medianCut reduces the non-empty buckets to at most n colors by repeatedly
+// splitting the most populated box along its widest channel.
+func medianCut(buckets []colorBucket, n int) color.Palette {
+	var all []colorBucket
+	for i, bucket := range buckets {
+		if bucket.count == 0 {
+			continue
+		}
+		bucket.r, bucket.g, bucket.b = i>>10, i>>5&31, i&31
+		all = append(all, bucket)
+	}
+	if len(all) == 0 {
+		return color.Palette{color.NRGBA{A: 255}}
+	}
+
+	boxes := [][]colorBucket{all}
+	for len(boxes) < n {
+		best, bestCount := -1, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			if count := boxCount(box); count > bestCount {
+				best, bestCount = i, count
+			}
+		}
+		if best < 0 {
+			break
+		}
+		lo, hi := splitBox(boxes[best])
+		boxes[best] = lo
+		boxes = append(boxes, hi)
+	}
+
+	palette := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		var count, r, g, b int
+		for _, bucket := range box {
+			count += bucket.count
+			r += bucket.sumR
+			g += bucket.sumG
+			b += bucket.sumB
+		}
+		palette[i] = color.NRGBA{R: uint8(r / count), G: uint8(g / count), B: uint8(b / count), A: 255}
+	}
+	return palette
+}
+
+// boxCount returns the number of pixels in box.
+func boxCount(box []colorBucket) int {
+	var n int
+	for _, bucket := range box {
+		n += bucket.count
+	}
+	return n
+}
+
+// splitBox sorts box along its widest channel and splits it at the pixel median.
+func splitBox(box []colorBucket) ([]colorBucket, []colorBucket) {
+	channel := func(b colorBucket, c int) int {
+		switch c {
+		case 0:
+			return b.r
+		case 1:
+			return b.g
+		default:
+			return b.b
+		}
+	}
+	widest, widestRange := 0, -1
+	for c := range 3 {
+		lo, hi := 31, 0
+		for _, bucket := range box {
+			v := channel(bucket, c)
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		if hi-lo > widestRange {
+			widest, widestRange = c, hi-lo
+		}
+	}
+	slices.SortFunc(box, func(a, b colorBucket) int {
+		return cmp.Compare(channel(a, widest), channel(b, widest))
+	})
+
+	half := boxCount(box) / 2
+	var n int
+	for i, bucket := range box[:len(box)-1] {
+		n += bucket.count
+		if n >= half {
+			return box[:i+1], box[i+1:]
+		}
+	}
+	return box[:len(box)-1], box[len(box)-1:]
+}
+
+// index returns the palette index of the opaque color closest to (r, g, b).
+func (q *gifQuantizer) index(r, g, b uint8) uint8 {
+	if q.exact != nil {
+		if i, ok := q.exact[packRGB(r, g, b)]; ok {
+			return i
+		}
+	}
+	key := bucketIndex(r, g, b)
+	if i := q.lut[key]; i >= 0 {
+		return uint8(i)
+	}
+	best, bestDist := 0, int(^uint(0)>>1)
+	for i, c := range q.palette[:q.transparent] {
+		pc := c.(color.NRGBA)
+		dr, dg, db := int(pc.R)-int(r), int(pc.G)-int(g), int(pc.B)-int(b)
+		if d := dr*dr + dg*dg + db*db; d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	q.lut[key] = int16(best)
+	return uint8(best)
+}
+
+// quantize maps frame to the palette, optionally with Floyd-Steinberg
+// dithering. Pixels with alpha below 128 become transparent. It reports
+// whether any transparent pixel was written.
+func (q *gifQuantizer) quantize(frame *image.NRGBA, dither bool) (*image.Paletted, bool) {
+	w, h := frame.Rect.Dx(), frame.Rect.Dy()
+	dst := image.NewPaletted(frame.Rect, q.palette)
+	// cur and next hold the diffused error of this and the next row, 3 channels
+	// per pixel with one pixel of padding on each side.
+	cur := make([]int, (w+2)*3)
+	next := make([]int, (w+2)*3)
+	transparent := false
+	for y := range h {
+		for x := range w {
+			px := frame.Pix[y*frame.Stride+x*4 : y*frame.Stride+x*4+4 : y*frame.Stride+x*4+4]
+			if px[3] < 128 {
+				dst.Pix[y*dst.Stride+x] = q.transparent
+				transparent = true
+				continue
+			}
+			if !dither {
+				dst.Pix[y*dst.Stride+x] = q.index(px[0], px[1], px[2])
+				continue
+			}
+			e := cur[(x+1)*3 : (x+1)*3+3]
+			r := clampUint8(int(px[0]) + e[0]/16)
+			g := clampUint8(int(px[1]) + e[1]/16)
+			b := clampUint8(int(px[2]) + e[2]/16)
+			i := q.index(r, g, b)
+			dst.Pix[y*dst.Stride+x] = i
+			pc := q.palette[i].(color.NRGBA)
+			diff := [3]int{int(r) - int(pc.R), int(g) - int(pc.G), int(b) - int(pc.B)}
+			for c := range 3 {
+				cur[(x+2)*3+c] += diff[c] * 7
+				next[x*3+c] += diff[c] * 3
+				next[(x+1)*3+c] += diff[c] * 5
+				next[(x+2)*3+c] += diff[c]
+			}
+		}
+		cur, next = next, cur
+		clear(next)
+	}
+	return dst, transparent
+}
+
+// clampUint8 clamps v to the range of a uint8.
+func clampUint8(v int) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"slices"
+
+	// Register the HEIC decoder ("ftypheic" brand) for Convert function
+	"github.com/gen2brain/heic"
+)
+
+// heifBrands lists additional ISO BMFF major brands used by HEIC/HEIF stills.
+// The heic package only registers the "heic" brand, while iPhones and Android
+// devices also emit "heix" or the generic "mif1"/"msf1" brands. AVIF files
+// list the generic brands too, so isHEIF also checks the compatible brands.
+var heifBrands = []string{"heix", "mif1", "msf1"}
+
+// errAVIF reports an AVIF file that matched a generic HEIF brand.
+var errAVIF = errors.New("avif images are not supported")
+
+func init() {
+	for _, brand := range heifBrands {
+		image.RegisterFormat("heif", "????ftyp"+brand, decodeHEIF, decodeHEIFConfig)
+	}
+}
+
+// decodeHEIF decodes a HEIF image whose major brand may be generic.
+func decodeHEIF(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !isHEIF(data) {
+		return nil, errAVIF
+	}
+	return heic.Decode(bytes.NewReader(normalizeHEIFBrand(data)))
+}
+
+// decodeHEIFConfig returns the image configuration of a HEIF image whose major brand may be generic.
+func decodeHEIFConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if !isHEIF(data) {
+		return image.Config{}, errAVIF
+	}
+	return heic.DecodeConfig(bytes.NewReader(normalizeHEIFBrand(data)))
+}
+
+// isHEIF reports whether data starts with a HEIC/HEIF file type box. A generic
+// major brand only counts when no compatible brand marks the file as AVIF.
+func isHEIF(data []byte) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	major := string(data[8:12])
+	if major != "heic" && !slices.Contains(heifBrands, major) {
+		return false
+	}
+	size := min(int(binary.BigEndian.Uint32(data[0:4])), len(data))
+	for off := 16; off+4 <= size; off += 4 {
+		if brand := string(data[off : off+4]); brand == "avif" || brand == "avis" {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeHEIFBrand rewrites a generic major brand (e.g. "mif1") to the HEVC
+// brand found in the compatible brands list, since the underlying decoder only
+// accepts "heic"/"heix" as major brand. data is returned unchanged otherwise.
+func normalizeHEIFBrand(data []byte) []byte {
+	if len(data) < 16 || string(data[4:8]) != "ftyp" {
+		return data
+	}
+	major := string(data[8:12])
+	if major == "heic" || major == "heix" {
+		return data
+	}
+	size := int(binary.BigEndian.Uint32(data[0:4]))
+	if size > len(data) {
+		return data
+	}
+	for off := 16; off+4 <= size; off += 4 {
+		brand := string(data[off : off+4])
+		if brand == "heic" || brand == "heix" {
+			patched := append([]byte{}, data...)
+			copy(patched[8:12], brand)
+			return patched
+		}
+	}
+	return data
+}
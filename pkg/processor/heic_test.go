@@ -0,0 +1,117 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadTestHEIC reads the HEIC sample image from testdata.
+func loadTestHEIC(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "sample.heic"))
+	if err != nil {
+		t.Fatalf("failed to read HEIC sample: %v", err)
+	}
+	return data
+}
+
+func TestHEIC_DecodeRegisteredBrands(t *testing.T) {
+	data := loadTestHEIC(t)
+
+	for _, brand := range append([]string{"heic"}, heifBrands...) {
+		t.Run(brand, func(t *testing.T) {
+			patched := append([]byte{}, data...)
+			copy(patched[8:12], brand)
+
+			img, _, err := image.Decode(bytes.NewReader(patched))
+			if err != nil {
+				t.Fatalf("image.Decode() error = %v", err)
+			}
+			if img.Bounds().Empty() {
+				t.Error("decoded image is empty")
+			}
+		})
+	}
+}
+
+func TestHEIC_DecodeRejectsAVIF(t *testing.T) {
+	data := []byte("\x00\x00\x00\x1cftypmif1\x00\x00\x00\x00mif1avif")
+
+	if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		t.Error("image.DecodeConfig() should fail for an AVIF header")
+	}
+	if _, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+		t.Error("image.Decode() should fail for an AVIF header")
+	}
+}
+
+func TestHEIC_ConvertToJPEG(t *testing.T) {
+	data := loadTestHEIC(t)
+
+	proc := NewJPEGProcessor()
+	var buf bytes.Buffer
+	result, err := proc.Convert(context.Background(), bytes.NewReader(data), &buf, DefaultConvertOptions(FormatJPEG))
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if result.Format != FormatJPEG {
+		t.Errorf("Format = %v, want %v", result.Format, FormatJPEG)
+	}
+	if _, err := jpeg.Decode(&buf); err != nil {
+		t.Errorf("output is not a valid JPEG: %v", err)
+	}
+}
+
+func TestHEIC_ScanDirectory(t *testing.T) {
+	inputDir := t.TempDir()
+	data := loadTestHEIC(t)
+	writeTestFile(t, inputDir, "photo.heic", data)
+	writeTestFile(t, inputDir, "photo2.HEIF", data)
+	writeTestFile(t, inputDir, "image.jpg", createTestJPEG(t, 10, 10, 90))
+
+	items, err := ScanDirectory(inputDir, t.TempDir())
+	if err != nil {
+		t.Fatalf("ScanDirectory() error = %v", err)
+	}
+	if len(items) != 1 {
+		t.Errorf("ScanDirectory() returned %d items, want 1 (HEIC is decode-only)", len(items))
+	}
+
+	convertItems, err := ScanDirectoryForConvert(inputDir, t.TempDir(), FormatWEBP)
+	if err != nil {
+		t.Fatalf("ScanDirectoryForConvert() error = %v", err)
+	}
+	if len(convertItems) != 3 {
+		t.Fatalf("ScanDirectoryForConvert() returned %d items, want 3", len(convertItems))
+	}
+	for _, item := range convertItems {
+		if filepath.Ext(item.OutputPath) != ".webp" {
+			t.Errorf("OutputPath = %s, want .webp extension", item.OutputPath)
+		}
+	}
+}
+
+func TestHEIC_ProcessBatchCompressRejected(t *testing.T) {
+	inputDir := t.TempDir()
+	outputPath := filepath.Join(t.TempDir(), "photo.heic")
+	inputPath := writeTestFile(t, inputDir, "photo.heic", loadTestHEIC(t))
+
+	bp := NewDefaultBatchProcessor(WithMaxWorkers(1))
+	results, err := bp.ProcessBatch(context.Background(), []BatchItem{
+		{InputPath: inputPath, OutputPath: outputPath, Options: DefaultCompressOptions()},
+	})
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	if results[0].IsSuccess() {
+		t.Error("compressing HEIC should fail")
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("output file should not be created, stat err = %v", err)
+	}
+}
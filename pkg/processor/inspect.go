@@ -0,0 +1,563 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// Color models reported in ImageInfo.ColorModel.
+const (
+	ColorModelGray      = "gray"
+	ColorModelGrayAlpha = "gray_alpha"
+	ColorModelRGB       = "rgb"
+	ColorModelRGBA      = "rgba"
+	ColorModelPaletted  = "paletted"
+	ColorModelYCbCr     = "ycbcr"
+	ColorModelCMYK      = "cmyk"
+)
+
+// tiffTagOrientation is the EXIF/TIFF orientation tag.
+const tiffTagOrientation = 274
+
+// TIFF tags describing the pixel layout of an IFD.
+const (
+	tiffTagBitsPerSample   = 258
+	tiffTagPhotometric     = 262
+	tiffTagSamplesPerPixel = 277
+	tiffTagExtraSamples    = 338
+)
+
+// jpegStdLuminanceQuant is the luminance quantization table of the JPEG
+// specification (Annex K), which encoders scale to reach a quality setting.
+var jpegStdLuminanceQuant = [64]int{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+// ImageInfo describes an image as stored, before any processing.
+type ImageInfo struct {
+	// Format is the detected format name, such as "jpeg".
+	Format string `json:"format"`
+	// Size is the file size in bytes.
+	Size   int64 `json:"size"`
+	Width  int   `json:"width"`
+	Height int   `json:"height"`
+	// ColorModel is one of the ColorModel constants.
+	ColorModel string `json:"color_model"`
+	// BitDepth is the number of bits per channel, or per palette index for
+	// paletted images.
+	BitDepth int  `json:"bit_depth"`
+	HasAlpha bool `json:"has_alpha"`
+	// Orientation is the EXIF orientation (1-8), or 0 when there is none.
+	Orientation   int  `json:"orientation,omitempty"`
+	HasICCProfile bool `json:"has_icc_profile"`
+	// ICCProfile is the description of the embedded ICC profile, if any.
+	ICCProfile string `json:"icc_profile,omitempty"`
+	// Progressive reports a progressive JPEG or an interlaced PNG or GIF.
+	Progressive bool `json:"progressive"`
+	// JPEGQuality is the quality estimated from the JPEG quantization
+	// tables, or 0 for other formats.
+	JPEGQuality int `json:"jpeg_quality,omitempty"`
+	// Frames is the number of animation frames or TIFF pages; 1 for a
+	// still image.
+	Frames int `json:"frames"`
+}
+
+// Inspect reads an image and reports its format, dimensions and encoding
+// details. Only the headers are parsed; the pixel data is not decoded.
+func Inspect(r io.Reader) (*ImageInfo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	format, err := DetectFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ImageInfo{Format: format.String(), Size: int64(len(data)), Frames: 1}
+	if format == FormatSVG {
+		size, err := inspectSVG(data)
+		if err != nil {
+			return nil, err
+		}
+		info.Width, info.Height = svgTargetSize(size, 0, 0, 0)
+		info.ColorModel, info.BitDepth, info.HasAlpha = ColorModelRGBA, 8, true
+		return info, nil
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image header: %w", err)
+	}
+	info.Width, info.Height = cfg.Width, cfg.Height
+	info.ColorModel, info.BitDepth, info.HasAlpha = describeColorModel(cfg.ColorModel)
+
+	switch format {
+	case FormatJPEG:
+		inspectJPEG(data, info)
+	case FormatPNG:
+		inspectPNG(data, info)
+	case FormatGIF:
+		inspectGIF(data, info)
+	case FormatWEBP:
+		inspectWebP(data, info)
+	case FormatTIFF:
+		inspectTIFF(data, info)
+	}
+
+	if profile := extractICCProfile(data); profile != nil {
+		info.HasICCProfile = true
+		info.ICCProfile = iccDescription(profile)
+	}
+	return info, nil
+}
+
+// describeColorModel maps the color model reported by a decoder to a color
+// model name, bit depth and alpha presence. Format-specific header parsing
+// refines the result where the decoder's model is not exact.
+func describeColorModel(m color.Model) (string, int, bool) {
+	switch m {
+	case color.GrayModel:
+		return ColorModelGray, 8, false
+	case color.Gray16Model:
+		return ColorModelGray, 16, false
+	case color.RGBAModel:
+		return ColorModelRGB, 8, false
+	case color.RGBA64Model:
+		return ColorModelRGB, 16, false
+	case color.NRGBAModel:
+		return ColorModelRGBA, 8, true
+	case color.NRGBA64Model:
+		return ColorModelRGBA, 16, true
+	case color.YCbCrModel:
+		return ColorModelYCbCr, 8, false
+	case color.NYCbCrAModel:
+		return ColorModelYCbCr, 8, true
+	case color.CMYKModel:
+		return ColorModelCMYK, 8, false
+	}
+	if p, ok := m.(color.Palette); ok {
+		for _, c := range p {
+			if _, _, _, a := c.RGBA(); a != 0xffff {
+				return ColorModelPaletted, 8, true
+			}
+		}
+		return ColorModelPaletted, 8, false
+	}
+	return ColorModelRGBA, 8, true
+}
+
+// inspectJPEG reads the frame header, quantization tables and EXIF
+// orientation of a JPEG file.
+func inspectJPEG(data []byte, info *ImageInfo) {
+	var luminance []int
+	for off := 2; off+4 <= len(data); {
+		if data[off] != 0xFF {
+			break
+		}
+		marker := data[off+1]
+		if marker == 0xFF {
+			off++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data[off+2 : off+4]))
+		if n < 2 || off+2+n > len(data) {
+			break
+		}
+		seg := data[off+4 : off+2+n]
+		off += 2 + n
+
+		switch {
+		case marker == 0xDB:
+			if t := jpegLuminanceTable(seg); t != nil {
+				luminance = t
+			}
+		case marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")):
+			info.Orientation = exifOrientation(seg[6:])
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			if len(seg) < 6 {
+				continue
+			}
+			info.BitDepth = int(seg[0])
+			// SOF2, SOF6, SOF10 and SOF14 are the progressive processes.
+			info.Progressive = marker&0x03 == 0x02
+			switch seg[5] {
+			case 1:
+				info.ColorModel = ColorModelGray
+			case 4:
+				info.ColorModel = ColorModelCMYK
+			default:
+				info.ColorModel = ColorModelYCbCr
+			}
+		}
+	}
+	if luminance != nil {
+		info.JPEGQuality = estimateJPEGQuality(luminance)
+	}
+}
+
+// jpegLuminanceTable returns quantization table 0 from a DQT segment, which
+// may define several tables.
+func jpegLuminanceTable(seg []byte) []int {
+	for len(seg) > 0 {
+		precision, id := seg[0]>>4, seg[0]&0x0F
+		size := 64
+		if precision != 0 {
+			size = 128
+		}
+		if len(seg) < 1+size {
+			return nil
+		}
+		if id == 0 {
+			table := make([]int, 64)
+			for i := range table {
+				if precision != 0 {
+					table[i] = int(binary.BigEndian.Uint16(seg[1+2*i:]))
+				} else {
+					table[i] = int(seg[1+i])
+				}
+			}
+			return table
+		}
+		seg = seg[1+size:]
+	}
+	return nil
+}
+
+// estimateJPEGQuality inverts the libjpeg quality scaling by comparing a
+// luminance quantization table with the standard one. The order of the
+// entries does not matter since only their sum is compared.
+func estimateJPEGQuality(table []int) int {
+	var sum, std int
+	for i, q := range table {
+		sum += q
+		std += jpegStdLuminanceQuant[i]
+	}
+	scale := float64(sum) * 100 / float64(std)
+	var q float64
+	if scale <= 100 {
+		q = (200 - scale) / 2
+	} else {
+		q = 5000 / scale
+	}
+	return min(max(int(math.Round(q)), 1), 100)
+}
+
+// inspectPNG reads the IHDR chunk of a PNG file, and the tRNS, eXIf and
+// acTL chunks when present.
+func inspectPNG(data []byte, info *ImageInfo) {
+	for off := len(pngSignature); len(data)-off >= 12; {
+		n := int(binary.BigEndian.Uint32(data[off : off+4]))
+		if n > len(data)-off-12 {
+			return
+		}
+		chunk := data[off+8 : off+8+n]
+		switch string(data[off+4 : off+8]) {
+		case "IHDR":
+			if n < 13 {
+				return
+			}
+			info.BitDepth = int(chunk[8])
+			switch chunk[9] {
+			case 0:
+				info.ColorModel, info.HasAlpha = ColorModelGray, false
+			case 2:
+				info.ColorModel, info.HasAlpha = ColorModelRGB, false
+			case 3:
+				info.ColorModel, info.HasAlpha = ColorModelPaletted, false
+			case 4:
+				info.ColorModel, info.HasAlpha = ColorModelGrayAlpha, true
+			case 6:
+				info.ColorModel, info.HasAlpha = ColorModelRGBA, true
+			}
+			info.Progressive = chunk[12] == 1
+		case "tRNS":
+			info.HasAlpha = true
+		case "eXIf":
+			info.Orientation = exifOrientation(chunk)
+		case "acTL":
+			if n >= 4 {
+				info.Frames = int(binary.BigEndian.Uint32(chunk[0:4]))
+			}
+		case "IEND":
+			return
+		}
+		off += 12 + n
+	}
+}
+
+// inspectGIF walks the blocks of a GIF file, counting its frames and reading
+// the transparency and interlacing of the first one.
+func inspectGIF(data []byte, info *ImageInfo) {
+	if len(data) < 13 {
+		return
+	}
+	frames := 0
+	off := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		off += 3 << (flags&0x07 + 1)
+	}
+blocks:
+	for off < len(data) {
+		switch data[off] {
+		case gifExtension:
+			if off+2 > len(data) {
+				break blocks
+			}
+			// The graphic control extension before the first image says
+			// whether that image has a transparent color.
+			if data[off+1] == 0xF9 && frames == 0 && off+4 <= len(data) && data[off+2] >= 4 {
+				info.HasAlpha = data[off+3]&0x01 != 0
+			}
+			off = skipGIFSubBlocks(data, off+2)
+		case gifImageDescriptor:
+			if off+11 > len(data) {
+				break blocks
+			}
+			flags := data[off+9]
+			if frames == 0 {
+				info.Progressive = flags&0x40 != 0
+			}
+			frames++
+			off += 10
+			if flags&0x80 != 0 {
+				off += 3 << (flags&0x07 + 1)
+			}
+			// Skip the LZW minimum code size and the image data.
+			off = skipGIFSubBlocks(data, off+1)
+		default:
+			break blocks
+		}
+	}
+	info.BitDepth = 8
+	info.Frames = max(frames, 1)
+}
+
+// skipGIFSubBlocks returns the offset after the sub-block sequence at off.
+func skipGIFSubBlocks(data []byte, off int) int {
+	for off < len(data) {
+		n := int(data[off])
+		off++
+		if n == 0 {
+			return off
+		}
+		off += n
+	}
+	return off
+}
+
+// inspectWebP reads the chunks of a WebP file for alpha, EXIF orientation
+// and animation frames.
+func inspectWebP(data []byte, info *ImageInfo) {
+	body, ok := webpBody(data)
+	if !ok {
+		return
+	}
+	chunks, err := readRIFFChunks(body)
+	if err != nil {
+		return
+	}
+	frames := 0
+	alpha := false
+	for _, c := range chunks {
+		switch c.fourCC {
+		case "VP8X":
+			if len(c.data) > 0 && c.data[0]&webpFlagAlpha != 0 {
+				alpha = true
+			}
+		case "VP8L":
+			// The 32 bits after the signature hold the width, height and
+			// the alpha_is_used flag.
+			if len(c.data) >= 5 && binary.LittleEndian.Uint32(c.data[1:5])&(1<<28) != 0 {
+				alpha = true
+			}
+		case "ALPH":
+			alpha = true
+		case "EXIF":
+			info.Orientation = exifOrientation(bytes.TrimPrefix(c.data, []byte("Exif\x00\x00")))
+		case "ANMF":
+			frames++
+		}
+	}
+	info.BitDepth = 8
+	info.HasAlpha = alpha
+	info.ColorModel = ColorModelRGB
+	if alpha {
+		info.ColorModel = ColorModelRGBA
+	}
+	info.Frames = max(frames, 1)
+}
+
+// inspectTIFF reads the pixel layout and orientation from the first IFD of a
+// TIFF file and counts its pages.
+func inspectTIFF(data []byte, info *ImageInfo) {
+	offsets, err := tiffIFDOffsets(data)
+	if err != nil {
+		return
+	}
+	info.Frames = len(offsets)
+	order := tiffByteOrder(data)
+	ifd := offsets[0]
+
+	if bits, ok := tiffTagValue(data, order, ifd, tiffTagBitsPerSample); ok {
+		info.BitDepth = int(bits)
+	}
+	samples, ok := tiffTagValue(data, order, ifd, tiffTagSamplesPerPixel)
+	if !ok {
+		samples = 1
+	}
+	extra, _ := tiffTagValue(data, order, ifd, tiffTagExtraSamples)
+	// ExtraSamples 1 and 2 are associated and unassociated alpha.
+	alpha := extra == 1 || extra == 2
+	info.HasAlpha = alpha
+
+	photometric, _ := tiffTagValue(data, order, ifd, tiffTagPhotometric)
+	switch photometric {
+	case 0, 1:
+		info.ColorModel = ColorModelGray
+		if alpha || samples > 1 {
+			info.ColorModel = ColorModelGrayAlpha
+		}
+	case 2:
+		info.ColorModel = ColorModelRGB
+		if alpha {
+			info.ColorModel = ColorModelRGBA
+		}
+	case 3:
+		info.ColorModel = ColorModelPaletted
+	case 5:
+		info.ColorModel = ColorModelCMYK
+	case 6:
+		info.ColorModel = ColorModelYCbCr
+	}
+	if o, ok := tiffTagValue(data, order, ifd, tiffTagOrientation); ok {
+		info.Orientation = int(o)
+	}
+}
+
+// tiffTagValue returns the first value of a BYTE, SHORT or LONG tag in the
+// IFD at off.
+func tiffTagValue(data []byte, order binary.ByteOrder, off uint32, tag uint16) (uint32, bool) {
+	if uint64(off)+2 > uint64(len(data)) {
+		return 0, false
+	}
+	n := uint32(order.Uint16(data[off : off+2]))
+	for i := range n {
+		start := uint64(off) + 2 + uint64(i)*tiffIFDEntryLen
+		if start+tiffIFDEntryLen > uint64(len(data)) {
+			return 0, false
+		}
+		e := data[start : start+tiffIFDEntryLen]
+		if order.Uint16(e[0:2]) != tag {
+			continue
+		}
+		typ, count := order.Uint16(e[2:4]), order.Uint32(e[4:8])
+		if count == 0 {
+			return 0, false
+		}
+		size := tiffTypeSizes[typ]
+		value := e[8:12]
+		if uint64(size)*uint64(count) > 4 {
+			at := uint64(order.Uint32(e[8:12]))
+			if at+uint64(size) > uint64(len(data)) {
+				return 0, false
+			}
+			value = data[at : at+uint64(size)]
+		}
+		switch typ {
+		case 1:
+			return uint32(value[0]), true
+		case 3:
+			return uint32(order.Uint16(value)), true
+		case 4:
+			return order.Uint32(value), true
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// exifOrientation returns the orientation tag of EXIF data, which has the
+// layout of a TIFF file, or 0 when it is missing or invalid.
+func exifOrientation(exif []byte) int {
+	if len(exif) < tiffHeaderLen || !isTIFF(exif) {
+		return 0
+	}
+	order := tiffByteOrder(exif)
+	o, ok := tiffTagValue(exif, order, order.Uint32(exif[4:8]), tiffTagOrientation)
+	if !ok || o < 1 || o > 8 {
+		return 0
+	}
+	return int(o)
+}
+
+// iccDescription returns the profile description of an ICC profile, read
+// from its "desc" tag in the version 2 textDescription or version 4
+// multiLocalizedUnicode encoding, or "" when there is none.
+func iccDescription(profile []byte) string {
+	if len(profile) < 132 {
+		return ""
+	}
+	count := int(binary.BigEndian.Uint32(profile[128:132]))
+	for i := range count {
+		off := 132 + i*12
+		if off+12 > len(profile) {
+			return ""
+		}
+		if string(profile[off:off+4]) != "desc" {
+			continue
+		}
+		start := int(binary.BigEndian.Uint32(profile[off+4 : off+8]))
+		size := int(binary.BigEndian.Uint32(profile[off+8 : off+12]))
+		if start < 0 || size < 12 || start+size > len(profile) {
+			return ""
+		}
+		return decodeICCText(profile[start : start+size])
+	}
+	return ""
+}
+
+// decodeICCText decodes a textDescriptionType or multiLocalizedUnicodeType
+// tag, taking the first record of the latter.
+func decodeICCText(tag []byte) string {
+	switch string(tag[0:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(tag[8:12]))
+		if n > len(tag)-12 {
+			return ""
+		}
+		return strings.TrimRight(string(tag[12:12+n]), "\x00")
+	case "mluc":
+		if len(tag) < 28 || binary.BigEndian.Uint32(tag[8:12]) == 0 {
+			return ""
+		}
+		n := int(binary.BigEndian.Uint32(tag[20:24]))
+		start := int(binary.BigEndian.Uint32(tag[24:28]))
+		if start < 0 || n < 0 || start+n > len(tag) {
+			return ""
+		}
+		units := make([]uint16, n/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(tag[start+2*i:])
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	}
+	return ""
+}
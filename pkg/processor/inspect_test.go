@@ -0,0 +1,209 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"testing"
+	"unicode/utf16"
+)
+
+// embedOrientationInJPEG inserts an EXIF APP1 segment holding only an
+// orientation tag right after the SOI marker.
+func embedOrientationInJPEG(t *testing.T, jpegData []byte, orientation uint16) []byte {
+	t.Helper()
+
+	exif := []byte("Exif\x00\x00MM\x00\x2A\x00\x00\x00\x08\x00\x01")
+	exif = binary.BigEndian.AppendUint16(exif, tiffTagOrientation)
+	exif = binary.BigEndian.AppendUint16(exif, 3)
+	exif = binary.BigEndian.AppendUint32(exif, 1)
+	exif = binary.BigEndian.AppendUint16(exif, orientation)
+	exif = append(exif, 0, 0, 0, 0, 0, 0)
+
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(exif)+2))
+	segment = append(segment, exif...)
+
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(out, segment...)
+	return append(out, jpegData[2:]...)
+}
+
+// withICCDescription appends a version 4 "desc" tag to an ICC profile built
+// by buildTestICCProfile.
+func withICCDescription(t *testing.T, profile []byte, desc string) []byte {
+	t.Helper()
+
+	units := utf16.Encode([]rune(desc))
+	tag := []byte("mluc\x00\x00\x00\x00")
+	tag = binary.BigEndian.AppendUint32(tag, 1)
+	tag = binary.BigEndian.AppendUint32(tag, 12)
+	tag = append(tag, "enUS"...)
+	tag = binary.BigEndian.AppendUint32(tag, uint32(len(units)*2))
+	tag = binary.BigEndian.AppendUint32(tag, 28)
+	for _, u := range units {
+		tag = binary.BigEndian.AppendUint16(tag, u)
+	}
+
+	// Shift the existing tag data by the new table entry and append the tag.
+	count := binary.BigEndian.Uint32(profile[128:132])
+	tableEnd := 132 + int(count)*12
+	out := append([]byte{}, profile[:tableEnd]...)
+	for i := range int(count) {
+		off := 132 + i*12 + 4
+		binary.BigEndian.PutUint32(out[off:], binary.BigEndian.Uint32(out[off:])+12)
+	}
+	binary.BigEndian.PutUint32(out[128:132], count+1)
+	out = append(out, "desc"...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(profile)+12))
+	out = binary.BigEndian.AppendUint32(out, uint32(len(tag)))
+	out = append(out, profile[tableEnd:]...)
+	out = append(out, tag...)
+	binary.BigEndian.PutUint32(out[0:4], uint32(len(out)))
+	return out
+}
+
+func TestInspect_JPEG(t *testing.T) {
+	for _, quality := range []int{30, 50, 75, 90, 100} {
+		info, err := Inspect(bytes.NewReader(createTestJPEG(t, 32, 16, quality)))
+		if err != nil {
+			t.Fatalf("Inspect() error = %v", err)
+		}
+		if diff := info.JPEGQuality - quality; diff < -1 || diff > 1 {
+			t.Errorf("quality %d: JPEGQuality = %d", quality, info.JPEGQuality)
+		}
+		if info.Format != "jpeg" || info.Width != 32 || info.Height != 16 ||
+			info.ColorModel != ColorModelYCbCr || info.BitDepth != 8 || info.HasAlpha || info.Progressive {
+			t.Errorf("Inspect() = %+v", info)
+		}
+	}
+}
+
+func TestInspect_JPEGProgressiveAndOrientation(t *testing.T) {
+	data := embedOrientationInJPEG(t, createTestJPEG(t, 16, 16, 80), 6)
+	// Mark the frame as progressive; only the headers are read.
+	sof := bytes.Index(data, []byte{0xFF, 0xC0})
+	data[sof+1] = 0xC2
+
+	info, err := Inspect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	if !info.Progressive {
+		t.Error("Progressive = false, want true")
+	}
+	if info.Orientation != 6 {
+		t.Errorf("Orientation = %d, want 6", info.Orientation)
+	}
+}
+
+func TestInspect_ICCProfile(t *testing.T) {
+	profile := withICCDescription(t, buildTestICCProfile(t, sRGBColorantsD50, 2.2), "Display P3")
+
+	info, err := Inspect(bytes.NewReader(embedICCInPNG(t, createTestPNG(t, 8, 8), profile)))
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	if !info.HasICCProfile || info.ICCProfile != "Display P3" {
+		t.Errorf("HasICCProfile = %v, ICCProfile = %q, want Display P3", info.HasICCProfile, info.ICCProfile)
+	}
+
+	info, err = Inspect(bytes.NewReader(createTestPNG(t, 8, 8)))
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	if info.HasICCProfile || info.ICCProfile != "" {
+		t.Errorf("HasICCProfile = %v, ICCProfile = %q for an image without a profile", info.HasICCProfile, info.ICCProfile)
+	}
+}
+
+func TestInspect_Formats(t *testing.T) {
+	gray := image.NewGray16(image.Rect(0, 0, 5, 4))
+	var gray16 bytes.Buffer
+	if err := png.Encode(&gray16, gray); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+
+	pal := color.Palette{color.Transparent, color.White}
+	var transparentGIF bytes.Buffer
+	if err := gif.Encode(&transparentGIF, image.NewPaletted(image.Rect(0, 0, 6, 3), pal), nil); err != nil {
+		t.Fatalf("gif.Encode() error = %v", err)
+	}
+
+	heic, err := os.ReadFile("testdata/sample.heic")
+	if err != nil {
+		t.Fatalf("failed to read testdata: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want ImageInfo
+	}{
+		{
+			name: "PNG",
+			data: createTestPNG(t, 20, 10),
+			want: ImageInfo{Format: "png", Width: 20, Height: 10, ColorModel: ColorModelRGB, BitDepth: 8, Frames: 1},
+		},
+		{
+			name: "16ビットグレースケールPNG",
+			data: gray16.Bytes(),
+			want: ImageInfo{Format: "png", Width: 5, Height: 4, ColorModel: ColorModelGray, BitDepth: 16, Frames: 1},
+		},
+		{
+			name: "アニメーションGIF",
+			data: createTestGIF(t, 12, 8),
+			want: ImageInfo{Format: "gif", Width: 12, Height: 8, ColorModel: ColorModelPaletted, BitDepth: 8, Frames: len(testFrameColors)},
+		},
+		{
+			name: "透過GIF",
+			data: transparentGIF.Bytes(),
+			want: ImageInfo{Format: "gif", Width: 6, Height: 3, ColorModel: ColorModelPaletted, BitDepth: 8, HasAlpha: true, Frames: 1},
+		},
+		{
+			name: "WebP",
+			data: createTestWEBP(t, 16, 8, 80),
+			want: ImageInfo{Format: "webp", Width: 16, Height: 8, ColorModel: ColorModelRGB, BitDepth: 8, Frames: 1},
+		},
+		{
+			name: "マルチページTIFF",
+			data: createTestTIFFPages(t, 3),
+			want: ImageInfo{Format: "tiff", Width: 10, Height: 8, ColorModel: ColorModelRGBA, BitDepth: 8, HasAlpha: true, Frames: 3},
+		},
+		{
+			name: "SVG",
+			data: []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="40" height="30"/>`),
+			want: ImageInfo{Format: "svg", Width: 40, Height: 30, ColorModel: ColorModelRGBA, BitDepth: 8, HasAlpha: true, Frames: 1},
+		},
+		{
+			name: "HEIC",
+			data: heic,
+			want: ImageInfo{Format: "heic", Width: 512, Height: 512, ColorModel: ColorModelYCbCr, BitDepth: 8, Frames: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Inspect(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("Inspect() error = %v", err)
+			}
+			tt.want.Size = int64(len(tt.data))
+			if *info != tt.want {
+				t.Errorf("Inspect() = %+v, want %+v", *info, tt.want)
+			}
+		})
+	}
+}
+
+func TestInspect_Error(t *testing.T) {
+	if _, err := Inspect(bytes.NewReader([]byte("not an image"))); err == nil {
+		t.Error("Inspect() error = nil for an unknown format")
+	}
+	if _, err := Inspect(bytes.NewReader([]byte("\x89PNG\r\n\x1a\ntruncated"))); err == nil {
+		t.Error("Inspect() error = nil for a truncated image")
+	}
+}
@@ -0,0 +1,253 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JournalEntry is one line of a batch journal, recording an item that was
+// processed successfully.
+type JournalEntry struct {
+	// InputPath is the path of the input image file.
+	InputPath string `json:"input"`
+
+	// InputHash is the hex-encoded SHA-256 of the input file contents.
+	InputHash string `json:"input_sha256"`
+
+	// OutputPath is the path of the written output file.
+	OutputPath string `json:"output"`
+
+	// OptionsHash is the hex-encoded SHA-256 of the pipeline that wrote the output.
+	OptionsHash string `json:"options_sha256"`
+
+	// OriginalSize is the size of the input in bytes.
+	OriginalSize int64 `json:"original_size"`
+
+	// CompressedSize is the size of the output in bytes.
+	CompressedSize int64 `json:"compressed_size"`
+
+	// Format is the name of the output format, e.g. "jpeg".
+	Format string `json:"format"`
+}
+
+// ReadJournal reads the entries of the JSON Lines journal at path.
+// A truncated last line, left behind by a crash during a write, is ignored.
+func ReadJournal(path string) ([]JournalEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, _, err := parseJournal(data)
+	return entries, err
+}
+
+// parseJournal parses the complete lines of data and also returns the length
+// of the consistent prefix, i.e. data up to and including the last newline.
+func parseJournal(data []byte) ([]JournalEntry, int, error) {
+	end := bytes.LastIndexByte(data, '\n') + 1
+	var entries []JournalEntry
+	sc := bufio.NewScanner(bytes.NewReader(data[:end]))
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, 0, fmt.Errorf("invalid journal line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, 0, err
+	}
+	return entries, end, nil
+}
+
+// journal records completed batch items in a JSON Lines file.
+// Each entry is written with a single append, so concurrent workers and
+// interrupted runs never leave interleaved or partial lines behind other than
+// a truncated last line, which is discarded when the journal is reopened.
+type journal struct {
+	mu      sync.Mutex
+	f       *os.File
+	done    map[string]JournalEntry // keyed by output path
+	err     error                   // first write error
+	storage Storage                 // where inputs are hashed and outputs checked
+}
+
+// openJournal opens the journal at path for appending. With resume, the
+// entries already in the file are loaded so completed items can be skipped;
+// otherwise the file is truncated and the run starts from scratch.
+func openJournal(path string, resume bool) (*journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	flag := os.O_RDWR | os.O_CREATE
+	if !resume {
+		flag |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flag, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	j := &journal{f: f, done: make(map[string]JournalEntry), storage: LocalStorage{}}
+	if resume {
+		if err := j.load(); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// load reads the existing entries and truncates a partial last line so that
+// new entries start on a line of their own.
+func (j *journal) load() error {
+	data, err := io.ReadAll(j.f)
+	if err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	entries, end, err := parseJournal(data)
+	if err != nil {
+		return err
+	}
+	if end < len(data) {
+		if err := j.f.Truncate(int64(end)); err != nil {
+			return fmt.Errorf("failed to repair journal: %w", err)
+		}
+	}
+	if _, err := j.f.Seek(int64(end), io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	for _, e := range entries {
+		j.done[e.OutputPath] = e
+	}
+	return nil
+}
+
+// run processes one item through process unless the journal shows that the
+// same input was already written to outputPath by an equivalent p and the
+// output still exists, in which case the journaled result and input hash are
+// returned with skipped set. The output of an optimize pipeline is looked up
+// with the extension of the journaled format. The input is only hashed up
+// front for such a journaled item; otherwise process returns the hash of the
+// input it read. Successful results are appended to the journal. A nil
+// journal just calls process.
+func (j *journal) run(ctx context.Context, inputPath, outputPath string, p Pipeline, process func() (*Result, string, error)) (res *Result, inputHash string, skipped bool, err error) {
+	if j == nil {
+		res, inputHash, err = process()
+		return res, inputHash, false, err
+	}
+
+	optsHash := optionsHash(p)
+	j.mu.Lock()
+	e, ok := j.done[outputPath]
+	j.mu.Unlock()
+	if ok && e.InputPath == inputPath && e.OptionsHash == optsHash {
+		format, _ := formatFromName(e.Format)
+		if _, statErr := j.storage.Stat(ctx, p.outputPath(outputPath, format)); statErr == nil {
+			hash, err := hashFile(ctx, j.storage, inputPath)
+			if err != nil {
+				return nil, "", false, err
+			}
+			if hash == e.InputHash {
+				return &Result{OriginalSize: e.OriginalSize, CompressedSize: e.CompressedSize, Format: format}, hash, true, nil
+			}
+		}
+	}
+
+	res, inputHash, err = process()
+	if err != nil {
+		return nil, "", false, err
+	}
+	j.record(JournalEntry{
+		InputPath:      inputPath,
+		InputHash:      inputHash,
+		OutputPath:     outputPath,
+		OptionsHash:    optsHash,
+		OriginalSize:   res.OriginalSize,
+		CompressedSize: res.CompressedSize,
+		Format:         res.Format.String(),
+	})
+	return res, inputHash, false, nil
+}
+
+// processedHash returns the hex-encoded SHA-256 that h computed while
+// inputPath was processed. When the input was replaced in place by its output,
+// the new contents are hashed instead so that a later run does not process
+// the file again.
+func processedHash(ctx context.Context, s Storage, inputPath, outputPath string, h hash.Hash) (string, error) {
+	if sameName(s, inputPath, outputPath) {
+		return hashFile(ctx, s, outputPath)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// record appends e to the journal. Write errors are kept and reported by close.
+func (j *journal) record(e JournalEntry) {
+	line, _ := json.Marshal(e) // JournalEntry holds only strings and integers.
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.f.Write(line); err != nil && j.err == nil {
+		j.err = fmt.Errorf("failed to write journal: %w", err)
+	}
+	j.done[e.OutputPath] = e
+}
+
+// close flushes the journal to disk and returns the first write error, if any.
+func (j *journal) close() error {
+	if j == nil {
+		return nil
+	}
+	err := j.f.Sync()
+	if cerr := j.f.Close(); err == nil {
+		err = cerr
+	}
+	if j.err != nil {
+		return j.err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to close journal: %w", err)
+	}
+	return nil
+}
+
+// hashFile returns the hex-encoded SHA-256 of the file at path in s.
+func hashFile(ctx context.Context, s Storage, path string) (string, error) {
+	f, err := s.Open(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read input file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// formatFromName returns the ImageFormat whose String() is name.
+func formatFromName(name string) (ImageFormat, error) {
+	for f := FormatJPEG; f.IsValid(); f++ {
+		if f.String() == name {
+			return f, nil
+		}
+	}
+	return -1, errors.New("unknown image format: " + name)
+}
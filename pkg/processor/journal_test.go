@@ -0,0 +1,256 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// journalTestItems writes n JPEG inputs and returns batch items for them.
+func journalTestItems(t *testing.T, n int) []BatchItem {
+	t.Helper()
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	jpegData := createTestJPEG(t, 64, 64, 95)
+
+	items := make([]BatchItem, n)
+	for i := range items {
+		name := "img" + string(rune('0'+i)) + ".jpg"
+		items[i] = BatchItem{
+			InputPath:  writeTestFile(t, inputDir, name, jpegData),
+			OutputPath: filepath.Join(outputDir, name),
+			Options:    DefaultCompressOptions(),
+		}
+	}
+	return items
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_ジャーナル記録(t *testing.T) {
+	items := journalTestItems(t, 3)
+	journalPath := filepath.Join(t.TempDir(), "sub", "journal.jsonl")
+
+	bp := NewDefaultBatchProcessor(WithJournal(journalPath))
+	if _, err := bp.ProcessBatch(context.Background(), items); err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+
+	entries, err := ReadJournal(journalPath)
+	if err != nil {
+		t.Fatalf("ReadJournal() error = %v", err)
+	}
+	if len(entries) != len(items) {
+		t.Fatalf("journal has %d entries, want %d", len(entries), len(items))
+	}
+	for _, e := range entries {
+		if len(e.InputHash) != 64 || len(e.OptionsHash) != 64 {
+			t.Errorf("InputHash = %q, OptionsHash = %q, want hex SHA-256", e.InputHash, e.OptionsHash)
+		}
+		if e.Format != "jpeg" || e.CompressedSize <= 0 {
+			t.Errorf("unexpected entry %+v", e)
+		}
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_レジューム(t *testing.T) {
+	items := journalTestItems(t, 4)
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	bp := NewDefaultBatchProcessor(WithJournal(journalPath))
+	if _, err := bp.ProcessBatch(context.Background(), items); err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+
+	// Change one input and delete another output: both must be processed again.
+	if err := os.WriteFile(items[1].InputPath, createTestJPEG(t, 32, 32, 90), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(items[2].OutputPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var last Progress
+	bp = NewDefaultBatchProcessor(WithJournal(journalPath), WithResume(), WithMaxWorkers(1),
+		WithProgressCallback(func(p Progress) { last = p }))
+	results, err := bp.ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+
+	wantSkipped := []bool{true, false, false, true}
+	for i, r := range results {
+		if !r.IsSuccess() {
+			t.Fatalf("result[%d] error = %v", i, r.Error)
+		}
+		if r.Skipped != wantSkipped[i] {
+			t.Errorf("result[%d].Skipped = %v, want %v", i, r.Skipped, wantSkipped[i])
+		}
+		if r.Result.CompressedSize <= 0 || r.Result.Format != FormatJPEG {
+			t.Errorf("result[%d].Result = %+v", i, r.Result)
+		}
+	}
+	if last.Completed != 4 || last.Skipped != 2 {
+		t.Errorf("last progress = %+v, want Completed=4 Skipped=2", last)
+	}
+	if _, err := os.Stat(items[2].OutputPath); err != nil {
+		t.Errorf("output was not recreated: %v", err)
+	}
+
+	// Re-processed items are recorded again, so a further resume skips everything.
+	results, err = bp.ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	for i, r := range results {
+		if !r.Skipped {
+			t.Errorf("result[%d] was processed again after resume", i)
+		}
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_オプション変更時は再処理(t *testing.T) {
+	items := journalTestItems(t, 2)
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	bp := NewDefaultBatchProcessor(WithJournal(journalPath))
+	if _, err := bp.ProcessBatch(context.Background(), items); err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+
+	items[0].Options.Quality = 40
+	bp = NewDefaultBatchProcessor(WithJournal(journalPath), WithResume())
+	results, err := bp.ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	if results[0].Skipped || !results[1].Skipped {
+		t.Errorf("Skipped = [%v %v], want [false true]", results[0].Skipped, results[1].Skipped)
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_レジュームなしでジャーナルを初期化(t *testing.T) {
+	items := journalTestItems(t, 2)
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	bp := NewDefaultBatchProcessor(WithJournal(journalPath))
+	for range 2 {
+		results, err := bp.ProcessBatch(context.Background(), items)
+		if err != nil {
+			t.Fatalf("ProcessBatch() error = %v", err)
+		}
+		for i, r := range results {
+			if r.Skipped {
+				t.Errorf("result[%d] skipped without WithResume", i)
+			}
+		}
+	}
+
+	entries, err := ReadJournal(journalPath)
+	if err != nil {
+		t.Fatalf("ReadJournal() error = %v", err)
+	}
+	if len(entries) != len(items) {
+		t.Errorf("journal has %d entries, want %d", len(entries), len(items))
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_途中で切れたジャーナル(t *testing.T) {
+	items := journalTestItems(t, 2)
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	bp := NewDefaultBatchProcessor(WithJournal(journalPath))
+	if _, err := bp.ProcessBatch(context.Background(), items[:1]); err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+
+	// Simulate a crash in the middle of writing the next entry.
+	f, err := os.OpenFile(journalPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"input":"` + items[1].InputPath); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	bp = NewDefaultBatchProcessor(WithJournal(journalPath), WithResume())
+	results, err := bp.ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	if !results[0].Skipped || results[1].Skipped {
+		t.Errorf("Skipped = [%v %v], want [true false]", results[0].Skipped, results[1].Skipped)
+	}
+
+	data, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("journal has %d lines, want 2:\n%s", len(lines), data)
+	}
+	if _, err := ReadJournal(journalPath); err != nil {
+		t.Errorf("ReadJournal() error = %v", err)
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_キャンセル時はジャーナルに記録しない(t *testing.T) {
+	items := journalTestItems(t, 3)
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	bp := NewDefaultBatchProcessor(WithJournal(journalPath), WithMaxWorkers(1))
+	if _, err := bp.ProcessBatch(ctx, items); err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+
+	entries, err := ReadJournal(journalPath)
+	if err != nil {
+		t.Fatalf("ReadJournal() error = %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("journal has %d entries after cancellation, want 0", len(entries))
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_変換_レジューム(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, inputDir, "a.jpg", createTestJPEG(t, 32, 32, 90))
+	writeTestFile(t, inputDir, "b.jpg", createTestJPEG(t, 48, 48, 90))
+	items, err := ScanDirectoryForConvert(inputDir, outputDir, FormatPNG)
+	if err != nil {
+		t.Fatalf("ScanDirectoryForConvert() error = %v", err)
+	}
+	journalPath := filepath.Join(outputDir, ".journal.jsonl")
+
+	bp := NewDefaultBatchProcessor(WithJournal(journalPath), WithResume())
+	for run, wantSkipped := range []bool{false, true} {
+		results, err := bp.ProcessBatch(context.Background(), items)
+		if err != nil {
+			t.Fatalf("ProcessBatch() error = %v", err)
+		}
+		for i, r := range results {
+			if !r.IsSuccess() || r.Skipped != wantSkipped {
+				t.Errorf("run %d result[%d]: success=%v skipped=%v, want skipped=%v", run, i, r.IsSuccess(), r.Skipped, wantSkipped)
+			}
+			if r.Result.Format != FormatPNG {
+				t.Errorf("run %d result[%d].Format = %v, want png", run, i, r.Result.Format)
+			}
+		}
+	}
+}
+
+func TestReadJournal_不正な行(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	if err := os.WriteFile(path, []byte("not json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadJournal(path); err == nil {
+		t.Error("ReadJournal() expected error for invalid line")
+	}
+}
@@ -1,11 +1,7 @@
 package processor
 
 import (
-	"bytes"
 	"context"
-	"fmt"
-	"image"
-	"image/jpeg"
 	"io"
 
 	// Register PNG decoder for Convert function
@@ -25,122 +21,12 @@ func NewJPEGProcessor() *JPEGProcessor {
 
 // Compress compresses a JPEG image.
 func (p *JPEGProcessor) Compress(ctx context.Context, r io.Reader, w io.Writer, opts CompressOptions) (*Result, error) {
-	if err := opts.Validate(); err != nil {
-		return nil, err
-	}
-
-	if err := checkContext(ctx); err != nil {
-		return nil, err
-	}
-
-	// Read all input data to calculate original size
-	inputData, err := readAllWithLimit(r, opts.MaxFileSize)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read input: %w", err)
-	}
-	originalSize := int64(len(inputData))
-
-	if err := checkContext(ctx); err != nil {
-		return nil, err
-	}
-
-	// Decode the image
-	img, _, err := image.Decode(bytes.NewReader(inputData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
-	}
-
-	if err := checkContext(ctx); err != nil {
-		return nil, err
-	}
-
-	// Determine quality
-	quality := opts.Quality
-	if quality == 0 {
-		// Use the compression level to derive JPEG quality when no explicit quality is provided.
-		quality = opts.Level.ToJPEGQuality()
-	} else {
-		// Clamp explicitly provided quality values to the valid JPEG range.
-		if quality < 1 {
-			quality = 1
-		}
-		if quality > 100 {
-			quality = 100
-		}
-	}
-
-	// Encode directly to output via countingWriter
-	cw := &countingWriter{w: w}
-	if err := jpeg.Encode(cw, img, &jpeg.Options{Quality: quality}); err != nil {
-		return nil, fmt.Errorf("failed to encode JPEG: %w", err)
-	}
-
-	return &Result{
-		OriginalSize:   originalSize,
-		CompressedSize: cw.n,
-		Format:         FormatJPEG,
-	}, nil
+	return runAs(ctx, "JPEGProcessor", FormatJPEG, r, w, CompressPipeline(FormatJPEG, opts))
 }
 
 // Convert converts an image to JPEG format.
 func (p *JPEGProcessor) Convert(ctx context.Context, r io.Reader, w io.Writer, opts ConvertOptions) (*Result, error) {
-	// Validate target format
-	if opts.Format != FormatJPEG {
-		return nil, fmt.Errorf("JPEGProcessor only supports conversion to JPEG, got %s", opts.Format)
-	}
-
-	if err := opts.Validate(); err != nil {
-		return nil, err
-	}
-
-	if err := checkContext(ctx); err != nil {
-		return nil, err
-	}
-
-	// Read all input data to calculate original size
-	inputData, err := readAllWithLimit(r, opts.MaxFileSize)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read input: %w", err)
-	}
-	originalSize := int64(len(inputData))
-
-	if err := checkContext(ctx); err != nil {
-		return nil, err
-	}
-
-	// Decode the image (supports multiple formats via registered decoders)
-	img, _, err := image.Decode(bytes.NewReader(inputData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
-	}
-
-	if err := checkContext(ctx); err != nil {
-		return nil, err
-	}
-
-	// Determine quality
-	quality := opts.Quality
-	if quality <= 0 {
-		quality = opts.Level.ToJPEGQuality()
-	}
-	if quality < 1 {
-		quality = 1
-	}
-	if quality > 100 {
-		quality = 100
-	}
-
-	// Encode directly to output via countingWriter
-	cw := &countingWriter{w: w}
-	if err := jpeg.Encode(cw, img, &jpeg.Options{Quality: quality}); err != nil {
-		return nil, fmt.Errorf("failed to encode JPEG: %w", err)
-	}
-
-	return &Result{
-		OriginalSize:   originalSize,
-		CompressedSize: cw.n,
-		Format:         FormatJPEG,
-	}, nil
+	return runAs(ctx, "JPEGProcessor", FormatJPEG, r, w, ConvertPipeline(opts))
 }
 
 // SupportedFormats returns the formats supported by this processor.
@@ -0,0 +1,235 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestVersion is the version of the manifest file format.
+const manifestVersion = 1
+
+// ManifestEntry records the state of an input when its output was last written.
+type ManifestEntry struct {
+	// InputPath is the path of the input image file.
+	InputPath string `json:"input"`
+
+	// OutputPath is the path of the output written from the input.
+	OutputPath string `json:"output"`
+
+	// Size is the size of the input in bytes.
+	Size int64 `json:"size"`
+
+	// ModTime is the modification time of the input.
+	ModTime time.Time `json:"mtime"`
+
+	// InputHash is the hex-encoded SHA-256 of the input file contents.
+	InputHash string `json:"input_sha256"`
+
+	// OptionsHash is the hex-encoded SHA-256 of the options that affect the
+	// output, as listed by optionsHash.
+	OptionsHash string `json:"options_sha256"`
+}
+
+// manifestFile is the on-disk representation of a Manifest.
+type manifestFile struct {
+	Version int             `json:"version"`
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// Manifest tracks the inputs and options of previous runs so that directory
+// scans can leave out items whose input and options have not changed.
+// Use WithManifest or WithConvertManifest to apply it to a scan, and Record
+// and Save after processing to update it. A Manifest is safe for concurrent use.
+type Manifest struct {
+	mu      sync.Mutex
+	entries map[string]ManifestEntry // keyed by output path
+	skipped []ManifestEntry
+}
+
+// NewManifest returns an empty manifest.
+func NewManifest() *Manifest {
+	return &Manifest{entries: make(map[string]ManifestEntry)}
+}
+
+// LoadManifest reads the manifest at path. A missing file yields an empty manifest.
+func LoadManifest(path string) (*Manifest, error) {
+	m := NewManifest()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var f manifestFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if f.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version: %d", f.Version)
+	}
+	for _, e := range f.Entries {
+		m.entries[e.OutputPath] = e
+	}
+	return m, nil
+}
+
+// Save writes the manifest to path. The file is replaced atomically so an
+// interrupted save leaves the previous manifest intact.
+func (m *Manifest) Save(path string) error {
+	m.mu.Lock()
+	f := manifestFile{Version: manifestVersion, Entries: make([]ManifestEntry, 0, len(m.entries))}
+	for _, e := range m.entries {
+		f.Entries = append(f.Entries, e)
+	}
+	m.mu.Unlock()
+	slices.SortFunc(f.Entries, func(a, b ManifestEntry) int { return strings.Compare(a.OutputPath, b.OutputPath) })
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Record stores the current state of inputPath after it has been written to
+// outputPath by p. inputHash is the hex-encoded SHA-256 of the input as it was
+// processed, such as BatchResult.InputHash; when it is empty the file is
+// hashed now. Call it only for items that were processed successfully.
+func (m *Manifest) Record(inputPath, outputPath, inputHash string, p Pipeline) error {
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to access input file: %w", err)
+	}
+	hash := inputHash
+	if hash == "" {
+		if hash, err = hashFile(context.Background(), LocalStorage{}, inputPath); err != nil {
+			return err
+		}
+	}
+	optsHash := optionsHash(p)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[outputPath] = ManifestEntry{
+		InputPath:   inputPath,
+		OutputPath:  outputPath,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		InputHash:   hash,
+		OptionsHash: optsHash,
+	}
+	return nil
+}
+
+// Unchanged reports whether outputPath exists and was written from the
+// current contents of inputPath by an equivalent p. For optimize pipelines
+// outputPath has no extension and an output in any format counts. The size and modification
+// time are compared first; the content hash is only computed when the size
+// matches but the time differs, e.g. after a fresh checkout.
+func (m *Manifest) Unchanged(inputPath, outputPath string, p Pipeline) bool {
+	m.mu.Lock()
+	e, ok := m.entries[outputPath]
+	m.mu.Unlock()
+	if !ok || e.InputPath != inputPath {
+		return false
+	}
+	if optionsHash(p) != e.OptionsHash {
+		return false
+	}
+	if !p.outputExists(context.Background(), LocalStorage{}, outputPath) {
+		return false
+	}
+	info, err := os.Stat(inputPath)
+	if err != nil || info.Size() != e.Size {
+		return false
+	}
+	if info.ModTime().Equal(e.ModTime) {
+		return true
+	}
+	hash, err := hashFile(context.Background(), LocalStorage{}, inputPath)
+	if err != nil || hash != e.InputHash {
+		return false
+	}
+
+	// Remember the new time so the next run can skip hashing.
+	m.mu.Lock()
+	e.ModTime = info.ModTime()
+	m.entries[outputPath] = e
+	m.mu.Unlock()
+	return true
+}
+
+// Skipped returns the number of items left out by scans using this manifest.
+func (m *Manifest) Skipped() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.skipped)
+}
+
+// SkippedEntries returns the recorded entries of the items left out by scans
+// using this manifest, in the order they were scanned.
+func (m *Manifest) SkippedEntries() []ManifestEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.skipped)
+}
+
+// skip reports whether a scanned item is unchanged and counts it if so.
+// A nil manifest never skips.
+func (m *Manifest) skip(inputPath, outputPath string, p Pipeline) bool {
+	if m == nil || !m.Unchanged(inputPath, outputPath, p) {
+		return false
+	}
+	m.mu.Lock()
+	m.skipped = append(m.skipped, m.entries[outputPath])
+	m.mu.Unlock()
+	return true
+}
+
+// optionsHashVersion identifies the list of fields hashed by optionsHash.
+// Bump it whenever a field that affects the output is added, so that outputs
+// recorded with the old list are written again.
+const optionsHashVersion = 1
+
+// optionsHash returns the hex-encoded SHA-256 of the fields of p that affect
+// the output. Fields that only guard the input, such as MaxFileSize, are left
+// out so that changing them does not invalidate previous outputs. Optimize is
+// only hashed when set, since no output recorded before it existed used it.
+func optionsHash(p Pipeline) string {
+	o := p.Options
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "v%d\nformat=%s\nall_pages=%t\nquality=%d\nlevel=%d\npreserve_metadata=%t\n",
+		optionsHashVersion, p.Format, p.AllPages, o.Quality, o.Level, o.PreserveMetadata)
+	_, _ = fmt.Fprintf(h, "convert_to_srgb=%t\ndither_to_8bit=%t\npage=%d\nposter=%t\n",
+		o.ConvertToSRGB, o.DitherTo8Bit, o.Page, o.Poster)
+	_, _ = fmt.Fprintf(h, "width=%d\nheight=%d\ndpi=%g\nlossless=%t\n",
+		o.Width, o.Height, o.DPI, o.Lossless)
+	if p.Optimize {
+		_, _ = fmt.Fprint(h, "optimize=true\n")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
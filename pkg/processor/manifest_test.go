@@ -0,0 +1,265 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// runIncremental scans inputDir with m, processes the items and records them in m.
+func runIncremental(t *testing.T, inputDir, outputDir string, m *Manifest, opts CompressOptions) []BatchItem {
+	t.Helper()
+	items, err := ScanDirectory(inputDir, outputDir, WithCompressOptions(opts), WithManifest(m))
+	if err != nil {
+		t.Fatalf("ScanDirectory() error = %v", err)
+	}
+	results, err := NewDefaultBatchProcessor().ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	for _, r := range results {
+		if !r.IsSuccess() {
+			t.Fatalf("%s: %v", r.Item.InputPath, r.Error)
+		}
+		pl, err := r.Item.Pipeline()
+		if err != nil {
+			t.Fatalf("Pipeline() error = %v", err)
+		}
+		if err := m.Record(r.Item.InputPath, r.Item.OutputPath, r.InputHash, pl); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	return items
+}
+
+func TestScanDirectory_インクリメンタル(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	manifestPath := filepath.Join(outputDir, "manifest.json")
+	a := writeTestFile(t, inputDir, "a.jpg", createTestJPEG(t, 32, 32, 90))
+	writeTestFile(t, inputDir, "b.jpg", createTestJPEG(t, 32, 32, 90))
+	writeTestFile(t, inputDir, "sub/c.png", createTestPNG(t, 32, 32))
+	opts := DefaultCompressOptions()
+
+	m, err := LoadManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("LoadManifest() error = %v", err)
+	}
+	if items := runIncremental(t, inputDir, outputDir, m, opts); len(items) != 3 {
+		t.Fatalf("first run scanned %d items, want 3", len(items))
+	}
+	if err := m.Save(manifestPath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(t *testing.T)
+		opts        CompressOptions
+		wantItems   int
+		wantSkipped int
+	}{
+		{
+			name:        "変更なし",
+			modify:      func(t *testing.T) {},
+			opts:        opts,
+			wantItems:   0,
+			wantSkipped: 3,
+		},
+		{
+			name: "mtimeのみ変更は内容ハッシュで判定",
+			modify: func(t *testing.T) {
+				future := time.Now().Add(time.Hour)
+				if err := os.Chtimes(a, future, future); err != nil {
+					t.Fatal(err)
+				}
+			},
+			opts:        opts,
+			wantItems:   0,
+			wantSkipped: 3,
+		},
+		{
+			name: "内容の変更",
+			modify: func(t *testing.T) {
+				if err := os.WriteFile(a, createTestJPEG(t, 48, 48, 90), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			opts:        opts,
+			wantItems:   1,
+			wantSkipped: 2,
+		},
+		{
+			name: "出力の削除",
+			modify: func(t *testing.T) {
+				if err := os.Remove(filepath.Join(outputDir, "sub", "c.png")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			opts:        opts,
+			wantItems:   1,
+			wantSkipped: 2,
+		},
+		{
+			name:        "オプションの変更",
+			modify:      func(t *testing.T) {},
+			opts:        CompressOptions{Quality: 50, Level: CompressionHigh},
+			wantItems:   3,
+			wantSkipped: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.modify(t)
+			m, err := LoadManifest(manifestPath)
+			if err != nil {
+				t.Fatalf("LoadManifest() error = %v", err)
+			}
+			items := runIncremental(t, inputDir, outputDir, m, tt.opts)
+			if len(items) != tt.wantItems {
+				t.Errorf("scanned %d items, want %d", len(items), tt.wantItems)
+			}
+			if m.Skipped() != tt.wantSkipped {
+				t.Errorf("Skipped() = %d, want %d", m.Skipped(), tt.wantSkipped)
+			}
+			if err := m.Save(manifestPath); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestScanDirectoryForConvert_インクリメンタル(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, inputDir, "a.jpg", createTestJPEG(t, 32, 32, 90))
+	writeTestFile(t, inputDir, "b.png", createTestPNG(t, 32, 32))
+
+	m := NewManifest()
+	for run, want := range []int{2, 0} {
+		items, err := ScanDirectoryForConvert(inputDir, outputDir, FormatWEBP, WithConvertManifest(m))
+		if err != nil {
+			t.Fatalf("ScanDirectoryForConvert() error = %v", err)
+		}
+		if len(items) != want {
+			t.Fatalf("run %d scanned %d items, want %d", run, len(items), want)
+		}
+		results, err := NewDefaultBatchProcessor().ProcessBatch(context.Background(), items)
+		if err != nil {
+			t.Fatalf("ProcessBatch() error = %v", err)
+		}
+		for _, r := range results {
+			if err := m.Record(r.Item.InputPath, r.Item.OutputPath, r.InputHash, ConvertPipeline(r.Item.ConvertOptions())); err != nil {
+				t.Fatalf("Record() error = %v", err)
+			}
+		}
+	}
+	if m.Skipped() != 2 {
+		t.Errorf("Skipped() = %d, want 2", m.Skipped())
+	}
+
+	// A different target format writes to other outputs, so nothing is skipped.
+	items, err := ScanDirectoryForConvert(inputDir, outputDir, FormatGIF, WithConvertManifest(m))
+	if err != nil {
+		t.Fatalf("ScanDirectoryForConvert() error = %v", err)
+	}
+	if len(items) != 2 {
+		t.Errorf("scanned %d items for gif, want 2", len(items))
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "空のマニフェスト", data: `{"version":1,"entries":[]}`},
+		{name: "不正なJSON", data: `{`, wantErr: true},
+		{name: "未対応のバージョン", data: `{"version":99,"entries":[]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "manifest.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadManifest(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("存在しないファイル", func(t *testing.T) {
+		m, err := LoadManifest(filepath.Join(dir, "missing.json"))
+		if err != nil || m == nil {
+			t.Errorf("LoadManifest() = %v, %v; want empty manifest", m, err)
+		}
+	})
+}
+
+func TestOptionsHash(t *testing.T) {
+	base := CompressPipeline(FormatJPEG, DefaultCompressOptions())
+	limited := base
+	limited.Options.MaxFileSize = 1 << 20
+	if optionsHash(limited) != optionsHash(base) {
+		t.Error("MaxFileSize changed the options hash")
+	}
+
+	for name, modify := range map[string]func(*Pipeline){
+		"format":    func(p *Pipeline) { p.Format = FormatPNG },
+		"all pages": func(p *Pipeline) { p.AllPages = false },
+		"quality":   func(p *Pipeline) { p.Options.Quality = 50 },
+		"level":     func(p *Pipeline) { p.Options.Level = CompressionHigh },
+		"page":      func(p *Pipeline) { p.Options.Page = 1 },
+		"width":     func(p *Pipeline) { p.Options.Width = 10 },
+		"dpi":       func(p *Pipeline) { p.Options.DPI = 300 },
+		"lossless":  func(p *Pipeline) { p.Options.Lossless = true },
+		"optimize":  func(p *Pipeline) { p.Optimize = true },
+	} {
+		p := base
+		modify(&p)
+		if optionsHash(p) == optionsHash(base) {
+			t.Errorf("%s did not change the options hash", name)
+		}
+	}
+}
+
+func TestDefaultBatchProcessor_InputHashes(t *testing.T) {
+	items := journalTestItems(t, 2)
+	data, err := os.ReadFile(items[0].InputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	items[1].OutputPath = items[1].InputPath
+
+	results, err := NewDefaultBatchProcessor(WithInputHashes()).ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	if got := results[0].InputHash; got != hex.EncodeToString(sum[:]) {
+		t.Errorf("InputHash = %q, want SHA-256 of the input", got)
+	}
+	// An item processed in place is recorded with the hash of its new contents.
+	if want, _ := hashFile(context.Background(), LocalStorage{}, items[1].OutputPath); results[1].InputHash != want {
+		t.Errorf("in-place InputHash = %q, want %q", results[1].InputHash, want)
+	}
+
+	results, err = NewDefaultBatchProcessor().ProcessBatch(context.Background(), items[:1])
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	if results[0].InputHash != "" {
+		t.Errorf("InputHash = %q without WithInputHashes, want empty", results[0].InputHash)
+	}
+}
@@ -0,0 +1,203 @@
+package processor
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"image"
+	"image/color"
+	"io"
+	"sync"
+)
+
+// WithMemoryBudget limits the estimated memory of the items processed at the
+// same time to budget bytes. Each item is weighted by the decoded size of its
+// input, read from the image header and the item's options (see
+// estimateMemory); an item larger than the budget runs alone. Items still
+// never exceed the workers set by WithMaxWorkers. A budget of 0 or less
+// disables the limit.
+func WithMemoryBudget(budget int64) BatchProcessorOption {
+	return func(bp *DefaultBatchProcessor) {
+		bp.memoryBudget = budget
+	}
+}
+
+// memoryOverhead is the number of decoded copies assumed to be alive at once:
+// the decoded image plus a converted or resized copy handed to the encoder.
+const memoryOverhead = 2
+
+// estimateHeaderSize is how much of a file estimateMemory reads, enough for
+// the header of every supported format.
+const estimateHeaderSize = 64 << 10
+
+// estimateMemory estimates the peak memory needed to run p on the image at
+// path in s. The size is that of the decoded image, i.e. the target size of
+// an SVG, times the number of frames or pages that p keeps in memory: every
+// frame of an animation that stays animated, the frames up to the selected
+// one otherwise, and every TIFF page with AllPages. Optimize pipelines keep
+// animations like animated formats. Inputs whose size cannot be read
+// (unsupported or broken files) are weighted by their file size.
+//
+// Only the first estimateHeaderSize bytes are read, fetched as a range from a
+// RangeStorage, so frames and pages stored past them are not counted.
+func estimateMemory(ctx context.Context, s Storage, path string, p Pipeline) int64 {
+	var (
+		f   io.ReadCloser
+		err error
+	)
+	if rs, ok := s.(RangeStorage); ok {
+		f, err = rs.OpenRange(ctx, path, 0, estimateHeaderSize)
+	} else {
+		f, err = s.Open(ctx, path)
+	}
+	if err != nil {
+		return 0
+	}
+	defer func() { _ = f.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(f, estimateHeaderSize))
+	if err != nil {
+		return statSize(ctx, s, path)
+	}
+	size, err := decodedSize(data, p.Options)
+	if err != nil {
+		return statSize(ctx, s, path)
+	}
+
+	bytesPerPixel := int64(4)
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		switch cfg.ColorModel {
+		case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+			bytesPerPixel = 8
+		}
+	}
+
+	images := max(frameCount(data), 1)
+	if !(encoders[p.Format].animated || p.Optimize) || p.Options.Poster {
+		images = min(images, p.Options.Page+1)
+	}
+	if p.AllPages && encoders[p.Format].multiPage && isTIFF(data) {
+		if pages, err := tiffPageCount(data); err == nil {
+			images = max(pages, 1)
+		}
+	}
+	return int64(size.X) * int64(size.Y) * bytesPerPixel * int64(images) * memoryOverhead
+}
+
+// statSize returns the size of the file at path in s, or 0 if it cannot be read.
+func statSize(ctx context.Context, s Storage, path string) int64 {
+	info, err := s.Stat(ctx, path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// memorySemaphore is a weighted semaphore admitting items in FIFO order, so
+// that a large item waiting for memory is not starved by smaller ones.
+type memorySemaphore struct {
+	mu      sync.Mutex
+	size    int64
+	cur     int64
+	waiters list.List
+}
+
+type memoryWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// newMemorySemaphore returns a semaphore of size bytes, or nil if size is not positive.
+func newMemorySemaphore(size int64) *memorySemaphore {
+	if size <= 0 {
+		return nil
+	}
+	return &memorySemaphore{size: size}
+}
+
+// weight clamps n to the semaphore size so that oversized items run alone.
+func (s *memorySemaphore) weight(n int64) int64 {
+	return min(max(n, 1), s.size)
+}
+
+// acquire blocks until n bytes are available or ctx is done. s may be nil, in
+// which case acquire returns immediately.
+func (s *memorySemaphore) acquire(ctx context.Context, n int64) error {
+	if s == nil {
+		return nil
+	}
+	n = s.weight(n)
+
+	s.mu.Lock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		return nil
+	}
+	w := memoryWaiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// Acquired just after cancellation: give the memory back.
+			s.cur -= n
+			s.notify()
+		default:
+			isFront := s.waiters.Front() == elem
+			s.waiters.Remove(elem)
+			if isFront {
+				s.notify()
+			}
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// release returns n bytes taken by acquire. s may be nil.
+func (s *memorySemaphore) release(n int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.cur -= s.weight(n)
+	s.notify()
+	s.mu.Unlock()
+}
+
+// notify wakes the waiters at the front of the queue that now fit. s.mu must be held.
+func (s *memorySemaphore) notify() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+		w := front.Value.(memoryWaiter)
+		if s.size-s.cur < w.n {
+			return
+		}
+		s.cur += w.n
+		s.waiters.Remove(front)
+		close(w.ready)
+	}
+}
+
+// admit runs fn once the estimated memory of running p on the image at path
+// fits into sem. sem may be nil, in which case fn runs immediately.
+func admit(ctx context.Context, sem *memorySemaphore, s Storage, path string, p Pipeline, fn func() (*Result, error)) (*Result, error) {
+	if sem == nil {
+		return fn()
+	}
+	n := estimateMemory(ctx, s, path, p)
+	if err := sem.acquire(ctx, n); err != nil {
+		return nil, err
+	}
+	defer sem.release(n)
+	return fn()
+}
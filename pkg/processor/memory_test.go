@@ -0,0 +1,163 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEstimateMemory(t *testing.T) {
+	dir := t.TempDir()
+
+	var png16 bytes.Buffer
+	if err := png.Encode(&png16, image.NewNRGBA64(image.Rect(0, 0, 10, 10))); err != nil {
+		t.Fatal(err)
+	}
+
+	padded := append(createTestJPEG(t, 40, 20, 80), make([]byte, 2*estimateHeaderSize)...)
+	garbage := bytes.Repeat([]byte("x"), 2*estimateHeaderSize)
+
+	gif := createTestGIF(t, 8, 8)
+	frames := int64(len(testFrameColors))
+
+	tests := []struct {
+		name string
+		data []byte
+		p    Pipeline
+		want int64
+	}{
+		{name: "jpeg", data: createTestJPEG(t, 40, 20, 80), p: CompressPipeline(FormatJPEG, CompressOptions{}), want: 40 * 20 * 4 * memoryOverhead},
+		{name: "16-bit png", data: png16.Bytes(), p: CompressPipeline(FormatPNG, CompressOptions{}), want: 10 * 10 * 8 * memoryOverhead},
+		{name: "animation", data: gif, p: CompressPipeline(FormatGIF, CompressOptions{}), want: 8 * 8 * 4 * frames * memoryOverhead},
+		{name: "poster", data: gif, p: ConvertPipeline(ConvertOptions{Format: FormatPNG, CompressOptions: CompressOptions{Poster: true, Page: 1}}), want: 8 * 8 * 4 * 2 * memoryOverhead},
+		{name: "animation to jpeg", data: gif, p: ConvertPipeline(ConvertOptions{Format: FormatJPEG}), want: 8 * 8 * 4 * memoryOverhead},
+		{name: "svg target size", data: []byte(testSVG), p: ConvertPipeline(ConvertOptions{Format: FormatPNG, CompressOptions: CompressOptions{Width: 400}}), want: 400 * 200 * 4 * memoryOverhead},
+		{name: "svg dpi", data: []byte(testSVG), p: ConvertPipeline(ConvertOptions{Format: FormatPNG, CompressOptions: CompressOptions{DPI: 192}}), want: 200 * 100 * 4 * memoryOverhead},
+		{name: "unreadable header", data: []byte("not an image"), p: CompressPipeline(FormatJPEG, CompressOptions{}), want: int64(len("not an image"))},
+		{name: "header of large file", data: padded, p: CompressPipeline(FormatJPEG, CompressOptions{}), want: 40 * 20 * 4 * memoryOverhead},
+		{name: "large unreadable file", data: garbage, p: CompressPipeline(FormatJPEG, CompressOptions{}), want: int64(len(garbage))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, dir, tt.name, tt.data)
+			if got := estimateMemory(context.Background(), LocalStorage{}, path, tt.p); got != tt.want {
+				t.Errorf("estimateMemory() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if got := estimateMemory(context.Background(), LocalStorage{}, filepath.Join(dir, "missing.jpg"), CompressPipeline(FormatJPEG, CompressOptions{})); got != 0 {
+		t.Errorf("estimateMemory(missing) = %d, want 0", got)
+	}
+}
+
+// acquired reports whether acquire(n) succeeds within a short time.
+func acquired(s *memorySemaphore, n int64) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	return s.acquire(ctx, n) == nil
+}
+
+func TestMemorySemaphore(t *testing.T) {
+	t.Run("small items share the budget", func(t *testing.T) {
+		s := newMemorySemaphore(100)
+		for i := range 4 {
+			if !acquired(s, 25) {
+				t.Fatalf("acquire #%d blocked, want 4 items of 25 to fit into 100", i)
+			}
+		}
+		if acquired(s, 1) {
+			t.Error("acquire succeeded on a full budget")
+		}
+	})
+
+	t.Run("oversized item runs alone", func(t *testing.T) {
+		s := newMemorySemaphore(100)
+		if !acquired(s, 1000) {
+			t.Fatal("oversized item blocked on an empty budget")
+		}
+		if acquired(s, 1) {
+			t.Error("acquire succeeded while an oversized item is running")
+		}
+		s.release(1000)
+		if !acquired(s, 100) {
+			t.Error("budget was not fully released")
+		}
+	})
+
+	t.Run("waiters are admitted in order", func(t *testing.T) {
+		s := newMemorySemaphore(100)
+		if !acquired(s, 60) {
+			t.Fatal("first acquire blocked")
+		}
+		large := make(chan error, 1)
+		go func() { large <- s.acquire(context.Background(), 80) }()
+		time.Sleep(10 * time.Millisecond)
+
+		// A small item that would fit must not overtake the waiting large one.
+		if acquired(s, 10) {
+			t.Error("small item overtook a waiting large item")
+		}
+		s.release(60)
+		if err := <-large; err != nil {
+			t.Fatalf("large acquire error = %v", err)
+		}
+	})
+
+	t.Run("cancelled waiter", func(t *testing.T) {
+		s := newMemorySemaphore(100)
+		if !acquired(s, 100) {
+			t.Fatal("first acquire blocked")
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := s.acquire(ctx, 50); !errors.Is(err, context.Canceled) {
+			t.Errorf("acquire() error = %v, want context.Canceled", err)
+		}
+		s.release(100)
+		if !acquired(s, 100) {
+			t.Error("cancelled waiter kept part of the budget")
+		}
+	})
+
+	t.Run("nil semaphore", func(t *testing.T) {
+		var s *memorySemaphore
+		if !acquired(s, 1<<40) {
+			t.Error("nil semaphore blocked")
+		}
+		s.release(1 << 40)
+	})
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_メモリ予算(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	jpegData := createTestJPEG(t, 50, 50, 90)
+
+	var items []BatchItem
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"} {
+		items = append(items, BatchItem{
+			InputPath:  writeTestFile(t, inputDir, name, jpegData),
+			OutputPath: filepath.Join(outputDir, name),
+			Options:    DefaultCompressOptions(),
+		})
+	}
+
+	// A budget smaller than one image forces every item to run alone.
+	bp := NewDefaultBatchProcessor(WithMaxWorkers(4), WithMemoryBudget(1))
+	results, err := bp.ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	for i, r := range results {
+		if !r.IsSuccess() {
+			t.Errorf("result[%d] error = %v", i, r.Error)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"slices"
+	"time"
+)
+
+// Candidate is one encoding tried by Optimize.
+type Candidate struct {
+	// Format is the output format of the encoding.
+	Format ImageFormat
+	// Lossless reports whether the encoding keeps every pixel of the input.
+	Lossless bool
+	// Size is the encoded size in bytes.
+	Size int64
+	// Original reports whether the candidate is the input itself, which
+	// Optimize keeps when no encoding is smaller. It is only listed when kept.
+	Original bool
+}
+
+// Optimize reads an image from r, encodes it as JPEG, WebP and PNG with the
+// same options and writes the smallest encoding to w. The Result's Format is
+// the chosen format and Candidates holds the size of every encoding tried.
+//
+// Images stored without loss, such as screenshots and line art saved as PNG,
+// GIF, BMP, TIFF, SVG or lossless WebP, are only tried as PNG and lossless
+// WebP so that no compression artifacts are added. Raster images among them
+// with more than photoColors distinct colors are treated as photos and also
+// tried with lossy encodings. opts.Lossless restricts the candidates to
+// lossless encodings. JPEG is skipped for images with transparency and for
+// animations, which are kept as APNG or animated WebP unless Poster is set.
+// Multi-page input is reduced to the page selected by opts.Page.
+//
+// A JPEG, PNG, WebP or GIF input is written unchanged when no encoding is
+// smaller and opts do not select a page or change its pixels; the Result's
+// Format is then that of the input and Candidates ends with the input, marked
+// Original.
+func Optimize(ctx context.Context, r io.Reader, w io.Writer, opts CompressOptions) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	inputData, err := readAllWithLimit(r, opts.MaxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	var st Stats
+	anim, img, err := decodeAnimated(inputData, opts, &st)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	src := decoded{anim: anim, pages: []image.Image{img}}
+
+	candidates := optimizeCandidates(inputData, src)
+	if opts.Lossless {
+		candidates = slices.DeleteFunc(candidates, func(c Candidate) bool { return !c.Lossless })
+	}
+	chosen := -1
+	best, buf := new(bytes.Buffer), new(bytes.Buffer)
+	for i := range candidates {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+
+		c := &candidates[i]
+		enc := encoders[c.Format]
+		candidateOpts := opts
+		candidateOpts.Lossless = c.Lossless
+
+		buf.Reset()
+		encodeStart := time.Now()
+		if err := enc.encode(buf, src, candidateOpts); err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", enc.name, err)
+		}
+		st.addEncode(encodeStart)
+
+		c.Size = int64(buf.Len())
+		if chosen < 0 || c.Size < candidates[chosen].Size {
+			chosen = i
+			best, buf = buf, best
+		}
+	}
+
+	output, format := best.Bytes(), candidates[chosen].Format
+	if original, ok := keepableOriginal(inputData, opts); ok && int64(len(inputData)) <= candidates[chosen].Size {
+		output, format = inputData, original
+		candidates = append(candidates, Candidate{Format: original, Size: int64(len(inputData)), Original: true})
+	}
+	if _, err := w.Write(output); err != nil {
+		return nil, fmt.Errorf("failed to write output: %w", err)
+	}
+
+	return &Result{
+		OriginalSize:   int64(len(inputData)),
+		CompressedSize: int64(len(output)),
+		Format:         format,
+		Stats:          st,
+		Candidates:     candidates,
+	}, nil
+}
+
+// keepableOriginal returns the format of data if Optimize may write it
+// unchanged: it is in a format Optimize could choose or serve as is, and
+// opts neither select a page or frame nor change the pixels.
+func keepableOriginal(data []byte, opts CompressOptions) (ImageFormat, bool) {
+	if opts.Page != 0 || opts.Poster || opts.ConvertToSRGB || opts.DitherTo8Bit {
+		return 0, false
+	}
+	format, err := DetectFormat(data)
+	if err != nil {
+		return 0, false
+	}
+	switch format {
+	case FormatJPEG, FormatPNG, FormatWEBP, FormatGIF:
+		return format, true
+	default:
+		return 0, false
+	}
+}
+
+// keptOriginal reports whether res is the result of Optimize writing its
+// input unchanged.
+func keptOriginal(res *Result) bool {
+	return len(res.Candidates) > 0 && res.Candidates[len(res.Candidates)-1].Original
+}
+
+// optimizeCandidates returns the encodings Optimize tries for src, decoded
+// from data.
+func optimizeCandidates(data []byte, src decoded) []Candidate {
+	if isLosslessSource(data) && !isPhoto(data, src) {
+		return []Candidate{
+			{Format: FormatPNG, Lossless: true},
+			{Format: FormatWEBP, Lossless: true},
+		}
+	}
+	var candidates []Candidate
+	if src.anim == nil && isOpaque(src.pages[0]) {
+		candidates = append(candidates, Candidate{Format: FormatJPEG})
+	}
+	return append(candidates,
+		Candidate{Format: FormatWEBP},
+		Candidate{Format: FormatPNG, Lossless: true},
+	)
+}
+
+// isLosslessSource reports whether data holds an image stored without loss.
+func isLosslessSource(data []byte) bool {
+	format, err := DetectFormat(data)
+	if err != nil {
+		return false
+	}
+	switch format {
+	case FormatPNG, FormatGIF, FormatBMP, FormatTIFF, FormatSVG:
+		return true
+	case FormatWEBP:
+		return isLosslessWebP(data)
+	default:
+		return false
+	}
+}
+
+// photoColors is the number of distinct colors above which isPhoto treats an
+// image as a photo. Screenshots, line art and diagrams stay well below it,
+// while photos of a few hundred pixels per side already exceed it.
+const photoColors = 1 << 14
+
+// isPhoto reports whether src, decoded from data, looks like a photo stored
+// without loss: a raster image with more than photoColors distinct colors in
+// its decoded page or first animation frame. SVG input is never a photo.
+func isPhoto(data []byte, src decoded) bool {
+	if format, err := DetectFormat(data); err != nil || format == FormatSVG {
+		return false
+	}
+	img := src.pages[0]
+	if src.anim != nil {
+		img = src.anim.Frames[0].Image
+	}
+	b := img.Bounds()
+	if b.Dx()*b.Dy() <= photoColors {
+		return false
+	}
+	n := toNRGBA(img)
+	colors := make(map[uint32]struct{}, photoColors+1)
+	for y := range b.Dy() {
+		row := n.Pix[y*n.Stride : y*n.Stride+b.Dx()*4]
+		for i := 0; i < len(row); i += 4 {
+			colors[binary.LittleEndian.Uint32(row[i:])] = struct{}{}
+			if len(colors) > photoColors {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isLosslessWebP reports whether the WebP image in data is stored as VP8L.
+// Animations are judged by their first frame.
+func isLosslessWebP(data []byte) bool {
+	body, ok := webpBody(data)
+	if !ok {
+		return false
+	}
+	chunks, err := readRIFFChunks(body)
+	if err != nil {
+		return false
+	}
+	for _, c := range chunks {
+		switch c.fourCC {
+		case "VP8L":
+			return true
+		case "VP8 ":
+			return false
+		case "ANMF":
+			// Frame data follows the 16-byte ANMF header.
+			if len(c.data) <= 16 {
+				return false
+			}
+			frame, err := readRIFFChunks(c.data[16:])
+			if err != nil {
+				return false
+			}
+			for _, fc := range frame {
+				if fc.fourCC == "VP8L" || fc.fourCC == "VP8 " {
+					return fc.fourCC == "VP8L"
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// isOpaque reports whether every pixel of img is fully opaque.
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return toNRGBA(img).Opaque()
+}
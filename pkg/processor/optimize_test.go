@@ -0,0 +1,298 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/bmp"
+)
+
+func TestOptimize_LossySource(t *testing.T) {
+	input := createTestJPEG(t, 128, 96, 85)
+	var buf bytes.Buffer
+	result, err := Optimize(context.Background(), bytes.NewReader(input), &buf, CompressOptions{Quality: 75})
+	if err != nil {
+		t.Fatalf("Optimize() error = %v", err)
+	}
+
+	want := []ImageFormat{FormatJPEG, FormatWEBP, FormatPNG}
+	if len(result.Candidates) != len(want) {
+		t.Fatalf("Candidates = %+v, want formats %v", result.Candidates, want)
+	}
+	smallest := result.Candidates[0]
+	for i, c := range result.Candidates {
+		if c.Format != want[i] {
+			t.Errorf("Candidates[%d].Format = %v, want %v", i, c.Format, want[i])
+		}
+		if c.Size <= 0 {
+			t.Errorf("Candidates[%d].Size = %d, want > 0", i, c.Size)
+		}
+		if c.Size < smallest.Size {
+			smallest = c
+		}
+	}
+	if result.Format != smallest.Format || result.CompressedSize != smallest.Size {
+		t.Errorf("chose %v (%d bytes), want smallest %v (%d bytes)", result.Format, result.CompressedSize, smallest.Format, smallest.Size)
+	}
+	if result.Format == FormatPNG {
+		t.Errorf("a photo should not be kept as PNG: %+v", result.Candidates)
+	}
+	if int64(buf.Len()) != result.CompressedSize || result.OriginalSize != int64(len(input)) {
+		t.Errorf("sizes = %d/%d, wrote %d bytes from %d", result.OriginalSize, result.CompressedSize, buf.Len(), len(input))
+	}
+	if got, err := DetectFormat(buf.Bytes()); err != nil || got != result.Format {
+		t.Errorf("output format = %v (%v), want %v", got, err, result.Format)
+	}
+}
+
+func TestOptimize_LosslessSource(t *testing.T) {
+	input := createTestPNG(t, 64, 64)
+	var buf bytes.Buffer
+	result, err := Optimize(context.Background(), bytes.NewReader(input), &buf, CompressOptions{Quality: 10})
+	if err != nil {
+		t.Fatalf("Optimize() error = %v", err)
+	}
+
+	for _, c := range result.Candidates {
+		if !c.Lossless || c.Format == FormatJPEG {
+			t.Errorf("lossless source tried a lossy candidate: %+v", result.Candidates)
+		}
+	}
+	if len(result.Candidates) != 2 {
+		t.Errorf("Candidates = %+v, want PNG and lossless WebP", result.Candidates)
+	}
+
+	c, err := Compare(bytes.NewReader(input), &buf)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	if !c.Identical() {
+		t.Errorf("output of a lossless source differs from the input: max error %d", c.MaxError)
+	}
+}
+
+func TestOptimize_LosslessWebPSource(t *testing.T) {
+	var src bytes.Buffer
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	if err := webp.Encode(&src, img, &webp.Options{Lossless: true}); err != nil {
+		t.Fatalf("webp.Encode() error = %v", err)
+	}
+	if !isLosslessSource(src.Bytes()) {
+		t.Error("isLosslessSource(lossless WebP) = false, want true")
+	}
+	if isLosslessSource(createTestWEBP(t, 16, 16, 80)) {
+		t.Error("isLosslessSource(lossy WebP) = true, want false")
+	}
+}
+
+func TestOptimize_Animation(t *testing.T) {
+	var buf bytes.Buffer
+	result, err := Optimize(context.Background(), bytes.NewReader(createTestGIF(t, 8, 8)), &buf, CompressOptions{})
+	if err != nil {
+		t.Fatalf("Optimize() error = %v", err)
+	}
+	if result.Format != FormatPNG && result.Format != FormatWEBP && !keptOriginal(result) {
+		t.Fatalf("Format = %v, want PNG, WebP or the original GIF", result.Format)
+	}
+	anim, err := decodeAnimation(buf.Bytes(), 0)
+	if err != nil || anim == nil {
+		t.Fatalf("decodeAnimation() = %v, %v", anim, err)
+	}
+	assertTestAnimation(t, anim, 0)
+}
+
+func TestOptimizeCandidates_Transparency(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 128})
+	for _, c := range optimizeCandidates(createTestJPEG(t, 4, 4, 90), decoded{pages: []image.Image{img}}) {
+		if c.Format == FormatJPEG {
+			t.Error("JPEG must not be tried for an image with transparency")
+		}
+	}
+}
+
+func TestOptimize_Errors(t *testing.T) {
+	if _, err := Optimize(context.Background(), bytes.NewReader([]byte("not an image")), &bytes.Buffer{}, CompressOptions{}); err == nil {
+		t.Error("Optimize(invalid data) error = nil, want error")
+	}
+
+	input := createTestPNG(t, 16, 16)
+	_, err := Optimize(context.Background(), bytes.NewReader(input), &bytes.Buffer{}, CompressOptions{MaxFileSize: 10})
+	if !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Optimize(too large) error = %v, want ErrFileTooLarge", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Optimize(ctx, bytes.NewReader(input), &bytes.Buffer{}, CompressOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Optimize(canceled) error = %v, want context.Canceled", err)
+	}
+}
+
+// createPhotoPNG returns a PNG of random pixels, with as many distinct colors
+// as a photo.
+func createPhotoPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = uint8(rng.Uint32()), uint8(rng.Uint32()), uint8(rng.Uint32()), 255
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestOptimize_PhotoPNG(t *testing.T) {
+	input := createPhotoPNG(t, 256, 256)
+	var buf bytes.Buffer
+	result, err := Optimize(context.Background(), bytes.NewReader(input), &buf, CompressOptions{Quality: 75})
+	if err != nil {
+		t.Fatalf("Optimize() error = %v", err)
+	}
+	var lossy bool
+	for _, c := range result.Candidates {
+		lossy = lossy || !c.Lossless
+	}
+	if !lossy {
+		t.Errorf("a photo stored as PNG was only tried losslessly: %+v", result.Candidates)
+	}
+	if isPhoto(createTestPNG(t, 64, 64), decoded{pages: []image.Image{image.NewNRGBA(image.Rect(0, 0, 64, 64))}}) {
+		t.Error("isPhoto(small image) = true, want false")
+	}
+}
+
+func TestOptimize_Lossless(t *testing.T) {
+	var buf bytes.Buffer
+	result, err := Optimize(context.Background(), bytes.NewReader(createTestJPEG(t, 32, 32, 90)), &buf, CompressOptions{Lossless: true})
+	if err != nil {
+		t.Fatalf("Optimize() error = %v", err)
+	}
+	for _, c := range result.Candidates {
+		if !c.Lossless && !c.Original {
+			t.Errorf("Lossless tried a lossy candidate: %+v", result.Candidates)
+		}
+	}
+}
+
+func TestOptimize_KeepsOriginal(t *testing.T) {
+	// A tiny GIF is smaller than any re-encoding of it.
+	input := createTestGIF(t, 8, 8)
+	var buf bytes.Buffer
+	result, err := Optimize(context.Background(), bytes.NewReader(input), &buf, CompressOptions{})
+	if err != nil {
+		t.Fatalf("Optimize() error = %v", err)
+	}
+	if !keptOriginal(result) || result.Format != FormatGIF {
+		t.Fatalf("Optimize() = %v with %+v, want the original GIF kept", result.Format, result.Candidates)
+	}
+	if !bytes.Equal(buf.Bytes(), input) || result.CompressedSize != result.OriginalSize {
+		t.Errorf("wrote %d bytes (CompressedSize %d), want the %d-byte input unchanged", buf.Len(), result.CompressedSize, len(input))
+	}
+
+	// Options that select a frame or change the pixels never keep the original.
+	result, err = Optimize(context.Background(), bytes.NewReader(input), &bytes.Buffer{}, CompressOptions{Poster: true})
+	if err != nil {
+		t.Fatalf("Optimize() error = %v", err)
+	}
+	if keptOriginal(result) {
+		t.Errorf("Optimize(Poster) kept the original: %+v", result.Candidates)
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_最適化(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, inputDir, "photo.jpg", createTestJPEG(t, 64, 48, 90))
+	writeTestFile(t, inputDir, "sub/shot.png", createTestPNG(t, 32, 32))
+	var icon bytes.Buffer
+	if err := bmp.Encode(&icon, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, inputDir, "icon.bmp", icon.Bytes())
+	journalPath := filepath.Join(outputDir, "journal.jsonl")
+
+	items, err := ScanDirectory(inputDir, outputDir, WithOptimize())
+	if err != nil {
+		t.Fatalf("ScanDirectory() error = %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("ScanDirectory() = %d items, want 3 including the BMP", len(items))
+	}
+	results, err := NewDefaultBatchProcessor(WithJournal(journalPath)).ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	for _, r := range results {
+		if !r.IsSuccess() {
+			t.Fatalf("%s: %v", r.Item.InputPath, r.Error)
+		}
+		if filepath.Ext(r.Item.OutputPath) != "" {
+			t.Errorf("OutputPath = %q, want no extension", r.Item.OutputPath)
+		}
+		out := r.OutputPath()
+		if out != OptimizedPath(r.Item.OutputPath, r.Result.Format) {
+			t.Errorf("OutputPath() = %q, want the extension of %s", out, r.Result.Format)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("output %s: %v", out, err)
+		}
+		if got, err := DetectFormat(data); err != nil || got != r.Result.Format {
+			t.Errorf("%s format = %v (%v), want %v", out, got, err, r.Result.Format)
+		}
+	}
+
+	// A resumed run finds the outputs by their journaled format.
+	results, err = NewDefaultBatchProcessor(WithJournal(journalPath), WithResume()).ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	for _, r := range results {
+		if !r.Skipped {
+			t.Errorf("%s was processed again, want skipped", r.Item.InputPath)
+		}
+	}
+
+	// A manifest finds them too.
+	m := NewManifest()
+	for _, r := range results {
+		if err := m.Record(r.Item.InputPath, r.Item.OutputPath, r.InputHash, OptimizePipeline(r.Item.Options)); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if items, err := ScanDirectory(inputDir, outputDir, WithOptimize(), WithManifest(m)); err != nil || len(items) != 0 {
+		t.Errorf("ScanDirectory(WithManifest) = %d items, %v, want all unchanged", len(items), err)
+	}
+}
+
+func TestScanDirectory_最適化の出力衝突(t *testing.T) {
+	inputDir := t.TempDir()
+	writeTestFile(t, inputDir, "a.jpg", createTestJPEG(t, 8, 8, 90))
+	writeTestFile(t, inputDir, "a.png", createTestPNG(t, 8, 8))
+
+	_, err := ScanDirectory(inputDir, t.TempDir(), WithOptimize())
+	if err == nil || !strings.Contains(err.Error(), "an earlier input") {
+		t.Errorf("ScanDirectory() error = %v, want an output collision", err)
+	}
+
+	tmpl, err := ParseOutputTemplate("{name}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScanDirectory(inputDir, t.TempDir(), WithOptimize(), WithOutputTemplate(tmpl)); err == nil {
+		t.Error("ScanDirectory(WithOptimize, WithOutputTemplate) error = nil, want error")
+	}
+}
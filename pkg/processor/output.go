@@ -0,0 +1,279 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithBackupSuffix saves a copy of each original as "{input}{suffix}" (e.g.
+// ".bak") before it is replaced by in-place compression.
+func WithBackupSuffix(suffix string) BatchProcessorOption {
+	return func(bp *DefaultBatchProcessor) {
+		bp.backupSuffix = suffix
+	}
+}
+
+// WithBackupDir saves a copy of each original under dir before it is replaced
+// by in-place compression. Inputs under root keep their path relative to root;
+// other inputs are stored by base name.
+func WithBackupDir(root, dir string) BatchProcessorOption {
+	return func(bp *DefaultBatchProcessor) {
+		bp.backupRoot = root
+		bp.backupDir = dir
+	}
+}
+
+// WithNeverGrow keeps the original whenever compression would not make it
+// smaller. In-place items are then left untouched; other items get an exact
+// copy of the input. Such results have KeptOriginal set.
+func WithNeverGrow() BatchProcessorOption {
+	return func(bp *DefaultBatchProcessor) {
+		bp.neverGrow = true
+	}
+}
+
+// OutputSink stores the encoded output of each batch item. The default sink
+// writes files atomically (see ProcessBatch); DiscardSink drops the output.
+type OutputSink interface {
+	// WriteOutput runs encode into the destination of outputPath. With
+	// neverGrow, an output that is not smaller than the input at inputPath is
+	// replaced by the original and kept is true.
+	WriteOutput(inputPath, outputPath string, neverGrow bool, encode func(io.Writer) (*Result, error)) (res *Result, kept bool, err error)
+}
+
+// DiscardSink is an OutputSink that runs every encoder into io.Discard and
+// stores nothing, so a batch reports the sizes it would produce without
+// touching the disk.
+var DiscardSink OutputSink = discardSink{}
+
+type discardSink struct{}
+
+func (discardSink) WriteOutput(_, _ string, neverGrow bool, encode func(io.Writer) (*Result, error)) (*Result, bool, error) {
+	res, err := encode(io.Discard)
+	if err != nil {
+		return nil, false, err
+	}
+	if neverGrow && res.CompressedSize >= res.OriginalSize {
+		res.CompressedSize = res.OriginalSize
+		return res, true, nil
+	}
+	return res, false, nil
+}
+
+// WithOutputSink sends the output of every item to sink instead of writing
+// files. Backup options only apply to the default sink. Use it without
+// WithJournal, since journaled items are skipped only when their output file exists.
+func WithOutputSink(sink OutputSink) BatchProcessorOption {
+	return func(bp *DefaultBatchProcessor) {
+		bp.sink = sink
+	}
+}
+
+// output runs encode through the configured sink, stores it in the configured
+// storage, or writes the local file itself by default. original, if non-nil,
+// holds the input once encode has read it; a storage keeps it as the output
+// with neverGrow instead of reading the input again.
+func (bp *DefaultBatchProcessor) output(ctx context.Context, inputPath, outputPath string, neverGrow bool, original *bytes.Buffer, encode func(io.Writer) (*Result, error)) (*Result, bool, error) {
+	if bp.sink != nil {
+		return bp.sink.WriteOutput(inputPath, outputPath, neverGrow, encode)
+	}
+	if !isLocal(bp.storage) {
+		return storageSink{ctx: ctx, s: bp.storage, original: original}.WriteOutput(inputPath, outputPath, neverGrow, encode)
+	}
+	return bp.writeOutput(inputPath, outputPath, neverGrow, encode)
+}
+
+// writeOutput runs encode into a temporary file next to outputPath, syncs it
+// and renames it into place, so the output is never seen half-written and a
+// failed or cancelled item leaves any existing file untouched. The directory
+// is synced after the rename so that the new name survives a crash. New
+// files get mode 0666 as modified by the umask, like any other created file.
+//
+// When outputPath is the input itself the original's permissions and
+// modification time are kept, and a backup is saved first if configured.
+// With neverGrow, an output that is not smaller than the input is replaced by
+// the original and kept is true.
+func (bp *DefaultBatchProcessor) writeOutput(inputPath, outputPath string, neverGrow bool, encode func(io.Writer) (*Result, error)) (res *Result, kept bool, err error) {
+	inPlace := sameFile(inputPath, outputPath)
+
+	outDir := filepath.Dir(outputPath)
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, false, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	tmp, err := createTemp(outDir, "."+filepath.Base(outputPath)+".tmp-*")
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	res, err = encode(tmp)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if neverGrow && res.CompressedSize >= res.OriginalSize {
+		kept = true
+		res.CompressedSize = res.OriginalSize
+		if inPlace {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+			return res, true, nil
+		}
+		if err := copyInto(tmp, inputPath); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return nil, false, fmt.Errorf("failed to sync output file: %w", err)
+	}
+	// Explicitly close to catch buffered write/flush errors (e.g., disk full).
+	if err := tmp.Close(); err != nil {
+		return nil, false, fmt.Errorf("failed to close output file: %w", err)
+	}
+
+	if inPlace {
+		info, err := os.Stat(inputPath)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to access input file: %w", err)
+		}
+		if err := bp.backup(inputPath, info); err != nil {
+			return nil, false, err
+		}
+		if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+			return nil, false, fmt.Errorf("failed to set output permissions: %w", err)
+		}
+		if err := os.Chtimes(tmp.Name(), time.Now(), info.ModTime()); err != nil {
+			return nil, false, fmt.Errorf("failed to set output modification time: %w", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), outputPath); err != nil {
+		return nil, false, fmt.Errorf("failed to replace output file: %w", err)
+	}
+	if err := syncDir(outDir); err != nil {
+		return nil, false, fmt.Errorf("failed to sync output directory: %w", err)
+	}
+	return res, kept, nil
+}
+
+// createTemp creates a new file in dir like os.CreateTemp, replacing the last
+// "*" in pattern with a random string, but with mode 0666 before the umask
+// instead of 0600 so that the renamed output gets the usual permissions.
+func createTemp(dir, pattern string) (*os.File, error) {
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for range 10000 {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+suffix)
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return f, err
+	}
+	return nil, &fs.PathError{Op: "createtemp", Path: filepath.Join(dir, pattern), Err: fs.ErrExist}
+}
+
+// syncDir flushes the directory entries of dir to disk. Windows cannot sync
+// directories and persists renames on its own, so it is a no-op there.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// backup copies the original at inputPath to the configured backup locations.
+func (bp *DefaultBatchProcessor) backup(inputPath string, info os.FileInfo) error {
+	if bp.backupSuffix != "" {
+		if err := copyFile(inputPath+bp.backupSuffix, inputPath, info); err != nil {
+			return fmt.Errorf("failed to back up original: %w", err)
+		}
+	}
+	if bp.backupDir != "" {
+		rel, err := filepath.Rel(bp.backupRoot, inputPath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			rel = filepath.Base(inputPath)
+		}
+		dst := filepath.Join(bp.backupDir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return fmt.Errorf("failed to create backup directory: %w", err)
+		}
+		if err := copyFile(dst, inputPath, info); err != nil {
+			return fmt.Errorf("failed to back up original: %w", err)
+		}
+	}
+	return nil
+}
+
+// copyFile copies src to dst, keeping the permissions and modification time in info.
+func copyFile(dst, src string, info os.FileInfo) error {
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err := copyInto(out, src); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, time.Now(), info.ModTime())
+}
+
+// copyInto replaces the contents of f with the contents of the file at src.
+func copyInto(f *os.File, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func() { _ = in.Close() }()
+
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(f, in)
+	return err
+}
+
+// sameFile reports whether a and b refer to the same existing file.
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ai, bi)
+}
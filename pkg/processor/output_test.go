@@ -0,0 +1,251 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDefaultBatchProcessor_ProcessBatch_インプレース(t *testing.T) {
+	dir := t.TempDir()
+	original := createTestJPEG(t, 64, 64, 100)
+	path := writeTestFile(t, dir, "sub/photo.jpg", original)
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	backupDir := filepath.Join(t.TempDir(), "backup")
+
+	bp := NewDefaultBatchProcessor(WithBackupSuffix(".bak"), WithBackupDir(dir, backupDir))
+	results, err := bp.ProcessBatch(context.Background(), []BatchItem{
+		{InputPath: path, OutputPath: path, Options: CompressOptions{Quality: 50}},
+	})
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	if !results[0].IsSuccess() {
+		t.Fatalf("result error = %v", results[0].Error)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != results[0].Result.CompressedSize || info.Size() >= int64(len(original)) {
+		t.Errorf("size = %d, want compressed size %d", info.Size(), results[0].Result.CompressedSize)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("perm = %v, want 0600", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("mtime = %v, want %v", info.ModTime(), modTime)
+	}
+
+	for _, backup := range []string{path + ".bak", filepath.Join(backupDir, "sub", "photo.jpg")} {
+		data, err := os.ReadFile(backup)
+		if err != nil {
+			t.Errorf("backup %s: %v", backup, err)
+			continue
+		}
+		if !bytes.Equal(data, original) {
+			t.Errorf("backup %s differs from the original", backup)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("directory has %d entries, want photo.jpg and its backup only", len(entries))
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_出力のパーミッション(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "photo.jpg", createTestJPEG(t, 16, 16, 90))
+	outPath := filepath.Join(dir, "out", "photo.jpg")
+
+	results, err := NewDefaultBatchProcessor().ProcessBatch(context.Background(), []BatchItem{
+		{InputPath: path, OutputPath: outPath, Options: DefaultCompressOptions()},
+	})
+	if err != nil || !results[0].IsSuccess() {
+		t.Fatalf("ProcessBatch() = %v, %v", results, err)
+	}
+
+	// The output gets the same mode as a file created normally under the umask.
+	ref, err := os.Create(filepath.Join(dir, "ref"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = ref.Close()
+	want, err := os.Stat(ref.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.Stat(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Mode().Perm() != want.Mode().Perm() {
+		t.Errorf("perm = %v, want %v", got.Mode().Perm(), want.Mode().Perm())
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_失敗時は元のファイルを保持(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := []byte("not a jpeg")
+	path := writeTestFile(t, dir, "broken.jpg", corrupt)
+	existing := writeTestFile(t, dir, "out/broken.jpg", []byte("previous output"))
+
+	bp := NewDefaultBatchProcessor()
+	results, err := bp.ProcessBatch(context.Background(), []BatchItem{
+		{InputPath: path, OutputPath: path, Options: DefaultCompressOptions()},
+		{InputPath: path, OutputPath: existing, Options: DefaultCompressOptions()},
+	})
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	for i, r := range results {
+		if r.IsSuccess() {
+			t.Errorf("result[%d] succeeded for a corrupt input", i)
+		}
+	}
+
+	for path, want := range map[string]string{path: string(corrupt), existing: "previous output"} {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", path, data, err, want)
+		}
+	}
+	for _, sub := range []string{dir, filepath.Join(dir, "out")} {
+		entries, _ := os.ReadDir(sub)
+		for _, e := range entries {
+			if filepath.Ext(e.Name()) != ".jpg" && e.Type().IsRegular() {
+				t.Errorf("temporary file left behind: %s", e.Name())
+			}
+		}
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_NeverGrow(t *testing.T) {
+	tests := []struct {
+		name    string
+		inPlace bool
+	}{
+		{name: "インプレース", inPlace: true},
+		{name: "別ファイルに出力", inPlace: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// A low-quality JPEG grows when re-encoded at a high quality.
+			original := createTestJPEG(t, 64, 64, 20)
+			path := writeTestFile(t, dir, "photo.jpg", original)
+			outPath := path
+			if !tt.inPlace {
+				outPath = filepath.Join(dir, "out", "photo.jpg")
+			}
+
+			bp := NewDefaultBatchProcessor(WithNeverGrow(), WithBackupSuffix(".bak"))
+			results, err := bp.ProcessBatch(context.Background(), []BatchItem{
+				{InputPath: path, OutputPath: outPath, Options: CompressOptions{Quality: 100}},
+			})
+			if err != nil {
+				t.Fatalf("ProcessBatch() error = %v", err)
+			}
+			r := results[0]
+			if !r.IsSuccess() || !r.KeptOriginal {
+				t.Fatalf("result = %+v, want success with KeptOriginal", r)
+			}
+			if r.Result.CompressedSize != int64(len(original)) {
+				t.Errorf("CompressedSize = %d, want %d", r.Result.CompressedSize, len(original))
+			}
+
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, original) {
+				t.Error("output is not the original file")
+			}
+			if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+				t.Error("backup written although the original was kept")
+			}
+		})
+	}
+}
+
+// memorySink is an OutputSink that keeps every output in memory.
+type memorySink struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (s *memorySink) WriteOutput(_, outputPath string, _ bool, encode func(io.Writer) (*Result, error)) (*Result, bool, error) {
+	var buf bytes.Buffer
+	res, err := encode(&buf)
+	if err != nil {
+		return nil, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[outputPath] = buf.Bytes()
+	return res, false, nil
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_出力シンク(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "photo.jpg", createTestJPEG(t, 64, 64, 100))
+	outPath := filepath.Join(dir, "out", "photo.jpg")
+	items := []BatchItem{{InputPath: path, OutputPath: outPath, Options: CompressOptions{Quality: 50}}}
+
+	t.Run("DiscardSink", func(t *testing.T) {
+		bp := NewDefaultBatchProcessor(WithOutputSink(DiscardSink))
+		results, err := bp.ProcessBatch(context.Background(), items)
+		if err != nil {
+			t.Fatalf("ProcessBatch() error = %v", err)
+		}
+		r := results[0]
+		if !r.IsSuccess() || r.Result.CompressedSize == 0 || r.Result.CompressedSize >= r.Result.OriginalSize {
+			t.Errorf("result = %+v, want projected savings", r)
+		}
+		if _, err := os.Stat(filepath.Dir(outPath)); !os.IsNotExist(err) {
+			t.Error("DiscardSink created the output directory")
+		}
+	})
+
+	t.Run("DiscardSink_NeverGrow", func(t *testing.T) {
+		bp := NewDefaultBatchProcessor(WithOutputSink(DiscardSink), WithNeverGrow())
+		results, err := bp.ProcessBatch(context.Background(), []BatchItem{
+			{InputPath: path, OutputPath: path, Options: CompressOptions{Quality: 100}},
+		})
+		if err != nil {
+			t.Fatalf("ProcessBatch() error = %v", err)
+		}
+		if r := results[0]; !r.KeptOriginal || r.Result.CompressedSize != r.Result.OriginalSize {
+			t.Errorf("result = %+v, want KeptOriginal with the original size", r)
+		}
+	})
+
+	t.Run("カスタムシンク", func(t *testing.T) {
+		sink := &memorySink{data: make(map[string][]byte)}
+		bp := NewDefaultBatchProcessor(WithOutputSink(sink))
+		results, err := bp.ProcessBatch(context.Background(), items)
+		if err != nil {
+			t.Fatalf("ProcessBatch() error = %v", err)
+		}
+		if got := int64(len(sink.data[outPath])); got == 0 || got != results[0].Result.CompressedSize {
+			t.Errorf("sink received %d bytes, want %d", got, results[0].Result.CompressedSize)
+		}
+	})
+}
@@ -0,0 +1,297 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"time"
+
+	"github.com/chai2010/webp"
+)
+
+// ErrUnsupportedFormat is returned when a pipeline's output format cannot be written.
+var ErrUnsupportedFormat = errors.New("unsupported output format")
+
+// Pipeline describes one image operation: the input is decoded, run through
+// the color-management and resize transforms configured in Options and
+// encoded as Format. Compression and conversion are presets of it, built by
+// CompressPipeline and ConvertPipeline.
+type Pipeline struct {
+	// Format is the output format.
+	Format ImageFormat
+
+	// Options configures the decode, transform and encode stages. Page and
+	// Poster select what is decoded; Quality and Level drive the encoder.
+	Options CompressOptions
+
+	// AllPages keeps every page of a multi-page input when Format can hold
+	// several pages (TIFF); Options.Page is then ignored. Otherwise only the
+	// selected page is written.
+	AllPages bool
+
+	// Optimize writes the smallest of several encodings, chosen by Optimize,
+	// instead of encoding as Format, which is then ignored. The Result's
+	// Format is the chosen format.
+	Optimize bool
+}
+
+// CompressPipeline returns the pipeline that recompresses an image of the
+// given format: every page and animation frame is kept in the same format.
+func CompressPipeline(format ImageFormat, opts CompressOptions) Pipeline {
+	return Pipeline{Format: format, Options: opts, AllPages: true}
+}
+
+// ConvertPipeline returns the pipeline that converts an image to opts.Format.
+// Multi-page input is reduced to the page selected by opts.Page.
+func ConvertPipeline(opts ConvertOptions) Pipeline {
+	return Pipeline{Format: opts.Format, Options: opts.CompressOptions}
+}
+
+// OptimizePipeline returns the pipeline that writes an image in the smallest
+// format chosen by Optimize.
+func OptimizePipeline(opts CompressOptions) Pipeline {
+	return Pipeline{Options: opts, Optimize: true}
+}
+
+// Pipeline returns the pipeline that runs the item: a conversion to Format
+// when Convert is set, the choice of the smallest format when Optimize is
+// set, otherwise compression in the format detected from the extension of
+// InputPath.
+func (item BatchItem) Pipeline() (Pipeline, error) {
+	if item.Optimize {
+		return OptimizePipeline(item.Options), nil
+	}
+	if item.Convert {
+		if _, ok := encoders[item.Format]; !ok {
+			return Pipeline{}, fmt.Errorf("%w: %s", ErrUnsupportedFormat, item.Format)
+		}
+		return ConvertPipeline(item.ConvertOptions()), nil
+	}
+	format, err := detectFormatFromPath(item.InputPath)
+	if err != nil {
+		return Pipeline{}, err
+	}
+	if _, ok := encoders[format]; !ok {
+		return Pipeline{}, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	return CompressPipeline(format, item.Options), nil
+}
+
+// Run reads an image from r, runs it through the pipeline and writes the
+// result to w. The Result reports the input and output sizes and the time
+// spent in each stage.
+func (p Pipeline) Run(ctx context.Context, r io.Reader, w io.Writer) (*Result, error) {
+	if p.Optimize {
+		return Optimize(ctx, r, w, p.Options)
+	}
+	enc, ok := encoders[p.Format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, p.Format)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	// Read all input data to calculate original size
+	inputData, err := readAllWithLimit(r, p.Options.MaxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+	originalSize := int64(len(inputData))
+
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	var st Stats
+	src, err := p.decode(ctx, inputData, enc, &st)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	// Encode directly to output via countingWriter
+	encodeStart := time.Now()
+	cw := &countingWriter{w: w}
+	if err := enc.encode(cw, src, p.Options); err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", enc.name, err)
+	}
+	st.addEncode(encodeStart)
+
+	return &Result{
+		OriginalSize:   originalSize,
+		CompressedSize: cw.n,
+		Format:         p.Format,
+		Stats:          st,
+	}, nil
+}
+
+// Validate validates the options of the pipeline and returns an error if
+// any of them is unsupported, including Lossless for formats other than WebP.
+func (p Pipeline) Validate() error {
+	if err := p.Options.Validate(); err != nil {
+		return err
+	}
+	if p.Options.Lossless && !p.Optimize && p.Format != FormatWEBP {
+		return ErrLosslessNotSupported
+	}
+	return nil
+}
+
+// outputPath returns the path that p writes the output of format to, given
+// the output path of its item: the path itself, or for optimize pipelines the
+// path with the extension of the chosen format.
+func (p Pipeline) outputPath(output string, format ImageFormat) string {
+	if p.Optimize {
+		return OptimizedPath(output, format)
+	}
+	return output
+}
+
+// outputExists reports whether an output of p for the given output path of
+// its item exists in s. For optimize pipelines any format counts, since the
+// chosen one is not known before the item runs.
+func (p Pipeline) outputExists(ctx context.Context, s Storage, output string) bool {
+	if !p.Optimize {
+		_, err := s.Stat(ctx, output)
+		return err == nil
+	}
+	for f := FormatJPEG; f.IsValid(); f++ {
+		if _, err := s.Stat(ctx, OptimizedPath(output, f)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// decode decodes as much of inputData as enc can store: every frame of an
+// animation for animated formats, every page for multi-page formats when
+// AllPages is set, and the selected page or frame otherwise.
+func (p Pipeline) decode(ctx context.Context, inputData []byte, enc encoder, st *Stats) (decoded, error) {
+	switch {
+	case enc.animated:
+		anim, img, err := decodeAnimated(inputData, p.Options, st)
+		if err != nil {
+			return decoded{}, fmt.Errorf("failed to decode image: %w", err)
+		}
+		return decoded{anim: anim, pages: []image.Image{img}}, nil
+
+	case enc.multiPage && p.AllPages:
+		pages := 1
+		if isTIFF(inputData) {
+			var err error
+			if pages, err = tiffPageCount(inputData); err != nil {
+				return decoded{}, fmt.Errorf("failed to decode image: %w", err)
+			}
+		}
+		imgs := make([]image.Image, 0, pages)
+		for page := range pages {
+			pageOpts := p.Options
+			pageOpts.Page = page
+			img, err := decodeImage(inputData, pageOpts, st)
+			if err != nil {
+				return decoded{}, fmt.Errorf("failed to decode image: %w", err)
+			}
+			imgs = append(imgs, img)
+
+			if err := checkContext(ctx); err != nil {
+				return decoded{}, err
+			}
+		}
+		return decoded{pages: imgs}, nil
+
+	default:
+		img, err := decodeImage(inputData, p.Options, st)
+		if err != nil {
+			return decoded{}, fmt.Errorf("failed to decode image: %w", err)
+		}
+		return decoded{pages: []image.Image{img}}, nil
+	}
+}
+
+// decoded is the input of an encoder: an animation, or one or more pages.
+type decoded struct {
+	anim  *Animation
+	pages []image.Image
+}
+
+// encoder writes decoded images in one output format.
+type encoder struct {
+	// name is the format name used in encode errors.
+	name string
+	// animated encoders receive every frame of an animated input unless
+	// Poster is set; multiPage encoders receive every page when AllPages is set.
+	animated  bool
+	multiPage bool
+	encode    func(w io.Writer, src decoded, opts CompressOptions) error
+}
+
+// encoders holds the encoder of every writable format.
+var encoders = map[ImageFormat]encoder{
+	FormatJPEG: {name: "JPEG", encode: encodeJPEG},
+	FormatPNG:  {name: "PNG", animated: true, encode: encodePNG},
+	FormatWEBP: {name: "WebP", animated: true, encode: encodeWebP},
+	FormatTIFF: {name: "TIFF", multiPage: true, encode: encodeTIFF},
+	FormatGIF:  {name: "GIF", animated: true, encode: encodeGIFImage},
+}
+
+func encodeJPEG(w io.Writer, src decoded, opts CompressOptions) error {
+	// Use the compression level to derive JPEG quality when no explicit quality is provided.
+	quality := opts.Level.ToJPEGQuality()
+	if opts.Quality > 0 {
+		quality = min(opts.Quality, 100)
+	}
+	return jpeg.Encode(w, src.pages[0], &jpeg.Options{Quality: quality})
+}
+
+func encodePNG(w io.Writer, src decoded, opts CompressOptions) error {
+	if src.anim != nil {
+		return encodeAPNG(w, src.anim, opts.Level)
+	}
+	encoder := &png.Encoder{CompressionLevel: opts.Level.ToPNGCompressionLevel()}
+	return encoder.Encode(w, src.pages[0])
+}
+
+func encodeWebP(w io.Writer, src decoded, opts CompressOptions) error {
+	quality := opts.Level.ToWebPQuality()
+	if opts.Quality > 0 {
+		quality = float32(min(opts.Quality, 100))
+	}
+	webpOpts := &webp.Options{Quality: quality, Lossless: opts.Lossless}
+	if src.anim != nil {
+		return encodeAnimatedWebP(w, src.anim, webpOpts)
+	}
+	return webp.Encode(w, src.pages[0], webpOpts)
+}
+
+func encodeTIFF(w io.Writer, src decoded, opts CompressOptions) error {
+	return encodeTIFFPages(w, src.pages, opts.Level.ToTIFFOptions())
+}
+
+func encodeGIFImage(w io.Writer, src decoded, opts CompressOptions) error {
+	anim := src.anim
+	if anim == nil {
+		anim = &Animation{Frames: []Frame{{Image: src.pages[0]}}}
+	}
+	return encodeGIF(w, anim, opts.Level)
+}
+
+// runAs runs p on a processor that only writes format, named name in errors.
+func runAs(ctx context.Context, name string, format ImageFormat, r io.Reader, w io.Writer, p Pipeline) (*Result, error) {
+	if p.Format != format {
+		return nil, fmt.Errorf("%s only supports conversion to %s, got %s", name, encoders[format].name, p.Format)
+	}
+	return p.Run(ctx, r, w)
+}
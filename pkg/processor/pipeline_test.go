@@ -0,0 +1,159 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestPipeline_Run(t *testing.T) {
+	tiffData := createTestTIFFPages(t, 3)
+
+	tests := []struct {
+		name       string
+		pipeline   Pipeline
+		input      []byte
+		wantPages  int
+		wantWidth  int
+		wantFormat ImageFormat
+	}{
+		{
+			name:       "compress keeps every TIFF page",
+			pipeline:   CompressPipeline(FormatTIFF, DefaultCompressOptions()),
+			input:      tiffData,
+			wantPages:  3,
+			wantFormat: FormatTIFF,
+		},
+		{
+			name:       "convert keeps the selected page",
+			pipeline:   ConvertPipeline(DefaultConvertOptions(FormatTIFF)),
+			input:      tiffData,
+			wantPages:  1,
+			wantFormat: FormatTIFF,
+		},
+		{
+			name:       "compress keeps raster size",
+			pipeline:   CompressPipeline(FormatJPEG, CompressOptions{Level: CompressionMedium, Width: 10}),
+			input:      createTestJPEG(t, 40, 20, 90),
+			wantPages:  1,
+			wantWidth:  40,
+			wantFormat: FormatJPEG,
+		},
+		{
+			name:       "convert to WebP",
+			pipeline:   ConvertPipeline(DefaultConvertOptions(FormatWEBP)),
+			input:      createTestPNG(t, 30, 30),
+			wantPages:  1,
+			wantWidth:  30,
+			wantFormat: FormatWEBP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			res, err := tt.pipeline.Run(context.Background(), bytes.NewReader(tt.input), &buf)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if res.Format != tt.wantFormat || res.CompressedSize != int64(buf.Len()) {
+				t.Errorf("result = %+v, want format %s and size %d", res, tt.wantFormat, buf.Len())
+			}
+			if tt.wantFormat == FormatTIFF {
+				pages, err := PageCount(bytes.NewReader(buf.Bytes()))
+				if err != nil || pages != tt.wantPages {
+					t.Errorf("PageCount() = %d, %v, want %d", pages, err, tt.wantPages)
+				}
+			}
+			if tt.wantWidth > 0 {
+				cfg, _, err := image.DecodeConfig(&buf)
+				if err != nil || cfg.Width != tt.wantWidth {
+					t.Errorf("output width = %d, %v, want %d", cfg.Width, err, tt.wantWidth)
+				}
+			}
+		})
+	}
+}
+
+func TestPipeline_Run_非対応フォーマット(t *testing.T) {
+	for _, format := range []ImageFormat{FormatHEIC, FormatBMP, FormatSVG, ImageFormat(-1)} {
+		_, err := ConvertPipeline(DefaultConvertOptions(format)).Run(context.Background(), bytes.NewReader(createTestPNG(t, 4, 4)), &bytes.Buffer{})
+		if !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("Run() to %s error = %v, want ErrUnsupportedFormat", format, err)
+		}
+	}
+}
+
+func TestPipeline_Validate_Lossless(t *testing.T) {
+	opts := DefaultConvertOptions(FormatJPEG)
+	opts.Lossless = true
+	_, err := ConvertPipeline(opts).Run(context.Background(), bytes.NewReader(createTestPNG(t, 4, 4)), &bytes.Buffer{})
+	if !errors.Is(err, ErrLosslessNotSupported) {
+		t.Errorf("Run() lossless JPEG error = %v, want ErrLosslessNotSupported", err)
+	}
+
+	opts.Format = FormatWEBP
+	if err := ConvertPipeline(opts).Validate(); err != nil {
+		t.Errorf("Validate() lossless WebP error = %v, want nil", err)
+	}
+	if err := OptimizePipeline(opts.CompressOptions).Validate(); err != nil {
+		t.Errorf("Validate() lossless optimize error = %v, want nil", err)
+	}
+}
+
+func TestBatchItem_Pipeline(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    ImageFormat
+		wantErr bool
+	}{
+		{name: "jpeg", input: "a.jpeg", want: FormatJPEG},
+		{name: "apng", input: "a.apng", want: FormatPNG},
+		{name: "input-only format", input: "a.heic", wantErr: true},
+		{name: "unknown extension", input: "a.txt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := BatchItem{InputPath: tt.input, Options: DefaultCompressOptions()}.Pipeline()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Pipeline() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (p.Format != tt.want || !p.AllPages) {
+				t.Errorf("Pipeline() = %+v, want a compress pipeline to %s", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessor_Convert_出力フォーマット不一致(t *testing.T) {
+	_, err := NewJPEGProcessor().Convert(context.Background(), bytes.NewReader(createTestPNG(t, 4, 4)), &bytes.Buffer{}, DefaultConvertOptions(FormatPNG))
+	if err == nil || err.Error() != "JPEGProcessor only supports conversion to JPEG, got png" {
+		t.Errorf("Convert() error = %v, want a format mismatch", err)
+	}
+}
+
+func TestPipeline_NegativeQualityUsesLevel(t *testing.T) {
+	input := createTestPNG(t, 32, 32)
+	for _, format := range []ImageFormat{FormatJPEG, FormatWEBP} {
+		t.Run(format.String(), func(t *testing.T) {
+			encode := func(quality int) []byte {
+				var buf bytes.Buffer
+				opts := ConvertOptions{Format: format, CompressOptions: CompressOptions{Quality: quality, Level: CompressionHigh}}
+				if _, err := ConvertPipeline(opts).Run(context.Background(), bytes.NewReader(input), &buf); err != nil {
+					t.Fatalf("Run(quality %d) error = %v", quality, err)
+				}
+				return buf.Bytes()
+			}
+			if !bytes.Equal(encode(-10), encode(0)) {
+				t.Error("negative quality does not fall back to the level default")
+			}
+			if bytes.Equal(encode(-10), encode(1)) {
+				t.Error("negative quality is clamped to 1")
+			}
+		})
+	}
+}
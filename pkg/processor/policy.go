@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrBatchAborted is the error of items that were not processed, or were
+// cancelled while in flight, because the failure policy stopped the batch.
+var ErrBatchAborted = errors.New("batch aborted after too many failures")
+
+// WithFailFast stops a batch at its first failed item. It is the same as WithMaxFailures(1).
+func WithFailFast() BatchProcessorOption {
+	return WithMaxFailures(1)
+}
+
+// WithMaxFailures stops a batch once n items have failed. Items in flight are
+// cancelled through their context, and they and the items not yet started
+// are reported as Aborted with ErrBatchAborted. n of 0 or less disables the limit.
+func WithMaxFailures(n int) BatchProcessorOption {
+	return func(bp *DefaultBatchProcessor) {
+		bp.maxFailures = n
+	}
+}
+
+// WithMaxFailurePercent stops a batch, like WithMaxFailures, once more than
+// percent of its items have failed. For streams, whose length is unknown,
+// failures are compared to the number of finished items instead, and only
+// once at least minFailureSample items have finished, so that a failure
+// among the first few items does not stop the stream.
+// percent of 0 or less disables the limit.
+func WithMaxFailurePercent(percent float64) BatchProcessorOption {
+	return func(bp *DefaultBatchProcessor) {
+		bp.maxFailurePercent = percent
+	}
+}
+
+// minFailureSample is the number of finished items a stream needs before
+// WithMaxFailurePercent is applied to it.
+const minFailureSample = 20
+
+// exceedsFailureBudget reports whether the failures in p trip the failure policy.
+// Aborted items do not count as failures.
+func (bp *DefaultBatchProcessor) exceedsFailureBudget(p Progress) bool {
+	if p.Failed == 0 {
+		return false
+	}
+	if bp.maxFailures > 0 && p.Failed >= bp.maxFailures {
+		return true
+	}
+	if bp.maxFailurePercent > 0 {
+		n := p.Total
+		if n == 0 {
+			if n = p.Finished(); n < minFailureSample {
+				return false
+			}
+		}
+		return float64(p.Failed)*100 > bp.maxFailurePercent*float64(n)
+	}
+	return false
+}
+
+// abortError returns ErrBatchAborted for an item error caused by the failure
+// policy cancelling ctx, and err otherwise.
+func abortError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil || !errors.Is(context.Cause(ctx), ErrBatchAborted) {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrBatchAborted) {
+		return ErrBatchAborted
+	}
+	return err
+}
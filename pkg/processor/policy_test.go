@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultBatchProcessor_exceedsFailureBudget(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []BatchProcessorOption
+		p    Progress
+		want bool
+	}{
+		{name: "no policy", p: Progress{Total: 10, Failed: 9}, want: false},
+		{name: "fail fast", opts: []BatchProcessorOption{WithFailFast()}, p: Progress{Total: 10, Failed: 1}, want: true},
+		{name: "below max failures", opts: []BatchProcessorOption{WithMaxFailures(3)}, p: Progress{Total: 10, Failed: 2}, want: false},
+		{name: "max failures reached", opts: []BatchProcessorOption{WithMaxFailures(3)}, p: Progress{Total: 10, Failed: 3}, want: true},
+		{name: "aborted items do not count", opts: []BatchProcessorOption{WithMaxFailures(3)}, p: Progress{Total: 10, Failed: 2, Aborted: 2}, want: false},
+		{name: "percent of total not exceeded", opts: []BatchProcessorOption{WithMaxFailurePercent(20)}, p: Progress{Total: 10, Completed: 1, Failed: 2}, want: false},
+		{name: "percent of total exceeded", opts: []BatchProcessorOption{WithMaxFailurePercent(20)}, p: Progress{Total: 10, Completed: 1, Failed: 3}, want: true},
+		{name: "stream below the minimum sample", opts: []BatchProcessorOption{WithMaxFailurePercent(50)}, p: Progress{Completed: 1, Failed: 2}, want: false},
+		{name: "first failure of a stream", opts: []BatchProcessorOption{WithMaxFailurePercent(10)}, p: Progress{Failed: 1}, want: false},
+		{name: "percent of finished items in a stream", opts: []BatchProcessorOption{WithMaxFailurePercent(50)}, p: Progress{Completed: minFailureSample / 2, Failed: minFailureSample/2 + 1}, want: true},
+		{name: "max failures in a stream ignore the sample", opts: []BatchProcessorOption{WithMaxFailures(1)}, p: Progress{Failed: 1}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bp := NewDefaultBatchProcessor(tt.opts...)
+			if got := bp.exceedsFailureBudget(tt.p); got != tt.want {
+				t.Errorf("exceedsFailureBudget(%+v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAbortError(t *testing.T) {
+	aborted, cancel := context.WithCancelCause(context.Background())
+	cancel(ErrBatchAborted)
+	cancelled, cancel2 := context.WithCancel(context.Background())
+	cancel2()
+	decodeErr := errors.New("decode failed")
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want error
+	}{
+		{name: "live context", ctx: context.Background(), err: decodeErr, want: decodeErr},
+		{name: "cancelled by the caller", ctx: cancelled, err: context.Canceled, want: context.Canceled},
+		{name: "cancelled by the policy", ctx: aborted, err: fmt.Errorf("encode: %w", context.Canceled), want: ErrBatchAborted},
+		{name: "unrelated error after abort", ctx: aborted, err: decodeErr, want: decodeErr},
+		{name: "no error", ctx: aborted, err: nil, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := abortError(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("abortError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_失敗ポリシー(t *testing.T) {
+	inputDir := t.TempDir()
+	good := writeTestFile(t, inputDir, "good.jpg", createTestJPEG(t, 20, 20, 90))
+	bad := writeTestFile(t, inputDir, "bad.jpg", []byte("not an image"))
+
+	tests := []struct {
+		name        string
+		opt         BatchProcessorOption
+		inputs      []string
+		wantAborted []bool
+	}{
+		{
+			name:        "fail-fast",
+			opt:         WithFailFast(),
+			inputs:      []string{good, bad, good, good},
+			wantAborted: []bool{false, false, true, true},
+		},
+		{
+			name:        "失敗2件で停止",
+			opt:         WithMaxFailures(2),
+			inputs:      []string{bad, good, bad, good, good},
+			wantAborted: []bool{false, false, false, true, true},
+		},
+		{
+			name:        "失敗率で停止",
+			opt:         WithMaxFailurePercent(20),
+			inputs:      []string{bad, good, good, bad, good},
+			wantAborted: []bool{false, false, false, false, true},
+		},
+		{
+			name:        "上限未満",
+			opt:         WithMaxFailures(2),
+			inputs:      []string{bad, good, good},
+			wantAborted: []bool{false, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			var items []BatchItem
+			for i, in := range tt.inputs {
+				items = append(items, BatchItem{
+					InputPath:  in,
+					OutputPath: filepath.Join(outputDir, fmt.Sprintf("%d.jpg", i)),
+					Options:    DefaultCompressOptions(),
+				})
+			}
+
+			// A single worker makes the order in which items finish deterministic.
+			bp := NewDefaultBatchProcessor(WithMaxWorkers(1), tt.opt)
+			results, err := bp.ProcessBatch(context.Background(), items)
+			if err != nil {
+				t.Fatalf("ProcessBatch() error = %v", err)
+			}
+			for i, r := range results {
+				if r.Aborted != tt.wantAborted[i] {
+					t.Errorf("result[%d].Aborted = %v, want %v (error = %v)", i, r.Aborted, tt.wantAborted[i], r.Error)
+				}
+				if r.Aborted {
+					if !errors.Is(r.Error, ErrBatchAborted) {
+						t.Errorf("result[%d].Error = %v, want ErrBatchAborted", i, r.Error)
+					}
+					if _, err := os.Stat(r.Item.OutputPath); !os.IsNotExist(err) {
+						t.Errorf("aborted item %d wrote its output", i)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_変換_失敗ポリシー(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	bad := writeTestFile(t, inputDir, "bad.jpg", []byte("not an image"))
+	good := writeTestFile(t, inputDir, "good.jpg", createTestJPEG(t, 20, 20, 90))
+
+	var last Progress
+	bp := NewDefaultBatchProcessor(WithMaxWorkers(1), WithFailFast(), WithProgressCallback(func(p Progress) { last = p }))
+	results, err := bp.ProcessBatch(context.Background(), []BatchItem{
+		ConvertItem(bad, filepath.Join(outputDir, "bad.png"), DefaultConvertOptions(FormatPNG)),
+		ConvertItem(good, filepath.Join(outputDir, "good.png"), DefaultConvertOptions(FormatPNG)),
+	})
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	if results[0].Aborted || !results[1].Aborted {
+		t.Errorf("aborted = %v, %v, want false, true", results[0].Aborted, results[1].Aborted)
+	}
+	if last.Failed != 1 || last.Aborted != 1 || last.Finished() != 2 {
+		t.Errorf("progress = %+v, want 1 failed and 1 aborted", last)
+	}
+}
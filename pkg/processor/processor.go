@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"time"
 )
 
 // Errors returned by processor operations.
@@ -14,9 +15,14 @@ var (
 
 	// ErrFileTooLarge is returned when the input file exceeds the MaxFileSize limit.
 	ErrFileTooLarge = errors.New("file size exceeds maximum allowed size")
+
+	// ErrLosslessNotSupported is returned when Lossless is set for an output
+	// format other than WebP.
+	ErrLosslessNotSupported = errors.New("lossless output is only supported for webp")
 )
 
 // Processor defines the interface for image processing operations.
+// Compress and Convert are presets of Run; see CompressPipeline and ConvertPipeline.
 type Processor interface {
 	// Compress compresses an image from the reader and writes to the writer.
 	Compress(ctx context.Context, r io.Reader, w io.Writer, opts CompressOptions) (*Result, error)
@@ -30,9 +36,9 @@ type Processor interface {
 
 // CompressOptions contains options for image compression.
 type CompressOptions struct {
-	// Quality specifies the JPEG quality (1-100). 0 means use default.
-	// This setting is only applied to JPEG and is ignored for PNG,
-	// which uses Level to control compression.
+	// Quality specifies the JPEG and WebP quality (1-100). 0 or a negative
+	// value means the default derived from Level; values above 100 are treated
+	// as 100. PNG ignores it and uses Level to control compression.
 	Quality int
 
 	// Level specifies the compression level.
@@ -47,6 +53,42 @@ type CompressOptions struct {
 	// MaxFileSize specifies the maximum allowed input file size in bytes.
 	// 0 means no limit.
 	MaxFileSize int64
+
+	// ConvertToSRGB converts pixels to sRGB using the embedded ICC profile.
+	// Images without an embedded profile are assumed to already be sRGB.
+	// Only matrix/TRC RGB profiles are supported; other RGB profiles cause
+	// ErrUnsupportedColorProfile. Images with a GRAY, CMYK or other non-RGB
+	// profile are passed through unchanged.
+	ConvertToSRGB bool
+
+	// DitherTo8Bit reduces 16-bit-per-channel images to 8 bits using ordered dithering.
+	// When false, 16-bit images are passed to the encoder unchanged.
+	DitherTo8Bit bool
+
+	// Page selects the zero-based page to decode from multi-page inputs such as TIFF,
+	// or the frame of an animated GIF, APNG or WebP.
+	// Single-page formats only have page 0; other values cause ErrPageOutOfRange.
+	// Animations written as GIF, APNG or WebP keep every frame unless Poster is set.
+	Page int
+
+	// Poster writes only the animation frame selected by Page as a still image.
+	// Output formats without animation support (JPEG, TIFF) always write a single frame.
+	Poster bool
+
+	// Width and Height set the size SVG input is rendered at, in pixels.
+	// When only one is set the other is derived from the aspect ratio; 0 for
+	// both uses the intrinsic size scaled by DPI. Raster input keeps its size.
+	Width  int
+	Height int
+
+	// DPI is the resolution used to render SVG input when Width and Height are 0.
+	// 0 means 96 DPI, the CSS reference resolution. It is ignored for raster input.
+	DPI float64
+
+	// Lossless writes WebP output losslessly, ignoring Quality and Level.
+	// Pipelines writing other formats reject it with ErrLosslessNotSupported;
+	// Optimize only tries lossless encodings with it.
+	Lossless bool
 }
 
 // Validate validates the CompressOptions and returns an error if any option is unsupported.
@@ -57,6 +99,15 @@ func (o CompressOptions) Validate() error {
 	if o.MaxFileSize < 0 {
 		return errors.New("max file size must be non-negative")
 	}
+	if o.Page < 0 {
+		return errors.New("page must be non-negative")
+	}
+	if o.Width < 0 || o.Height < 0 {
+		return errors.New("width and height must be non-negative")
+	}
+	if o.DPI < 0 {
+		return errors.New("dpi must be non-negative")
+	}
 	return nil
 }
 
@@ -96,6 +147,14 @@ type Result struct {
 
 	// Format is the format of the output image.
 	Format ImageFormat
+
+	// Stats holds the stage durations and image dimensions of the run.
+	Stats Stats
+
+	// Candidates lists the encodings tried by Optimize, in the order they
+	// were tried; Format is the smallest of them. It is nil for pipelines
+	// with a fixed output format.
+	Candidates []Candidate
 }
 
 // CompressionRatio returns the compression ratio as a percentage.
@@ -128,60 +187,118 @@ type BatchProcessor interface {
 	ProcessBatch(ctx context.Context, items []BatchItem) ([]BatchResult, error)
 }
 
-// BatchItem represents a single item in batch processing.
+// BatchItem represents a single item in batch processing. The item is
+// compressed in its own format unless Convert or Optimize is set; use
+// ConvertItem or OptimizeItem to build such items.
 type BatchItem struct {
 	// InputPath is the path to the input image file.
 	InputPath string
 
-	// OutputPath is the path to the output image file.
+	// OutputPath is the path to the output image file. For optimize items it
+	// has no extension; see OptimizedPath.
 	OutputPath string
 
 	// Options contains the compression options for this item.
 	Options CompressOptions
-}
 
-// BatchResult represents the result of processing a single batch item.
-type BatchResult struct {
-	// Item is the original batch item.
-	Item BatchItem
+	// Convert converts the item to Format instead of compressing it in the
+	// format of InputPath. Only the page selected by Options.Page is kept.
+	Convert bool
 
-	// Result contains the processing result, nil if error occurred.
-	Result *Result
+	// Format is the output format of a conversion. It is ignored unless
+	// Convert is set.
+	Format ImageFormat
 
-	// Error contains any error that occurred during processing.
-	Error error
+	// Optimize writes the item in the smallest format chosen by Optimize, to
+	// OutputPath with the extension of that format. It takes precedence over
+	// Convert.
+	Optimize bool
 }
 
-// IsSuccess returns true if the batch item was processed successfully.
-func (br *BatchResult) IsSuccess() bool {
-	return br.Error == nil && br.Result != nil
+// ConvertItem returns a batch item that converts inputPath to outputPath with opts.
+func ConvertItem(inputPath, outputPath string, opts ConvertOptions) BatchItem {
+	return BatchItem{
+		InputPath:  inputPath,
+		OutputPath: outputPath,
+		Options:    opts.CompressOptions,
+		Convert:    true,
+		Format:     opts.Format,
+	}
 }
 
-// BatchConvertItem represents a single item in batch format conversion.
-type BatchConvertItem struct {
-	// InputPath is the path to the input image file.
-	InputPath string
+// OptimizeItem returns a batch item that writes inputPath in the smallest
+// format chosen by Optimize with opts. outputBase is the output path without
+// an extension; the extension of the chosen format is appended to it.
+func OptimizeItem(inputPath, outputBase string, opts CompressOptions) BatchItem {
+	return BatchItem{
+		InputPath:  inputPath,
+		OutputPath: outputBase,
+		Options:    opts,
+		Optimize:   true,
+	}
+}
 
-	// OutputPath is the path to the output image file.
-	OutputPath string
+// OptimizedPath returns the path an optimize item with the output path base
+// writes an image of the chosen format to.
+func OptimizedPath(base string, format ImageFormat) string {
+	return base + format.Extension()
+}
 
-	// Options contains the conversion options for this item.
-	Options ConvertOptions
+// ConvertOptions returns the conversion options of a conversion item.
+func (item BatchItem) ConvertOptions() ConvertOptions {
+	return ConvertOptions{Format: item.Format, CompressOptions: item.Options}
 }
 
-// BatchConvertResult represents the result of processing a single batch convert item.
-type BatchConvertResult struct {
-	// Item is the original batch convert item.
-	Item BatchConvertItem
+// BatchResult represents the result of processing a single batch item.
+type BatchResult struct {
+	// Item is the original batch item.
+	Item BatchItem
 
 	// Result contains the processing result, nil if error occurred.
 	Result *Result
 
+	// InputHash is the hex-encoded SHA-256 of the input as it was processed,
+	// or of the output when the item was processed in place. It is only set
+	// with WithJournal or WithInputHashes.
+	InputHash string
+
 	// Error contains any error that occurred during processing.
 	Error error
+
+	// Skipped is true if the item was not processed because the batch journal
+	// showed it as already done. Result then holds the journaled result.
+	Skipped bool
+
+	// KeptOriginal is true if compression would not have made the file smaller
+	// and the original was kept, as requested by WithNeverGrow. It is never
+	// set for conversion items. For optimize items it is true when Optimize
+	// wrote the input unchanged because no encoding was smaller.
+	KeptOriginal bool
+
+	// Aborted is true if the item was cancelled or never started because the
+	// failure policy stopped the batch. Error is then ErrBatchAborted.
+	Aborted bool
+
+	// Attempts is the number of times the item was processed, more than 1
+	// when it was retried by WithRetry. It is 0 for items that never ran.
+	Attempts int
+
+	// Duration is the wall-clock time spent on the item, including reading
+	// the input and writing the output.
+	Duration time.Duration
 }
 
-// IsSuccess returns true if the batch convert item was processed successfully.
-func (br *BatchConvertResult) IsSuccess() bool {
+// IsSuccess returns true if the batch item was processed successfully.
+func (br *BatchResult) IsSuccess() bool {
 	return br.Error == nil && br.Result != nil
 }
+
+// OutputPath returns the path the item was written to: Item.OutputPath, or
+// for a successful optimize item that path with the extension of the chosen
+// format.
+func (br *BatchResult) OutputPath() string {
+	if br.Item.Optimize && br.Result != nil {
+		return OptimizedPath(br.Item.OutputPath, br.Result.Format)
+	}
+	return br.Item.OutputPath
+}
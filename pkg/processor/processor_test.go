@@ -229,6 +229,34 @@ func TestCompressOptions_Validate(t *testing.T) {
 			},
 			wantAnyErr: true,
 		},
+		{
+			name: "Page negative is invalid",
+			opts: CompressOptions{
+				Page: -1,
+			},
+			wantAnyErr: true,
+		},
+		{
+			name: "Width negative is invalid",
+			opts: CompressOptions{
+				Width: -1,
+			},
+			wantAnyErr: true,
+		},
+		{
+			name: "Height negative is invalid",
+			opts: CompressOptions{
+				Height: -1,
+			},
+			wantAnyErr: true,
+		},
+		{
+			name: "DPI negative is invalid",
+			opts: CompressOptions{
+				DPI: -72,
+			},
+			wantAnyErr: true,
+		},
 	}
 
 	for _, tt := range tests {
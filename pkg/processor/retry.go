@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy retries batch items that fail with a transient I/O error, such
+// as those seen on network filesystems. Each retry reopens the input and
+// rewrites the output from scratch.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts per item, including the
+	// first. Values below 2 disable retries.
+	Attempts int
+
+	// Backoff is the delay before the first retry. It doubles with every
+	// further retry, up to MaxBackoff when that is set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Retryable reports whether an item error is worth retrying.
+	// nil means IsTransientIOError.
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy returns a policy of 3 attempts with a backoff starting
+// at 100ms and capped at 2s, retrying transient I/O errors.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:   3,
+		Backoff:    100 * time.Millisecond,
+		MaxBackoff: 2 * time.Second,
+		Retryable:  IsTransientIOError,
+	}
+}
+
+// WithRetry retries failed batch items according to p. The number of
+// attempts made is recorded in the Attempts field of each result.
+func WithRetry(p RetryPolicy) BatchProcessorOption {
+	return func(bp *DefaultBatchProcessor) {
+		bp.retry = p
+	}
+}
+
+// transientErrnos are the system errors that commonly clear up on their own
+// on NFS and FUSE mounts.
+var transientErrnos = []syscall.Errno{
+	syscall.EIO,
+	syscall.EAGAIN,
+	syscall.EINTR,
+	syscall.EBUSY,
+	syscall.ESTALE,
+	syscall.ETIMEDOUT,
+	syscall.ECONNRESET,
+}
+
+// IsTransientIOError reports whether err is an I/O error that may succeed
+// when retried: an interrupted, stale or timed-out file or network operation,
+// or an S3 server error or throttling response. Decode and encode errors,
+// missing files and permission errors are not transient.
+func IsTransientIOError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var s3Err *S3Error
+	if errors.As(err, &s3Err) {
+		return s3Err.Temporary()
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// do runs fn until it succeeds, fails with an error that is not retryable,
+// or the attempts are used up, waiting with backoff in between. attempts is
+// set to the number of calls made. The wait is cut short when ctx is done.
+func (p RetryPolicy) do(ctx context.Context, attempts *int, fn func() (*Result, error)) (*Result, error) {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsTransientIOError
+	}
+	delay := p.Backoff
+	for n := 1; ; n++ {
+		*attempts = n
+		res, err := fn()
+		if err == nil || n >= p.Attempts || !retryable(err) {
+			return res, err
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+		delay *= 2
+		if p.MaxBackoff > 0 {
+			delay = min(delay, p.MaxBackoff)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsTransientIOError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "EIO from open", err: &fs.PathError{Op: "open", Path: "a.jpg", Err: syscall.EIO}, want: true},
+		{name: "stale NFS handle", err: fmt.Errorf("write output: %w", syscall.ESTALE), want: true},
+		{name: "timeout", err: &fs.PathError{Op: "read", Path: "a.jpg", Err: syscall.ETIMEDOUT}, want: true},
+		{name: "deadline exceeded", err: os.ErrDeadlineExceeded, want: true},
+		{name: "missing file", err: &fs.PathError{Op: "open", Path: "a.jpg", Err: syscall.ENOENT}, want: false},
+		{name: "permission denied", err: &fs.PathError{Op: "open", Path: "a.jpg", Err: syscall.EACCES}, want: false},
+		{name: "decode error", err: errors.New("failed to decode image: invalid JPEG format"), want: false},
+		{name: "cancelled", err: context.Canceled, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransientIOError(tt.err); got != tt.want {
+				t.Errorf("IsTransientIOError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_do(t *testing.T) {
+	transient := &fs.PathError{Op: "open", Path: "a.jpg", Err: syscall.EIO}
+	permanent := errors.New("failed to decode image")
+
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		errs         []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{name: "no policy", errs: []error{transient, nil}, wantAttempts: 1, wantErr: transient},
+		{name: "succeeds after a transient error", policy: RetryPolicy{Attempts: 3}, errs: []error{transient, nil}, wantAttempts: 2},
+		{name: "attempts used up", policy: RetryPolicy{Attempts: 3}, errs: []error{transient, transient, transient, nil}, wantAttempts: 3, wantErr: transient},
+		{name: "not retryable", policy: RetryPolicy{Attempts: 3}, errs: []error{permanent, nil}, wantAttempts: 1, wantErr: permanent},
+		{
+			name:         "custom classifier",
+			policy:       RetryPolicy{Attempts: 3, Retryable: func(err error) bool { return err == permanent }},
+			errs:         []error{permanent, nil},
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			var attempts int
+			_, err := tt.policy.do(context.Background(), &attempts, func() (*Result, error) {
+				err := tt.errs[calls]
+				calls++
+				return nil, err
+			})
+			if err != tt.wantErr {
+				t.Errorf("do() error = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts || calls != tt.wantAttempts {
+				t.Errorf("attempts = %d, calls = %d, want %d", attempts, calls, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_do_キャンセル(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	p := RetryPolicy{Attempts: 5, Backoff: time.Hour}
+	var attempts int
+	start := time.Now()
+	_, err := p.do(ctx, &attempts, func() (*Result, error) { return nil, syscall.EIO })
+	if !errors.Is(err, syscall.EIO) || attempts != 1 {
+		t.Errorf("do() = %v after %d attempts, want EIO after 1", err, attempts)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("do() waited out the backoff of a cancelled context")
+	}
+}
+
+// flakySink fails the first failures writes with a transient error and
+// discards the rest.
+type flakySink struct {
+	failures int64
+	calls    atomic.Int64
+}
+
+func (s *flakySink) WriteOutput(inputPath, outputPath string, neverGrow bool, encode func(io.Writer) (*Result, error)) (*Result, bool, error) {
+	if s.calls.Add(1) <= s.failures {
+		return nil, false, &fs.PathError{Op: "open", Path: outputPath, Err: syscall.ESTALE}
+	}
+	return DiscardSink.WriteOutput(inputPath, outputPath, neverGrow, encode)
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_リトライ(t *testing.T) {
+	inputDir := t.TempDir()
+	good := writeTestFile(t, inputDir, "good.jpg", createTestJPEG(t, 20, 20, 90))
+	bad := writeTestFile(t, inputDir, "bad.jpg", []byte("not an image"))
+
+	tests := []struct {
+		name         string
+		input        string
+		failures     int64
+		wantSuccess  bool
+		wantAttempts int
+	}{
+		{name: "一時的な書き込みエラーから回復", input: good, failures: 2, wantSuccess: true, wantAttempts: 3},
+		{name: "試行回数を使い切る", input: good, failures: 5, wantSuccess: false, wantAttempts: 3},
+		{name: "デコードエラーは再試行しない", input: bad, failures: 0, wantSuccess: false, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &flakySink{failures: tt.failures}
+			bp := NewDefaultBatchProcessor(WithOutputSink(sink), WithRetry(RetryPolicy{Attempts: 3, Backoff: time.Millisecond}))
+			results, err := bp.ProcessBatch(context.Background(), []BatchItem{
+				{InputPath: tt.input, OutputPath: filepath.Join(t.TempDir(), "out.jpg"), Options: DefaultCompressOptions()},
+			})
+			if err != nil {
+				t.Fatalf("ProcessBatch() error = %v", err)
+			}
+			r := results[0]
+			if r.IsSuccess() != tt.wantSuccess {
+				t.Errorf("IsSuccess() = %v, want %v (error = %v)", r.IsSuccess(), tt.wantSuccess, r.Error)
+			}
+			if r.Attempts != tt.wantAttempts {
+				t.Errorf("Attempts = %d, want %d", r.Attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_変換_リトライ(t *testing.T) {
+	input := writeTestFile(t, t.TempDir(), "a.jpg", createTestJPEG(t, 20, 20, 90))
+
+	bp := NewDefaultBatchProcessor(WithOutputSink(&flakySink{failures: 1}), WithRetry(RetryPolicy{Attempts: 2}))
+	results, err := bp.ProcessBatch(context.Background(), []BatchItem{
+		ConvertItem(input, filepath.Join(t.TempDir(), "a.png"), DefaultConvertOptions(FormatPNG)),
+	})
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	if !results[0].IsSuccess() || results[0].Attempts != 2 {
+		t.Errorf("result = %v after %d attempts, want success after 2", results[0].Error, results[0].Attempts)
+	}
+}
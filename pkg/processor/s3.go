@@ -0,0 +1,402 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3Storage.
+type S3Config struct {
+	// Bucket is the bucket holding the files.
+	Bucket string
+
+	// Region is the region requests are signed for. Empty means "us-east-1".
+	Region string
+
+	// Endpoint is the base URL of an S3-compatible service such as MinIO,
+	// e.g. "http://localhost:9000"; the bucket is then addressed path-style.
+	// Empty means AWS, addressed virtual-hosted-style.
+	Endpoint string
+
+	// AccessKeyID, SecretAccessKey and SessionToken are the credentials.
+	// Without an AccessKeyID requests are sent unsigned.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Client sends the requests. Nil means a client whose requests time out
+	// after DefaultS3Timeout, including reading the response body.
+	Client *http.Client
+}
+
+// DefaultS3Timeout is the time limit of each request sent by an S3Storage
+// without a Client of its own.
+const DefaultS3Timeout = 5 * time.Minute
+
+// S3Storage is a Storage backed by a bucket of Amazon S3 or an S3-compatible
+// service. Names are object keys; List treats "/" as the directory separator.
+// Created objects are buffered in memory and uploaded on Close.
+type S3Storage struct {
+	cfg  S3Config
+	base *url.URL // URL of the bucket root
+	now  func() time.Time
+}
+
+// NewS3Storage returns the S3Storage of the bucket in cfg.
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("S3 bucket is empty")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultS3Timeout}
+	}
+
+	var base *url.URL
+	if cfg.Endpoint != "" {
+		u, err := url.Parse(cfg.Endpoint)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid S3 endpoint: %q", cfg.Endpoint)
+		}
+		base = &url.URL{Scheme: u.Scheme, Host: u.Host, Path: strings.TrimRight(u.Path, "/") + "/" + cfg.Bucket}
+	} else {
+		base = &url.URL{Scheme: "https", Host: cfg.Bucket + ".s3." + cfg.Region + ".amazonaws.com"}
+	}
+	return &S3Storage{cfg: cfg, base: base, now: time.Now}, nil
+}
+
+// S3Error is an error response of an S3-compatible service.
+type S3Error struct {
+	Op         string
+	Key        string
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *S3Error) Error() string {
+	msg := e.Code
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("s3 %s %s: %d %s", e.Op, e.Key, e.StatusCode, msg)
+}
+
+// Temporary reports whether the service asked to retry: server errors and throttling.
+func (e *S3Error) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Open downloads the named object.
+func (s *S3Storage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	key := objectKey(name)
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("open", key, resp)
+	}
+	return resp.Body, nil
+}
+
+// OpenRange downloads length bytes of the named object starting at offset.
+func (s *S3Storage) OpenRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length <= 0 {
+		return nil, fmt.Errorf("invalid range %d+%d", offset, length)
+	}
+	key := objectKey(name)
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)}}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		// The service ignored the range and sent the whole object.
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(resp.Body, length), resp.Body}, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// offset is at or past the end of the object.
+		_ = resp.Body.Close()
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	return nil, responseError("open", key, resp)
+}
+
+// Create returns a writer that uploads the named object when closed.
+func (s *S3Storage) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return &s3Writer{ctx: ctx, s: s, key: objectKey(name)}, nil
+}
+
+// Stat returns the size and modification time of the named object.
+func (s *S3Storage) Stat(ctx context.Context, name string) (fs.FileInfo, error) {
+	key := objectKey(name)
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("stat", key, resp)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return objectInfo{name: path.Base(key), size: resp.ContentLength, modTime: modTime}, nil
+}
+
+// List calls fn for every object under dir. Keys ending in "/", which some
+// tools create as folder markers, are left out.
+func (s *S3Storage) List(ctx context.Context, dir string, fn func(name string) error) error {
+	prefix := objectKey(dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return err
+		}
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if resp.StatusCode != http.StatusOK {
+			return responseError("list", prefix, resp)
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		_ = resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("s3 list %s: %w", prefix, err)
+		}
+
+		for _, c := range page.Contents {
+			if strings.HasSuffix(c.Key, "/") {
+				continue
+			}
+			if err := fn(c.Key); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// s3Writer buffers an object until Close uploads it.
+type s3Writer struct {
+	ctx context.Context
+	s   *S3Storage
+	key string
+	buf bytes.Buffer
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *s3Writer) Close() error {
+	resp, err := w.s.do(w.ctx, http.MethodPut, w.key, nil, nil, w.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return responseError("create", w.key, resp)
+	}
+	return nil
+}
+
+// objectKey returns the object key of name: a cleaned slash-separated path
+// without a leading slash.
+func objectKey(name string) string {
+	return memoryKey(name)
+}
+
+// do sends a signed request for key, or for the bucket itself when key is
+// empty, with the extra headers in header.
+func (s *S3Storage) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.base
+	escaped := uriEncode(u.Path, false)
+	if key != "" {
+		escaped = strings.TrimRight(escaped, "/") + "/" + uriEncode(key, false)
+	} else if escaped == "" {
+		escaped = "/"
+	}
+	u.Path, u.RawPath = "", ""
+	if err := setEscapedPath(&u, escaped); err != nil {
+		return nil, err
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]), s.now())
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %w", strings.ToLower(method), key, err)
+	}
+	return resp, nil
+}
+
+// setEscapedPath sets the path of u from its escaped form, keeping the exact
+// escaping so the request matches its signature.
+func setEscapedPath(u *url.URL, escaped string) error {
+	p, err := url.PathUnescape(escaped)
+	if err != nil {
+		return err
+	}
+	u.Path, u.RawPath = p, escaped
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req, signing
+// the host and every header already set. payloadHash is the hex-encoded
+// SHA-256 of the body.
+func (s *S3Storage) sign(req *http.Request, payloadHash string, now time.Time) {
+	if s.cfg.AccessKeyID == "" {
+		return
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.cfg.SecretAccessKey)
+	for _, part := range []string{date, s.cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.cfg.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by key, as Signature Version 4 requires.
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for k, vs := range query {
+		for _, v := range vs {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes every byte of s except the unreserved characters
+// A-Z, a-z, 0-9, '-', '.', '_' and '~', and '/' unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// responseError reads the error response in resp, mapping a missing object
+// to fs.ErrNotExist.
+func responseError(op, key string, resp *http.Response) error {
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return &fs.PathError{Op: op, Path: key, Err: fs.ErrNotExist}
+	}
+	var body struct {
+		Code    string
+		Message string
+	}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body)
+	return &S3Error{Op: op, Key: key, StatusCode: resp.StatusCode, Code: body.Code, Message: body.Message}
+}
@@ -0,0 +1,349 @@
+package processor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkMode controls how directory scans treat symbolic links.
+type SymlinkMode int
+
+const (
+	// SymlinkFiles scans symlinked files but does not descend into symlinked directories.
+	SymlinkFiles SymlinkMode = iota
+	// SymlinkFollow scans symlinked files and directories. Each directory is visited once,
+	// so link cycles are not followed.
+	SymlinkFollow
+	// SymlinkSkip leaves out every symbolic link.
+	SymlinkSkip
+)
+
+// ScanFilter selects the files visited by ScanDirectory and ScanDirectoryForConvert.
+//
+// Patterns use slash-separated paths relative to the input directory. A
+// pattern without a slash matches the base name at any depth, e.g. "*.png";
+// otherwise it matches the whole relative path, where "**" matches any number
+// of directories, e.g. "**/icons/*.png" or "node_modules/**". A trailing slash
+// matches directories only.
+//
+// The zero value visits every file, including hidden ones, and scans symlinked
+// files without descending into symlinked directories.
+type ScanFilter struct {
+	// Include limits the scan to files matching at least one pattern. Empty means all files.
+	Include []string
+
+	// Exclude leaves out files and whole directories matching any pattern.
+	Exclude []string
+
+	// MaxDepth limits how many directory levels are scanned; 1 means only the
+	// files directly in the input directory. 0 means no limit.
+	MaxDepth int
+
+	// IgnoreFiles names ignore files, e.g. ".gitignore" or ".lokiignore", read
+	// from every scanned directory. They use gitignore syntax, including "!" to
+	// re-include, and apply to the directory they are in and below.
+	IgnoreFiles []string
+
+	// Symlinks controls how symbolic links are treated.
+	Symlinks SymlinkMode
+
+	// SkipHidden leaves out files and directories whose name starts with a dot.
+	SkipHidden bool
+}
+
+// WithFilter sets the filter selecting the files scanned by ScanDirectory.
+func WithFilter(f ScanFilter) ScanDirectoryOption {
+	return func(cfg *scanConfig) {
+		cfg.filter = f
+	}
+}
+
+// WithConvertFilter sets the filter selecting the files scanned by ScanDirectoryForConvert.
+func WithConvertFilter(f ScanFilter) ScanDirectoryForConvertOption {
+	return func(cfg *scanConvertConfig) {
+		cfg.filter = f
+	}
+}
+
+// ScanImages returns the image files under dir that pass f, in lexical order.
+// Unlike ScanDirectory it also returns decode-only formats such as HEIC and SVG.
+func ScanImages(dir string, f ScanFilter) ([]string, error) {
+	if err := checkInputDir(dir); err != nil {
+		return nil, err
+	}
+	var paths []string
+	err := walkFiles(dir, f, func(path string) error {
+		if _, err := detectFormatFromPath(path); err == nil {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan directory: %w", err)
+	}
+	return paths, nil
+}
+
+// globPattern is a compiled include, exclude or ignore pattern.
+type globPattern struct {
+	segments []string
+	anchored bool // matched against the whole relative path instead of the base name
+	dirOnly  bool
+	negate   bool // "!" in ignore files
+}
+
+// compileGlob parses pattern, reporting malformed patterns.
+func compileGlob(pattern string) (globPattern, error) {
+	var g globPattern
+	p := pattern
+	if strings.HasSuffix(p, "/") {
+		g.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	if strings.HasPrefix(p, "/") {
+		g.anchored = true
+		p = strings.TrimLeft(p, "/")
+	}
+	if p == "" {
+		return g, fmt.Errorf("invalid pattern %q: empty", pattern)
+	}
+	if strings.Contains(p, "/") {
+		g.anchored = true
+	}
+	g.segments = strings.Split(p, "/")
+	for _, seg := range g.segments {
+		if _, err := path.Match(seg, ""); err != nil {
+			return g, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return g, nil
+}
+
+// match reports whether the slash-separated relative path rel matches g.
+func (g globPattern) match(rel string, isDir bool) bool {
+	if g.dirOnly && !isDir {
+		return false
+	}
+	if g.anchored {
+		return matchSegments(g.segments, strings.Split(rel, "/"))
+	}
+	return matchSegments(g.segments, []string{path.Base(rel)})
+}
+
+// matchSegments matches path segments against pattern segments, where "**"
+// matches zero or more segments.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range len(name) + 1 {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// compileGlobs compiles every pattern in patterns.
+func compileGlobs(patterns []string) ([]globPattern, error) {
+	globs := make([]globPattern, 0, len(patterns))
+	for _, p := range patterns {
+		g, err := compileGlob(p)
+		if err != nil {
+			return nil, err
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+// matchAny reports whether rel matches any of globs.
+func matchAny(globs []globPattern, rel string, isDir bool) bool {
+	for _, g := range globs {
+		if g.match(rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// walker visits the files under a directory that pass a ScanFilter.
+type walker struct {
+	filter  ScanFilter
+	include []globPattern
+	exclude []globPattern
+	ignores map[string][]globPattern // ignore rules keyed by relative directory
+	visited map[string]bool          // real paths of visited directories when following links
+}
+
+// walkFiles calls fn for every regular file under root that passes f, in
+// lexical order. Paths passed to fn are joined to root like filepath.WalkDir.
+func walkFiles(root string, f ScanFilter, fn func(path string) error) error {
+	w, err := newWalker(f)
+	if err != nil {
+		return err
+	}
+	return w.walkDir(root, ".", 0, fn)
+}
+
+// newWalker compiles the patterns of f.
+func newWalker(f ScanFilter) (*walker, error) {
+	w := &walker{filter: f, ignores: make(map[string][]globPattern), visited: make(map[string]bool)}
+	var err error
+	if w.include, err = compileGlobs(f.Include); err != nil {
+		return nil, err
+	}
+	if w.exclude, err = compileGlobs(f.Exclude); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *walker) walkDir(dir, rel string, depth int, fn func(string) error) error {
+	if w.filter.Symlinks == SymlinkFollow {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+		if w.visited[real] {
+			return nil
+		}
+		w.visited[real] = true
+	}
+	if err := w.loadIgnores(context.Background(), LocalStorage{}, dir, rel); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if w.filter.SkipHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		p := filepath.Join(dir, name)
+		r := path.Join(rel, name)
+
+		isDir := e.IsDir()
+		if e.Type()&fs.ModeSymlink != 0 {
+			if w.filter.Symlinks == SymlinkSkip {
+				continue
+			}
+			info, err := os.Stat(p)
+			if err != nil {
+				continue // Broken link.
+			}
+			isDir = info.IsDir()
+			if isDir && w.filter.Symlinks != SymlinkFollow {
+				continue
+			}
+		}
+
+		if matchAny(w.exclude, r, isDir) || w.ignored(r, isDir) {
+			continue
+		}
+		if isDir {
+			if w.filter.MaxDepth > 0 && depth+1 >= w.filter.MaxDepth {
+				continue
+			}
+			if err := w.walkDir(p, r, depth+1, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(w.include) > 0 && !matchAny(w.include, r, false) {
+			continue
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadIgnores reads the ignore files of dir from s.
+func (w *walker) loadIgnores(ctx context.Context, s Storage, dir, rel string) error {
+	for _, name := range w.filter.IgnoreFiles {
+		rules, err := readIgnoreFile(ctx, s, filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		w.ignores[rel] = append(w.ignores[rel], rules...)
+	}
+	return nil
+}
+
+// ignored applies the ignore rules of every directory above rel, from the
+// root down; the last matching rule wins.
+func (w *walker) ignored(rel string, isDir bool) bool {
+	if len(w.ignores) == 0 {
+		return false
+	}
+	ignored := false
+	dir := "."
+	sub := rel
+	for {
+		for _, g := range w.ignores[dir] {
+			if g.match(sub, isDir) {
+				ignored = !g.negate
+			}
+		}
+		head, tail, ok := strings.Cut(sub, "/")
+		if !ok {
+			return ignored
+		}
+		dir = path.Join(dir, head)
+		sub = tail
+	}
+}
+
+// readIgnoreFile parses a gitignore-style file. A missing file has no rules.
+func readIgnoreFile(ctx context.Context, s Storage, name string) ([]globPattern, error) {
+	f, err := s.Open(ctx, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var rules []globPattern
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := strings.HasPrefix(line, "!")
+		g, err := compileGlob(strings.TrimPrefix(line, "!"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		g.negate = negate
+		rules = append(rules, g)
+	}
+	return rules, sc.Err()
+}
@@ -0,0 +1,224 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// scanRelPaths runs ScanDirectory with f and returns the slash-separated input paths relative to dir.
+func scanRelPaths(t *testing.T, dir string, f ScanFilter) []string {
+	t.Helper()
+	items, err := ScanDirectory(dir, t.TempDir(), WithFilter(f))
+	if err != nil {
+		t.Fatalf("ScanDirectory() error = %v", err)
+	}
+	var rels []string
+	for _, item := range items {
+		rel, err := filepath.Rel(dir, item.InputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	return rels
+}
+
+func TestScanDirectory_フィルタ(t *testing.T) {
+	dir := t.TempDir()
+	jpeg := createTestJPEG(t, 8, 8, 80)
+	for _, name := range []string{
+		"a.jpg", "b.png", "sub/c.jpg", "sub/deep/d.png", "sub/deep/keep.png",
+		"node_modules/pkg/x.png", ".hidden/e.jpg", ".f.jpg", "build/g.jpg",
+	} {
+		writeTestFile(t, dir, name, jpeg)
+	}
+	writeTestFile(t, dir, ".lokiignore", []byte("# generated\nbuild/\n"))
+	writeTestFile(t, dir, "sub/.gitignore", []byte("deep/*.png\n!keep.png\n"))
+
+	all := []string{".f.jpg", ".hidden/e.jpg", "a.jpg", "b.png", "build/g.jpg", "node_modules/pkg/x.png", "sub/c.jpg", "sub/deep/d.png", "sub/deep/keep.png"}
+
+	tests := []struct {
+		name   string
+		filter ScanFilter
+		want   []string
+	}{
+		{name: "フィルタなし", want: all},
+		{
+			name:   "include_ダブルスター",
+			filter: ScanFilter{Include: []string{"**/*.png"}},
+			want:   []string{"b.png", "node_modules/pkg/x.png", "sub/deep/d.png", "sub/deep/keep.png"},
+		},
+		{
+			name:   "include_ベース名",
+			filter: ScanFilter{Include: []string{"c.jpg", "x.png"}},
+			want:   []string{"node_modules/pkg/x.png", "sub/c.jpg"},
+		},
+		{
+			name:   "exclude_ディレクトリ",
+			filter: ScanFilter{Exclude: []string{"node_modules/**", "sub/deep/"}},
+			want:   []string{".f.jpg", ".hidden/e.jpg", "a.jpg", "b.png", "build/g.jpg", "sub/c.jpg"},
+		},
+		{
+			name:   "最大深さ1",
+			filter: ScanFilter{MaxDepth: 1},
+			want:   []string{".f.jpg", "a.jpg", "b.png"},
+		},
+		{
+			name:   "最大深さ2",
+			filter: ScanFilter{MaxDepth: 2, SkipHidden: true, Exclude: []string{"node_modules"}},
+			want:   []string{"a.jpg", "b.png", "build/g.jpg", "sub/c.jpg"},
+		},
+		{
+			name:   "隠しファイルを除外",
+			filter: ScanFilter{SkipHidden: true, Include: []string{"*.jpg"}},
+			want:   []string{"a.jpg", "build/g.jpg", "sub/c.jpg"},
+		},
+		{
+			name:   "ignoreファイル",
+			filter: ScanFilter{IgnoreFiles: []string{".gitignore", ".lokiignore"}, SkipHidden: true},
+			want:   []string{"a.jpg", "b.png", "node_modules/pkg/x.png", "sub/c.jpg", "sub/deep/keep.png"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scanRelPaths(t, dir, tt.filter)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("scanned %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanDirectory_シンボリックリンク(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "in")
+	outside := filepath.Join(base, "outside")
+	jpeg := createTestJPEG(t, 8, 8, 80)
+	writeTestFile(t, dir, "a.jpg", jpeg)
+	writeTestFile(t, outside, "b.jpg", jpeg)
+	if err := os.Symlink(outside, filepath.Join(dir, "linkdir")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "b.jpg"), filepath.Join(dir, "link.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	// A cycle back to the input directory must not be followed forever.
+	if err := os.Symlink(dir, filepath.Join(outside, "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		mode SymlinkMode
+		want []string
+	}{
+		{name: "ファイルのみ", mode: SymlinkFiles, want: []string{"a.jpg", "link.jpg"}},
+		{name: "たどる", mode: SymlinkFollow, want: []string{"a.jpg", "link.jpg", "linkdir/b.jpg"}},
+		{name: "スキップ", mode: SymlinkSkip, want: []string{"a.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scanRelPaths(t, dir, ScanFilter{Symlinks: tt.mode})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("scanned %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanDirectoryForConvert_フィルタ(t *testing.T) {
+	dir := t.TempDir()
+	jpeg := createTestJPEG(t, 8, 8, 80)
+	writeTestFile(t, dir, "a.jpg", jpeg)
+	writeTestFile(t, dir, "skip/b.jpg", jpeg)
+
+	items, err := ScanDirectoryForConvert(dir, t.TempDir(), FormatPNG, WithConvertFilter(ScanFilter{Exclude: []string{"skip/"}}))
+	if err != nil {
+		t.Fatalf("ScanDirectoryForConvert() error = %v", err)
+	}
+	if len(items) != 1 || filepath.Base(items[0].InputPath) != "a.jpg" {
+		t.Errorf("items = %+v, want only a.jpg", items)
+	}
+}
+
+func TestScanImages(t *testing.T) {
+	dir := t.TempDir()
+	jpeg := createTestJPEG(t, 8, 8, 80)
+	for _, name := range []string{"b.heic", "a.jpg", "notes.txt", "sub/c.svg", "sub/deep/d.png"} {
+		writeTestFile(t, dir, name, jpeg)
+	}
+
+	paths, err := ScanImages(dir, ScanFilter{MaxDepth: 2})
+	if err != nil {
+		t.Fatalf("ScanImages() error = %v", err)
+	}
+	var rels []string
+	for _, p := range paths {
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	if want := []string{"a.jpg", "b.heic", "sub/c.svg"}; !slices.Equal(rels, want) {
+		t.Errorf("ScanImages() = %v, want %v", rels, want)
+	}
+
+	if _, err := ScanImages(filepath.Join(dir, "a.jpg"), ScanFilter{}); err == nil {
+		t.Error("ScanImages() expected error for a file")
+	}
+}
+
+func TestScanDirectory_不正なパターン(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.jpg", createTestJPEG(t, 8, 8, 80))
+
+	tests := []struct {
+		name   string
+		filter ScanFilter
+	}{
+		{name: "include", filter: ScanFilter{Include: []string{"[a-"}}},
+		{name: "exclude", filter: ScanFilter{Exclude: []string{"/"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ScanDirectory(dir, t.TempDir(), WithFilter(tt.filter)); err == nil {
+				t.Error("ScanDirectory() expected error for invalid pattern")
+			}
+		})
+	}
+}
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"**/*.png", "a.png", true},
+		{"**/*.png", "x/y/a.png", true},
+		{"**/*.png", "x/a.jpg", false},
+		{"icons/**", "icons", true},
+		{"icons/**", "icons/a/b.png", true},
+		{"a/**/b.png", "a/b.png", true},
+		{"a/**/b.png", "a/x/y/b.png", true},
+		{"a/*/b.png", "a/x/y/b.png", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"_"+tt.path, func(t *testing.T) {
+			g, err := compileGlob(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := g.match(tt.path, false); got != tt.want {
+				t.Errorf("match(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
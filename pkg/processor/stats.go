@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"image"
+	"sync"
+	"time"
+)
+
+// Stats holds the measurements taken while processing one image.
+type Stats struct {
+	// DecodeDuration is the time spent decoding the input.
+	DecodeDuration time.Duration
+
+	// TransformDuration is the time spent on color management and resizing.
+	TransformDuration time.Duration
+
+	// EncodeDuration is the time spent encoding and writing the output.
+	EncodeDuration time.Duration
+
+	// InputWidth and InputHeight are the pixel dimensions of the decoded
+	// input. For multi-page and animated input they describe the first page or frame.
+	InputWidth  int
+	InputHeight int
+
+	// OutputWidth and OutputHeight are the pixel dimensions of the encoded
+	// output. SVG input is rasterized at the output size, so both sizes match.
+	OutputWidth  int
+	OutputHeight int
+}
+
+// Add accumulates the stage durations of o into s. Dimensions are left unchanged,
+// which makes Add suitable for summing the stats of a batch.
+func (s *Stats) Add(o Stats) {
+	s.DecodeDuration += o.DecodeDuration
+	s.TransformDuration += o.TransformDuration
+	s.EncodeDuration += o.EncodeDuration
+}
+
+// addDecode adds the time since start to the decode stage. s may be nil.
+func (s *Stats) addDecode(start time.Time) {
+	if s != nil {
+		s.DecodeDuration += time.Since(start)
+	}
+}
+
+// addTransform adds the time since start to the transform stage. s may be nil.
+func (s *Stats) addTransform(start time.Time) {
+	if s != nil {
+		s.TransformDuration += time.Since(start)
+	}
+}
+
+// addEncode adds the time since start to the encode stage. s may be nil.
+func (s *Stats) addEncode(start time.Time) {
+	if s != nil {
+		s.EncodeDuration += time.Since(start)
+	}
+}
+
+// recordInput records the size of the first decoded image. s may be nil.
+func (s *Stats) recordInput(img image.Image) {
+	if s != nil && s.InputWidth == 0 {
+		s.InputWidth, s.InputHeight = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+}
+
+// recordOutput records the size of the first image to encode. s may be nil.
+func (s *Stats) recordOutput(img image.Image) {
+	if s != nil && s.OutputWidth == 0 {
+		s.OutputWidth, s.OutputHeight = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+}
+
+// progressTracker accumulates the counts and throughput reported to the
+// progress callback of a batch.
+type progressTracker struct {
+	mu    sync.Mutex
+	p     Progress
+	start time.Time
+	bytes int64
+}
+
+func newProgressTracker(total int) *progressTracker {
+	return &progressTracker{p: Progress{Total: total}, start: time.Now()}
+}
+
+// finish records a finished item and returns a snapshot of the progress.
+func (t *progressTracker) finish(o itemOutcome) Progress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case o.aborted:
+		t.p.Aborted++
+	case o.failed:
+		t.p.Failed++
+	default:
+		t.p.Completed++
+		if o.skipped {
+			t.p.Skipped++
+		}
+	}
+	// Skipped items finish without being read, so they would inflate the
+	// throughput and shorten the ETA.
+	if o.res != nil && !o.skipped {
+		t.bytes += o.res.OriginalSize
+	}
+	return t.progress(o.path)
+}
+
+// snapshot returns the current progress with path as the current item.
+func (t *progressTracker) snapshot(path string) Progress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.progress(path)
+}
+
+// progress derives the rates and ETA of the counts so far. t.mu must be held.
+func (t *progressTracker) progress(path string) Progress {
+	p := t.p
+	p.Current = path
+	p.Elapsed = time.Since(t.start)
+	done := p.Finished()
+	processed := done - p.Skipped - p.Aborted
+	if secs := p.Elapsed.Seconds(); secs > 0 {
+		p.FilesPerSecond = float64(done) / secs
+		p.BytesPerSecond = float64(t.bytes) / secs
+	}
+	if processed > 0 && p.Total > 0 {
+		p.ETA = time.Duration(float64(p.Elapsed) / float64(processed) * float64(p.Total-done))
+	}
+	return p
+}
@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestResult_Stats(t *testing.T) {
+	tests := []struct {
+		name       string
+		p          Processor
+		input      []byte
+		opts       CompressOptions
+		wantInput  [2]int
+		wantOutput [2]int
+	}{
+		{name: "jpeg original size", p: NewJPEGProcessor(), input: createTestJPEG(t, 40, 20, 90), wantInput: [2]int{40, 20}, wantOutput: [2]int{40, 20}},
+		{name: "jpeg width ignored", p: NewJPEGProcessor(), input: createTestJPEG(t, 40, 20, 90), opts: CompressOptions{Width: 10}, wantInput: [2]int{40, 20}, wantOutput: [2]int{40, 20}},
+		{name: "svg rendered", p: NewPNGProcessor(), input: []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 30 30"><rect width="30" height="30"/></svg>`), opts: CompressOptions{Height: 15}, wantInput: [2]int{15, 15}, wantOutput: [2]int{15, 15}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			res, err := tt.p.Compress(context.Background(), bytes.NewReader(tt.input), &buf, tt.opts)
+			if err != nil {
+				t.Fatalf("Compress() error = %v", err)
+			}
+			st := res.Stats
+			if got := [2]int{st.InputWidth, st.InputHeight}; got != tt.wantInput {
+				t.Errorf("input size = %v, want %v", got, tt.wantInput)
+			}
+			if got := [2]int{st.OutputWidth, st.OutputHeight}; got != tt.wantOutput {
+				t.Errorf("output size = %v, want %v", got, tt.wantOutput)
+			}
+			if st.DecodeDuration <= 0 || st.EncodeDuration <= 0 {
+				t.Errorf("durations = %+v, want positive decode and encode", st)
+			}
+		})
+	}
+}
+
+func TestStats_Add(t *testing.T) {
+	total := Stats{InputWidth: 10}
+	total.Add(Stats{DecodeDuration: 1, TransformDuration: 2, EncodeDuration: 3, InputWidth: 99})
+	total.Add(Stats{DecodeDuration: 10, TransformDuration: 20, EncodeDuration: 30})
+
+	want := Stats{DecodeDuration: 11, TransformDuration: 22, EncodeDuration: 33, InputWidth: 10}
+	if total != want {
+		t.Errorf("Add() = %+v, want %+v", total, want)
+	}
+}
+
+func TestProgressTracker_SkippedItems(t *testing.T) {
+	tracker := newProgressTracker(4)
+	tracker.start = time.Now().Add(-time.Second)
+	tracker.finish(itemOutcome{path: "a", res: &Result{OriginalSize: 1000}, skipped: true})
+	p := tracker.finish(itemOutcome{path: "b", res: &Result{OriginalSize: 1000}, skipped: true})
+	if p.BytesPerSecond != 0 || p.ETA != 0 {
+		t.Errorf("skipped only: BytesPerSecond = %v, ETA = %v, want 0", p.BytesPerSecond, p.ETA)
+	}
+
+	p = tracker.finish(itemOutcome{path: "c", res: &Result{OriginalSize: 500}})
+	if p.Skipped != 2 || p.Completed != 3 {
+		t.Errorf("Progress = %+v, want 3 completed with 2 skipped", p)
+	}
+	if p.BytesPerSecond <= 0 || p.BytesPerSecond > 500 {
+		t.Errorf("BytesPerSecond = %v, want only the processed item", p.BytesPerSecond)
+	}
+	// One processed item took the whole elapsed time and one item remains.
+	if p.ETA < p.Elapsed-10*time.Millisecond || p.ETA > p.Elapsed+10*time.Millisecond {
+		t.Errorf("ETA = %v, want about %v", p.ETA, p.Elapsed)
+	}
+}
@@ -0,0 +1,435 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage is where batches and scans read their inputs and write their
+// outputs. Names are paths within the storage: operating system paths for
+// LocalStorage and slash-separated keys for the other backends. Remote
+// backends stop waiting once ctx is done; a reader or writer returned by
+// Open or Create stays bound to the ctx it was created with.
+type Storage interface {
+	// Open opens the named file for reading. A missing file is reported with
+	// an error matching fs.ErrNotExist.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+
+	// Create returns a writer replacing the named file. The new contents are
+	// stored only once Close returns nil; until then any existing file is left
+	// untouched. Close stores nothing once ctx is done, so cancelling ctx
+	// abandons a partly written file.
+	Create(ctx context.Context, name string) (io.WriteCloser, error)
+
+	// Stat returns the size and modification time of the named file. A
+	// missing file is reported with an error matching fs.ErrNotExist.
+	Stat(ctx context.Context, name string) (fs.FileInfo, error)
+
+	// List calls fn for every file under dir, at any depth, in lexical order.
+	// Listing stops at the first error returned by fn.
+	List(ctx context.Context, dir string, fn func(name string) error) error
+}
+
+// RangeStorage is implemented by storages that can read part of a file,
+// such as S3Storage. Memory estimates then fetch only the image header
+// instead of the whole file.
+type RangeStorage interface {
+	Storage
+
+	// OpenRange opens length bytes of the named file starting at offset for
+	// reading. Fewer bytes are returned when the file ends earlier.
+	OpenRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error)
+}
+
+// WithStorage reads inputs from s and writes outputs to it instead of the
+// local file system. Backups, in-place permissions and WithManifest only
+// apply to local files; the journal set by WithJournal is still a local file
+// but hashes inputs and checks outputs through s.
+func WithStorage(s Storage) BatchProcessorOption {
+	return func(bp *DefaultBatchProcessor) {
+		bp.storage = s
+	}
+}
+
+// WithScanStorage makes ScanDirectory list inputDir in s. IgnoreFiles are
+// read from s; Symlinks only applies to LocalStorage.
+func WithScanStorage(s Storage) ScanDirectoryOption {
+	return func(cfg *scanConfig) {
+		cfg.storage = s
+	}
+}
+
+// WithScanContext makes ScanDirectory pass ctx to the storage it lists, so
+// that a scan of remote storage stops once ctx is done.
+func WithScanContext(ctx context.Context) ScanDirectoryOption {
+	return func(cfg *scanConfig) {
+		cfg.ctx = ctx
+	}
+}
+
+// WithConvertScanStorage makes ScanDirectoryForConvert list inputDir in s.
+// IgnoreFiles are read from s; Symlinks only applies to LocalStorage.
+func WithConvertScanStorage(s Storage) ScanDirectoryForConvertOption {
+	return func(cfg *scanConvertConfig) {
+		cfg.storage = s
+	}
+}
+
+// WithConvertScanContext is the ScanDirectoryForConvert counterpart of WithScanContext.
+func WithConvertScanContext(ctx context.Context) ScanDirectoryForConvertOption {
+	return func(cfg *scanConvertConfig) {
+		cfg.ctx = ctx
+	}
+}
+
+// storageOrLocal returns s, or LocalStorage when s is nil.
+func storageOrLocal(s Storage) Storage {
+	if s == nil {
+		return LocalStorage{}
+	}
+	return s
+}
+
+// isLocal reports whether s is the local file system.
+func isLocal(s Storage) bool {
+	_, ok := storageOrLocal(s).(LocalStorage)
+	return ok
+}
+
+// sameName reports whether a and b name the same file of s.
+func sameName(s Storage, a, b string) bool {
+	if isLocal(s) {
+		return sameFile(a, b)
+	}
+	return path.Clean(filepath.ToSlash(a)) == path.Clean(filepath.ToSlash(b))
+}
+
+// readStorageFile returns the contents of the named file of s.
+func readStorageFile(ctx context.Context, s Storage, name string) ([]byte, error) {
+	f, err := s.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return io.ReadAll(f)
+}
+
+// LocalStorage is the Storage of the local file system. Create writes a
+// temporary file next to the target and renames it into place on Close.
+// File system calls do not block on ctx, which only decides whether Close
+// stores the new file.
+type LocalStorage struct{}
+
+// Open opens the named file for reading.
+func (LocalStorage) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// Create creates the parent directories of name and returns a writer that
+// replaces the file atomically when closed. A new file gets mode 0666 as
+// modified by the umask; an existing file is replaced with a new one.
+func (LocalStorage) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := createTemp(dir, "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &localWriter{ctx: ctx, f: tmp, name: name}, nil
+}
+
+// Stat returns the FileInfo of the named file.
+func (LocalStorage) Stat(_ context.Context, name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// List calls fn for every regular file under dir, like walkFiles without a filter.
+func (LocalStorage) List(_ context.Context, dir string, fn func(name string) error) error {
+	return walkFiles(dir, ScanFilter{}, fn)
+}
+
+// localWriter is the temporary file behind LocalStorage.Create.
+type localWriter struct {
+	ctx  context.Context
+	f    *os.File
+	name string
+	err  error
+}
+
+func (w *localWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// Close renames the temporary file into place, or removes it if a write
+// failed or ctx is done.
+func (w *localWriter) Close() error {
+	err := w.err
+	if err == nil {
+		err = w.ctx.Err()
+	}
+	if err == nil {
+		err = w.f.Sync()
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(w.f.Name(), w.name)
+	}
+	if err != nil {
+		_ = os.Remove(w.f.Name())
+	}
+	return err
+}
+
+// MemoryStorage is a Storage kept in memory, e.g. for tests or for
+// processing images that never touch the disk. It is safe for concurrent use.
+type MemoryStorage struct {
+	mu    sync.Mutex
+	files map[string]memoryFile
+}
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: make(map[string]memoryFile)}
+}
+
+// memoryKey returns the key of name: a cleaned slash-separated path without a leading slash.
+func memoryKey(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// WriteFile stores data as the named file.
+func (m *MemoryStorage) WriteFile(name string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[memoryKey(name)] = memoryFile{data: slices.Clone(data), modTime: time.Now()}
+}
+
+// remove deletes the named file, if any.
+func (m *MemoryStorage) remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, memoryKey(name))
+}
+
+// ReadFile returns a copy of the contents of the named file.
+func (m *MemoryStorage) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[memoryKey(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return slices.Clone(f.data), nil
+}
+
+// Open opens the named file for reading.
+func (m *MemoryStorage) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	data, err := m.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Create returns a writer that stores the named file when closed.
+func (m *MemoryStorage) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return &memoryWriter{ctx: ctx, m: m, name: name}, nil
+}
+
+// Stat returns the size and modification time of the named file.
+func (m *MemoryStorage) Stat(_ context.Context, name string) (fs.FileInfo, error) {
+	key := memoryKey(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[key]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return objectInfo{name: path.Base(key), size: int64(len(f.data)), modTime: f.modTime}, nil
+}
+
+// List calls fn for every file under dir in lexical order.
+func (m *MemoryStorage) List(_ context.Context, dir string, fn func(name string) error) error {
+	prefix := memoryKey(dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+	m.mu.Lock()
+	var names []string
+	for key := range m.files {
+		if strings.HasPrefix(key, prefix) {
+			names = append(names, key)
+		}
+	}
+	m.mu.Unlock()
+
+	slices.Sort(names)
+	for _, name := range names {
+		if err := fn(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryWriter struct {
+	ctx  context.Context
+	m    *MemoryStorage
+	name string
+	buf  bytes.Buffer
+}
+
+func (w *memoryWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *memoryWriter) Close() error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	w.m.WriteFile(w.name, w.buf.Bytes())
+	return nil
+}
+
+// objectInfo is the fs.FileInfo of a file in a storage without directories.
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i objectInfo) Name() string       { return i.name }
+func (i objectInfo) Size() int64        { return i.size }
+func (i objectInfo) Mode() fs.FileMode  { return 0o644 }
+func (i objectInfo) ModTime() time.Time { return i.modTime }
+func (i objectInfo) IsDir() bool        { return false }
+func (i objectInfo) Sys() any           { return nil }
+
+// storageSink is the OutputSink of a storage other than LocalStorage. The
+// output is encoded into memory and only stored once encoding succeeded.
+type storageSink struct {
+	ctx context.Context
+	s   Storage
+
+	// original is the input as read by the encoder, if it was kept.
+	original *bytes.Buffer
+}
+
+func (sink storageSink) WriteOutput(inputPath, outputPath string, neverGrow bool, encode func(io.Writer) (*Result, error)) (*Result, bool, error) {
+	var buf bytes.Buffer
+	res, err := encode(&buf)
+	if err != nil {
+		return nil, false, err
+	}
+
+	kept := false
+	if neverGrow && res.CompressedSize >= res.OriginalSize {
+		res.CompressedSize = res.OriginalSize
+		if sameName(sink.s, inputPath, outputPath) {
+			return res, true, nil
+		}
+		kept = true
+		var data []byte
+		if sink.original != nil && int64(sink.original.Len()) == res.OriginalSize {
+			data = sink.original.Bytes()
+		} else if data, err = readStorageFile(sink.ctx, sink.s, inputPath); err != nil {
+			return nil, false, fmt.Errorf("failed to open input file: %w", err)
+		}
+		buf.Reset()
+		buf.Write(data)
+	}
+
+	w, err := sink.s.Create(sink.ctx, outputPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create output file: %w", err)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		_ = w.Close()
+		return nil, false, fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, false, fmt.Errorf("failed to close output file: %w", err)
+	}
+	return res, kept, nil
+}
+
+// walkStorage is walkFiles for storages other than LocalStorage. Their
+// listings hold files only, so directory patterns are matched against the
+// parent directories of each name.
+func walkStorage(ctx context.Context, s Storage, root string, f ScanFilter, fn func(name string) error) error {
+	w, err := newWalker(f)
+	if err != nil {
+		return err
+	}
+	loaded := make(map[string]bool)
+	load := func(dir string) error {
+		if loaded[dir] {
+			return nil
+		}
+		loaded[dir] = true
+		return w.loadIgnores(ctx, s, filepath.Join(root, dir), dir)
+	}
+	return s.List(ctx, root, func(name string) error {
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		ok, err := w.allows(filepath.ToSlash(rel), load)
+		if err != nil || !ok {
+			return err
+		}
+		return fn(name)
+	})
+}
+
+// allows reports whether the file at the slash-separated path rel passes the
+// filter of w. load, if non-nil, is called for every directory above rel,
+// from the root down, before its ignore rules are applied.
+func (w *walker) allows(rel string, load func(dir string) error) (bool, error) {
+	segs := strings.Split(rel, "/")
+	if w.filter.MaxDepth > 0 && len(segs) > w.filter.MaxDepth {
+		return false, nil
+	}
+
+	dir := "."
+	for i, seg := range segs {
+		if w.filter.SkipHidden && strings.HasPrefix(seg, ".") {
+			return false, nil
+		}
+		if load != nil {
+			if err := load(dir); err != nil {
+				return false, err
+			}
+		}
+		r := path.Join(segs[:i+1]...)
+		isDir := i < len(segs)-1
+		if matchAny(w.exclude, r, isDir) || w.ignored(r, isDir) {
+			return false, nil
+		}
+		dir = r
+	}
+	return len(w.include) == 0 || matchAny(w.include, dir, false), nil
+}
@@ -0,0 +1,270 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	s := NewMemoryStorage()
+	s.WriteFile("in/b.jpg", []byte("b"))
+	s.WriteFile("/in/sub/a.png", []byte("a"))
+	s.WriteFile("other/c.jpg", []byte("c"))
+
+	w, err := s.Create(context.Background(), "in/new.gif")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := w.Write([]byte("new")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, err := s.Stat(context.Background(), "in/new.gif"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat() before Close error = %v, want fs.ErrNotExist", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	info, err := s.Stat(context.Background(), "in/new.gif")
+	if err != nil || info.Size() != 3 || info.Name() != "new.gif" {
+		t.Errorf("Stat() = %v, %v, want new.gif of 3 bytes", info, err)
+	}
+	f, err := s.Open(context.Background(), "in/sub/a.png")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	if string(data) != "a" {
+		t.Errorf("Open() read %q, want %q", data, "a")
+	}
+	if _, err := s.Open(context.Background(), "in/missing.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open(missing) error = %v, want fs.ErrNotExist", err)
+	}
+
+	var names []string
+	if err := s.List(context.Background(), "in", func(name string) error {
+		names = append(names, name)
+		return nil
+	}); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	want := []string{"in/b.jpg", "in/new.gif", "in/sub/a.png"}
+	if !slices.Equal(names, want) {
+		t.Errorf("List() = %v, want %v", names, want)
+	}
+}
+
+func TestLocalStorage_Create(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "sub", "out.jpg")
+
+	w, err := LocalStorage{}.Create(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := w.Write([]byte("data")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, err := os.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("output exists before Close: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	got, err := os.ReadFile(name)
+	if err != nil || string(got) != "data" {
+		t.Errorf("output = %q, %v, want %q", got, err, "data")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(name))
+	if len(entries) != 1 {
+		t.Errorf("output directory has %d entries, want only the output", len(entries))
+	}
+
+	// The output gets the same mode as a file created normally under the umask.
+	ref, err := os.Create(filepath.Join(dir, "ref"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = ref.Close()
+	want, err := os.Stat(ref.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != want.Mode().Perm() {
+		t.Errorf("perm = %v, want %v", info.Mode().Perm(), want.Mode().Perm())
+	}
+}
+
+func TestStorage_Create_キャンセル(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "out.jpg")
+	if err := os.WriteFile(name, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemoryStorage()
+	mem.WriteFile("out.jpg", []byte("old"))
+
+	for _, tt := range []struct {
+		name string
+		s    Storage
+		read func() ([]byte, error)
+	}{
+		{"local", LocalStorage{}, func() ([]byte, error) { return os.ReadFile(name) }},
+		{"memory", mem, func() ([]byte, error) { return mem.ReadFile("out.jpg") }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			target := name
+			if tt.name == "memory" {
+				target = "out.jpg"
+			}
+			w, err := tt.s.Create(ctx, target)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			_, _ = w.Write([]byte("partial"))
+			cancel()
+			if err := w.Close(); !errors.Is(err, context.Canceled) {
+				t.Errorf("Close() error = %v, want context.Canceled", err)
+			}
+			if got, err := tt.read(); err != nil || string(got) != "old" {
+				t.Errorf("file = %q, %v, want the old contents", got, err)
+			}
+		})
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(name)); len(entries) != 1 {
+		t.Errorf("output directory has %d entries, want no temporary file left", len(entries))
+	}
+}
+
+func TestWalkStorage(t *testing.T) {
+	s := NewMemoryStorage()
+	for _, name := range []string{
+		"root/a.jpg",
+		"root/.hidden.jpg",
+		"root/icons/b.png",
+		"root/icons/deep/c.png",
+		"root/node_modules/d.jpg",
+		"root/tmp/e.jpg",
+		"other/f.jpg",
+	} {
+		s.WriteFile(name, []byte("x"))
+	}
+	s.WriteFile("root/.lokiignore", []byte("tmp/\n"))
+
+	tests := []struct {
+		name   string
+		filter ScanFilter
+		want   []string
+	}{
+		{
+			name: "no filter",
+			want: []string{"root/.hidden.jpg", "root/.lokiignore", "root/a.jpg", "root/icons/b.png", "root/icons/deep/c.png", "root/node_modules/d.jpg", "root/tmp/e.jpg"},
+		},
+		{
+			name:   "include and exclude",
+			filter: ScanFilter{Include: []string{"*.png", "*.jpg"}, Exclude: []string{"node_modules/", "deep"}},
+			want:   []string{"root/.hidden.jpg", "root/a.jpg", "root/icons/b.png", "root/tmp/e.jpg"},
+		},
+		{
+			name:   "max depth and hidden",
+			filter: ScanFilter{MaxDepth: 1, SkipHidden: true},
+			want:   []string{"root/a.jpg"},
+		},
+		{
+			name:   "ignore files",
+			filter: ScanFilter{IgnoreFiles: []string{".lokiignore"}, Include: []string{"*.jpg"}},
+			want:   []string{"root/.hidden.jpg", "root/a.jpg", "root/node_modules/d.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := walkStorage(context.Background(), s, "root", tt.filter, func(name string) error {
+				got = append(got, name)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("walkStorage() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("walkStorage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessBatch_メモリストレージ(t *testing.T) {
+	s := NewMemoryStorage()
+	s.WriteFile("in/a.jpg", createTestJPEG(t, 40, 40, 95))
+	s.WriteFile("in/sub/b.png", createTestPNG(t, 20, 20))
+	s.WriteFile("in/broken.jpg", []byte("not an image"))
+
+	items, err := ScanDirectory("in", "out", WithScanStorage(s), WithFilter(ScanFilter{Exclude: []string{"broken.jpg"}}))
+	if err != nil {
+		t.Fatalf("ScanDirectory() error = %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("ScanDirectory() = %d items, want 2", len(items))
+	}
+
+	bp := NewDefaultBatchProcessor(WithStorage(s), WithNeverGrow())
+	results, err := bp.ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	for _, r := range results {
+		if !r.IsSuccess() {
+			t.Fatalf("%s failed: %v", r.Item.InputPath, r.Error)
+		}
+		info, err := s.Stat(context.Background(), r.Item.OutputPath)
+		if err != nil {
+			t.Fatalf("output %s missing: %v", r.Item.OutputPath, err)
+		}
+		if info.Size() != r.Result.CompressedSize {
+			t.Errorf("%s size = %d, want %d", r.Item.OutputPath, info.Size(), r.Result.CompressedSize)
+		}
+	}
+	if _, err := os.Stat("out"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("batch wrote to the local disk: %v", err)
+	}
+}
+
+func TestScanDirectoryForConvert_メモリストレージ(t *testing.T) {
+	s := NewMemoryStorage()
+	s.WriteFile("in/a.jpg", createTestJPEG(t, 10, 10, 90))
+	s.WriteFile("in/b.png", createTestPNG(t, 10, 10))
+
+	items, err := ScanDirectoryForConvert("in", "out", FormatPNG, WithConvertScanStorage(s))
+	if err != nil {
+		t.Fatalf("ScanDirectoryForConvert() error = %v", err)
+	}
+	if len(items) != 1 || items[0].OutputPath != filepath.Join("out", "a.png") {
+		t.Fatalf("ScanDirectoryForConvert() = %+v, want in/a.jpg to out/a.png", items)
+	}
+
+	results, err := NewDefaultBatchProcessor(WithStorage(s)).ProcessBatch(context.Background(), items)
+	if err != nil || !results[0].IsSuccess() {
+		t.Fatalf("ProcessBatch() = %v, %v", results, err)
+	}
+	data, err := s.ReadFile("out/a.png")
+	if err != nil {
+		t.Fatalf("output missing: %v", err)
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || format != "png" {
+		t.Errorf("output format = %q, %v, want png", format, err)
+	}
+}
@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"context"
+	"iter"
+	"sync"
+)
+
+// ProcessStream processes the items of a sequence, for example one returned
+// by ScanDirectorySeq, and yields each result as soon as it completes. Unlike
+// ProcessBatch it neither collects the items nor the results, so memory stays
+// bounded by the number of workers however long the sequence is. Items are
+// pulled from the sequence while earlier ones are still being processed.
+//
+// Results are yielded in completion order. Progress updates report a Total
+// of 0 since the length of the sequence is unknown. Stopping the iteration
+// early cancels the items in flight. A failure policy set by WithMaxFailures
+// or WithMaxFailurePercent aborts the rest of the stream as in ProcessBatch,
+// with every remaining item yielded as Aborted. The returned function reports
+// the error of opening or closing the journal, if any, once iteration has
+// finished.
+func (bp *DefaultBatchProcessor) ProcessStream(ctx context.Context, items iter.Seq[BatchItem]) (iter.Seq[BatchResult], func() error) {
+	var err error
+	seq := func(yield func(BatchResult) bool) {
+		err = bp.stream(func(j *journal) {
+			streamBatch(ctx, bp, j, 0, items, func(_ int, r BatchResult) bool { return yield(r) })
+		})
+	}
+	return seq, func() error { return err }
+}
+
+// stream runs fn with the journal of bp open.
+func (bp *DefaultBatchProcessor) stream(fn func(*journal)) error {
+	j, err := bp.openJournal()
+	if err != nil {
+		return err
+	}
+	fn(j)
+	return j.close()
+}
+
+// itemOutcome summarizes a finished item for progress reporting.
+type itemOutcome struct {
+	path    string
+	res     *Result
+	failed  bool
+	skipped bool
+	aborted bool
+}
+
+func (br BatchResult) outcome() itemOutcome {
+	return itemOutcome{path: br.Item.InputPath, res: br.Result, failed: br.Error != nil, skipped: br.Skipped, aborted: br.Aborted}
+}
+
+// streamBatch runs every item on the workers of bp, reports the
+// progress of each result and passes it with the index of its item to yield
+// until yield returns false. total is the number of items, or 0 if unknown.
+// Once the failure policy trips, the remaining items are aborted.
+func streamBatch(ctx context.Context, bp *DefaultBatchProcessor, j *journal, total int, items iter.Seq[BatchItem], yield func(int, BatchResult) bool) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	progress := newProgressTracker(total)
+	sem := newMemorySemaphore(bp.memoryBudget)
+	workers := bp.maxWorkers
+	if total > 0 {
+		workers = min(workers, total)
+	}
+
+	// Results are accounted for on the worker, so that a tripped failure
+	// policy takes effect before the worker starts on its next item. The
+	// progress callback is called here on the collecting goroutine only, so
+	// that callbacks never run concurrently and their counts never decrease.
+	work := func(item BatchItem) BatchResult {
+		result := bp.runItem(ctx, j, sem, item)
+		if bp.exceedsFailureBudget(progress.finish(result.outcome())) {
+			cancel(ErrBatchAborted)
+		}
+		return result
+	}
+	for idx, result := range runWorkers(workers, items, work) {
+		if bp.progressCallback != nil {
+			bp.progressCallback(progress.snapshot(result.outcome().path))
+		}
+		if !yield(idx, result) {
+			// Let the items in flight fail fast before the workers are drained.
+			cancel(nil)
+			break
+		}
+	}
+}
+
+// indexed pairs a value with the position of its item in the input sequence.
+type indexed[T any] struct {
+	idx int
+	v   T
+}
+
+// runWorkers calls work for every item of items on the given number of
+// goroutines and yields each result with the index of its item, in completion
+// order. Items are pulled from the sequence only as workers become free, so at
+// most a few items per worker are buffered. When the consumer stops early,
+// the remaining items are not pulled and the results in flight are discarded.
+func runWorkers[I, R any](workers int, items iter.Seq[I], work func(I) R) iter.Seq2[int, R] {
+	return func(yield func(int, R) bool) {
+		workers = max(workers, 1)
+		stop := make(chan struct{})
+		jobs := make(chan indexed[I], workers)
+		results := make(chan indexed[R], workers)
+
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			defer close(jobs)
+			idx := 0
+			for item := range items {
+				select {
+				case jobs <- indexed[I]{idx: idx, v: item}:
+				case <-stop:
+					return
+				}
+				idx++
+			}
+		})
+		for range workers {
+			wg.Go(func() {
+				for job := range jobs {
+					select {
+					case results <- indexed[R]{idx: job.idx, v: work(job.v)}:
+					case <-stop:
+						return
+					}
+				}
+			})
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		defer func() {
+			close(stop)
+			for range results {
+				// Drain so that every goroutine has exited on return.
+			}
+		}()
+		for r := range results {
+			if !yield(r.idx, r.v) {
+				return
+			}
+		}
+	}
+}
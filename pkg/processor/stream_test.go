@@ -0,0 +1,182 @@
+package processor
+
+import (
+	"context"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDefaultBatchProcessor_ProcessStream(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	jpegData := createTestJPEG(t, 20, 20, 90)
+	names := []string{"a.jpg", "b.png", "sub/c.jpg", "sub/deep/d.jpg"}
+	for _, name := range names {
+		data := jpegData
+		if filepath.Ext(name) == ".png" {
+			data = createTestPNG(t, 20, 20)
+		}
+		writeTestFile(t, inputDir, name, data)
+	}
+	writeTestFile(t, inputDir, "broken.jpg", []byte("not an image"))
+
+	var mu sync.Mutex
+	var updates []Progress
+	bp := NewDefaultBatchProcessor(WithMaxWorkers(2), WithProgressCallback(func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		updates = append(updates, p)
+	}))
+	items, scanErr := ScanDirectorySeq(inputDir, outputDir)
+	results, streamErr := bp.ProcessStream(context.Background(), items)
+
+	var succeeded, failed []string
+	for r := range results {
+		rel, _ := filepath.Rel(inputDir, r.Item.InputPath)
+		if r.IsSuccess() {
+			succeeded = append(succeeded, filepath.ToSlash(rel))
+		} else {
+			failed = append(failed, filepath.ToSlash(rel))
+		}
+	}
+	if err := scanErr(); err != nil {
+		t.Fatalf("scan error = %v", err)
+	}
+	if err := streamErr(); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+
+	slices.Sort(succeeded)
+	if !slices.Equal(succeeded, names) {
+		t.Errorf("succeeded = %v, want %v", succeeded, names)
+	}
+	if !slices.Equal(failed, []string{"broken.jpg"}) {
+		t.Errorf("failed = %v, want [broken.jpg]", failed)
+	}
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); err != nil {
+			t.Errorf("output %s: %v", name, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(updates) != 5 {
+		t.Fatalf("got %d progress updates, want 5", len(updates))
+	}
+	// Callbacks are serialized, so the counts never decrease.
+	for i := 1; i < len(updates); i++ {
+		if updates[i].Finished() < updates[i-1].Finished() {
+			t.Errorf("progress went back from %d to %d finished items", updates[i-1].Finished(), updates[i].Finished())
+		}
+	}
+	last := updates[len(updates)-1]
+	if last.Total != 0 || last.Completed != 4 || last.Failed != 1 || last.ETA != 0 {
+		t.Errorf("last progress = %+v, want unknown total, 4 completed, 1 failed and no ETA", last)
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessStream_途中で停止(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	input := writeTestFile(t, inputDir, "a.jpg", createTestJPEG(t, 20, 20, 90))
+
+	// An endless sequence: the stream must stop pulling once the consumer stops.
+	var pulled atomic.Int64
+	var items iter.Seq[BatchItem] = func(yield func(BatchItem) bool) {
+		for i := 0; ; i++ {
+			pulled.Add(1)
+			item := BatchItem{InputPath: input, OutputPath: filepath.Join(outputDir, "out", string(rune('a'+i%26))+".jpg")}
+			if !yield(item) {
+				return
+			}
+		}
+	}
+
+	bp := NewDefaultBatchProcessor(WithMaxWorkers(2))
+	results, streamErr := bp.ProcessStream(context.Background(), items)
+	n := 0
+	for range results {
+		n++
+		if n == 3 {
+			break
+		}
+	}
+	if err := streamErr(); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+	if n != 3 {
+		t.Errorf("got %d results, want 3", n)
+	}
+	// Up to one item per worker, per buffer slot and in the feeder may be in flight.
+	if got := pulled.Load(); got > 3+3*2+1 {
+		t.Errorf("pulled %d items after stopping at 3, want a bounded read-ahead", got)
+	}
+}
+
+func TestDefaultBatchProcessor_ProcessStream_変換(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, inputDir, "a.jpg", createTestJPEG(t, 20, 20, 90))
+	writeTestFile(t, inputDir, "sub/b.jpg", createTestJPEG(t, 20, 20, 90))
+
+	items, scanErr := ScanDirectoryForConvertSeq(inputDir, outputDir, FormatPNG)
+	results, streamErr := NewDefaultBatchProcessor().ProcessStream(context.Background(), items)
+
+	var outputs []string
+	for r := range results {
+		if !r.IsSuccess() {
+			t.Errorf("%s: %v", r.Item.InputPath, r.Error)
+			continue
+		}
+		rel, _ := filepath.Rel(outputDir, r.Item.OutputPath)
+		outputs = append(outputs, filepath.ToSlash(rel))
+	}
+	if err := scanErr(); err != nil {
+		t.Fatalf("scan error = %v", err)
+	}
+	if err := streamErr(); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+	slices.Sort(outputs)
+	if want := []string{"a.png", "sub/b.png"}; !slices.Equal(outputs, want) {
+		t.Errorf("outputs = %v, want %v", outputs, want)
+	}
+}
+
+func TestScanDirectorySeq(t *testing.T) {
+	t.Run("stops walking when the consumer stops", func(t *testing.T) {
+		dir := t.TempDir()
+		jpeg := createTestJPEG(t, 4, 4, 80)
+		for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+			writeTestFile(t, dir, name, jpeg)
+		}
+		items, scanErr := ScanDirectorySeq(dir, t.TempDir())
+		var got []string
+		for item := range items {
+			got = append(got, filepath.Base(item.InputPath))
+			break
+		}
+		if err := scanErr(); err != nil {
+			t.Fatalf("scan error = %v", err)
+		}
+		if !slices.Equal(got, []string{"a.jpg"}) {
+			t.Errorf("items = %v, want [a.jpg]", got)
+		}
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		items, scanErr := ScanDirectorySeq(filepath.Join(t.TempDir(), "missing"), t.TempDir())
+		for range items {
+			t.Error("yielded an item for a missing directory")
+		}
+		if scanErr() == nil {
+			t.Error("expected an error for a missing directory")
+		}
+	})
+}
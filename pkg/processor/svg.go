@@ -0,0 +1,299 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"golang.org/x/net/html/charset"
+)
+
+// ErrUnsafeSVG is returned when an SVG document contains a DOCTYPE, entity
+// declaration or a reference to an external resource. Only same-document
+// references such as href="#id" and url(#id) are allowed.
+var ErrUnsafeSVG = errors.New("svg contains external references")
+
+// defaultSVGDPI is the CSS reference resolution used to convert SVG units to pixels.
+const defaultSVGDPI = 96
+
+// maxSVGPixels bounds the rendered pixel count to avoid huge allocations:
+// the RGBA canvas of the largest allowed render takes 256 MiB.
+const maxSVGPixels = 8192 * 8192
+
+// svgSniffTokens limits how many XML tokens isSVG reads before giving up.
+const svgSniffTokens = 64
+
+// svgUnits maps SVG length units to CSS pixels at 96 DPI.
+var svgUnits = map[string]float64{
+	"":   1,
+	"px": 1,
+	"in": 96,
+	"cm": 96 / 2.54,
+	"mm": 96 / 25.4,
+	"pt": 96.0 / 72,
+	"pc": 16,
+}
+
+// isSVG reports whether data is an XML document whose root element is <svg>.
+func isSVG(data []byte) bool {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if !bytes.HasPrefix(data, []byte("<")) {
+		return false
+	}
+	dec := newSVGDecoder(data)
+	for range svgSniffTokens {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			return se.Name.Local == "svg"
+		}
+	}
+	return false
+}
+
+// newSVGDecoder returns an XML decoder that accepts non-UTF-8 encodings.
+func newSVGDecoder(data []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = charset.NewReaderLabel
+	return dec
+}
+
+// svgSize is the intrinsic size of an SVG document in CSS pixels.
+type svgSize struct {
+	width, height float64
+	// hasViewBox reports whether the root element declares a viewBox.
+	hasViewBox bool
+}
+
+// inspectSVG rejects unsafe SVG documents and returns the intrinsic size of the
+// root element, taken from its width/height attributes or else its viewBox.
+func inspectSVG(data []byte) (svgSize, error) {
+	var size svgSize
+	var inStyle bool
+	root := true
+	dec := newSVGDecoder(data)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return size, fmt.Errorf("invalid svg: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.Directive:
+			return size, fmt.Errorf("%w: DOCTYPE and entity declarations are not allowed", ErrUnsafeSVG)
+		case xml.ProcInst:
+			if t.Target != "xml" {
+				return size, fmt.Errorf("%w: processing instruction %q", ErrUnsafeSVG, t.Target)
+			}
+		case xml.StartElement:
+			if t.Name.Local == "foreignObject" {
+				return size, fmt.Errorf("%w: foreignObject is not allowed", ErrUnsafeSVG)
+			}
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "href" && !strings.HasPrefix(strings.TrimSpace(attr.Value), "#") {
+					return size, fmt.Errorf("%w: href %q", ErrUnsafeSVG, attr.Value)
+				}
+				if err := checkSVGURLs(attr.Value); err != nil {
+					return size, err
+				}
+			}
+			if root {
+				size = svgRootSize(t.Attr)
+				root = false
+			}
+			inStyle = t.Name.Local == "style"
+		case xml.EndElement:
+			inStyle = false
+		case xml.CharData:
+			if !inStyle {
+				continue
+			}
+			if strings.Contains(strings.ToLower(unescapeCSS(string(t))), "@import") {
+				return size, fmt.Errorf("%w: @import", ErrUnsafeSVG)
+			}
+			if err := checkSVGURLs(string(t)); err != nil {
+				return size, err
+			}
+		}
+	}
+	if size.width <= 0 || size.height <= 0 {
+		return size, errors.New("invalid svg: missing width/height and viewBox")
+	}
+	return size, nil
+}
+
+// checkSVGURLs returns ErrUnsafeSVG if s contains a url() that is not a
+// fragment reference. CSS escapes are decoded and function names are matched
+// case-insensitively, so spellings such as URL( or u\72l( are caught too.
+func checkSVGURLs(s string) error {
+	s = unescapeCSS(s)
+	lower := strings.ToLower(s)
+	for {
+		i := strings.Index(lower, "url(")
+		if i < 0 {
+			return nil
+		}
+		s, lower = s[i+len("url("):], lower[i+len("url("):]
+		ref := strings.TrimLeft(s, " \t\r\n\f'\"")
+		if !strings.HasPrefix(ref, "#") {
+			end := strings.IndexByte(s, ')')
+			if end < 0 {
+				end = len(s)
+			}
+			return fmt.Errorf("%w: url(%s)", ErrUnsafeSVG, s[:end])
+		}
+	}
+}
+
+// unescapeCSS decodes CSS escapes: a backslash followed by up to six hex
+// digits and an optional whitespace character, or by any other character
+// that then stands for itself.
+func unescapeCSS(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		j := i + 1
+		for j < len(s) && j-i <= 6 && isHexDigit(s[j]) {
+			j++
+		}
+		if j == i+1 {
+			b.WriteByte(s[j])
+			i = j
+			continue
+		}
+		v, _ := strconv.ParseUint(s[i+1:j], 16, 32)
+		b.WriteRune(rune(v))
+		if j < len(s) && strings.IndexByte(" \t\r\n\f", s[j]) >= 0 {
+			j++
+		}
+		i = j - 1
+	}
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// svgRootSize returns the intrinsic size declared on the root <svg> element.
+func svgRootSize(attrs []xml.Attr) svgSize {
+	var size, viewBox svgSize
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "width":
+			size.width = parseSVGLength(attr.Value)
+		case "height":
+			size.height = parseSVGLength(attr.Value)
+		case "viewBox":
+			f := strings.FieldsFunc(attr.Value, func(r rune) bool { return r == ',' || r == ' ' })
+			if len(f) == 4 {
+				viewBox.width, _ = strconv.ParseFloat(f[2], 64)
+				viewBox.height, _ = strconv.ParseFloat(f[3], 64)
+				viewBox.hasViewBox = viewBox.width > 0 && viewBox.height > 0
+			}
+		}
+	}
+	// Missing or relative (e.g. "100%") lengths fall back to the viewBox,
+	// preserving its aspect ratio when only one length is given.
+	size.hasViewBox = viewBox.hasViewBox
+	switch {
+	case size.width > 0 && size.height > 0:
+		return size
+	case size.width > 0 && viewBox.hasViewBox:
+		size.height = size.width * viewBox.height / viewBox.width
+		return size
+	case size.height > 0 && viewBox.hasViewBox:
+		size.width = size.height * viewBox.width / viewBox.height
+		return size
+	default:
+		return viewBox
+	}
+}
+
+// parseSVGLength converts an absolute SVG length to CSS pixels.
+// Relative or unparseable lengths return 0.
+func parseSVGLength(s string) float64 {
+	s = strings.TrimSpace(s)
+	unit := strings.TrimLeft(s, "0123456789.+-eE")
+	scale, ok := svgUnits[unit]
+	if !ok {
+		return 0
+	}
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, unit), 64)
+	if err != nil {
+		return 0
+	}
+	return v * scale
+}
+
+// svgTargetSize returns the pixel size to render at. An explicit width and
+// height are used as-is; a single one keeps the intrinsic aspect ratio;
+// otherwise the intrinsic size is scaled by dpi/96. Both sizes are at least 1.
+func svgTargetSize(size svgSize, width, height int, dpi float64) (int, int) {
+	switch {
+	case width > 0 && height > 0:
+		return width, height
+	case width > 0:
+		return width, svgPixels(float64(width) * size.height / size.width)
+	case height > 0:
+		return svgPixels(float64(height) * size.width / size.height), height
+	}
+	if dpi <= 0 {
+		dpi = defaultSVGDPI
+	}
+	scale := dpi / defaultSVGDPI
+	return svgPixels(size.width * scale), svgPixels(size.height * scale)
+}
+
+// svgPixels rounds a render length to whole pixels, clamped to [1, MaxInt32]
+// so that absurd sizes are rejected by the pixel limit instead of overflowing.
+func svgPixels(v float64) int {
+	return int(min(max(math.Round(v), 1), math.MaxInt32))
+}
+
+// decodeSVG rasterizes an SVG document at the size requested in opts.
+func decodeSVG(data []byte, opts CompressOptions) (image.Image, error) {
+	size, err := inspectSVG(data)
+	if err != nil {
+		return nil, err
+	}
+	w, h := svgTargetSize(size, opts.Width, opts.Height, opts.DPI)
+	if int64(w)*int64(h) > maxSVGPixels {
+		return nil, fmt.Errorf("invalid svg: render size %dx%d exceeds %d pixels", w, h, maxSVGPixels)
+	}
+
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid svg: %w", err)
+	}
+	if !size.hasViewBox {
+		// Without a viewBox, user units are CSS pixels of the intrinsic size.
+		icon.ViewBox.X, icon.ViewBox.Y = 0, 0
+		icon.ViewBox.W, icon.ViewBox.H = size.width, size.height
+	}
+	icon.SetTarget(0, 0, float64(w), float64(h))
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	scanner := rasterx.NewScannerGV(w, h, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(w, h, scanner), 1)
+	return img, nil
+}
@@ -0,0 +1,235 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/png"
+	"testing"
+)
+
+// testSVG is a 100x50 red rectangle with a blue right half.
+const testSVG = `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="100" height="50" viewBox="0 0 100 50">
+  <rect x="0" y="0" width="100" height="50" fill="#ff0000"/>
+  <rect x="50" y="0" width="50" height="50" fill="#0000ff"/>
+</svg>`
+
+func TestIsSVG(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{name: "with xml declaration", data: testSVG, want: true},
+		{name: "bare svg element", data: `<svg xmlns="http://www.w3.org/2000/svg"/>`, want: true},
+		{name: "leading comment and BOM", data: "\xef\xbb\xbf\n<!-- logo --><svg/>", want: true},
+		{name: "other xml root", data: `<?xml version="1.0"?><html/>`, want: false},
+		{name: "binary", data: "\x89PNG\r\n\x1a\n", want: false},
+		{name: "empty", data: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSVG([]byte(tt.data)); got != tt.want {
+				t.Errorf("isSVG() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSVG_Size(t *testing.T) {
+	tests := []struct {
+		name       string
+		svg        string
+		opts       CompressOptions
+		wantWidth  int
+		wantHeight int
+	}{
+		{name: "intrinsic size", svg: testSVG, wantWidth: 100, wantHeight: 50},
+		{name: "width keeps aspect ratio", svg: testSVG, opts: CompressOptions{Width: 512}, wantWidth: 512, wantHeight: 256},
+		{name: "height keeps aspect ratio", svg: testSVG, opts: CompressOptions{Height: 20}, wantWidth: 40, wantHeight: 20},
+		{name: "explicit width and height", svg: testSVG, opts: CompressOptions{Width: 30, Height: 30}, wantWidth: 30, wantHeight: 30},
+		{name: "dpi scales intrinsic size", svg: testSVG, opts: CompressOptions{DPI: 192}, wantWidth: 200, wantHeight: 100},
+		{
+			name:      "physical units",
+			svg:       `<svg xmlns="http://www.w3.org/2000/svg" width="1in" height="0.5in" viewBox="0 0 2 1"><rect width="2" height="1"/></svg>`,
+			opts:      CompressOptions{DPI: 300},
+			wantWidth: 300, wantHeight: 150,
+		},
+		{
+			name:      "viewBox only",
+			svg:       `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 12"><rect width="24" height="12"/></svg>`,
+			wantWidth: 24, wantHeight: 12,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := decodeImage([]byte(tt.svg), tt.opts, nil)
+			if err != nil {
+				t.Fatalf("decodeImage() error = %v", err)
+			}
+			if got := img.Bounds().Size(); got.X != tt.wantWidth || got.Y != tt.wantHeight {
+				t.Errorf("size = %dx%d, want %dx%d", got.X, got.Y, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestDecodeSVG_Pixels(t *testing.T) {
+	img, err := decodeImage([]byte(testSVG), CompressOptions{Width: 200}, nil)
+	if err != nil {
+		t.Fatalf("decodeImage() error = %v", err)
+	}
+	r, g, b, a := img.At(50, 50).RGBA()
+	if r>>8 != 255 || g != 0 || b != 0 || a>>8 != 255 {
+		t.Errorf("left pixel = (%d,%d,%d,%d), want opaque red", r>>8, g>>8, b>>8, a>>8)
+	}
+	r, g, b, _ = img.At(150, 50).RGBA()
+	if r != 0 || g != 0 || b>>8 != 255 {
+		t.Errorf("right pixel = (%d,%d,%d), want blue", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestDecodeSVG_RejectsUnsafe(t *testing.T) {
+	tests := []struct {
+		name string
+		svg  string
+	}{
+		{
+			name: "doctype with external entity",
+			svg: `<?xml version="1.0"?><!DOCTYPE svg [<!ENTITY xxe SYSTEM "file:///etc/passwd">]>
+<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><text>&xxe;</text></svg>`,
+		},
+		{
+			name: "external image href",
+			svg:  `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><image href="https://example.com/a.png" width="10" height="10"/></svg>`,
+		},
+		{
+			name: "external xlink href",
+			svg:  `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="10" height="10"><use xlink:href="other.svg#icon"/></svg>`,
+		},
+		{
+			name: "external url in attribute",
+			svg:  `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10" fill="url(https://example.com/g.svg#g)"/></svg>`,
+		},
+		{
+			name: "uppercase url in attribute",
+			svg:  `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10" style="fill: URL( 'https://example.com/g.svg#g' )"/></svg>`,
+		},
+		{
+			name: "css escaped url in style",
+			svg:  `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><style>rect { fill: u\72 l(https://example.com/g.svg#g) }</style></svg>`,
+		},
+		{
+			name: "escaped import",
+			svg:  `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><style>@\69mport "https://example.com/a.css";</style></svg>`,
+		},
+		{
+			name: "style import",
+			svg:  `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><style>@import "https://example.com/a.css";</style></svg>`,
+		},
+		{
+			name: "stylesheet processing instruction",
+			svg:  `<?xml version="1.0"?><?xml-stylesheet href="https://example.com/a.css"?><svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"/>`,
+		},
+		{
+			name: "foreignObject",
+			svg:  `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><foreignObject width="10" height="10"/></svg>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeImage([]byte(tt.svg), CompressOptions{}, nil)
+			if !errors.Is(err, ErrUnsafeSVG) {
+				t.Errorf("decodeImage() error = %v, want %v", err, ErrUnsafeSVG)
+			}
+		})
+	}
+}
+
+func TestDecodeSVG_AllowsFragmentReferences(t *testing.T) {
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="10" height="10">
+  <defs>
+    <linearGradient id="g"><stop offset="0" stop-color="#fff"/><stop offset="1" stop-color="#000"/></linearGradient>
+    <rect id="box" width="10" height="10"/>
+  </defs>
+  <rect width="10" height="10" fill="url(#g)"/>
+  <use xlink:href="#box"/>
+</svg>`
+	if _, err := decodeImage([]byte(svg), CompressOptions{}, nil); err != nil {
+		t.Errorf("decodeImage() error = %v", err)
+	}
+}
+
+func TestDecodeSVG_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		svg  string
+		opts CompressOptions
+	}{
+		{name: "missing size", svg: `<svg xmlns="http://www.w3.org/2000/svg"><rect width="1" height="1"/></svg>`},
+		{name: "too many pixels", svg: testSVG, opts: CompressOptions{Width: 12000, Height: 12000}},
+		{name: "huge dpi", svg: testSVG, opts: CompressOptions{DPI: 1e300}},
+		{name: "truncated", svg: `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeImage([]byte(tt.svg), tt.opts, nil); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestSVG_ConvertToPNG(t *testing.T) {
+	opts := DefaultConvertOptions(FormatPNG)
+	opts.Width = 64
+
+	var buf bytes.Buffer
+	result, err := NewPNGProcessor().Convert(context.Background(), bytes.NewReader([]byte(testSVG)), &buf, opts)
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if result.Format != FormatPNG {
+		t.Errorf("Format = %v, want %v", result.Format, FormatPNG)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("output is not a valid PNG: %v", err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 32 {
+		t.Errorf("size = %v, want 64x32", img.Bounds().Size())
+	}
+}
+
+func TestRasterInputKeepsSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       CompressOptions
+		wantWidth  int
+		wantHeight int
+	}{
+		{name: "unchanged", opts: CompressOptions{}, wantWidth: 40, wantHeight: 20},
+		{name: "width ignored", opts: CompressOptions{Width: 10}, wantWidth: 40, wantHeight: 20},
+		{name: "height ignored", opts: CompressOptions{Height: 10}, wantWidth: 40, wantHeight: 20},
+		{name: "both ignored", opts: CompressOptions{Width: 7, Height: 9}, wantWidth: 40, wantHeight: 20},
+		{name: "dpi ignored", opts: CompressOptions{DPI: 300}, wantWidth: 40, wantHeight: 20},
+	}
+
+	input := createTestPNG(t, 40, 20)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := decodeImage(input, tt.opts, nil)
+			if err != nil {
+				t.Fatalf("decodeImage() error = %v", err)
+			}
+			if got := img.Bounds().Size(); got.X != tt.wantWidth || got.Y != tt.wantHeight {
+				t.Errorf("size = %dx%d, want %dx%d", got.X, got.Y, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
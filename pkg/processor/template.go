@@ -0,0 +1,227 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// templateVars lists the variables supported by output templates.
+var templateVars = map[string]bool{
+	"dir":     true,
+	"name":    true,
+	"ext":     true,
+	"format":  true,
+	"width":   true,
+	"height":  true,
+	"quality": true,
+	"hash":    true,
+	"hash8":   true,
+}
+
+// OutputTemplate builds output paths from a pattern such as
+// "{dir}/{name}.{width}w.{ext}". The supported variables are:
+//
+//	{dir}     directory of the input relative to the scanned directory ("." at the top)
+//	{name}    base name of the input without its extension
+//	{ext}     extension of the output format without the dot, e.g. "jpg"
+//	{format}  output format, e.g. "jpeg"
+//	{width}   width of the output image in pixels
+//	{height}  height of the output image in pixels
+//	{quality} JPEG/WebP quality used, from Quality or Level
+//	{hash}    hex SHA-256 of the input contents; {hash8} is its first 8 characters
+//
+// {width} and {height} are read from the image headers, or computed from the
+// render options for SVG, so they never decode the input.
+type OutputTemplate struct {
+	pattern string
+	parts   []templatePart
+}
+
+// templatePart is a literal string or, when isVar is set, a variable name.
+type templatePart struct {
+	text  string
+	isVar bool
+}
+
+// ParseOutputTemplate parses an output path template, reporting unknown
+// variables and unbalanced braces.
+func ParseOutputTemplate(pattern string) (*OutputTemplate, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("invalid output template: empty")
+	}
+	t := &OutputTemplate{pattern: pattern}
+	rest := pattern
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			t.parts = append(t.parts, templatePart{text: rest})
+			break
+		}
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("invalid output template %q: unexpected '}'", pattern)
+		}
+		if open > 0 {
+			t.parts = append(t.parts, templatePart{text: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid output template %q: unclosed '{'", pattern)
+		}
+		name := rest[open+1 : open+end]
+		if !templateVars[name] {
+			return nil, fmt.Errorf("invalid output template %q: unknown variable {%s}", pattern, name)
+		}
+		t.parts = append(t.parts, templatePart{text: name, isVar: true})
+		rest = rest[open+end+1:]
+	}
+	return t, nil
+}
+
+// String returns the template pattern.
+func (t *OutputTemplate) String() string {
+	return t.pattern
+}
+
+// uses reports whether the template refers to any of the named variables.
+func (t *OutputTemplate) uses(names ...string) bool {
+	for _, p := range t.parts {
+		if p.isVar && slices.Contains(names, p.text) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand returns the output path for the input at inputPath written as format
+// with opts. {dir} is relative to root; when root is empty it is the
+// directory of inputPath itself. The result is a cleaned path using the
+// operating system's separators.
+func (t *OutputTemplate) Expand(root, inputPath string, format ImageFormat, opts CompressOptions) (string, error) {
+	return t.expand(context.Background(), LocalStorage{}, root, inputPath, format, opts)
+}
+
+// expand is Expand reading the input from s.
+func (t *OutputTemplate) expand(ctx context.Context, s Storage, root, inputPath string, format ImageFormat, opts CompressOptions) (string, error) {
+	dir := filepath.Dir(inputPath)
+	if root != "" {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return "", err
+		}
+		dir = rel
+	}
+	base := filepath.Base(inputPath)
+	vars := map[string]string{
+		"dir":     filepath.ToSlash(dir),
+		"name":    strings.TrimSuffix(base, filepath.Ext(base)),
+		"ext":     strings.TrimPrefix(format.Extension(), "."),
+		"format":  format.String(),
+		"quality": strconv.Itoa(templateQuality(opts)),
+	}
+
+	if t.uses("width", "height", "hash", "hash8") {
+		data, err := readStorageFile(ctx, s, inputPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read input file: %w", err)
+		}
+		if t.uses("hash", "hash8") {
+			sum := sha256.Sum256(data)
+			vars["hash"] = hex.EncodeToString(sum[:])
+			vars["hash8"] = vars["hash"][:8]
+		}
+		if t.uses("width", "height") {
+			size, err := decodedSize(data, opts)
+			if err != nil {
+				return "", fmt.Errorf("failed to read the size of %s: %w", inputPath, err)
+			}
+			vars["width"] = strconv.Itoa(size.X)
+			vars["height"] = strconv.Itoa(size.Y)
+		}
+	}
+
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.isVar {
+			b.WriteString(vars[p.text])
+		} else {
+			b.WriteString(p.text)
+		}
+	}
+	return filepath.Clean(filepath.FromSlash(b.String())), nil
+}
+
+// templateQuality returns the JPEG/WebP quality opts encode with.
+func templateQuality(opts CompressOptions) int {
+	if opts.Quality > 0 {
+		return opts.Quality
+	}
+	return opts.Level.ToJPEGQuality()
+}
+
+// WithOutputTemplate names the outputs of ScanDirectory with t instead of
+// mirroring the input paths. Expanded paths are relative to the output
+// directory and must stay inside it. Two inputs expanding to the same path
+// end the scan with an error; to detect this, a scan keeps a small digest of
+// every expanded path, so its memory grows with the number of files even when
+// items are streamed with ScanDirectorySeq.
+func WithOutputTemplate(t *OutputTemplate) ScanDirectoryOption {
+	return func(cfg *scanConfig) {
+		cfg.template = t
+	}
+}
+
+// WithConvertOutputTemplate names the outputs of ScanDirectoryForConvert with t
+// instead of mirroring the input paths. Expanded paths are relative to the
+// output directory and must stay inside it. Multi-page items still get "_p{n}"
+// inserted before the extension.
+func WithConvertOutputTemplate(t *OutputTemplate) ScanDirectoryForConvertOption {
+	return func(cfg *scanConvertConfig) {
+		cfg.template = t
+	}
+}
+
+// templateOutputs records the output paths expanded during a scan, or the
+// output bases of optimize items, so that two inputs are never written to
+// the same file. Collisions can occur between
+// any two directories, so every path is kept until the scan ends; to bound
+// the memory of streaming scans over large trees, each path is stored as a
+// fixed-size digest instead of the path itself (about 50 bytes per output).
+type templateOutputs map[templateKey]struct{}
+
+// templateKey is the truncated SHA-256 of an output path. 128 bits keep
+// accidental collisions out of reach for any realistic number of files.
+type templateKey [16]byte
+
+// templatePath expands t for the input at path under inputDir and joins the
+// result to outputDir.
+func (o templateOutputs) templatePath(ctx context.Context, s Storage, t *OutputTemplate, inputDir, outputDir, path string, format ImageFormat, opts CompressOptions) (string, error) {
+	rel, err := t.expand(ctx, s, inputDir, path, format, opts)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("output template %q expands to %q outside the output directory", t, rel)
+	}
+	outPath := filepath.Join(outputDir, rel)
+	if !o.add(outPath) {
+		return "", fmt.Errorf("output template %q maps both %s and an earlier input to %s", t, path, outPath)
+	}
+	return outPath, nil
+}
+
+// add records outPath and reports whether it was not recorded before.
+func (o templateOutputs) add(outPath string) bool {
+	sum := sha256.Sum256([]byte(outPath))
+	key := templateKey(sum[:16])
+	if _, ok := o[key]; ok {
+		return false
+	}
+	o[key] = struct{}{}
+	return true
+}
@@ -0,0 +1,183 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseOutputTemplate_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+	}{
+		{name: "empty", pattern: ""},
+		{name: "unknown variable", pattern: "{dir}/{size}.{ext}"},
+		{name: "unclosed brace", pattern: "{name.{ext}"},
+		{name: "stray closing brace", pattern: "name}.{ext}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseOutputTemplate(tt.pattern); err == nil {
+				t.Errorf("ParseOutputTemplate(%q) expected error", tt.pattern)
+			}
+		})
+	}
+}
+
+func TestOutputTemplate_Expand(t *testing.T) {
+	dir := t.TempDir()
+	data := createTestJPEG(t, 40, 20, 80)
+	path := writeTestFile(t, dir, "sub/photo.jpeg", data)
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		pattern string
+		root    string
+		format  ImageFormat
+		opts    CompressOptions
+		want    string
+	}{
+		{name: "mirror", pattern: "{dir}/{name}.{ext}", root: dir, format: FormatJPEG, want: "sub/photo.jpg"},
+		{name: "format", pattern: "{format}/{name}.{ext}", root: dir, format: FormatWEBP, want: "webp/photo.webp"},
+		{name: "raster keeps its width", pattern: "{dir}/{name}.{width}w.{ext}", root: dir, format: FormatJPEG, opts: CompressOptions{Width: 10}, want: "sub/photo.40w.jpg"},
+		{name: "original size", pattern: "{name}-{width}x{height}.{ext}", root: dir, format: FormatPNG, want: "photo-40x20.png"},
+		{name: "quality from level", pattern: "{name}.q{quality}.{ext}", root: dir, format: FormatJPEG, opts: CompressOptions{Level: CompressionHigh}, want: "photo.q90.jpg"},
+		{name: "explicit quality", pattern: "{name}.q{quality}.{ext}", root: dir, format: FormatJPEG, opts: CompressOptions{Quality: 42}, want: "photo.q42.jpg"},
+		{name: "hash8", pattern: "{dir}/{name}.{hash8}.{ext}", root: dir, format: FormatJPEG, want: "sub/photo." + hash[:8] + ".jpg"},
+		{name: "hash", pattern: "{hash}.{ext}", root: dir, format: FormatJPEG, want: hash + ".jpg"},
+		{name: "top-level dir", pattern: "{dir}/{name}.{ext}", root: filepath.Join(dir, "sub"), format: FormatJPEG, want: "photo.jpg"},
+		{name: "no root", pattern: "{dir}/{name}.min.{ext}", format: FormatJPEG, want: filepath.ToSlash(filepath.Join(dir, "sub", "photo.min.jpg"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseOutputTemplate(tt.pattern)
+			if err != nil {
+				t.Fatalf("ParseOutputTemplate() error = %v", err)
+			}
+			got, err := tmpl.Expand(tt.root, path, tt.format, tt.opts)
+			if err != nil {
+				t.Fatalf("Expand() error = %v", err)
+			}
+			if filepath.ToSlash(got) != tt.want {
+				t.Errorf("Expand() = %q, want %q", filepath.ToSlash(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodedSize(t *testing.T) {
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 32 16"><rect width="32" height="16"/></svg>`)
+	tests := []struct {
+		name string
+		data []byte
+		opts CompressOptions
+	}{
+		{name: "jpeg", data: createTestJPEG(t, 40, 20, 80)},
+		{name: "jpeg ignores width", data: createTestJPEG(t, 40, 20, 80), opts: CompressOptions{Width: 10}},
+		{name: "gif frame", data: createTestGIF(t, 16, 8), opts: CompressOptions{Page: 2}},
+		{name: "tiff page", data: createTestTIFFPages(t, 3), opts: CompressOptions{Page: 1}},
+		{name: "svg width", data: svg, opts: CompressOptions{Width: 64}},
+		{name: "svg dpi", data: svg, opts: CompressOptions{DPI: 192}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := decodeImage(tt.data, tt.opts, nil)
+			if err != nil {
+				t.Fatalf("decodeImage() error = %v", err)
+			}
+			got, err := decodedSize(tt.data, tt.opts)
+			if err != nil {
+				t.Fatalf("decodedSize() error = %v", err)
+			}
+			if want := img.Bounds().Size(); got != want {
+				t.Errorf("decodedSize() = %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := decodedSize(createTestGIF(t, 16, 8), CompressOptions{Page: 3}); !errors.Is(err, ErrPageOutOfRange) {
+		t.Errorf("decodedSize(page 3) error = %v, want ErrPageOutOfRange", err)
+	}
+}
+
+func TestScanDirectory_出力テンプレート(t *testing.T) {
+	dir := t.TempDir()
+	outDir := t.TempDir()
+	jpeg := createTestJPEG(t, 8, 8, 80)
+	writeTestFile(t, dir, "a.jpg", jpeg)
+	writeTestFile(t, dir, "sub/b.jpg", jpeg)
+
+	tmpl, err := ParseOutputTemplate("{dir}/{name}.min.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := ScanDirectory(dir, outDir, WithOutputTemplate(tmpl))
+	if err != nil {
+		t.Fatalf("ScanDirectory() error = %v", err)
+	}
+	var got []string
+	for _, item := range items {
+		rel, err := filepath.Rel(outDir, item.OutputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, filepath.ToSlash(rel))
+	}
+	if want := []string{"a.min.jpg", "sub/b.min.jpg"}; !slices.Equal(got, want) {
+		t.Errorf("outputs = %v, want %v", got, want)
+	}
+}
+
+func TestScanDirectoryForConvert_出力テンプレート(t *testing.T) {
+	dir := t.TempDir()
+	outDir := t.TempDir()
+	writeTestFile(t, dir, "sub/a.jpg", createTestJPEG(t, 8, 8, 80))
+
+	tmpl, err := ParseOutputTemplate("{format}/{name}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := ScanDirectoryForConvert(dir, outDir, FormatPNG, WithConvertOutputTemplate(tmpl))
+	if err != nil {
+		t.Fatalf("ScanDirectoryForConvert() error = %v", err)
+	}
+	if want := filepath.Join(outDir, "png", "a.png"); len(items) != 1 || items[0].OutputPath != want {
+		t.Errorf("items = %+v, want output %s", items, want)
+	}
+}
+
+func TestScanDirectory_出力テンプレートのエラー(t *testing.T) {
+	dir := t.TempDir()
+	jpeg := createTestJPEG(t, 8, 8, 80)
+	writeTestFile(t, dir, "a.jpg", jpeg)
+	writeTestFile(t, dir, "sub/a.jpg", jpeg)
+
+	tests := []struct {
+		name    string
+		pattern string
+	}{
+		{name: "出力先の重複", pattern: "{name}.{ext}"},
+		{name: "出力ディレクトリの外", pattern: "../{dir}/{name}.{ext}"},
+		{name: "絶対パス", pattern: "/tmp/{name}.{ext}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseOutputTemplate(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ScanDirectory(dir, t.TempDir(), WithOutputTemplate(tmpl)); err == nil {
+				t.Error("ScanDirectory() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	"golang.org/x/image/tiff"
+)
+
+// ErrPageOutOfRange is returned when CompressOptions.Page selects a page that
+// does not exist in the input image.
+var ErrPageOutOfRange = errors.New("page out of range")
+
+// maxTIFFPages bounds the IFD chain walk so that corrupt or cyclic files cannot
+// make PageCount loop forever.
+const maxTIFFPages = 10000
+
+// TIFF tags and data types used when walking and relocating IFDs.
+const (
+	tiffTagStripOffsets = 273
+	tiffTagTileOffsets  = 324
+	tiffTagICCProfile   = 34675
+
+	tiffHeaderLen   = 8
+	tiffIFDEntryLen = 12
+)
+
+// tiffTypeSizes maps TIFF field types to their size in bytes.
+var tiffTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// TIFFProcessor implements the Processor interface for TIFF images.
+type TIFFProcessor struct{}
+
+// NewTIFFProcessor creates a new TIFFProcessor.
+func NewTIFFProcessor() *TIFFProcessor {
+	return &TIFFProcessor{}
+}
+
+// Compress recompresses a TIFF image.
+// Every page of a multi-page TIFF is kept; CompressOptions.Page is ignored.
+func (p *TIFFProcessor) Compress(ctx context.Context, r io.Reader, w io.Writer, opts CompressOptions) (*Result, error) {
+	return runAs(ctx, "TIFFProcessor", FormatTIFF, r, w, CompressPipeline(FormatTIFF, opts))
+}
+
+// Convert converts an image to TIFF format.
+// Only the page selected by CompressOptions.Page is written.
+func (p *TIFFProcessor) Convert(ctx context.Context, r io.Reader, w io.Writer, opts ConvertOptions) (*Result, error) {
+	return runAs(ctx, "TIFFProcessor", FormatTIFF, r, w, ConvertPipeline(opts))
+}
+
+// SupportedFormats returns the formats supported by this processor.
+func (p *TIFFProcessor) SupportedFormats() []ImageFormat {
+	return []ImageFormat{FormatTIFF}
+}
+
+// PageCount returns the number of pages in the image read from r.
+// Multi-page TIFF files report one page per IFD; all other formats report 1.
+func PageCount(r io.Reader) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if !isTIFF(data) {
+		return 1, nil
+	}
+	return tiffPageCount(data)
+}
+
+// isTIFF reports whether data starts with a little- or big-endian TIFF header.
+func isTIFF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("II\x2A\x00")) || bytes.HasPrefix(data, []byte("MM\x00\x2A"))
+}
+
+// tiffByteOrder returns the byte order declared in the TIFF header.
+func tiffByteOrder(data []byte) binary.ByteOrder {
+	if data[0] == 'M' {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// tiffIFDOffsets walks the IFD chain and returns the offset of every page's IFD.
+func tiffIFDOffsets(data []byte) ([]uint32, error) {
+	if len(data) < tiffHeaderLen || !isTIFF(data) {
+		return nil, errors.New("tiff: invalid header")
+	}
+	order := tiffByteOrder(data)
+	seen := make(map[uint32]bool)
+	var offsets []uint32
+	for off := order.Uint32(data[4:8]); off != 0; {
+		if seen[off] || len(offsets) >= maxTIFFPages {
+			return nil, errors.New("tiff: IFD chain loops")
+		}
+		if uint64(off)+2 > uint64(len(data)) {
+			return nil, errors.New("tiff: IFD offset out of range")
+		}
+		seen[off] = true
+		offsets = append(offsets, off)
+
+		n := uint64(order.Uint16(data[off : off+2]))
+		next := uint64(off) + 2 + n*tiffIFDEntryLen
+		if next+4 > uint64(len(data)) {
+			return nil, errors.New("tiff: truncated IFD")
+		}
+		off = order.Uint32(data[next : next+4])
+	}
+	if len(offsets) == 0 {
+		return nil, errors.New("tiff: no IFD")
+	}
+	return offsets, nil
+}
+
+// tiffPageCount returns the number of IFDs in a TIFF file.
+func tiffPageCount(data []byte) (int, error) {
+	offsets, err := tiffIFDOffsets(data)
+	if err != nil {
+		return 0, err
+	}
+	return len(offsets), nil
+}
+
+// selectPage returns input data whose first image is the requested page.
+// The TIFF decoder only reads the first IFD, so for TIFF input the header is
+// patched to point at the page's IFD. Other formats only have page 0.
+func selectPage(data []byte, page int) ([]byte, error) {
+	if !isTIFF(data) {
+		if page != 0 {
+			return nil, fmt.Errorf("%w: page %d of single-page image", ErrPageOutOfRange, page)
+		}
+		return data, nil
+	}
+	if page == 0 {
+		return data, nil
+	}
+	offsets, err := tiffIFDOffsets(data)
+	if err != nil {
+		return nil, err
+	}
+	if page >= len(offsets) {
+		return nil, fmt.Errorf("%w: page %d of %d", ErrPageOutOfRange, page, len(offsets))
+	}
+	patched := append([]byte{}, data...)
+	tiffByteOrder(data).PutUint32(patched[4:8], offsets[page])
+	return patched, nil
+}
+
+// extractTIFFICCProfile returns the ICC profile (tag 34675) of the IFD the
+// header points at. selectPage points the header at the selected page, so
+// every page is color-managed with its own profile rather than the first
+// page's.
+func extractTIFFICCProfile(data []byte) []byte {
+	if len(data) < tiffHeaderLen || !isTIFF(data) {
+		return nil
+	}
+	return tiffIFDICCProfile(data, tiffByteOrder(data).Uint32(data[4:8]))
+}
+
+// tiffIFDICCProfile returns the ICC profile of the IFD at off, or nil if it
+// has none.
+func tiffIFDICCProfile(data []byte, off uint32) []byte {
+	order := tiffByteOrder(data)
+	if uint64(off)+2 > uint64(len(data)) {
+		return nil
+	}
+	n := uint64(order.Uint16(data[off : off+2]))
+	if uint64(off)+2+n*tiffIFDEntryLen > uint64(len(data)) {
+		return nil
+	}
+	for i := range n {
+		e := data[uint64(off)+2+i*tiffIFDEntryLen : uint64(off)+2+(i+1)*tiffIFDEntryLen]
+		if order.Uint16(e[0:2]) != tiffTagICCProfile {
+			continue
+		}
+		size := uint64(tiffTypeSizes[order.Uint16(e[2:4])]) * uint64(order.Uint32(e[4:8]))
+		if size <= 4 {
+			return nil
+		}
+		start := uint64(order.Uint32(e[8:12]))
+		if start+size > uint64(len(data)) {
+			return nil
+		}
+		return data[start : start+size]
+	}
+	return nil
+}
+
+// encodeTIFFPages writes imgs as a single multi-page TIFF file.
+//
+// x/image/tiff only writes single-page files, so each page is encoded on its
+// own and the results are concatenated. Every single-page file has the layout
+// "header | pixel data | IFD | IFD data", with all offsets relative to the
+// start of the file, so the offsets are shifted by the page's position in the
+// combined file and the IFDs are chained together.
+func encodeTIFFPages(w io.Writer, imgs []image.Image, opts *tiff.Options) error {
+	var out []byte
+	var prevNext int // Position of the previous page's next-IFD pointer.
+	for i, img := range imgs {
+		var buf bytes.Buffer
+		if err := tiff.Encode(&buf, img, opts); err != nil {
+			return err
+		}
+		if i == 0 {
+			out = buf.Bytes()
+			next, err := tiffNextIFDPointer(out, binary.LittleEndian.Uint32(out[4:8]))
+			if err != nil {
+				return err
+			}
+			prevNext = next
+			continue
+		}
+
+		// IFD offsets must fall on a word boundary.
+		if len(out)%2 != 0 {
+			out = append(out, 0)
+		}
+		page := buf.Bytes()[tiffHeaderLen:]
+		base := len(out)
+		out = append(out, page...)
+
+		delta := uint32(base - tiffHeaderLen)
+		ifd := binary.LittleEndian.Uint32(buf.Bytes()[4:8]) + delta
+		if err := relocateTIFFIFD(out, ifd, delta); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(out[prevNext:prevNext+4], ifd)
+		next, err := tiffNextIFDPointer(out, ifd)
+		if err != nil {
+			return err
+		}
+		prevNext = next
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+// tiffNextIFDPointer returns the position of the next-IFD pointer of the
+// little-endian IFD at off.
+func tiffNextIFDPointer(data []byte, off uint32) (int, error) {
+	if uint64(off)+2 > uint64(len(data)) {
+		return 0, errors.New("tiff: IFD offset out of range")
+	}
+	n := int(binary.LittleEndian.Uint16(data[off : off+2]))
+	next := int(off) + 2 + n*tiffIFDEntryLen
+	if next+4 > len(data) {
+		return 0, errors.New("tiff: truncated IFD")
+	}
+	return next, nil
+}
+
+// relocateTIFFIFD adds delta to every file offset stored in the little-endian
+// IFD at off: out-of-line entry values and strip/tile offsets.
+func relocateTIFFIFD(data []byte, off, delta uint32) error {
+	next, err := tiffNextIFDPointer(data, off)
+	if err != nil {
+		return err
+	}
+	le := binary.LittleEndian
+	for e := int(off) + 2; e < next; e += tiffIFDEntryLen {
+		tag := le.Uint16(data[e : e+2])
+		typ := le.Uint16(data[e+2 : e+4])
+		count := le.Uint32(data[e+4 : e+8])
+		value := data[e+8 : e+12]
+		size := tiffTypeSizes[typ] * count
+		if size > 4 {
+			le.PutUint32(value, le.Uint32(value)+delta)
+			if tag != tiffTagStripOffsets && tag != tiffTagTileOffsets {
+				continue
+			}
+			// Offsets stored out of line: relocate each element.
+			start := le.Uint32(value)
+			if uint64(start)+uint64(size) > uint64(len(data)) {
+				return errors.New("tiff: entry data out of range")
+			}
+			for j := range count {
+				p := start + j*4
+				le.PutUint32(data[p:p+4], le.Uint32(data[p:p+4])+delta)
+			}
+			continue
+		}
+		if (tag == tiffTagStripOffsets || tag == tiffTagTileOffsets) && typ == 4 {
+			le.PutUint32(value, le.Uint32(value)+delta)
+		}
+	}
+	return nil
+}
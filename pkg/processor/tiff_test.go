@@ -0,0 +1,389 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// createTestTIFFPages creates a multi-page TIFF whose page i is (i+1)*10 pixels wide
+// and filled with a distinct gray level, so pages can be told apart after decoding.
+func createTestTIFFPages(t *testing.T, pages int) []byte {
+	t.Helper()
+	imgs := make([]image.Image, pages)
+	for i := range pages {
+		img := image.NewNRGBA(image.Rect(0, 0, (i+1)*10, 8))
+		c := color.NRGBA{R: uint8(i * 60), G: uint8(i * 60), B: uint8(i * 60), A: 255}
+		for y := range 8 {
+			for x := range (i + 1) * 10 {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+		imgs[i] = img
+	}
+	var buf bytes.Buffer
+	if err := encodeTIFFPages(&buf, imgs, &tiff.Options{Compression: tiff.Deflate}); err != nil {
+		t.Fatalf("encodeTIFFPages() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+// addTIFFICCProfile returns a copy of the little-endian TIFF data whose
+// page carries profile as its ICC profile tag. The page's IFD is copied to
+// the end of the file with the extra entry and relinked in place of the old one.
+func addTIFFICCProfile(t *testing.T, data []byte, page int, profile []byte) []byte {
+	t.Helper()
+	offsets, err := tiffIFDOffsets(data)
+	if err != nil {
+		t.Fatalf("tiffIFDOffsets() error = %v", err)
+	}
+	le := binary.LittleEndian
+	out := append([]byte{}, data...)
+	if len(out)%2 != 0 {
+		out = append(out, 0)
+	}
+	profileOff := uint32(len(out))
+	out = append(out, profile...)
+	if len(out)%2 != 0 {
+		out = append(out, 0)
+	}
+
+	old := offsets[page]
+	n := uint32(le.Uint16(data[old : old+2]))
+	newIFD := uint32(len(out))
+	out = le.AppendUint16(out, uint16(n+1))
+	out = append(out, data[old+2:old+2+n*tiffIFDEntryLen]...)
+	out = le.AppendUint16(out, tiffTagICCProfile)
+	out = le.AppendUint16(out, 7) // UNDEFINED
+	out = le.AppendUint32(out, uint32(len(profile)))
+	out = le.AppendUint32(out, profileOff)
+	out = append(out, data[old+2+n*tiffIFDEntryLen:old+2+n*tiffIFDEntryLen+4]...)
+
+	// Point whatever referenced the old IFD at the new one.
+	ref := uint32(4)
+	if page > 0 {
+		prev := offsets[page-1]
+		ref = prev + 2 + uint32(le.Uint16(data[prev:prev+2]))*tiffIFDEntryLen
+	}
+	le.PutUint32(out[ref:ref+4], newIFD)
+	return out
+}
+
+func TestTIFFProcessor_SupportedFormats(t *testing.T) {
+	formats := NewTIFFProcessor().SupportedFormats()
+	if len(formats) != 1 || formats[0] != FormatTIFF {
+		t.Errorf("SupportedFormats() = %v, want [tiff]", formats)
+	}
+}
+
+func TestTIFFProcessor_Compress(t *testing.T) {
+	tests := []struct {
+		name  string
+		level CompressionLevel
+	}{
+		{name: "low", level: CompressionLow},
+		{name: "medium", level: CompressionMedium},
+		{name: "high", level: CompressionHigh},
+	}
+
+	input := createTestTIFFPages(t, 1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			result, err := NewTIFFProcessor().Compress(context.Background(), bytes.NewReader(input), &buf, CompressOptions{Level: tt.level})
+			if err != nil {
+				t.Fatalf("Compress() error = %v", err)
+			}
+			if result.Format != FormatTIFF {
+				t.Errorf("Format = %v, want %v", result.Format, FormatTIFF)
+			}
+			if result.CompressedSize != int64(buf.Len()) {
+				t.Errorf("CompressedSize = %d, want %d", result.CompressedSize, buf.Len())
+			}
+			if _, err := tiff.Decode(&buf); err != nil {
+				t.Errorf("output is not a valid TIFF: %v", err)
+			}
+		})
+	}
+}
+
+func TestTIFFProcessor_Compress_KeepsAllPages(t *testing.T) {
+	input := createTestTIFFPages(t, 3)
+
+	var buf bytes.Buffer
+	if _, err := NewTIFFProcessor().Compress(context.Background(), bytes.NewReader(input), &buf, CompressOptions{Level: CompressionLow}); err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+
+	pages, err := PageCount(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("PageCount() error = %v", err)
+	}
+	if pages != 3 {
+		t.Fatalf("PageCount() = %d, want 3", pages)
+	}
+	for page := range pages {
+		img, err := decodeImage(buf.Bytes(), CompressOptions{Page: page}, nil)
+		if err != nil {
+			t.Fatalf("decodeImage(page %d) error = %v", page, err)
+		}
+		if got, want := img.Bounds().Dx(), (page+1)*10; got != want {
+			t.Errorf("page %d width = %d, want %d", page, got, want)
+		}
+		r, _, _, _ := img.At(0, 0).RGBA()
+		if got, want := r>>8, uint32(page*60); got != want {
+			t.Errorf("page %d gray = %d, want %d", page, got, want)
+		}
+	}
+}
+
+func TestTIFFProcessor_Convert(t *testing.T) {
+	input := createTestPNG(t, 12, 7)
+
+	var buf bytes.Buffer
+	result, err := NewTIFFProcessor().Convert(context.Background(), bytes.NewReader(input), &buf, DefaultConvertOptions(FormatTIFF))
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if result.Format != FormatTIFF {
+		t.Errorf("Format = %v, want %v", result.Format, FormatTIFF)
+	}
+	img, err := tiff.Decode(&buf)
+	if err != nil {
+		t.Fatalf("output is not a valid TIFF: %v", err)
+	}
+	if img.Bounds().Dx() != 12 || img.Bounds().Dy() != 7 {
+		t.Errorf("size = %v, want 12x7", img.Bounds().Size())
+	}
+}
+
+func TestTIFFProcessor_Convert_FormatMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := NewTIFFProcessor().Convert(context.Background(), bytes.NewReader(createTestPNG(t, 4, 4)), &buf, DefaultConvertOptions(FormatPNG))
+	if err == nil {
+		t.Error("expected error for non-TIFF target format")
+	}
+}
+
+func TestConvert_SelectPage(t *testing.T) {
+	input := createTestTIFFPages(t, 3)
+
+	tests := []struct {
+		name      string
+		page      int
+		wantWidth int
+		wantErr   error
+	}{
+		{name: "first page", page: 0, wantWidth: 10},
+		{name: "last page", page: 2, wantWidth: 30},
+		{name: "out of range", page: 3, wantErr: ErrPageOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultConvertOptions(FormatPNG)
+			opts.Page = tt.page
+
+			var buf bytes.Buffer
+			_, err := NewPNGProcessor().Convert(context.Background(), bytes.NewReader(input), &buf, opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Convert() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+			img, err := png.Decode(&buf)
+			if err != nil {
+				t.Fatalf("output is not a valid PNG: %v", err)
+			}
+			if img.Bounds().Dx() != tt.wantWidth {
+				t.Errorf("width = %d, want %d", img.Bounds().Dx(), tt.wantWidth)
+			}
+		})
+	}
+}
+
+func TestExtractICCProfile_TIFFPerPage(t *testing.T) {
+	first := buildTestICCProfile(t, sRGBColorantsD50, 2.2)
+	second := buildTestICCProfile(t, sRGBColorantsD50, 1.0)
+	data := createTestTIFFPages(t, 3)
+	data = addTIFFICCProfile(t, data, 0, first)
+	data = addTIFFICCProfile(t, data, 1, second)
+
+	want := [][]byte{first, second, nil}
+	for page := range want {
+		selected, err := selectPage(data, page)
+		if err != nil {
+			t.Fatalf("selectPage(%d) error = %v", page, err)
+		}
+		if got := extractICCProfile(selected); !bytes.Equal(got, want[page]) {
+			t.Errorf("page %d: profile of %d bytes, want its own profile of %d bytes", page, len(got), len(want[page]))
+		}
+	}
+
+	// Page 1 has a linear profile, so converting it to sRGB brightens its gray
+	// level of 60; with page 0's gamma 2.2 profile it would stay unchanged.
+	img, err := decodeImage(data, CompressOptions{Page: 1, ConvertToSRGB: true}, nil)
+	if err != nil {
+		t.Fatalf("decodeImage() error = %v", err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA).R; got <= 60 {
+		t.Errorf("page 1 gray = %d, want it brightened by its linear profile (> 60)", got)
+	}
+}
+
+func TestConvert_PageOnSinglePageImage(t *testing.T) {
+	opts := DefaultConvertOptions(FormatJPEG)
+	opts.Page = 1
+
+	var buf bytes.Buffer
+	_, err := NewJPEGProcessor().Convert(context.Background(), bytes.NewReader(createTestPNG(t, 4, 4)), &buf, opts)
+	if !errors.Is(err, ErrPageOutOfRange) {
+		t.Errorf("Convert() error = %v, want %v", err, ErrPageOutOfRange)
+	}
+}
+
+func TestPageCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    int
+		wantErr bool
+	}{
+		{name: "single page TIFF", data: createTestTIFFPages(t, 1), want: 1},
+		{name: "multi page TIFF", data: createTestTIFFPages(t, 4), want: 4},
+		{name: "PNG", data: createTestPNG(t, 4, 4), want: 1},
+		{name: "truncated TIFF", data: []byte("II\x2A\x00\xff\x00\x00\x00"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PageCount(bytes.NewReader(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PageCount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("PageCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageCount_CyclicIFD(t *testing.T) {
+	data := createTestTIFFPages(t, 1)
+	ifd, err := tiffIFDOffsets(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := tiffNextIFDPointer(data, ifd[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Point the IFD back at itself.
+	copy(data[next:next+4], data[4:8])
+
+	if _, err := PageCount(bytes.NewReader(data)); err == nil {
+		t.Error("expected error for cyclic IFD chain")
+	}
+}
+
+func TestBMP_ConvertToPNG(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 9, 5))
+	var in bytes.Buffer
+	if err := bmp.Encode(&in, src); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := NewPNGProcessor().Convert(context.Background(), &in, &buf, DefaultConvertOptions(FormatPNG)); err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("output is not a valid PNG: %v", err)
+	}
+	if img.Bounds().Dx() != 9 || img.Bounds().Dy() != 5 {
+		t.Errorf("size = %v, want 9x5", img.Bounds().Size())
+	}
+}
+
+func TestScanDirectoryForConvert_AllPages(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, inputDir, "scan.tiff", createTestTIFFPages(t, 3))
+	writeTestFile(t, inputDir, "single.tif", createTestTIFFPages(t, 1))
+	writeTestFile(t, inputDir, "photo.png", createTestPNG(t, 4, 4))
+
+	items, err := ScanDirectoryForConvert(inputDir, outputDir, FormatJPEG, WithAllPages())
+	if err != nil {
+		t.Fatalf("ScanDirectoryForConvert() error = %v", err)
+	}
+
+	got := make(map[string]int)
+	for _, item := range items {
+		rel, _ := filepath.Rel(outputDir, item.OutputPath)
+		got[rel] = item.Options.Page
+	}
+	want := map[string]int{
+		"scan_p1.jpg": 0,
+		"scan_p2.jpg": 1,
+		"scan_p3.jpg": 2,
+		"single.jpg":  0,
+		"photo.jpg":   0,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("items = %v, want %v", got, want)
+	}
+	for path, page := range want {
+		if p, ok := got[path]; !ok || p != page {
+			t.Errorf("item %s page = %d (present %v), want %d", path, p, ok, page)
+		}
+	}
+
+	results, err := NewDefaultBatchProcessor().ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	for _, r := range results {
+		if !r.IsSuccess() {
+			t.Errorf("%s: %v", r.Item.OutputPath, r.Error)
+		}
+	}
+}
+
+func TestProcessBatch_TIFF(t *testing.T) {
+	inputDir := t.TempDir()
+	writeTestFile(t, inputDir, "scan.tiff", createTestTIFFPages(t, 2))
+	writeTestFile(t, inputDir, "scan.bmp", []byte("BM"))
+
+	items, err := ScanDirectory(inputDir, t.TempDir())
+	if err != nil {
+		t.Fatalf("ScanDirectory() error = %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("ScanDirectory() returned %d items, want 1 (BMP is decode-only)", len(items))
+	}
+
+	results, err := NewDefaultBatchProcessor().ProcessBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	if !results[0].IsSuccess() {
+		t.Fatalf("ProcessBatch() error = %v", results[0].Error)
+	}
+	if results[0].Result.Format != FormatTIFF {
+		t.Errorf("Format = %v, want %v", results[0].Result.Format, FormatTIFF)
+	}
+}
@@ -3,6 +3,8 @@ package processor
 
 import (
 	"image/png"
+
+	"golang.org/x/image/tiff"
 )
 
 // ImageFormat represents supported image formats.
@@ -15,6 +17,16 @@ const (
 	FormatPNG
 	// FormatWEBP represents WebP image format.
 	FormatWEBP
+	// FormatHEIC represents HEIC/HEIF image format. It is supported as input only.
+	FormatHEIC
+	// FormatTIFF represents TIFF image format, including multi-page files.
+	FormatTIFF
+	// FormatBMP represents BMP image format. It is supported as input only.
+	FormatBMP
+	// FormatSVG represents SVG vector images. They are rasterized on input and cannot be written.
+	FormatSVG
+	// FormatGIF represents GIF image format, including animated GIFs.
+	FormatGIF
 )
 
 // String returns the string representation of the ImageFormat.
@@ -26,6 +38,16 @@ func (f ImageFormat) String() string {
 		return "png"
 	case FormatWEBP:
 		return "webp"
+	case FormatHEIC:
+		return "heic"
+	case FormatTIFF:
+		return "tiff"
+	case FormatBMP:
+		return "bmp"
+	case FormatSVG:
+		return "svg"
+	case FormatGIF:
+		return "gif"
 	default:
 		return "unknown"
 	}
@@ -34,7 +56,18 @@ func (f ImageFormat) String() string {
 // IsValid returns true if the ImageFormat is a valid value.
 func (f ImageFormat) IsValid() bool {
 	switch f {
-	case FormatJPEG, FormatPNG, FormatWEBP:
+	case FormatJPEG, FormatPNG, FormatWEBP, FormatHEIC, FormatTIFF, FormatBMP, FormatSVG, FormatGIF:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanEncode returns true if images can be written in the ImageFormat.
+// Decode-only formats such as HEIC, BMP and SVG can be used as conversion input but not as output.
+func (f ImageFormat) CanEncode() bool {
+	switch f {
+	case FormatJPEG, FormatPNG, FormatWEBP, FormatTIFF, FormatGIF:
 		return true
 	default:
 		return false
@@ -50,6 +83,16 @@ func (f ImageFormat) Extension() string {
 		return ".png"
 	case FormatWEBP:
 		return ".webp"
+	case FormatHEIC:
+		return ".heic"
+	case FormatTIFF:
+		return ".tiff"
+	case FormatBMP:
+		return ".bmp"
+	case FormatSVG:
+		return ".svg"
+	case FormatGIF:
+		return ".gif"
 	default:
 		return ""
 	}
@@ -64,6 +107,16 @@ func (f ImageFormat) MIMEType() string {
 		return "image/png"
 	case FormatWEBP:
 		return "image/webp"
+	case FormatHEIC:
+		return "image/heic"
+	case FormatTIFF:
+		return "image/tiff"
+	case FormatBMP:
+		return "image/bmp"
+	case FormatSVG:
+		return "image/svg+xml"
+	case FormatGIF:
+		return "image/gif"
 	default:
 		return ""
 	}
@@ -148,3 +201,14 @@ func (c CompressionLevel) ToJPEGQuality() int {
 		return 75
 	}
 }
+
+// ToTIFFOptions converts CompressionLevel to TIFF encoder options.
+// Low writes uncompressed strips; Medium and High use Deflate.
+func (c CompressionLevel) ToTIFFOptions() *tiff.Options {
+	switch c {
+	case CompressionLow:
+		return &tiff.Options{Compression: tiff.Uncompressed}
+	default:
+		return &tiff.Options{Compression: tiff.Deflate}
+	}
+}
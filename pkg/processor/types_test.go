@@ -3,6 +3,8 @@ package processor
 import (
 	"image/png"
 	"testing"
+
+	"golang.org/x/image/tiff"
 )
 
 func TestImageFormat_String(t *testing.T) {
@@ -14,6 +16,11 @@ func TestImageFormat_String(t *testing.T) {
 		{"JPEG format", FormatJPEG, "jpeg"},
 		{"PNG format", FormatPNG, "png"},
 		{"WEBP format", FormatWEBP, "webp"},
+		{"HEIC format", FormatHEIC, "heic"},
+		{"TIFF format", FormatTIFF, "tiff"},
+		{"BMP format", FormatBMP, "bmp"},
+		{"SVG format", FormatSVG, "svg"},
+		{"GIF format", FormatGIF, "gif"},
 		{"Unknown format", ImageFormat(99), "unknown"},
 	}
 
@@ -35,6 +42,11 @@ func TestImageFormat_IsValid(t *testing.T) {
 		{"JPEG is valid", FormatJPEG, true},
 		{"PNG is valid", FormatPNG, true},
 		{"WEBP is valid", FormatWEBP, true},
+		{"HEIC is valid", FormatHEIC, true},
+		{"TIFF is valid", FormatTIFF, true},
+		{"BMP is valid", FormatBMP, true},
+		{"SVG is valid", FormatSVG, true},
+		{"GIF is valid", FormatGIF, true},
 		{"Unknown is invalid", ImageFormat(99), false},
 		{"Negative is invalid", ImageFormat(-1), false},
 	}
@@ -48,6 +60,32 @@ func TestImageFormat_IsValid(t *testing.T) {
 	}
 }
 
+func TestImageFormat_CanEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   ImageFormat
+		expected bool
+	}{
+		{"JPEG can encode", FormatJPEG, true},
+		{"PNG can encode", FormatPNG, true},
+		{"WEBP can encode", FormatWEBP, true},
+		{"HEIC is decode-only", FormatHEIC, false},
+		{"TIFF can be encoded", FormatTIFF, true},
+		{"BMP is decode-only", FormatBMP, false},
+		{"SVG is decode-only", FormatSVG, false},
+		{"GIF can encode", FormatGIF, true},
+		{"Unknown cannot encode", ImageFormat(99), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format.CanEncode(); got != tt.expected {
+				t.Errorf("ImageFormat.CanEncode() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestImageFormat_Extension(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -57,6 +95,11 @@ func TestImageFormat_Extension(t *testing.T) {
 		{"JPEG extension", FormatJPEG, ".jpg"},
 		{"PNG extension", FormatPNG, ".png"},
 		{"WEBP extension", FormatWEBP, ".webp"},
+		{"HEIC extension", FormatHEIC, ".heic"},
+		{"TIFF extension", FormatTIFF, ".tiff"},
+		{"BMP extension", FormatBMP, ".bmp"},
+		{"SVG extension", FormatSVG, ".svg"},
+		{"GIF extension", FormatGIF, ".gif"},
 		{"Unknown extension", ImageFormat(99), ""},
 	}
 
@@ -78,6 +121,11 @@ func TestImageFormat_MIMEType(t *testing.T) {
 		{"JPEG MIME type", FormatJPEG, "image/jpeg"},
 		{"PNG MIME type", FormatPNG, "image/png"},
 		{"WEBP MIME type", FormatWEBP, "image/webp"},
+		{"HEIC MIME type", FormatHEIC, "image/heic"},
+		{"TIFF MIME type", FormatTIFF, "image/tiff"},
+		{"BMP MIME type", FormatBMP, "image/bmp"},
+		{"SVG MIME type", FormatSVG, "image/svg+xml"},
+		{"GIF MIME type", FormatGIF, "image/gif"},
 		{"Unknown MIME type", ImageFormat(99), ""},
 	}
 
@@ -195,3 +243,24 @@ func TestCompressionLevel_ToJPEGQuality(t *testing.T) {
 		})
 	}
 }
+
+func TestCompressionLevel_ToTIFFOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    CompressionLevel
+		expected tiff.CompressionType
+	}{
+		{"Low is uncompressed", CompressionLow, tiff.Uncompressed},
+		{"Medium uses deflate", CompressionMedium, tiff.Deflate},
+		{"High uses deflate", CompressionHigh, tiff.Deflate},
+		{"Unknown defaults to deflate", CompressionLevel(99), tiff.Deflate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.level.ToTIFFOptions().Compression; got != tt.expected {
+				t.Errorf("CompressionLevel.ToTIFFOptions().Compression = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDebounce is the time a file must go without further events
+// before a Watcher yields it.
+const DefaultWatchDebounce = 500 * time.Millisecond
+
+// WatchOption is a functional option for NewWatcher.
+type WatchOption func(*Watcher)
+
+// WithWatchDebounce sets how long a file must go without further events
+// before it is yielded, so that a file still being written is yielded once.
+func WithWatchDebounce(d time.Duration) WatchOption {
+	return func(w *Watcher) {
+		if d > 0 {
+			w.debounce = d
+		}
+	}
+}
+
+// WithWatchRecursive also watches the subdirectories of the watched
+// directory, including the ones created while watching.
+func WithWatchRecursive() WatchOption {
+	return func(w *Watcher) {
+		w.recursive = true
+	}
+}
+
+// WithWatchIgnore leaves out the given files and directories, for example an
+// output directory inside the watched one.
+func WithWatchIgnore(paths ...string) WatchOption {
+	return func(w *Watcher) {
+		for _, p := range paths {
+			if abs, err := filepath.Abs(p); err == nil {
+				w.ignore = append(w.ignore, abs)
+			}
+		}
+	}
+}
+
+// Watcher reports the files created or written in a directory. Files
+// existing when watching starts are not reported, except those in
+// directories created later under a recursive watch. Hidden files and
+// directories, whose name starts with a dot, are left out, which also
+// covers the temporary files written by LocalStorage.
+//
+// When the operating system drops events because too many arrived at once,
+// the directory is scanned again and every file modified since watching
+// started is reported again.
+type Watcher struct {
+	fw        *fsnotify.Watcher
+	dir       string
+	debounce  time.Duration
+	recursive bool
+	ignore    []string
+	started   time.Time
+	err       error
+
+	mu       sync.Mutex
+	requeue  []string
+	requeued chan struct{}
+}
+
+// NewWatcher starts watching dir. Call Close to release the watcher.
+func NewWatcher(dir string, opts ...WatchOption) (*Watcher, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	w := &Watcher{dir: abs, debounce: DefaultWatchDebounce, started: time.Now(), requeued: make(chan struct{}, 1)}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	w.fw, err = fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	if _, err := w.addTree(abs); err != nil {
+		_ = w.fw.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Dir returns the absolute path of the watched directory.
+func (w *Watcher) Dir() string {
+	return w.dir
+}
+
+// Files yields the absolute path of every file created or written in the
+// watched directory once no further event for it has arrived for the
+// debounce interval. Files that become ready together are yielded in path
+// order. Events keep being collected while the caller handles a file, so a
+// slow caller does not make the operating system drop them. Iteration ends
+// when ctx is done, the watcher is closed or watching fails; Err reports
+// the failure.
+func (w *Watcher) Files(ctx context.Context) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		q := newReadyQueue()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			w.collect(ctx, q)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+
+		for {
+			path, ok := q.pop(ctx, done)
+			if !ok || !yield(path) {
+				return
+			}
+		}
+	}
+}
+
+// Requeue schedules the file at path to be yielded again after the debounce
+// interval, as if it had been written, for example when it changed while
+// the caller was still handling it. It is safe to call while Files is
+// being iterated.
+func (w *Watcher) Requeue(path string) {
+	w.mu.Lock()
+	w.requeue = append(w.requeue, path)
+	w.mu.Unlock()
+	select {
+	case w.requeued <- struct{}{}:
+	default:
+	}
+}
+
+// collect handles the events of the watcher until ctx is done or watching
+// ends, pushing the files to q once their debounce interval has passed.
+func (w *Watcher) collect(ctx context.Context, q *readyQueue) {
+	pending := make(map[string]time.Time)
+	timer := time.NewTimer(w.debounce)
+	defer timer.Stop()
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-w.fw.Events:
+			if !ok {
+				return
+			}
+			if err := w.handle(ev, pending); err != nil {
+				w.err = err
+				return
+			}
+		case err, ok := <-w.fw.Errors:
+			if !ok {
+				return
+			}
+			if !errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.err = fmt.Errorf("failed to watch %s: %w", w.dir, err)
+				return
+			}
+			if err := w.rescan(pending); err != nil {
+				w.err = err
+				return
+			}
+		case <-w.requeued:
+			w.mu.Lock()
+			paths := w.requeue
+			w.requeue = nil
+			w.mu.Unlock()
+			deadline := time.Now().Add(w.debounce)
+			for _, path := range paths {
+				pending[path] = deadline
+			}
+		case now := <-timer.C:
+			var ready []string
+			for path, at := range pending {
+				if !at.After(now) {
+					ready = append(ready, path)
+					delete(pending, path)
+				}
+			}
+			slices.Sort(ready)
+			q.push(ready)
+		}
+
+		if next, ok := earliest(pending); ok {
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+// rescan schedules the files modified since watching started, after events
+// were dropped. Under a recursive watch, directories created in the meantime
+// are watched as well.
+func (w *Watcher) rescan(pending map[string]time.Time) error {
+	var files []string
+	if w.recursive {
+		var err error
+		if files, err = w.addTree(w.dir); err != nil {
+			return err
+		}
+	} else {
+		entries, err := os.ReadDir(w.dir)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", w.dir, err)
+		}
+		for _, e := range entries {
+			path := filepath.Join(w.dir, e.Name())
+			if e.Type().IsRegular() && !w.ignored(path) {
+				files = append(files, path)
+			}
+		}
+	}
+
+	deadline := time.Now().Add(w.debounce)
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil && !info.ModTime().Before(w.started) {
+			pending[path] = deadline
+		}
+	}
+	return nil
+}
+
+// Err returns the error that ended the last iteration of Files, if any.
+func (w *Watcher) Err() error {
+	return w.err
+}
+
+// Close stops watching. An iteration of Files in progress ends.
+func (w *Watcher) Close() error {
+	return w.fw.Close()
+}
+
+// handle schedules or cancels the file named by ev. It fails if a new
+// subdirectory cannot be watched, except when it was removed again.
+func (w *Watcher) handle(ev fsnotify.Event, pending map[string]time.Time) error {
+	path := ev.Name
+	if w.ignored(path) {
+		return nil
+	}
+	switch {
+	case ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename):
+		delete(pending, path)
+	case ev.Has(fsnotify.Create) || ev.Has(fsnotify.Write):
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil
+		}
+		deadline := time.Now().Add(w.debounce)
+		if !info.IsDir() {
+			pending[path] = deadline
+			return nil
+		}
+		if !w.recursive || !ev.Has(fsnotify.Create) {
+			return nil
+		}
+		// Files may be moved or written into a new directory before it is
+		// watched, so the ones already inside are scheduled as well.
+		files, err := w.addTree(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			pending[f] = deadline
+		}
+	}
+	return nil
+}
+
+// addTree watches dir, and its subdirectories when recursive, and returns
+// the files found in the subdirectories.
+func (w *Watcher) addTree(dir string) ([]string, error) {
+	if !w.recursive {
+		if err := w.fw.Add(dir); err != nil {
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		return nil, nil
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && w.ignored(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			if d.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return nil
+		}
+		if err := w.fw.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ignored reports whether path is hidden or under an ignored path.
+func (w *Watcher) ignored(path string) bool {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return true
+	}
+	for _, ig := range w.ignore {
+		if path == ig || strings.HasPrefix(path, ig+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readyQueue holds the files ready to be yielded, in order and without
+// duplicates, between the goroutine collecting events and the caller.
+type readyQueue struct {
+	mu     sync.Mutex
+	paths  []string
+	queued map[string]bool
+	notify chan struct{}
+}
+
+func newReadyQueue() *readyQueue {
+	return &readyQueue{queued: make(map[string]bool), notify: make(chan struct{}, 1)}
+}
+
+// push appends the paths not queued yet.
+func (q *readyQueue) push(paths []string) {
+	q.mu.Lock()
+	for _, path := range paths {
+		if !q.queued[path] {
+			q.queued[path] = true
+			q.paths = append(q.paths, path)
+		}
+	}
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pop waits for the next path. It returns false once ctx or done is done.
+func (q *readyQueue) pop(ctx context.Context, done <-chan struct{}) (string, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.paths) > 0 {
+			path := q.paths[0]
+			q.paths = q.paths[1:]
+			delete(q.queued, path)
+			q.mu.Unlock()
+			return path, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return "", false
+		case <-done:
+			return "", false
+		case <-q.notify:
+		}
+	}
+}
+
+// earliest returns the earliest deadline in pending.
+func earliest(pending map[string]time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, at := range pending {
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return next, !next.IsZero()
+}
@@ -0,0 +1,231 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchFiles starts iterating w and returns the yielded paths relative to
+// the watched directory.
+func watchFiles(t *testing.T, w *Watcher) <-chan string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan string, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for path := range w.Files(ctx) {
+			rel, _ := filepath.Rel(w.Dir(), path)
+			ch <- filepath.ToSlash(rel)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return ch
+}
+
+// expectWatched waits for the next yielded path and checks it is want.
+func expectWatched(t *testing.T, ch <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		if got != want {
+			t.Errorf("yielded %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %q", want)
+	}
+}
+
+// expectNoneWatched checks that nothing is yielded for a while.
+func expectNoneWatched(t *testing.T, ch <-chan string) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		t.Errorf("unexpectedly yielded %q", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestWatcher_Files(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "existing.png", []byte("old"))
+	if err := os.MkdirAll(filepath.Join(dir, "out"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher(dir, WithWatchDebounce(50*time.Millisecond), WithWatchRecursive(), WithWatchIgnore(filepath.Join(dir, "out")))
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	ch := watchFiles(t, w)
+
+	// Several writes in quick succession are yielded once.
+	f, err := os.Create(filepath.Join(dir, "a.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		_, _ = f.Write([]byte("data"))
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = f.Close()
+	expectWatched(t, ch, "a.png")
+
+	writeTestFile(t, dir, ".hidden.png", []byte("x"))
+	writeTestFile(t, dir, "out/a.png", []byte("x"))
+	expectNoneWatched(t, ch)
+
+	// Files already inside a new directory are picked up with it.
+	staging := t.TempDir()
+	writeTestFile(t, staging, "sub/b.jpg", []byte("x"))
+	if err := os.Rename(filepath.Join(staging, "sub"), filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	expectWatched(t, ch, "sub/b.jpg")
+
+	writeTestFile(t, dir, "sub/c.jpg", []byte("x"))
+	expectWatched(t, ch, "sub/c.jpg")
+}
+
+func TestWatcher_Files_非再帰(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWatcher(dir, WithWatchDebounce(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	ch := watchFiles(t, w)
+
+	writeTestFile(t, dir, "sub/a.png", []byte("x"))
+	expectNoneWatched(t, ch)
+
+	writeTestFile(t, dir, "b.png", []byte("x"))
+	expectWatched(t, ch, "b.png")
+}
+
+func TestWatcher_Files_削除されたファイル(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWatcher(dir, WithWatchDebounce(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	ch := watchFiles(t, w)
+
+	writeTestFile(t, dir, "gone.png", []byte("x"))
+	if err := os.Remove(filepath.Join(dir, "gone.png")); err != nil {
+		t.Fatal(err)
+	}
+	expectNoneWatched(t, ch)
+}
+
+func TestWatcher_Requeue(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWatcher(dir, WithWatchDebounce(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	ch := watchFiles(t, w)
+
+	writeTestFile(t, dir, "a.png", []byte("x"))
+	expectWatched(t, ch, "a.png")
+	w.Requeue(filepath.Join(dir, "a.png"))
+	expectWatched(t, ch, "a.png")
+	expectNoneWatched(t, ch)
+}
+
+func TestWatcher_Files_処理中のイベント(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWatcher(dir, WithWatchDebounce(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writeTestFile(t, dir, "first.png", []byte("x"))
+	var got []string
+	for path := range w.Files(ctx) {
+		got = append(got, filepath.Base(path))
+		if len(got) == 1 {
+			// Files written while the caller is busy are still yielded.
+			for i := range 5 {
+				writeTestFile(t, dir, fmt.Sprintf("b%d.png", i), []byte("x"))
+			}
+			time.Sleep(200 * time.Millisecond)
+		}
+		if len(got) == 6 {
+			break
+		}
+	}
+	want := []string{"first.png", "b0.png", "b1.png", "b2.png", "b3.png", "b4.png"}
+	if !slices.Equal(got, want) {
+		t.Errorf("yielded %v, want %v", got, want)
+	}
+}
+
+func TestWatcher_Files_イベント溢れ(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "old.png", []byte("x"))
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "old.png"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(dir, WithWatchDebounce(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	ch := watchFiles(t, w)
+
+	writeTestFile(t, dir, "new.png", []byte("x"))
+	expectWatched(t, ch, "new.png")
+
+	// After dropped events, the files modified while watching are yielded
+	// again and watching goes on.
+	w.fw.Errors <- fsnotify.ErrEventOverflow
+	expectWatched(t, ch, "new.png")
+	expectNoneWatched(t, ch)
+	writeTestFile(t, dir, "later.png", []byte("x"))
+	expectWatched(t, ch, "later.png")
+}
+
+func TestNewWatcher_存在しないディレクトリ(t *testing.T) {
+	if _, err := NewWatcher(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("NewWatcher() error = nil, want error")
+	}
+}
+
+func TestWatcher_handle_監視できないディレクトリ(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWatcher(dir, WithWatchRecursive())
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+
+	pending := make(map[string]time.Time)
+	if err := w.handle(fsnotify.Event{Name: sub, Op: fsnotify.Create}, pending); err == nil {
+		t.Error("handle() error = nil, want error for a directory that cannot be watched")
+	}
+	if err := w.handle(fsnotify.Event{Name: filepath.Join(dir, "removed"), Op: fsnotify.Create}, pending); err != nil {
+		t.Errorf("handle(removed directory) error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,267 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"time"
+
+	"github.com/chai2010/webp"
+)
+
+// WebP extended-format (VP8X) flags.
+const (
+	webpFlagAnimation = 0x02
+	webpFlagAlpha     = 0x10
+)
+
+// ANMF frame flags.
+const (
+	webpFrameDispose = 0x01
+	webpFrameNoBlend = 0x02
+)
+
+// maxWebPDuration is the largest frame duration in milliseconds an ANMF chunk can hold.
+const maxWebPDuration = 1<<24 - 1
+
+// riffChunk is a raw RIFF chunk without its header and padding.
+type riffChunk struct {
+	fourCC string
+	data   []byte
+}
+
+// readRIFFChunks splits data into RIFF chunks.
+func readRIFFChunks(data []byte) ([]riffChunk, error) {
+	var chunks []riffChunk
+	for off := 0; off < len(data); {
+		if len(data)-off < 8 {
+			return nil, errors.New("invalid webp: truncated chunk")
+		}
+		n := binary.LittleEndian.Uint32(data[off+4 : off+8])
+		if uint64(n) > uint64(len(data)-off-8) {
+			return nil, errors.New("invalid webp: chunk length exceeds file size")
+		}
+		chunks = append(chunks, riffChunk{fourCC: string(data[off : off+4]), data: data[off+8 : off+8+int(n)]})
+		off += 8 + int(n) + int(n&1)
+	}
+	return chunks, nil
+}
+
+// writeRIFFChunk appends a chunk, padded to an even length, to buf.
+func writeRIFFChunk(buf *bytes.Buffer, fourCC string, data []byte) {
+	buf.WriteString(fourCC)
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+// webpBody returns the chunk data of a WebP file, after the "RIFF", size and "WEBP" header.
+func webpBody(data []byte) ([]byte, bool) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, false
+	}
+	size := int(binary.LittleEndian.Uint32(data[4:8]))
+	if size < 4 || size > len(data)-8 {
+		return data[12:], true
+	}
+	return data[12 : 8+size], true
+}
+
+// isAnimatedWebP reports whether data is a WebP with the VP8X animation flag set.
+func isAnimatedWebP(data []byte) bool {
+	body, ok := webpBody(data)
+	return ok && len(body) >= 9 && string(body[0:4]) == "VP8X" && body[8]&webpFlagAnimation != 0
+}
+
+// uint24 decodes a 24-bit little-endian integer.
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+// putUint24 encodes v as a 24-bit little-endian integer.
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+// decodeAnimatedWebP decodes every ANMF frame of an animated WebP, compositing
+// each frame onto the canvas according to its blending and disposal flags.
+// The background color hint of the ANIM chunk is ignored in favor of
+// transparency, as browsers do. When limit is positive only the first limit
+// frames are decoded.
+func decodeAnimatedWebP(data []byte, limit int) (*Animation, error) {
+	body, _ := webpBody(data)
+	chunks, err := readRIFFChunks(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].fourCC != "VP8X" || len(chunks[0].data) < 10 {
+		return nil, errors.New("invalid webp: missing VP8X chunk")
+	}
+	vp8x := chunks[0].data
+	canvasRect := image.Rect(0, 0, 1+uint24(vp8x[4:7]), 1+uint24(vp8x[7:10]))
+
+	var frames int
+	for _, c := range chunks {
+		if c.fourCC == "ANMF" {
+			frames++
+		}
+	}
+	if frames == 0 {
+		return nil, errors.New("invalid webp: no frames")
+	}
+	if limit > 0 {
+		frames = min(frames, limit)
+	}
+	if err := checkAnimationSize(canvasRect.Dx(), canvasRect.Dy(), frames); err != nil {
+		return nil, err
+	}
+
+	anim := &Animation{}
+	canvas := image.NewRGBA(canvasRect)
+	var disposeRect image.Rectangle
+	for _, c := range chunks {
+		switch c.fourCC {
+		case "ANIM":
+			if len(c.data) < 6 {
+				return nil, errors.New("invalid webp: bad ANIM length")
+			}
+			anim.LoopCount = int(binary.LittleEndian.Uint16(c.data[4:6]))
+		case "ANMF":
+			if len(anim.Frames) == frames {
+				return anim, nil
+			}
+			if len(c.data) < 16 {
+				return nil, errors.New("invalid webp: bad ANMF length")
+			}
+			x, y := 2*uint24(c.data[0:3]), 2*uint24(c.data[3:6])
+			rect := image.Rect(x, y, x+1+uint24(c.data[6:9]), y+1+uint24(c.data[9:12]))
+			if !rect.In(canvasRect) {
+				return nil, fmt.Errorf("invalid webp: frame %v outside canvas %v", rect, canvasRect)
+			}
+			img, err := decodeWebPFrame(c.data[16:], rect.Size())
+			if err != nil {
+				return nil, fmt.Errorf("invalid webp frame %d: %w", len(anim.Frames), err)
+			}
+
+			clearRect(canvas, disposeRect)
+			flags := c.data[15]
+			op := draw.Over
+			if flags&webpFrameNoBlend != 0 {
+				op = draw.Src
+			}
+			draw.Draw(canvas, rect, img, img.Bounds().Min, op)
+			anim.Frames = append(anim.Frames, Frame{
+				Image: snapshot(canvas),
+				Delay: time.Duration(uint24(c.data[12:15])) * time.Millisecond,
+			})
+
+			disposeRect = image.Rectangle{}
+			if flags&webpFrameDispose != 0 {
+				disposeRect = rect
+			}
+		}
+	}
+	return anim, nil
+}
+
+// decodeWebPFrame decodes the ALPH and VP8/VP8L chunks of one ANMF frame by
+// wrapping them in a standalone WebP file.
+func decodeWebPFrame(frameData []byte, size image.Point) (image.Image, error) {
+	chunks, err := readRIFFChunks(frameData)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, c := range chunks {
+		if c.fourCC == "ALPH" {
+			// Lossy frames with alpha need the extended format.
+			vp8x := make([]byte, 10)
+			vp8x[0] = webpFlagAlpha
+			putUint24(vp8x[4:7], size.X-1)
+			putUint24(vp8x[7:10], size.Y-1)
+			writeRIFFChunk(&body, "VP8X", vp8x)
+			break
+		}
+	}
+	for _, c := range chunks {
+		switch c.fourCC {
+		case "ALPH", "VP8 ", "VP8L":
+			writeRIFFChunk(&body, c.fourCC, c.data)
+		}
+	}
+	return webp.Decode(bytes.NewReader(riffFile(body.Bytes())))
+}
+
+// riffFile prepends the RIFF header to body.
+func riffFile(body []byte) []byte {
+	out := make([]byte, 8, 8+len(body))
+	copy(out, "RIFF")
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(body)))
+	return append(out, body...)
+}
+
+// encodeAnimatedWebP writes anim as an animated WebP. Each frame is encoded
+// over the whole canvas with the given options and replaces the previous one.
+func encodeAnimatedWebP(w io.Writer, anim *Animation, opts *webp.Options) error {
+	frames, err := animationFrames(anim)
+	if err != nil {
+		return err
+	}
+	size := frames[0].Rect.Size()
+
+	var flags byte = webpFlagAnimation
+	var anmf bytes.Buffer
+	for i, frame := range frames {
+		if !frame.Opaque() {
+			flags |= webpFlagAlpha
+		}
+		var encoded bytes.Buffer
+		if err := webp.Encode(&encoded, frame, opts); err != nil {
+			return err
+		}
+		body, ok := webpBody(encoded.Bytes())
+		if !ok {
+			return errors.New("unexpected WebP encoder output")
+		}
+		chunks, err := readRIFFChunks(body)
+		if err != nil {
+			return err
+		}
+
+		header := make([]byte, 16)
+		putUint24(header[6:9], size.X-1)
+		putUint24(header[9:12], size.Y-1)
+		putUint24(header[12:15], int(max(min(anim.Frames[i].Delay.Milliseconds(), maxWebPDuration), 0)))
+		header[15] = webpFrameNoBlend
+		frameData := bytes.NewBuffer(header)
+		for _, c := range chunks {
+			switch c.fourCC {
+			case "ALPH", "VP8 ", "VP8L":
+				writeRIFFChunk(frameData, c.fourCC, c.data)
+			}
+		}
+		writeRIFFChunk(&anmf, "ANMF", frameData.Bytes())
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	vp8x := make([]byte, 10)
+	vp8x[0] = flags
+	putUint24(vp8x[4:7], size.X-1)
+	putUint24(vp8x[7:10], size.Y-1)
+	writeRIFFChunk(&body, "VP8X", vp8x)
+	animChunk := make([]byte, 6)
+	binary.LittleEndian.PutUint16(animChunk[4:6], uint16(min(anim.LoopCount, 0xffff)))
+	writeRIFFChunk(&body, "ANIM", animChunk)
+	body.Write(anmf.Bytes())
+
+	_, err = w.Write(riffFile(body.Bytes()))
+	return err
+}